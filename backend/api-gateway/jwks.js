@@ -0,0 +1,88 @@
+const crypto = require('crypto');
+const { JWKS_URL } = require('./constants');
+
+// Verifies access tokens with the public keys the auth service publishes
+// at /.well-known/jwks.json. Keys are cached and fetched again when they get
+// old or a token names a key (kid) not seen yet, which is how a rotated key
+// is picked up.
+class JWKSVerifier {
+  constructor(jwksUrl, maxAgeMs, minRefetchMs) {
+    this.jwksUrl = jwksUrl;
+    this.maxAgeMs = maxAgeMs;
+    this.minRefetchMs = minRefetchMs;
+    this.keys = new Map(); // kid -> { alg, key }
+    this.fetchedAt = 0;
+    this.fetching = null;
+  }
+
+  async fetchKeys() {
+    const response = await fetch(this.jwksUrl);
+    if (!response.ok) {
+      throw new Error(`auth service returned status ${response.status}`);
+    }
+
+    const { keys } = await response.json();
+    const fetched = new Map();
+    for (const jwk of keys || []) {
+      fetched.set(jwk.kid, { alg: jwk.alg, key: crypto.createPublicKey({ key: jwk, format: 'jwk' }) });
+    }
+    this.keys = fetched;
+    this.fetchedAt = Date.now();
+  }
+
+  async getKey(kid) {
+    const age = Date.now() - this.fetchedAt;
+    if (age > this.maxAgeMs || (!this.keys.has(kid) && age > this.minRefetchMs)) {
+      this.fetching = this.fetching || this.fetchKeys().finally(() => { this.fetching = null; });
+      await this.fetching;
+    }
+    return this.keys.get(kid);
+  }
+
+  // Returns the token's claims, or throws if it is not signed by a published
+  // key or has expired
+  async verify(token) {
+    const parts = token.split('.');
+    if (parts.length !== 3) {
+      throw new Error('malformed token');
+    }
+
+    const header = JSON.parse(Buffer.from(parts[0], 'base64url').toString());
+    if (header.alg !== 'EdDSA' && header.alg !== 'RS256') {
+      throw new Error(`unsupported algorithm ${header.alg}`);
+    }
+
+    const entry = await this.getKey(header.kid);
+    if (!entry || entry.alg !== header.alg) {
+      throw new Error('unknown signing key');
+    }
+
+    const valid = crypto.verify(
+      header.alg === 'RS256' ? 'sha256' : null,
+      Buffer.from(`${parts[0]}.${parts[1]}`),
+      entry.key,
+      Buffer.from(parts[2], 'base64url')
+    );
+    if (!valid) {
+      throw new Error('invalid signature');
+    }
+
+    const claims = JSON.parse(Buffer.from(parts[1], 'base64url').toString());
+    const now = Date.now() / 1000;
+    if (typeof claims.exp !== 'number' || claims.exp <= now) {
+      throw new Error('token expired');
+    }
+    if (typeof claims.nbf === 'number' && claims.nbf > now) {
+      throw new Error('token not yet valid');
+    }
+    return claims;
+  }
+}
+
+const jwksVerifier = new JWKSVerifier(
+  JWKS_URL,
+  parseInt(process.env.JWKS_MAX_AGE_MS || '300000', 10),
+  30000
+);
+
+module.exports = jwksVerifier;
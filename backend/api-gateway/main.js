@@ -4,8 +4,8 @@ const cors = require('cors');
 const { createProxyMiddleware } = require('http-proxy-middleware');
 const morgan = require('morgan');
 const { validateJWT, blockInternalRoutes, tracingMiddleware } = require('./middleware');
+const revocationList = require('./revocation_list');
 const BlogRPCClient = require('./blog_rpc_client');
-const PurchaseRPCClient = require('./purchase_rpc_client');
 const StakeholderRPCClient = require('./stakeholder_rpc_client');
 
 // Load environment variables before requiring constants so they use .env values
@@ -38,7 +38,6 @@ const api = express();
 
 // Kreiram RPC klijente
 const blogRPCClient = new BlogRPCClient(process.env.BLOG_SERVICE_HOST || 'blog-service', 3012);
-const purchaseRPCClient = new PurchaseRPCClient(process.env.PURCHASE_SERVICE_HOST || 'purchase-service', 3013);
 const stakeholderRPCClient = new StakeholderRPCClient(process.env.STAKEHOLDER_SERVICE_HOST || 'stakeholder-service', 3014);
 
 // CORS configuration
@@ -51,7 +50,8 @@ api.use(cors({
   ],
   credentials: true,
   methods: ['GET', 'POST', 'PUT', 'DELETE', 'OPTIONS'],
-  allowedHeaders: ['Content-Type', 'Authorization']
+  allowedHeaders: ['Content-Type', 'Authorization', 'Idempotency-Key', 'X-Client-ID'],
+  exposedHeaders: ['Retry-After']
 }));
 
 api.use(morgan('dev'));
@@ -62,7 +62,18 @@ api.use(tracingMiddleware);
 // Add filtering middleware
 api.use(blockInternalRoutes);
 
-api.post('/api/auth/login', createProxyMiddleware({
+// xfwd appends the client address to X-Forwarded-For for login throttling.
+// The two-factor step of a login authenticates with its challenge token.
+api.post(['/api/auth/login', '/api/auth/login/2fa', '/api/auth/login/2fa/enroll'], createProxyMiddleware({
+  target: AUTH_SERVICE_URL,
+  changeOrigin: true,
+  xfwd: true,
+  pathRewrite: {
+    '^/api/auth': '',
+  }
+}));
+
+api.post('/api/auth/refresh', createProxyMiddleware({
   target: AUTH_SERVICE_URL,
   changeOrigin: true,
   pathRewrite: {
@@ -78,6 +89,24 @@ api.post('/api/auth/register', createProxyMiddleware({
   }
 }));
 
+// Forgotten passwords are reset and emails verified without a login
+api.post(['/api/auth/forgot-password', '/api/auth/reset-password', '/api/auth/verify-email'], createProxyMiddleware({
+  target: AUTH_SERVICE_URL,
+  changeOrigin: true,
+  pathRewrite: {
+    '^/api/auth': '',
+  }
+}));
+
+// Public keys for anyone verifying access tokens
+api.get('/api/auth/.well-known/jwks.json', createProxyMiddleware({
+  target: AUTH_SERVICE_URL,
+  changeOrigin: true,
+  pathRewrite: {
+    '^/api/auth': '',
+  }
+}));
+
 api.use('/api/auth', validateJWT, createProxyMiddleware({
   target: AUTH_SERVICE_URL,
   changeOrigin: true,
@@ -204,36 +233,44 @@ api.use('/api/reviews', validateJWT, createProxyMiddleware({
 }));
 
 
-api.use('/api/purchases', validateJWT, createProxyMiddleware({
+// Public guest cart routes, keyed by the X-Client-ID header instead of a user.
+// Identity headers are dropped so a guest cannot act as a user.
+api.use('/api/purchases/guest-cart', createProxyMiddleware({
   target: PURCHASE_SERVICE_URL,
   changeOrigin: true,
   pathRewrite: {
     '^/api/purchases': '',
   },
+  onProxyReq: (proxyReq, req, res) => {
+    proxyReq.removeHeader('x-username');
+    proxyReq.removeHeader('x-user-role');
+    proxyReq.removeHeader('x-user-permissions');
+  }
 }));
 
-// RPC-backed purchase handlers for cart checkout and tokens (match frontend routes)
-api.post('/api/purchases/cart/checkout', validateJWT, express.json(), async (req, res) => {
-  try {
-    const username = req.user && req.user.username;
-    const result = await purchaseRPCClient.checkout(username);
-    res.json(result);
-  } catch (err) {
-    console.error('Purchase RPC checkout error:', err);
-    res.status(500).json({ error: 'Failed to checkout via RPC' });
+// Payment provider webhook. The provider has no JWT; the purchase service
+// checks the X-Payment-Signature header instead. Identity headers are dropped
+// so a caller cannot act as a user.
+api.post('/api/purchases/payments/webhook', createProxyMiddleware({
+  target: PURCHASE_SERVICE_URL,
+  changeOrigin: true,
+  pathRewrite: {
+    '^/api/purchases': '',
+  },
+  onProxyReq: (proxyReq, req, res) => {
+    proxyReq.removeHeader('x-username');
+    proxyReq.removeHeader('x-user-role');
+    proxyReq.removeHeader('x-user-permissions');
   }
-});
+}));
 
-api.get('/api/purchases/tokens', validateJWT, async (req, res) => {
-  try {
-    const username = req.user && req.user.username;
-    const result = await purchaseRPCClient.getPurchasedTours(username);
-    res.json(result.tokens || []);
-  } catch (err) {
-    console.error('Purchase RPC getPurchasedTours error:', err);
-    res.status(500).json({ error: 'Failed to fetch purchased tokens via RPC' });
-  }
-});
+api.use('/api/purchases', validateJWT, createProxyMiddleware({
+  target: PURCHASE_SERVICE_URL,
+  changeOrigin: true,
+  pathRewrite: {
+    '^/api/purchases': '',
+  },
+}));
 
 api.use('/api/followers', validateJWT, createProxyMiddleware({
   target: FOLLOWER_SERVICE_URL,
@@ -250,6 +287,9 @@ api.get('/ping', (req, res) => {
   });
 });
 
+// Refuse access tokens revoked by logout or refresh token reuse
+revocationList.start();
+
 const PORT = process.env.API_GATEWAY_PORT || 3000;
 api.listen(PORT, () => {
   console.log(`API Gateway listening on port ${PORT}`);
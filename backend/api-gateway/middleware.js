@@ -1,8 +1,8 @@
-const jwt = require('jsonwebtoken');
 const { trace, context, SpanStatusCode } = require('@opentelemetry/api');
-const { JWT_SECRET } = require('./constants');
+const jwksVerifier = require('./jwks');
+const revocationList = require('./revocation_list');
 
-function validateJWT(req, res, next) {
+async function validateJWT(req, res, next) {
   const authHeader = req.headers.authorization;
   if (!authHeader) {
     return res.status(401).json({ message: 'Missing Authorization header' });
@@ -13,23 +13,34 @@ function validateJWT(req, res, next) {
     return res.status(401).json({ message: 'Token missing' });
   }
 
+  let decoded;
   try {
-    const decoded = jwt.verify(token, JWT_SECRET);
-
-		if (!decoded.username || !decoded.role) {
-			return res.status(403).json({
-				message: 'Invalid token: missing required fields (username and role)'
-			});
-		}
+    decoded = await jwksVerifier.verify(token);
+  } catch (err) {
+    // 401 tells the client to renew the access token with its refresh token
+    return res.status(401).json({ message: 'Invalid or expired token' });
+  }
 
-    req.headers['x-user-role'] = decoded.role;
-    req.headers['x-username'] = decoded.username;
+  if (decoded.jti && revocationList.isRevoked(decoded.jti)) {
+    return res.status(401).json({ message: 'Token has been revoked' });
+  }
 
-    req.user = decoded;
-    next();
-  } catch (err) {
-    return res.status(403).json({ message: 'Invalid or expired token' });
+  if (!decoded.username || !decoded.role) {
+    return res.status(403).json({
+      message: 'Invalid token: missing required fields (username and role)'
+    });
   }
+
+  req.headers['x-user-role'] = decoded.role;
+  req.headers['x-username'] = decoded.username;
+  req.headers['x-token-id'] = decoded.jti || '';
+  // Services refuse publishing and buying until the email is verified
+  req.headers['x-email-verified'] = decoded.email_verified === true ? 'true' : 'false';
+  // Services authorize with the permissions of the role, see authz in Go
+  req.headers['x-user-permissions'] = Array.isArray(decoded.permissions) ? decoded.permissions.join(',') : '';
+
+  req.user = decoded;
+  next();
 }
 
 function blockInternalRoutes(req, res, next) {
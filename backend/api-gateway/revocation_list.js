@@ -0,0 +1,64 @@
+const { AUTH_SERVICE_URL } = require('./constants');
+
+// Revocations are stamped before their transaction commits, so one can show
+// up after a later one was already listed. Each poll reads this far back from
+// the newest revocation seen; entries read twice are simply set again.
+const OVERLAP_MS = 60 * 1000;
+
+// Keeps a local copy of the access tokens the auth service has revoked,
+// so that validateJWT can refuse them without a call per request. The list
+// is polled incrementally with some overlap; each entry is dropped once its
+// token would have expired anyway.
+class RevocationList {
+  constructor(authServiceUrl, intervalMs) {
+    this.authServiceUrl = authServiceUrl;
+    this.intervalMs = intervalMs;
+    this.revoked = new Map(); // jti -> expiry in ms
+    this.latest = null; // newest revoked_at seen, in ms
+  }
+
+  isRevoked(jti) {
+    const expiresAt = this.revoked.get(jti);
+    return expiresAt !== undefined && expiresAt > Date.now();
+  }
+
+  async refresh() {
+    const url = new URL('/internal/revoked-tokens', this.authServiceUrl);
+    if (this.latest !== null) {
+      url.searchParams.set('since', new Date(this.latest - OVERLAP_MS).toISOString());
+    }
+
+    const response = await fetch(url);
+    if (!response.ok) {
+      throw new Error(`auth service returned status ${response.status}`);
+    }
+
+    const { revoked } = await response.json();
+    for (const token of revoked || []) {
+      this.revoked.set(token.jti, Date.parse(token.expires_at));
+      this.latest = Math.max(this.latest ?? 0, Date.parse(token.revoked_at));
+    }
+
+    const now = Date.now();
+    for (const [jti, expiresAt] of this.revoked) {
+      if (expiresAt <= now) {
+        this.revoked.delete(jti);
+      }
+    }
+  }
+
+  start() {
+    const poll = () => this.refresh().catch(err => {
+      console.error('Failed to refresh revoked tokens:', err.message);
+    });
+    poll();
+    setInterval(poll, this.intervalMs).unref();
+  }
+}
+
+const revocationList = new RevocationList(
+  AUTH_SERVICE_URL,
+  parseInt(process.env.REVOCATION_POLL_INTERVAL_MS || '10000', 10)
+);
+
+module.exports = revocationList;
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AdminAuditRepository struct {
+	database *gorm.DB
+}
+
+func (r *AdminAuditRepository) Create(action *AdminAction) error {
+	return r.database.Create(action).Error
+}
+
+// AdminActionFilter narrows down admin actions. Empty fields match all.
+type AdminActionFilter struct {
+	Target string
+	Admin  string
+	Action string
+	Since  *time.Time
+	Limit  int
+}
+
+// Find returns the newest admin actions matching the filter.
+func (r *AdminAuditRepository) Find(filter AdminActionFilter) ([]AdminAction, error) {
+	query := r.database.Order("created_at DESC").Order("id DESC").Limit(filter.Limit)
+	if filter.Target != "" {
+		query = query.Where("target = ?", filter.Target)
+	}
+	if filter.Admin != "" {
+		query = query.Where("admin = ?", filter.Admin)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+
+	actions := []AdminAction{}
+	err := query.Find(&actions).Error
+	return actions, err
+}
@@ -0,0 +1,32 @@
+package main
+
+import "time"
+
+// AdminAuditService keeps the audit log of what admins did to accounts.
+type AdminAuditService struct {
+	repository *AdminAuditRepository
+}
+
+// Record adds an action to the audit log through repository, which should
+// be bound to the transaction that carries out the action, so that an action
+// is never committed without its record.
+func (s *AdminAuditService) Record(repository *AdminAuditRepository, action *AdminAction) error {
+	if action.CreatedAt.IsZero() {
+		action.CreatedAt = time.Now()
+	}
+	return repository.Create(action)
+}
+
+// Log writes a recorded action to the service log once it is committed.
+func (s *AdminAuditService) Log(action *AdminAction) {
+	authLogger.InfoWithFields("Admin action", map[string]interface{}{
+		"action": action.Action,
+		"target": action.Target,
+		"admin":  action.Admin,
+		"reason": action.Reason,
+	})
+}
+
+func (s *AdminAuditService) Find(filter AdminActionFilter) ([]AdminAction, error) {
+	return s.repository.Find(filter)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AttemptRecord is what an AttemptCounter keeps for a key: the failures
+// within the counting window, the last of them and an optional lock.
+type AttemptRecord struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// AttemptCounter counts failed logins per key, such as a username or an IP.
+// Failures older than the counter's window are forgotten. Implementations
+// must be safe for concurrent use.
+type AttemptCounter interface {
+	// Name identifies the counter in logs.
+	Name() string
+	// Get returns the record of key, empty when there is none.
+	Get(ctx context.Context, key string, now time.Time) (*AttemptRecord, error)
+	// AddFailure counts a failure at now and returns the updated record.
+	AddFailure(ctx context.Context, key string, now time.Time) (*AttemptRecord, error)
+	// Lock refuses logins of key until the given time.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the failures and lock of key.
+	Reset(ctx context.Context, key string) error
+	// Prune removes records whose failures and lock are over.
+	Prune(ctx context.Context, now time.Time) error
+}
+
+// NewAttemptCounter picks the counter configured by LOGIN_ATTEMPT_STORE:
+// "memory" keeps counts in this process, "database" shares them between
+// replicas through the auth database.
+func NewAttemptCounter(database *gorm.DB, window time.Duration) AttemptCounter {
+	name := GetEnvOrDefault("LOGIN_ATTEMPT_STORE", "memory")
+	switch name {
+	case "database":
+		return &DatabaseAttemptCounter{database: database, window: window}
+	case "memory":
+	default:
+		authLogger.Warn("Unknown login attempt store " + name + ", falling back to memory")
+	}
+	return NewMemoryAttemptCounter(window)
+}
+
+// expired tells whether nothing of the record counts any more at now.
+func (r *AttemptRecord) expired(now time.Time, window time.Duration) bool {
+	locked := r.LockedUntil != nil && r.LockedUntil.After(now)
+	return !locked && !r.LastFailureAt.Add(window).After(now)
+}
+
+// current is the record as of now, with failures outside the window
+// forgotten. An expired lock starts a new window, so that the failures
+// that caused it do not lock the key again at the next failure.
+func (r AttemptRecord) current(now time.Time, window time.Duration) *AttemptRecord {
+	if !r.LastFailureAt.Add(window).After(now) {
+		r.Failures = 0
+	}
+	if r.LockedUntil != nil && !r.LockedUntil.After(now) {
+		r.Failures = 0
+		r.LockedUntil = nil
+	}
+	return &r
+}
+
+type MemoryAttemptCounter struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	records map[string]*AttemptRecord
+}
+
+func NewMemoryAttemptCounter(window time.Duration) *MemoryAttemptCounter {
+	return &MemoryAttemptCounter{window: window, records: map[string]*AttemptRecord{}}
+}
+
+func (c *MemoryAttemptCounter) Name() string {
+	return "memory"
+}
+
+func (c *MemoryAttemptCounter) Get(_ context.Context, key string, now time.Time) (*AttemptRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record, ok := c.records[key]
+	if !ok {
+		return &AttemptRecord{}, nil
+	}
+	return record.current(now, c.window), nil
+}
+
+func (c *MemoryAttemptCounter) AddFailure(_ context.Context, key string, now time.Time) (*AttemptRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record := &AttemptRecord{}
+	if existing, ok := c.records[key]; ok {
+		record = existing.current(now, c.window)
+	}
+	record.Failures++
+	record.LastFailureAt = now
+	c.records[key] = record
+
+	updated := *record
+	return &updated, nil
+}
+
+func (c *MemoryAttemptCounter) Lock(_ context.Context, key string, until time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record, ok := c.records[key]
+	if !ok {
+		record = &AttemptRecord{}
+		c.records[key] = record
+	}
+	record.LockedUntil = &until
+	return nil
+}
+
+func (c *MemoryAttemptCounter) Reset(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.records, key)
+	return nil
+}
+
+func (c *MemoryAttemptCounter) Prune(_ context.Context, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, record := range c.records {
+		if record.expired(now, c.window) {
+			delete(c.records, key)
+		}
+	}
+	return nil
+}
+
+// DatabaseAttemptCounter keeps the counts in the login_attempt_counters
+// table, so that every replica sees the same failures and locks.
+type DatabaseAttemptCounter struct {
+	database *gorm.DB
+	window   time.Duration
+}
+
+func (c *DatabaseAttemptCounter) Name() string {
+	return "database"
+}
+
+func (c *DatabaseAttemptCounter) Get(ctx context.Context, key string, now time.Time) (*AttemptRecord, error) {
+	var rows []LoginAttemptCounter
+	err := c.database.WithContext(ctx).Where("key = ?", key).Limit(1).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return &AttemptRecord{}, nil
+	}
+	return rows[0].record().current(now, c.window), nil
+}
+
+func (c *DatabaseAttemptCounter) AddFailure(ctx context.Context, key string, now time.Time) (*AttemptRecord, error) {
+	var updated *AttemptRecord
+	err := c.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		row, err := c.lock(tx, key)
+		if err != nil {
+			return err
+		}
+
+		record := row.record().current(now, c.window)
+		record.Failures++
+		record.LastFailureAt = now
+		err = tx.Model(&LoginAttemptCounter{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"failures":        record.Failures,
+			"last_failure_at": record.LastFailureAt,
+			"locked_until":    record.LockedUntil,
+		}).Error
+		updated = record
+		return err
+	})
+	return updated, err
+}
+
+func (c *DatabaseAttemptCounter) Lock(ctx context.Context, key string, until time.Time) error {
+	return c.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := c.lock(tx, key)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&LoginAttemptCounter{}).Where("key = ?", key).Update("locked_until", until).Error
+	})
+}
+
+func (c *DatabaseAttemptCounter) Reset(ctx context.Context, key string) error {
+	return c.database.WithContext(ctx).Where("key = ?", key).Delete(&LoginAttemptCounter{}).Error
+}
+
+func (c *DatabaseAttemptCounter) Prune(ctx context.Context, now time.Time) error {
+	return c.database.WithContext(ctx).
+		Where("last_failure_at <= ? AND (locked_until IS NULL OR locked_until <= ?)", now.Add(-c.window), now).
+		Delete(&LoginAttemptCounter{}).Error
+}
+
+// lock creates the row of key if needed and locks it until the transaction
+// ends, so that concurrent failures are all counted.
+func (c *DatabaseAttemptCounter) lock(tx *gorm.DB, key string) (*LoginAttemptCounter, error) {
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LoginAttemptCounter{Key: key}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var row LoginAttemptCounter
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&row).Error
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (row *LoginAttemptCounter) record() AttemptRecord {
+	return AttemptRecord{
+		Failures:      row.Failures,
+		LastFailureAt: row.LastFailureAt,
+		LockedUntil:   row.LockedUntil,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
@@ -28,11 +29,50 @@ func InitDatabase() *gorm.DB {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	db.AutoMigrate(&User{})
+	db.AutoMigrate(&User{}, &RefreshToken{}, &RevokedToken{}, &PasswordResetToken{}, &EmailVerificationToken{}, &FailedLogin{}, &LoginAttemptCounter{}, &TwoFactorSecret{}, &RecoveryCode{}, &LoginChallenge{}, &TwoFactorPolicy{}, &Role{}, &RolePermission{}, &AdminAction{}, &SigningKey{})
 
 	return db
 }
 
+// SeedRoles creates the default roles that do not exist yet. Roles an admin
+// already changed are left alone, except that permissions added since, which
+// no role has yet, are granted to the default roles they belong to.
+func SeedRoles(db *gorm.DB) {
+	repository := &RoleRepository{database: db}
+	for name, permissions := range DefaultRolePermissions {
+		exists, err := repository.Exists(name)
+		if err != nil {
+			log.Fatalf("Failed to check role %s: %v", name, err)
+		}
+		if exists {
+			grantNewPermissions(repository, name, permissions)
+			continue
+		}
+		err = repository.Save(&Role{Name: name, UpdatedBy: SystemActor, UpdatedAt: time.Now()}, permissions)
+		if err != nil {
+			log.Fatalf("Failed to create role %s: %v", name, err)
+		}
+		log.Printf("Created role: %s", name)
+	}
+}
+
+func grantNewPermissions(repository *RoleRepository, role string, permissions []string) {
+	for _, permission := range permissions {
+		granted, err := repository.IsGranted(permission)
+		if err != nil {
+			log.Fatalf("Failed to check permission %s: %v", permission, err)
+		}
+		if granted {
+			continue
+		}
+		err = repository.Grant(role, permission)
+		if err != nil {
+			log.Fatalf("Failed to grant %s to role %s: %v", permission, role, err)
+		}
+		log.Printf("Granted %s to role %s", permission, role)
+	}
+}
+
 func SeedAdmins(db *gorm.DB) {
 	// Check if data already exists
 	var count int64
@@ -49,6 +89,7 @@ func SeedAdmins(db *gorm.DB) {
 			Password: hashPassword("admin123"),
 			Email:    "admin123@gmail.com",
 			Role:     RoleAdmin,
+			Status:   UserStatusActive,
 		},
 	}
 
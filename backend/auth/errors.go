@@ -9,6 +9,41 @@ var (
 	ErrUserBanned         = errors.New("user is banned")
 )
 
+var (
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrSamePassword      = errors.New("new password must differ from the current one")
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrAlreadyVerified          = errors.New("email is already verified")
+	ErrVerificationResendLimit  = errors.New("too many verification emails, try again later")
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrNoSigningKey         = errors.New("no signing key available")
+)
+
+var (
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts, try again later")
+	ErrAccountLocked        = errors.New("account is temporarily locked after too many failed login attempts")
+)
+
+var (
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required for your role")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidLoginChallenge   = errors.New("invalid or expired login challenge")
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, all sessions of this login were revoked")
+)
+
 var (
 	ErrUsernameAlreadyExists = errors.New("username already exists")
 	ErrEmailAlreadyExists    = errors.New("email already exists")
@@ -18,3 +53,15 @@ const (
 	UserUsernamePrimaryKey = "users_pkey"
 	UserEmailUniqueIndex   = "idx_user_email"
 )
+
+var (
+	ErrAlreadyBlocked     = errors.New("user is already blocked")
+	ErrNotBlocked         = errors.New("user is not blocked")
+	ErrCannotBlockSelf    = errors.New("you cannot block yourself")
+	ErrInvalidBlockExpiry = errors.New("block expiry must be in the future")
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrUnknownPermission = errors.New("unknown permission")
+)
@@ -28,3 +28,7 @@ require (
 	golang.org/x/sys v0.35.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
 )
+
+require authz v0.0.0
+
+replace authz => ../authz
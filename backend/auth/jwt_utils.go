@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
 	"os"
 	"time"
@@ -8,9 +11,15 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Claims carry a unique ID (jti) so that a single access token can be
+// revoked before it expires. EmailVerified lets services refuse actions
+// that need a confirmed email.
 type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username      string `json:"username"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	// Permissions are those of the role when the token was issued
+	Permissions []string `json:"permissions"`
 	jwt.RegisteredClaims
 }
 
@@ -23,24 +32,79 @@ func GetEnv(key string) string {
 	return value
 }
 
-func CreateJWT(username string, role string) (string, error) {
-	jwtExpiration := GetEnv("JWT_EXPIRATION")
+func GetEnvOrDefault(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
 
-	expirationTime, err := time.ParseDuration(jwtExpiration)
+// accessTokenLifetime is how long an access token is valid, from
+// JWT_EXPIRATION. Access tokens are meant to be short-lived and renewed
+// with a refresh token.
+func accessTokenLifetime() (time.Duration, error) {
+	return time.ParseDuration(GetEnv("JWT_EXPIRATION"))
+}
+
+// CreateJWT signs an access token with the key, naming it in the kid header
+// so that verifiers can pick the matching public key from the JWKS.
+func CreateJWT(key *activeKey, user *User, permissions []string) (string, *Claims, error) {
+	expirationTime, err := accessTokenLifetime()
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	tokenID, err := randomToken(16)
+	if err != nil {
+		return "", nil, err
 	}
 
+	now := time.Now()
 	claims := &Claims{
-		Username: username,
-		Role:     role,
+		Username:      user.Username,
+		Role:          user.Role,
+		EmailVerified: user.IsVerified(),
+		Permissions:   permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expirationTime)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expirationTime)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	jwtSecret := []byte(GetEnv("JWT_SECRET"))
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	var method jwt.SigningMethod
+	switch key.algorithm {
+	case SigningAlgorithmEdDSA:
+		method = jwt.SigningMethodEdDSA
+	case SigningAlgorithmRS256:
+		method = jwt.SigningMethodRS256
+	default:
+		return "", nil, ErrUnsupportedAlgorithm
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.kid
+	signed, err := token.SignedString(key.signer)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// randomToken returns size random bytes, hex encoded.
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken is how refresh and reset tokens are stored, so that a leaked
+// table cannot be used to log in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// encryptedKeyPrefix marks a private key stored encrypted by keyCipher.
+// Keys without it are PEM from before keys were encrypted.
+const encryptedKeyPrefix = "aes-gcm:"
+
+// keyCipher encrypts private signing keys before they are stored, with
+// AES-256-GCM under a key-encryption key that is only in the environment,
+// so that the database or a backup alone cannot be used to sign tokens.
+type keyCipher struct {
+	aead cipher.AEAD
+}
+
+// newKeyCipher takes the key-encryption key as 32 bytes encoded in
+// standard base64.
+func newKeyCipher(encoded string) (*keyCipher, error) {
+	kek, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(kek))
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &keyCipher{aead: aead}, nil
+}
+
+// Encrypt seals a PEM private key. The key ID is authenticated with it, so
+// an encrypted key cannot be moved to another key's row.
+func (c *keyCipher) Encrypt(kid string, privatePEM string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(privatePEM), []byte(kid))
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a key sealed by Encrypt. PEM from before keys were
+// encrypted is returned as it is.
+func (c *keyCipher) Decrypt(kid string, stored string) (string, error) {
+	if !isEncryptedKey(stored) {
+		return stored, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("encrypted key too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt, wrong JWT_KEY_ENCRYPTION_KEY?")
+	}
+	return string(plain), nil
+}
+
+func isEncryptedKey(stored string) bool {
+	return strings.HasPrefix(stored, encryptedKeyPrefix)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"authz"
+)
+
+type KeyHandler struct {
+	service *KeyService
+}
+
+// JWKS publishes the public keys access tokens are verified with.
+func (h *KeyHandler) JWKS(w http.ResponseWriter, _ *http.Request) {
+	set, err := h.service.JWKS()
+	if err != nil {
+		authLogger.Error("Failed to build JWKS", err)
+		http.Error(w, "error building key set", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(set)
+}
+
+// RotateKeys makes a new key sign from now on. Tokens signed with the old
+// key stay valid for the overlap period, unless ?retire=now removes it from
+// the JWKS at once, for a key that may have leaked. That also ends every
+// session's current access token; users get a new one when they refresh.
+func (h *KeyHandler) RotateKeys(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.SecurityManage) {
+		http.Error(w, "forbidden: requires permission "+authz.SecurityManage, http.StatusForbidden)
+		return
+	}
+
+	retire := r.URL.Query().Get("retire")
+	if retire != "" && retire != "now" {
+		http.Error(w, "retire must be \"now\" or left out", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.Rotate(time.Now(), retire == "now")
+	if err != nil {
+		authLogger.Error("Failed to rotate signing keys", err)
+		http.Error(w, "error rotating signing keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.JWKS(w, r)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type KeyRepository struct {
+	database *gorm.DB
+}
+
+// keyRotationLock is the Postgres advisory lock held while keys rotate.
+const keyRotationLock = 7311
+
+// Transaction runs fn in a transaction that holds the key rotation lock.
+func (r *KeyRepository) Transaction(fn func(repo *KeyRepository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("SELECT pg_advisory_xact_lock(?)", keyRotationLock).Error
+		if err != nil {
+			return err
+		}
+		return fn(&KeyRepository{database: tx})
+	})
+}
+
+func (r *KeyRepository) Create(key *SigningKey) error {
+	return r.database.Create(key).Error
+}
+
+func (r *KeyRepository) UpdatePrivateKey(kid string, privateKey string) error {
+	return r.database.Model(&SigningKey{}).Where("kid = ?", kid).Update("private_key", privateKey).Error
+}
+
+// FindPublished returns the keys that have not retired, newest first.
+func (r *KeyRepository) FindPublished(now time.Time) ([]SigningKey, error) {
+	var keys []SigningKey
+	err := r.database.Where("retires_at IS NULL OR retires_at > ?", now).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// RetireOthers makes every key except kid retire at at, or earlier if it
+// already retires earlier.
+func (r *KeyRepository) RetireOthers(kid string, at time.Time) error {
+	return r.database.Model(&SigningKey{}).
+		Where("kid <> ? AND (retires_at IS NULL OR retires_at > ?)", kid, at).
+		Update("retires_at", at).Error
+}
+
+func (r *KeyRepository) DeleteRetired(before time.Time) error {
+	return r.database.Where("retires_at < ?", before).Delete(&SigningKey{}).Error
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// KeyService holds the keys access tokens are signed with. The newest key
+// of the configured algorithm signs, and a new one takes over every
+// rotation interval. A replaced key stays in the JWKS for the overlap
+// period, which is never shorter than an access token's lifetime, so that
+// every token it signed can still be verified. Private keys are stored
+// encrypted with the key-encryption key from JWT_KEY_ENCRYPTION_KEY.
+type KeyService struct {
+	repository       *KeyRepository
+	cipher           *keyCipher
+	algorithm        string
+	rotationInterval time.Duration
+	overlap          time.Duration
+
+	mu        sync.RWMutex
+	active    *activeKey
+	published []SigningKey
+}
+
+type activeKey struct {
+	kid       string
+	algorithm string
+	signer    crypto.Signer
+}
+
+func NewKeyService(repository *KeyRepository) (*KeyService, error) {
+	algorithm := GetEnvOrDefault("JWT_SIGNING_ALG", SigningAlgorithmEdDSA)
+	if algorithm != SigningAlgorithmEdDSA && algorithm != SigningAlgorithmRS256 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	rotationInterval, err := time.ParseDuration(GetEnvOrDefault("JWT_KEY_ROTATION_INTERVAL", "720h"))
+	if err != nil || rotationInterval <= 0 {
+		return nil, fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL: %q", GetEnvOrDefault("JWT_KEY_ROTATION_INTERVAL", "720h"))
+	}
+	overlap, err := time.ParseDuration(GetEnvOrDefault("JWT_KEY_OVERLAP", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEY_OVERLAP: %w", err)
+	}
+	lifetime, err := accessTokenLifetime()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_EXPIRATION: %w", err)
+	}
+	if overlap < lifetime {
+		overlap = lifetime
+	}
+	encryptionKey := GetEnvOrDefault("JWT_KEY_ENCRYPTION_KEY", "")
+	if encryptionKey == "" {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY is required")
+	}
+	cipher, err := newKeyCipher(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEY_ENCRYPTION_KEY: %w", err)
+	}
+
+	return &KeyService{
+		repository:       repository,
+		cipher:           cipher,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		overlap:          overlap,
+	}, nil
+}
+
+// Load reads the published keys and picks the signing key, creating a new
+// one when there is none or the current one is due for rotation. Keys stored
+// before keys were encrypted are encrypted on the way.
+func (s *KeyService) Load(now time.Time) error {
+	keys, err := s.repository.FindPublished(now)
+	if err != nil {
+		return err
+	}
+	err = s.encryptStored(keys)
+	if err != nil {
+		return err
+	}
+
+	newest := s.newest(keys)
+	if newest == nil || s.dueForRotation(newest, now) {
+		return s.rotate(now, false, now.Add(s.overlap))
+	}
+
+	privatePEM, err := s.cipher.Decrypt(newest.KID, newest.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("signing key %s: %w", newest.KID, err)
+	}
+	signer, err := parsePrivateKey(privatePEM)
+	if err != nil {
+		return fmt.Errorf("signing key %s: %w", newest.KID, err)
+	}
+
+	s.mu.Lock()
+	s.active = &activeKey{kid: newest.KID, algorithm: newest.Algorithm, signer: signer}
+	s.published = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// Rotate creates a new signing key and retires the others after the
+// overlap period or, with retireNow, right away. Other replicas and the
+// gateway stop accepting a retired key once they reload the keys.
+func (s *KeyService) Rotate(now time.Time, retireNow bool) error {
+	retiresAt := now.Add(s.overlap)
+	if retireNow {
+		retiresAt = now
+	}
+	return s.rotate(now, true, retiresAt)
+}
+
+// rotate holds the rotation lock, so that replicas rotate one at a time.
+// Unless forced, it only creates a key if no other replica has rotated
+// since the keys were read.
+func (s *KeyService) rotate(now time.Time, force bool, retiresAt time.Time) error {
+	var key *SigningKey
+	err := s.repository.Transaction(func(repo *KeyRepository) error {
+		if !force {
+			keys, err := repo.FindPublished(now)
+			if err != nil {
+				return err
+			}
+			newest := s.newest(keys)
+			if newest != nil && !s.dueForRotation(newest, now) {
+				return nil
+			}
+		}
+
+		created, err := generateSigningKey(s.algorithm, now)
+		if err != nil {
+			return err
+		}
+		created.PrivateKey, err = s.cipher.Encrypt(created.KID, created.PrivateKey)
+		if err != nil {
+			return err
+		}
+		err = repo.Create(created)
+		if err != nil {
+			return err
+		}
+		err = repo.RetireOthers(created.KID, retiresAt)
+		if err != nil {
+			return err
+		}
+		key = created
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if key != nil {
+		authLogger.InfoWithFields("Signing key rotated", map[string]interface{}{
+			"kid": key.KID,
+			"alg": key.Algorithm,
+		})
+	}
+	return s.Load(now)
+}
+
+// encryptStored encrypts the private keys among keys that are stored as
+// plain PEM.
+func (s *KeyService) encryptStored(keys []SigningKey) error {
+	for i := range keys {
+		if isEncryptedKey(keys[i].PrivateKey) {
+			continue
+		}
+		encrypted, err := s.cipher.Encrypt(keys[i].KID, keys[i].PrivateKey)
+		if err != nil {
+			return err
+		}
+		err = s.repository.UpdatePrivateKey(keys[i].KID, encrypted)
+		if err != nil {
+			return err
+		}
+		keys[i].PrivateKey = encrypted
+		authLogger.InfoWithFields("Signing key encrypted", map[string]interface{}{
+			"kid": keys[i].KID,
+		})
+	}
+	return nil
+}
+
+// newest returns the newest key of the configured algorithm that is not
+// retiring, or nil. keys are sorted newest first.
+func (s *KeyService) newest(keys []SigningKey) *SigningKey {
+	for i := range keys {
+		if keys[i].Algorithm == s.algorithm && keys[i].RetiresAt == nil {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+func (s *KeyService) dueForRotation(key *SigningKey, now time.Time) bool {
+	return now.Sub(key.CreatedAt) >= s.rotationInterval
+}
+
+// Start reloads the keys every interval, so that replicas pick up keys
+// rotated by another one, rotates when due and deletes retired keys.
+func (s *KeyService) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if err := s.Load(now); err != nil {
+			authLogger.Error("Failed to reload signing keys", err)
+			continue
+		}
+		if err := s.repository.DeleteRetired(now); err != nil {
+			authLogger.Error("Failed to delete retired signing keys", err)
+		}
+	}
+}
+
+func (s *KeyService) ActiveKey() (*activeKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return s.active, nil
+}
+
+// JWKS returns the public keys tokens can currently be verified with.
+func (s *KeyService) JWKS() (*JWKSet, error) {
+	s.mu.RLock()
+	keys := s.published
+	s.mu.RUnlock()
+
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range keys {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", key.KID, err)
+		}
+		set.Keys = append(set.Keys, *jwk)
+	}
+	return set, nil
+}
+
+func generateSigningKey(algorithm string, now time.Time) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case SigningAlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case SigningAlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid, err := randomToken(8)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		KID:        kid,
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		CreatedAt:  now,
+	}, nil
+}
+
+func parsePrivateKey(encoded string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return signer, nil
+}
+
+func publicJWK(key SigningKey) (*JWK, error) {
+	block, _ := pem.Decode([]byte(key.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM")
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	jwk := &JWK{KID: key.KID, Use: "sig", Algorithm: key.Algorithm}
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encode(public)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return jwk, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type LoginAuditRepository struct {
+	database *gorm.DB
+}
+
+func (r *LoginAuditRepository) Create(attempt *FailedLogin) error {
+	return r.database.Create(attempt).Error
+}
+
+// Find returns the newest failed logins, of the username and from the IP
+// when they are set.
+func (r *LoginAuditRepository) Find(username string, ip string, limit int) ([]FailedLogin, error) {
+	query := r.database.Order("created_at DESC").Limit(limit)
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+
+	attempts := []FailedLogin{}
+	err := query.Find(&attempts).Error
+	return attempts, err
+}
+
+// DeleteBefore removes failed logins recorded before the time.
+func (r *LoginAuditRepository) DeleteBefore(before time.Time) (int64, error) {
+	result := r.database.Where("created_at < ?", before).Delete(&FailedLogin{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// LoginPolicy is how LoginGuard slows down password guessing. After
+// BackoffAfter failures of a username, each further attempt has to wait
+// BackoffBase, doubling with every failure up to BackoffMax. IPs get the
+// same backoff after IPBackoffAfter failures, which is higher since many
+// users can share an address. LockoutThreshold failures lock the account
+// for LockoutDuration. Failures older than Window are forgotten.
+type LoginPolicy struct {
+	Window           time.Duration
+	BackoffAfter     int
+	IPBackoffAfter   int
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	AuditRetention   time.Duration
+}
+
+func LoadLoginPolicy() (LoginPolicy, error) {
+	var policy LoginPolicy
+	var err error
+	durations := []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"LOGIN_ATTEMPT_WINDOW", "1h", &policy.Window},
+		{"LOGIN_BACKOFF_BASE", "1s", &policy.BackoffBase},
+		{"LOGIN_BACKOFF_MAX", "5m", &policy.BackoffMax},
+		{"LOGIN_LOCKOUT_DURATION", "15m", &policy.LockoutDuration},
+		{"LOGIN_AUDIT_RETENTION", "2160h", &policy.AuditRetention},
+	}
+	for _, d := range durations {
+		*d.dest, err = time.ParseDuration(GetEnvOrDefault(d.key, d.value))
+		if err != nil || *d.dest <= 0 {
+			return policy, fmt.Errorf("invalid %s: %q", d.key, GetEnvOrDefault(d.key, d.value))
+		}
+	}
+
+	counts := []struct {
+		key   string
+		value string
+		dest  *int
+	}{
+		{"LOGIN_BACKOFF_AFTER", "3", &policy.BackoffAfter},
+		{"LOGIN_IP_BACKOFF_AFTER", "20", &policy.IPBackoffAfter},
+		{"LOGIN_LOCKOUT_THRESHOLD", "10", &policy.LockoutThreshold},
+	}
+	for _, c := range counts {
+		*c.dest, err = strconv.Atoi(GetEnvOrDefault(c.key, c.value))
+		if err != nil || *c.dest <= 0 {
+			return policy, fmt.Errorf("invalid %s: %q", c.key, GetEnvOrDefault(c.key, c.value))
+		}
+	}
+	return policy, nil
+}
+
+// backoff is how long to wait after the last of failures before another
+// attempt, once there were at least after of them.
+func (p LoginPolicy) backoff(failures int, after int) time.Duration {
+	if failures < after {
+		return 0
+	}
+	wait := p.BackoffBase
+	for i := after; i < failures && wait < p.BackoffMax; i++ {
+		wait *= 2
+	}
+	if wait > p.BackoffMax {
+		wait = p.BackoffMax
+	}
+	return wait
+}
+
+// LoginThrottledError refuses a login attempt until RetryAfter has passed.
+// It wraps ErrTooManyLoginAttempts or ErrAccountLocked.
+type LoginThrottledError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// LoginClient is where a login attempt came from.
+type LoginClient struct {
+	IP        string
+	UserAgent string
+}
+
+// LoginGuard tracks failed logins per username and per IP, refuses
+// attempts while they have to back off or the account is locked, and
+// keeps an audit record of every failed attempt.
+type LoginGuard struct {
+	counter    AttemptCounter
+	repository *LoginAuditRepository
+	policy     LoginPolicy
+}
+
+func usernameKey(username string) string {
+	return "user:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a LoginThrottledError when the username or IP may not try
+// to log in yet.
+func (g *LoginGuard) Check(ctx context.Context, username string, client LoginClient, now time.Time) error {
+	record, err := g.counter.Get(ctx, usernameKey(username), now)
+	if err != nil {
+		return err
+	}
+	if record.LockedUntil != nil {
+		return &LoginThrottledError{Err: ErrAccountLocked, RetryAfter: record.LockedUntil.Sub(now)}
+	}
+	if wait := g.wait(record, g.policy.BackoffAfter, now); wait > 0 {
+		return &LoginThrottledError{Err: ErrTooManyLoginAttempts, RetryAfter: wait}
+	}
+
+	if client.IP == "" {
+		return nil
+	}
+	record, err = g.counter.Get(ctx, ipKey(client.IP), now)
+	if err != nil {
+		return err
+	}
+	if wait := g.wait(record, g.policy.IPBackoffAfter, now); wait > 0 {
+		return &LoginThrottledError{Err: ErrTooManyLoginAttempts, RetryAfter: wait}
+	}
+	return nil
+}
+
+// wait is how much longer a key has to back off after its last failure.
+func (g *LoginGuard) wait(record *AttemptRecord, after int, now time.Time) time.Duration {
+	backoff := g.policy.backoff(record.Failures, after)
+	if backoff == 0 {
+		return 0
+	}
+	return record.LastFailureAt.Add(backoff).Sub(now)
+}
+
+// RecordFailure audits a failed attempt. Wrong passwords, also for unknown
+// usernames, and wrong two-factor codes count towards backoff and lockout;
+// attempts refused by the guard itself do not, so that waiting out a
+// backoff is enough.
+func (g *LoginGuard) RecordFailure(ctx context.Context, username string, client LoginClient, reason string, now time.Time) {
+	err := g.repository.Create(&FailedLogin{
+		Username:  username,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Reason:    reason,
+		CreatedAt: now,
+	})
+	if err != nil {
+		authLogger.Error("Failed to record failed login", err)
+	}
+
+	if reason != FailedLoginInvalidCredentials && reason != FailedLoginInvalidCode {
+		return
+	}
+
+	if client.IP != "" {
+		_, err = g.counter.AddFailure(ctx, ipKey(client.IP), now)
+		if err != nil {
+			authLogger.Error("Failed to count failed login via "+g.counter.Name(), err)
+		}
+	}
+
+	record, err := g.counter.AddFailure(ctx, usernameKey(username), now)
+	if err != nil {
+		authLogger.Error("Failed to count failed login via "+g.counter.Name(), err)
+		return
+	}
+	if record.Failures >= g.policy.LockoutThreshold && record.LockedUntil == nil {
+		err = g.counter.Lock(ctx, usernameKey(username), now.Add(g.policy.LockoutDuration))
+		if err != nil {
+			authLogger.Error("Failed to lock account", err)
+			return
+		}
+		authLogger.InfoWithFields("Account locked after failed logins", map[string]interface{}{
+			"username": username,
+			"failures": record.Failures,
+			"ip":       client.IP,
+		})
+	}
+}
+
+// RecordSuccess forgets the failures of the username. Those of the IP are
+// kept, so that logging in to one account does not allow guessing others.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, username string) {
+	err := g.counter.Reset(ctx, usernameKey(username))
+	if err != nil {
+		authLogger.Error("Failed to reset failed login count", err)
+	}
+}
+
+// Unlock lifts the lockout and backoff of the username.
+func (g *LoginGuard) Unlock(ctx context.Context, username string) error {
+	return g.counter.Reset(ctx, usernameKey(username))
+}
+
+func (g *LoginGuard) GetFailedLogins(username string, ip string, limit int) ([]FailedLogin, error) {
+	return g.repository.Find(username, ip, limit)
+}
+
+// StartCleanup prunes finished counters and old audit records every
+// interval.
+func (g *LoginGuard) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if err := g.counter.Prune(context.Background(), now); err != nil {
+			authLogger.Error("Failed to prune login attempt counters", err)
+		}
+		deleted, err := g.repository.DeleteBefore(now.Add(-g.policy.AuditRetention))
+		if err != nil {
+			authLogger.Error("Failed to delete old failed logins", err)
+			continue
+		}
+		if deleted > 0 {
+			authLogger.InfoWithFields("Deleted old failed logins", map[string]interface{}{
+				"count": deleted,
+			})
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email to users, such as password reset links.
+// Implementations must be safe for concurrent use.
+type Mailer interface {
+	// Name identifies the mailer in logs.
+	Name() string
+	Send(ctx context.Context, message MailMessage) error
+}
+
+// NewMailer picks the mailer configured by MAILER: "log" writes messages to
+// the service log, "file" appends them to MAIL_FILE. Neither delivers mail;
+// they are meant for development until a real sender is plugged in.
+func NewMailer() Mailer {
+	from := GetEnvOrDefault("MAIL_FROM", "no-reply@tour-discoverer.local")
+	name := GetEnvOrDefault("MAILER", "log")
+	switch name {
+	case "file":
+		return &FileMailer{from: from, path: GetEnvOrDefault("MAIL_FILE", "mail.log")}
+	case "log":
+	default:
+		authLogger.Warn(fmt.Sprintf("Unknown mailer %q, falling back to log mailer", name))
+	}
+	return &LogMailer{from: from}
+}
+
+type LogMailer struct {
+	from string
+}
+
+func (m *LogMailer) Name() string {
+	return "log"
+}
+
+func (m *LogMailer) Send(_ context.Context, message MailMessage) error {
+	authLogger.InfoWithFields("Mail sent", map[string]interface{}{
+		"from":    m.from,
+		"to":      message.To,
+		"subject": message.Subject,
+		"body":    message.Body,
+	})
+	return nil
+}
+
+// FileMailer appends every message to a file, one after another in a
+// mbox-like layout.
+type FileMailer struct {
+	from string
+	path string
+
+	mu sync.Mutex
+}
+
+func (m *FileMailer) Name() string {
+	return "file"
+}
+
+func (m *FileMailer) Send(_ context.Context, message MailMessage) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\n", m.from)
+	fmt.Fprintf(&b, "To: %s\n", message.To)
+	fmt.Fprintf(&b, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Subject: %s\n\n", message.Subject)
+	b.WriteString(message.Body)
+	b.WriteString("\n\n")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(b.String())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -17,11 +18,43 @@ func main() {
 
 	r := mux.NewRouter().StrictSlash(true)
 	database := InitDatabase()
+	SeedRoles(database)
 	SeedAdmins(database)
 
+	keyService, err := NewKeyService(&KeyRepository{database: database})
+	if err != nil {
+		authLogger.Error("Invalid signing key configuration", err)
+		os.Exit(1)
+	}
+	if err := keyService.Load(time.Now()); err != nil {
+		authLogger.Error("Failed to load signing keys", err)
+		os.Exit(1)
+	}
+
 	repository := &UserRepository{database: database}
-	service := &UserService{repository: repository}
+	auditService := &AdminAuditService{repository: &AdminAuditRepository{database: database}}
+	roleRepository := &RoleRepository{database: database}
+	sessionService := &SessionService{repository: &SessionRepository{database: database}, userRepository: repository, keys: keyService, roles: roleRepository}
+	loginPolicy, err := LoadLoginPolicy()
+	if err != nil {
+		authLogger.Error("Invalid login policy configuration", err)
+		os.Exit(1)
+	}
+	loginGuard := &LoginGuard{counter: NewAttemptCounter(database, loginPolicy.Window), repository: &LoginAuditRepository{database: database}, policy: loginPolicy}
+
+	mailer := NewMailer()
+	verificationService := &VerificationService{repository: &VerificationRepository{database: database}, userRepository: repository, mailer: mailer}
+	twoFactorService := &TwoFactorService{repository: &TwoFactorRepository{database: database}, userRepository: repository, sessions: sessionService, guard: loginGuard, roles: roleRepository}
+	service := &UserService{repository: repository, sessions: sessionService, verification: verificationService, guard: loginGuard, twoFactor: twoFactorService, audit: auditService}
+	passwordService := &PasswordService{repository: &PasswordRepository{database: database}, userRepository: repository, sessions: sessionService, mailer: mailer}
 	handler := &UserHandler{service: service}
+	sessionHandler := &SessionHandler{service: sessionService}
+	keyHandler := &KeyHandler{service: keyService}
+	passwordHandler := &PasswordHandler{service: passwordService}
+	verificationHandler := &VerificationHandler{service: verificationService}
+	twoFactorHandler := &TwoFactorHandler{service: twoFactorService}
+	roleService := &RoleService{repository: roleRepository, userRepository: repository, sessions: sessionService, audit: auditService}
+	roleHandler := &RoleHandler{service: roleService}
 
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -36,15 +69,58 @@ func main() {
 
 	r.HandleFunc("/register", handler.Register).Methods(http.MethodPost)
 	r.HandleFunc("/login", handler.Login).Methods(http.MethodPost)
+	r.HandleFunc("/login/2fa", twoFactorHandler.CompleteLogin).Methods(http.MethodPost)
+	r.HandleFunc("/login/2fa/enroll", twoFactorHandler.EnrollDuringLogin).Methods(http.MethodPost)
+	r.HandleFunc("/refresh", sessionHandler.Refresh).Methods(http.MethodPost)
+	r.HandleFunc("/logout", sessionHandler.Logout).Methods(http.MethodPost)
+	r.HandleFunc("/verify-email", verificationHandler.VerifyEmail).Methods(http.MethodPost)
+	r.HandleFunc("/verify-email/resend", verificationHandler.ResendVerification).Methods(http.MethodPost)
+	r.HandleFunc("/change-password", passwordHandler.ChangePassword).Methods(http.MethodPost)
+	r.HandleFunc("/forgot-password", passwordHandler.ForgotPassword).Methods(http.MethodPost)
+	r.HandleFunc("/reset-password", passwordHandler.ResetPassword).Methods(http.MethodPost)
+	r.HandleFunc("/2fa", twoFactorHandler.GetStatus).Methods(http.MethodGet)
+	r.HandleFunc("/2fa/enroll", twoFactorHandler.Enroll).Methods(http.MethodPost)
+	r.HandleFunc("/2fa/confirm", twoFactorHandler.Confirm).Methods(http.MethodPost)
+	r.HandleFunc("/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes).Methods(http.MethodPost)
+	r.HandleFunc("/2fa/disable", twoFactorHandler.Disable).Methods(http.MethodPost)
+	r.HandleFunc("/2fa/policies", twoFactorHandler.GetPolicies).Methods(http.MethodGet)
+	r.HandleFunc("/2fa/policies", twoFactorHandler.SetPolicy).Methods(http.MethodPut)
+	r.HandleFunc("/.well-known/jwks.json", keyHandler.JWKS).Methods(http.MethodGet)
+	r.HandleFunc("/keys/rotate", keyHandler.RotateKeys).Methods(http.MethodPost)
 	r.HandleFunc("/user", handler.GetAll).Methods(http.MethodGet)
 	r.HandleFunc("/block", handler.BlockUser).Methods(http.MethodPost)
+	r.HandleFunc("/unblock", handler.UnblockUser).Methods(http.MethodPost)
+	r.HandleFunc("/admin-actions", handler.GetAdminActions).Methods(http.MethodGet)
+	r.HandleFunc("/unlock", handler.UnlockUser).Methods(http.MethodPost)
+	r.HandleFunc("/failed-logins", handler.GetFailedLogins).Methods(http.MethodGet)
 	r.HandleFunc("/users", handler.GetAll).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/role", roleHandler.AssignRole).Methods(http.MethodPut)
+	r.HandleFunc("/roles", roleHandler.GetRoles).Methods(http.MethodGet)
+	r.HandleFunc("/roles/{name}", roleHandler.SaveRole).Methods(http.MethodPut)
 
 	r.HandleFunc("/internal/ping", handler.Ping).Methods(http.MethodGet)
+	r.HandleFunc("/internal/users/{username}/verify", verificationHandler.MarkVerified).Methods(http.MethodPost)
+	r.HandleFunc("/internal/revoked-tokens", sessionHandler.GetRevokedTokens).Methods(http.MethodGet)
+	r.HandleFunc("/internal/revoked-tokens/{jti}", sessionHandler.IsRevoked).Methods(http.MethodGet)
 
 	// Prometheus metrics uklonjen - sporo kompajliranje
 	// r.Handle("/metrics", metricsHandler()).Methods(http.MethodGet)
 
+	cleanupInterval, err := time.ParseDuration(GetEnvOrDefault("SESSION_CLEANUP_INTERVAL", "1h"))
+	if err != nil || cleanupInterval <= 0 {
+		authLogger.Warn("Invalid SESSION_CLEANUP_INTERVAL, using 1h")
+		cleanupInterval = time.Hour
+	}
+	go sessionService.StartCleanup(cleanupInterval)
+	go passwordService.StartCleanup(cleanupInterval)
+	go verificationService.StartCleanup(cleanupInterval)
+	go loginGuard.StartCleanup(cleanupInterval)
+	go twoFactorService.StartCleanup(cleanupInterval)
+	go service.StartCleanup(cleanupInterval)
+
+	// Pick up keys rotated by other replicas and rotate when due
+	go keyService.Start(time.Minute)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -1,21 +1,255 @@
 package main
 
+import (
+	"time"
+
+	"authz"
+)
+
 type User struct {
 	Username  string `json:"username" gorm:"primaryKey"`
 	Password  string `json:"-" gorm:"not null"` // "-" excludes from JSON
 	Email     string `json:"email" gorm:"not null;uniqueIndex:idx_user_email"`
 	Role      string `json:"role" gorm:"not null;default:'tourist'"`
 	IsBlocked bool   `json:"is_blocked" gorm:"default:false"`
+	Status    string `json:"status" gorm:"not null;default:'active'"`
+	// Why, by whom and since when the user is blocked. A block with
+	// BlockedUntil set is lifted once that time has passed.
+	BlockReason  string     `json:"block_reason,omitempty"`
+	BlockedBy    string     `json:"blocked_by,omitempty"`
+	BlockedAt    *time.Time `json:"blocked_at,omitempty"`
+	BlockedUntil *time.Time `json:"blocked_until,omitempty" gorm:"index"`
+}
+
+// IsVerified tells whether the user confirmed their email. Unverified users
+// can log in but not publish tours or buy.
+func (u *User) IsVerified() bool {
+	return u.Status != UserStatusPendingVerification
+}
+
+// IsBlockedAt tells whether the user is blocked at the time. Expired blocks
+// no longer count, even before they are lifted.
+func (u *User) IsBlockedAt(now time.Time) bool {
+	return u.IsBlocked && (u.BlockedUntil == nil || now.Before(*u.BlockedUntil))
+}
+
+// RefreshToken is one link in a chain of rotating refresh tokens. Every
+// refresh uses up the token and issues the next one in the same family, so
+// a token presented a second time means it was stolen: the whole family is
+// then revoked. Only the SHA-256 hash of the token is stored. AccessTokenID
+// is the jti of the access token issued alongside it.
+type RefreshToken struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Username        string     `json:"username" gorm:"not null;index"`
+	FamilyID        string     `json:"family_id" gorm:"not null;index"`
+	TokenHash       string     `json:"-" gorm:"not null;uniqueIndex"`
+	AccessTokenID   string     `json:"-"`
+	AccessExpiresAt time.Time  `json:"-"`
+	ExpiresAt       time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt          *time.Time `json:"used_at,omitempty"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// RevokedToken is an access token that must no longer be accepted although
+// it has not expired yet. It is kept until ExpiresAt, when the token would
+// have been refused anyway.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey"`
+	Username  string    `json:"username" gorm:"not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	RevokedAt time.Time `json:"revoked_at" gorm:"not null;index"`
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one.
+// It is sent by mail, works once and only until ExpiresAt. Only the SHA-256
+// hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Username  string     `json:"username" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// EmailVerificationToken confirms that a newly registered user owns their
+// email. It is sent by mail, works once and only until ExpiresAt. Only the
+// SHA-256 hash of the token is stored.
+type EmailVerificationToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Username  string     `json:"username" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
+
+// FailedLogin is the audit record of a login attempt that did not succeed,
+// including attempts refused because of backoff or lockout.
+type FailedLogin struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Username  string    `json:"username" gorm:"not null;index"`
+	IP        string    `json:"ip" gorm:"not null;index"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// Reasons a login attempt failed
+const (
+	FailedLoginInvalidCredentials = "invalid_credentials"
+	FailedLoginBlocked            = "blocked"
+	FailedLoginThrottled          = "throttled"
+	FailedLoginLocked             = "locked"
+	FailedLoginInvalidCode        = "invalid_code"
+)
+
+// LoginAttemptCounter is a row of the shared-store AttemptCounter: the
+// recent failed logins of a username or IP key.
+type LoginAttemptCounter struct {
+	Key           string     `json:"key" gorm:"primaryKey"`
+	Failures      int        `json:"failures" gorm:"not null"`
+	LastFailureAt time.Time  `json:"last_failure_at" gorm:"index"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// TwoFactorSecret is the TOTP secret of a user. It is pending until the
+// user confirms it with a code; from then on logins need a code too.
+// LastUsedStep is the time step of the last accepted code, so that a code
+// works only once. The secret has to be kept in clear to compute codes.
+type TwoFactorSecret struct {
+	Username     string     `json:"username" gorm:"primaryKey"`
+	Secret       string     `json:"-" gorm:"not null"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RecoveryCode logs a user in once instead of a TOTP code, for when their
+// authenticator is lost. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID       uint       `json:"id" gorm:"primaryKey"`
+	Username string     `json:"username" gorm:"not null;index"`
+	CodeHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
+
+// LoginChallenge is the second step of a login by a user with two-factor
+// authentication: the password was right and a code is still needed. Only
+// the SHA-256 hash of the challenge token is stored.
+type LoginChallenge struct {
+	TokenHash string    `json:"-" gorm:"primaryKey"`
+	Username  string    `json:"username" gorm:"not null;index"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TwoFactorPolicy makes two-factor authentication mandatory for a role.
+// Roles without a row do not require it.
+type TwoFactorPolicy struct {
+	Role      string    `json:"role" gorm:"primaryKey"`
+	Required  bool      `json:"required" gorm:"not null"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Role is a role users can have. Its permissions go into the access tokens
+// of its users.
+type Role struct {
+	Name        string           `json:"name" gorm:"primaryKey"`
+	Permissions []RolePermission `json:"-" gorm:"foreignKey:Role;constraint:OnDelete:CASCADE"`
+	UpdatedBy   string           `json:"updated_by"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+type RolePermission struct {
+	Role       string `gorm:"primaryKey"`
+	Permission string `gorm:"primaryKey"`
+}
+
+// AdminAction is an audit record of something an admin did to an account.
+// Blocks lifted on expiry are recorded with SystemActor as the admin.
+type AdminAction struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	Action string `json:"action" gorm:"not null;index"`
+	Target string `json:"target" gorm:"not null;index"`
+	Admin  string `json:"admin" gorm:"not null;index"`
+	Reason string `json:"reason,omitempty"`
+	// Details describes the change, e.g. the old and new role
+	Details   string     `json:"details,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
 }
 
+const (
+	AdminActionBlock      = "block"
+	AdminActionUnblock    = "unblock"
+	AdminActionUnlock     = "unlock"
+	AdminActionAssignRole = "assign_role"
+)
+
+// SystemActor stands in for an admin in changes auth makes by itself.
+const SystemActor = "system"
+
+// SigningKey is a key pair that access tokens are signed with, found by its
+// KID in the token header. The newest key signs; older keys stay published
+// in the JWKS until RetiresAt so that tokens they signed can still be
+// verified. Keys are PEM encoded, the private key as PKCS #8.
+type SigningKey struct {
+	KID        string     `json:"kid" gorm:"column:kid;primaryKey"`
+	Algorithm  string     `json:"alg" gorm:"not null"`
+	PrivateKey string     `json:"-" gorm:"not null"`
+	PublicKey  string     `json:"-" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+	RetiresAt  *time.Time `json:"retires_at,omitempty" gorm:"index"`
+}
+
+// Algorithms access tokens can be signed with
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmEdDSA = "EdDSA"
+)
+
 const (
 	RoleTourist = "tourist"
 	RoleGuide   = "guide"
 	RoleAdmin   = "admin"
 )
 
-var UserRoles = []string{
-	RoleTourist,
-	RoleGuide,
-	RoleAdmin,
+// User statuses. Users registered before verification existed and seeded
+// admins are active.
+const (
+	UserStatusActive              = "active"
+	UserStatusPendingVerification = "pending_verification"
+)
+
+// DefaultRolePermissions are the roles created when auth first starts.
+// Admins can change them and add roles later.
+var DefaultRolePermissions = map[string][]string{
+	RoleTourist: {authz.TourExecute},
+	RoleGuide: {
+		authz.TourWrite,
+		authz.TourPublish,
+		authz.SalesRead,
+		authz.CouponWrite,
+		authz.BundleWrite,
+	},
+	RoleAdmin: {
+		authz.ReviewModerate,
+		authz.UserRead,
+		authz.UserBlock,
+		authz.UserUnlock,
+		authz.LoginAudit,
+		authz.RoleManage,
+		authz.SecurityManage,
+		authz.RefundReview,
+		authz.OrderRead,
+		authz.InvoiceCredit,
+		authz.SalesAudit,
+		authz.PayoutCreate,
+		authz.CouponManage,
+		authz.BundleManage,
+	},
 }
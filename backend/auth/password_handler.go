@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type PasswordHandler struct {
+	service *PasswordService
+}
+
+// ChangePassword sets a new password for the caller and answers with a new
+// session, since all existing ones are revoked.
+func (h *PasswordHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var changeReq ChangePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&changeReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(changeReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.ChangePassword(username, changeReq.OldPassword, changeReq.NewPassword)
+	if err != nil {
+		if errors.Is(err, ErrIncorrectPassword) {
+			authLogger.Warn("Password change failed: incorrect password for user " + username)
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else if errors.Is(err, ErrSamePassword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			authLogger.Error("Password change failed", err)
+			http.Error(w, "error changing password: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	authLogger.InfoWithFields("Password changed", map[string]interface{}{
+		"username": username,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// ForgotPassword mails a reset link. It answers 202 whether or not the
+// email belongs to a user.
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgotReq ForgotPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&forgotReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(forgotReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.ForgotPassword(r.Context(), forgotReq.Email)
+	if err != nil {
+		authLogger.Error("Password reset request failed", err)
+		http.Error(w, "error requesting password reset", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetReq ResetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&resetReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(resetReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.ResetPassword(resetReq.Token, resetReq.NewPassword)
+	if err != nil {
+		if errors.Is(err, ErrInvalidResetToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			authLogger.Error("Password reset failed", err)
+			http.Error(w, "error resetting password: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PasswordRepository struct {
+	database *gorm.DB
+}
+
+// Transaction runs fn with a repository bound to a single transaction.
+func (r *PasswordRepository) Transaction(fn func(repo *PasswordRepository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		return fn(&PasswordRepository{database: tx})
+	})
+}
+
+func (r *PasswordRepository) UpdatePassword(username string, hashedPassword string) error {
+	return r.database.Model(&User{}).Where("username = ?", username).Update("password", hashedPassword).Error
+}
+
+func (r *PasswordRepository) CreateResetToken(token *PasswordResetToken) error {
+	return r.database.Create(token).Error
+}
+
+// LockResetToken loads a reset token by its hash and locks it until the
+// transaction ends, so that a token can only be used once.
+func (r *PasswordRepository) LockResetToken(tokenHash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	err := r.database.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseResetTokens marks every unused reset token of the user as used, so
+// that none of them works once the password has changed.
+func (r *PasswordRepository) UseResetTokens(username string, at time.Time) error {
+	return r.database.Model(&PasswordResetToken{}).
+		Where("username = ? AND used_at IS NULL", username).
+		Update("used_at", at).Error
+}
+
+// DeleteExpiredResetTokens removes reset tokens that have expired.
+func (r *PasswordRepository) DeleteExpiredResetTokens(now time.Time) (int64, error) {
+	result := r.database.Where("expires_at < ?", now).Delete(&PasswordResetToken{})
+	return result.RowsAffected, result.Error
+}
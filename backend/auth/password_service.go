@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordService changes passwords and resets forgotten ones. Either way
+// every existing login of the user is ended.
+type PasswordService struct {
+	repository     *PasswordRepository
+	userRepository *UserRepository
+	sessions       *SessionService
+	mailer         Mailer
+}
+
+// resetTokenLifetime is how long a password reset link works, from
+// PASSWORD_RESET_TOKEN_EXPIRATION.
+func resetTokenLifetime() (time.Duration, error) {
+	return time.ParseDuration(GetEnvOrDefault("PASSWORD_RESET_TOKEN_EXPIRATION", "1h"))
+}
+
+// ChangePassword replaces the password of a logged in user who knows the
+// current one. All of the user's sessions are revoked and a new one is
+// started, so the caller stays logged in while every other device is not.
+func (s *PasswordService) ChangePassword(username string, oldPassword string, newPassword string) (*JWTResponse, error) {
+	user, err := s.userRepository.FindByUsername(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword))
+	if err != nil {
+		return nil, ErrIncorrectPassword
+	}
+	if oldPassword == newPassword {
+		return nil, ErrSamePassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.repository.Transaction(func(repo *PasswordRepository) error {
+		err := repo.UpdatePassword(user.Username, string(hashedPassword))
+		if err != nil {
+			return err
+		}
+		return repo.UseResetTokens(user.Username, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sessions.RevokeUserSessions(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	return s.sessions.StartSession(user)
+}
+
+// ForgotPassword mails a reset link to the user with the email. Nothing
+// tells the caller whether such a user exists, so an unknown email is not
+// an error.
+func (s *PasswordService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepository.FindByEmail(email)
+	if err != nil {
+		authLogger.Info("Password reset requested for unknown email")
+		return nil
+	}
+	if user.IsBlockedAt(time.Now()) {
+		authLogger.Warn("Password reset requested for blocked user " + user.Username)
+		return nil
+	}
+
+	lifetime, err := resetTokenLifetime()
+	if err != nil {
+		return err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	record := &PasswordResetToken{
+		Username:  user.Username,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	err = s.repository.CreateResetToken(record)
+	if err != nil {
+		return err
+	}
+
+	link := GetEnvOrDefault("PASSWORD_RESET_URL", "http://localhost:3000/reset-password") + "?token=" + token
+	err = s.mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Reset your Tour Discoverer password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It works once and expires in %s.\n\n%s\n\nIf you did not ask for a password reset, you can ignore this email.",
+			user.Username, lifetime, link),
+	})
+	if err != nil {
+		// Failing the request would tell the caller the email is registered
+		authLogger.Error("Failed to send password reset mail via "+s.mailer.Name(), err)
+		return nil
+	}
+
+	authLogger.InfoWithFields("Password reset mail sent", map[string]interface{}{
+		"username": user.Username,
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a reset mail. The
+// token and any other outstanding ones of the user are used up, and all of
+// the user's sessions are revoked.
+func (s *PasswordService) ResetPassword(token string, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var username string
+	err = s.repository.Transaction(func(repo *PasswordRepository) error {
+		reset, err := repo.LockResetToken(hashToken(token))
+		if err != nil {
+			return err
+		}
+		if reset.UsedAt != nil || !reset.ExpiresAt.After(now) {
+			return ErrInvalidResetToken
+		}
+
+		err = repo.UpdatePassword(reset.Username, string(hashedPassword))
+		if err != nil {
+			return err
+		}
+		username = reset.Username
+		return repo.UseResetTokens(reset.Username, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	authLogger.InfoWithFields("Password reset", map[string]interface{}{
+		"username": username,
+	})
+	return s.sessions.RevokeUserSessions(username)
+}
+
+// StartCleanup removes expired reset tokens every interval.
+func (s *PasswordService) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.repository.DeleteExpiredResetTokens(time.Now())
+		if err != nil {
+			authLogger.Error("Failed to delete expired password reset tokens", err)
+			continue
+		}
+		if deleted > 0 {
+			authLogger.InfoWithFields("Deleted expired password reset tokens", map[string]interface{}{
+				"count": deleted,
+			})
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type RegisterRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
@@ -17,10 +19,163 @@ type PingResponse struct {
 	Service string `json:"service"`
 }
 
+// JWTResponse holds a short-lived access token and the refresh token that
+// renews it.
 type JWTResponse struct {
-	Token string `json:"token"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// LoginResponse is either the session of a login or, for users with
+// two-factor authentication, the challenge a code has to answer.
+type LoginResponse struct {
+	*JWTResponse
+	*TwoFactorChallenge
+}
+
+type TwoFactorChallenge struct {
+	ChallengeToken string    `json:"challenge_token"`
+	ExpiresAt      time.Time `json:"challenge_expires_at"`
+	// EnrolmentRequired is set when the user's role requires two-factor
+	// authentication and they have to enrol before logging in.
+	EnrolmentRequired bool `json:"enrolment_required"`
+}
+
+// TwoFactorLoginRequest answers a login challenge. Code is a TOTP code or a
+// recovery code.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+// TwoFactorLoginResponse carries the recovery codes too when the user
+// enrolled during the login.
+type TwoFactorLoginResponse struct {
+	*JWTResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest ends the login the refresh token belongs to, or every login
+// of the user with All set.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"`
+}
+
+type RevokedTokensResponse struct {
+	Revoked []RevokedToken `json:"revoked"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
 }
 
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type VerifyEmailResponse struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+type TwoFactorEnrolment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool  `json:"enabled"`
+	Pending           bool  `json:"pending"`
+	Required          bool  `json:"required"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+type TwoFactorPolicyRequest struct {
+	Role     string `json:"role" validate:"required"`
+	Required bool   `json:"required"`
+}
+
+// BlockUserRequest blocks a user, until ExpiresAt when it is set.
 type BlockUserRequest struct {
+	Username  string     `json:"username" validate:"required"`
+	Reason    string     `json:"reason" validate:"required,max=500"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type UnblockUserRequest struct {
 	Username string `json:"username" validate:"required"`
+	Reason   string `json:"reason" validate:"required,max=500"`
+}
+
+// RoleRequest sets the permissions of a role. Permissions must be ones
+// authz knows.
+type RoleRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+type RoleResponse struct {
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	UpdatedBy   string    `json:"updated_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RolesResponse lists the roles and every permission they can have.
+type RolesResponse struct {
+	Roles       []RoleResponse `json:"roles"`
+	Permissions []string       `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type UnlockUserRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// JWKSet is the JSON Web Key Set published at /.well-known/jwks.json. Only
+// the fields of RSA and Ed25519 public keys are used.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KID       string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"authz"
+
+	"github.com/gorilla/mux"
+)
+
+type RoleHandler struct {
+	service *RoleService
+}
+
+// GetRoles lists the roles with their permissions and every permission a
+// role can be given.
+func (h *RoleHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.RoleManage) {
+		http.Error(w, "forbidden: requires permission "+authz.RoleManage, http.StatusForbidden)
+		return
+	}
+
+	roles, err := h.service.GetRoles()
+	if err != nil {
+		http.Error(w, "error retrieving roles: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RolesResponse{Roles: roles, Permissions: authz.All})
+}
+
+// SaveRole creates the role in the path or replaces its permissions.
+func (h *RoleHandler) SaveRole(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.RoleManage) {
+		http.Error(w, "forbidden: requires permission "+authz.RoleManage, http.StatusForbidden)
+		return
+	}
+
+	var roleReq RoleRequest
+	err := json.NewDecoder(r.Body).Decode(&roleReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.service.SaveRole(mux.Vars(r)["name"], roleReq.Permissions, r.Header.Get("x-username"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRole) || errors.Is(err, ErrUnknownPermission) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "error saving role: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(role)
+}
+
+func (h *RoleHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.RoleManage) {
+		http.Error(w, "forbidden: requires permission "+authz.RoleManage, http.StatusForbidden)
+		return
+	}
+
+	var assignReq AssignRoleRequest
+	err := json.NewDecoder(r.Body).Decode(&assignReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(assignReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.AssignRole(mux.Vars(r)["username"], assignReq.Role, r.Header.Get("x-username"))
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "error assigning role: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type RoleRepository struct {
+	database *gorm.DB
+}
+
+// Transaction runs fn with a repository bound to a single transaction.
+func (r *RoleRepository) Transaction(fn func(repo *RoleRepository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		return fn(&RoleRepository{database: tx})
+	})
+}
+
+func (r *RoleRepository) FindAll() ([]Role, error) {
+	roles := []Role{}
+	err := r.database.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *RoleRepository) FindByName(name string) (*Role, error) {
+	var role Role
+	err := r.database.Preload("Permissions").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *RoleRepository) Exists(name string) (bool, error) {
+	var count int64
+	err := r.database.Model(&Role{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
+
+// FindPermissions returns the permissions of the role, none when the role
+// does not exist.
+func (r *RoleRepository) FindPermissions(role string) ([]string, error) {
+	permissions := []string{}
+	err := r.database.Model(&RolePermission{}).
+		Where("role = ?", role).
+		Order("permission").
+		Pluck("permission", &permissions).Error
+	return permissions, err
+}
+
+// IsGranted tells whether any role has the permission.
+func (r *RoleRepository) IsGranted(permission string) (bool, error) {
+	var count int64
+	err := r.database.Model(&RolePermission{}).Where("permission = ?", permission).Count(&count).Error
+	return count > 0, err
+}
+
+// Grant adds the permission to the role.
+func (r *RoleRepository) Grant(role string, permission string) error {
+	return r.database.Create(&RolePermission{Role: role, Permission: permission}).Error
+}
+
+// Save creates or updates the role and replaces its permissions.
+func (r *RoleRepository) Save(role *Role, permissions []string) error {
+	err := r.database.Omit("Permissions").Save(role).Error
+	if err != nil {
+		return err
+	}
+	err = r.database.Where("role = ?", role.Name).Delete(&RolePermission{}).Error
+	if err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+	rows := make([]RolePermission, len(permissions))
+	for i, permission := range permissions {
+		rows[i] = RolePermission{Role: role.Name, Permission: permission}
+	}
+	return r.database.Create(&rows).Error
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"time"
+
+	"authz"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// RoleService manages roles and the permissions they grant. Permissions are
+// read when an access token is issued, so a change reaches users of the
+// role when their access tokens are next refreshed.
+type RoleService struct {
+	repository     *RoleRepository
+	userRepository *UserRepository
+	sessions       *SessionService
+	audit          *AdminAuditService
+}
+
+func toRoleResponse(role Role) RoleResponse {
+	permissions := make([]string, len(role.Permissions))
+	for i, permission := range role.Permissions {
+		permissions[i] = permission.Permission
+	}
+	slices.Sort(permissions)
+	return RoleResponse{
+		Name:        role.Name,
+		Permissions: permissions,
+		UpdatedBy:   role.UpdatedBy,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
+
+func (s *RoleService) GetRoles() ([]RoleResponse, error) {
+	roles, err := s.repository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]RoleResponse, len(roles))
+	for i, role := range roles {
+		responses[i] = toRoleResponse(role)
+	}
+	return responses, nil
+}
+
+// SaveRole creates the role or replaces its permissions.
+func (s *RoleService) SaveRole(name string, permissions []string, admin string) (*RoleResponse, error) {
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrInvalidRole
+	}
+	for _, permission := range permissions {
+		if !authz.Known(permission) {
+			return nil, ErrUnknownPermission
+		}
+	}
+	permissions = slices.Clone(permissions)
+	slices.Sort(permissions)
+	permissions = slices.Compact(permissions)
+
+	role := &Role{Name: name, UpdatedBy: admin, UpdatedAt: time.Now()}
+	err := s.repository.Transaction(func(repo *RoleRepository) error {
+		return repo.Save(role, permissions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authLogger.InfoWithFields("Role saved", map[string]interface{}{
+		"role":        name,
+		"permissions": permissions,
+		"admin":       admin,
+	})
+	return &RoleResponse{Name: name, Permissions: permissions, UpdatedBy: admin, UpdatedAt: role.UpdatedAt}, nil
+}
+
+// AssignRole changes the role of a user and ends their sessions, so that no
+// access token keeps the permissions of the old role.
+func (s *RoleService) AssignRole(username string, role string, admin string) error {
+	exists, err := s.repository.Exists(role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	user, err := s.userRepository.FindByUsername(username)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if user.Role == role {
+		return nil
+	}
+	action := &AdminAction{
+		Action:  AdminActionAssignRole,
+		Target:  username,
+		Admin:   admin,
+		Details: user.Role + " -> " + role,
+	}
+	user.Role = role
+	err = s.userRepository.Transaction(func(repo *UserRepository) error {
+		err := repo.Update(user)
+		if err != nil {
+			return err
+		}
+		return s.audit.Record(repo.Audit(), action)
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Log(action)
+
+	return s.sessions.RevokeUserSessions(username)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type SessionHandler struct {
+	service *SessionService
+}
+
+func (h *SessionHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var refreshReq RefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&refreshReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(refreshReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.Refresh(refreshReq.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			authLogger.Warn("Refresh token reuse detected, login revoked")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else if errors.Is(err, ErrInvalidRefreshToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else if errors.Is(err, ErrUserBanned) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			authLogger.Error("Token refresh failed", err)
+			http.Error(w, "error refreshing token: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// Logout revokes the access token the request was made with, whose jti the
+// gateway passes in x-token-id, and the login of the refresh token in the
+// body.
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var logoutReq LogoutRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&logoutReq)
+		if err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := h.service.Logout(username, r.Header.Get("x-token-id"), logoutReq.RefreshToken, logoutReq.All)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			authLogger.Error("Logout failed", err)
+			http.Error(w, "error logging out: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	authLogger.InfoWithFields("User logged out", map[string]interface{}{
+		"username": username,
+		"all":      logoutReq.All,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRevokedTokens lists revoked access tokens that have not expired, for
+// the gateway to refuse. With ?since=<RFC 3339 time> only tokens revoked at
+// or after it are listed. Revocations are stamped before they commit, so a
+// poller should ask again from a little before the newest one it has seen.
+func (h *SessionHandler) GetRevokedTokens(w http.ResponseWriter, r *http.Request) {
+	var since *time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		since = &parsed
+	}
+
+	revoked, err := h.service.GetRevokedTokens(since)
+	if err != nil {
+		http.Error(w, "error retrieving revoked tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RevokedTokensResponse{Revoked: revoked})
+}
+
+// IsRevoked answers 200 when the access token with the jti is revoked and
+// 404 when it is not.
+func (h *SessionHandler) IsRevoked(w http.ResponseWriter, r *http.Request) {
+	revoked, err := h.service.IsRevoked(mux.Vars(r)["jti"])
+	if err != nil {
+		http.Error(w, "error checking token", http.StatusInternalServerError)
+		return
+	}
+
+	if revoked {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
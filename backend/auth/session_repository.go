@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionRepository struct {
+	database *gorm.DB
+}
+
+// Transaction runs fn with a repository bound to a single transaction.
+func (r *SessionRepository) Transaction(fn func(repo *SessionRepository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		return fn(&SessionRepository{database: tx})
+	})
+}
+
+func (r *SessionRepository) CreateRefreshToken(token *RefreshToken) error {
+	return r.database.Create(token).Error
+}
+
+// LockRefreshToken loads a refresh token by its hash and locks it until the
+// transaction ends, so that a token can only be rotated once.
+func (r *SessionRepository) LockRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := r.database.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *SessionRepository) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := r.database.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *SessionRepository) MarkRefreshTokenUsed(id uint, at time.Time) error {
+	return r.database.Model(&RefreshToken{}).Where("id = ?", id).Update("used_at", at).Error
+}
+
+// RevokeFamily revokes every refresh token of a family and returns them.
+func (r *SessionRepository) RevokeFamily(familyID string, at time.Time) ([]RefreshToken, error) {
+	var tokens []RefreshToken
+	err := r.database.Where("family_id = ?", familyID).Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	err = r.database.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+	return tokens, err
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user and
+// returns them.
+func (r *SessionRepository) RevokeUserRefreshTokens(username string, at time.Time) ([]RefreshToken, error) {
+	var tokens []RefreshToken
+	err := r.database.Where("username = ?", username).Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	err = r.database.Model(&RefreshToken{}).
+		Where("username = ? AND revoked_at IS NULL", username).
+		Update("revoked_at", at).Error
+	return tokens, err
+}
+
+// RevokeAccessToken adds an access token to the revocation list. Revoking a
+// token twice keeps the first entry.
+func (r *SessionRepository) RevokeAccessToken(token *RevokedToken) error {
+	return r.database.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+// GetRevokedTokens returns the revoked access tokens that have not expired,
+// revoked at or after since when it is set.
+func (r *SessionRepository) GetRevokedTokens(since *time.Time, now time.Time) ([]RevokedToken, error) {
+	query := r.database.Where("expires_at > ?", now)
+	if since != nil {
+		query = query.Where("revoked_at >= ?", *since)
+	}
+
+	var tokens []RevokedToken
+	err := query.Order("revoked_at").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *SessionRepository) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.database.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteExpired removes refresh tokens and revocations that have expired.
+func (r *SessionRepository) DeleteExpired(now time.Time) (int64, error) {
+	refresh := r.database.Where("expires_at < ?", now).Delete(&RefreshToken{})
+	if refresh.Error != nil {
+		return 0, refresh.Error
+	}
+	revoked := r.database.Where("expires_at < ?", now).Delete(&RevokedToken{})
+	return refresh.RowsAffected + revoked.RowsAffected, revoked.Error
+}
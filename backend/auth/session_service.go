@@ -0,0 +1,233 @@
+package main
+
+import "time"
+
+// SessionService issues access and refresh tokens and revokes them. A login
+// starts a family of refresh tokens; each refresh uses up the presented
+// token and continues the family with a new one.
+type SessionService struct {
+	repository     *SessionRepository
+	userRepository *UserRepository
+	keys           *KeyService
+	roles          *RoleRepository
+}
+
+// refreshTokenLifetime is how long a refresh token can be used, from
+// REFRESH_TOKEN_EXPIRATION. Every refresh starts the period again.
+func refreshTokenLifetime() (time.Duration, error) {
+	return time.ParseDuration(GetEnvOrDefault("REFRESH_TOKEN_EXPIRATION", "720h"))
+}
+
+// StartSession issues the first access and refresh token of a login.
+func (s *SessionService) StartSession(user *User) (*JWTResponse, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(s.repository, user, familyID, time.Now())
+}
+
+func (s *SessionService) issue(repo *SessionRepository, user *User, familyID string, now time.Time) (*JWTResponse, error) {
+	lifetime, err := refreshTokenLifetime()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.keys.ActiveKey()
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := s.roles.FindPermissions(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, claims, err := CreateJWT(key, user, permissions)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &RefreshToken{
+		Username:        user.Username,
+		FamilyID:        familyID,
+		TokenHash:       hashToken(refreshToken),
+		AccessTokenID:   claims.ID,
+		AccessExpiresAt: claims.ExpiresAt.Time,
+		ExpiresAt:       now.Add(lifetime),
+	}
+	err = repo.CreateRefreshToken(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTResponse{
+		Token:            accessToken,
+		ExpiresAt:        claims.ExpiresAt.Time,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: record.ExpiresAt,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. A
+// refresh token that was already used revokes its whole family, including
+// the access tokens issued with it, and returns ErrRefreshTokenReused.
+func (s *SessionService) Refresh(refreshToken string) (*JWTResponse, error) {
+	now := time.Now()
+
+	var response *JWTResponse
+	var refusal error
+	err := s.repository.Transaction(func(repo *SessionRepository) error {
+		token, err := repo.LockRefreshToken(hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case token.RevokedAt != nil || !token.ExpiresAt.After(now):
+			return ErrInvalidRefreshToken
+		case token.UsedAt != nil:
+			refusal = ErrRefreshTokenReused
+			return s.revokeFamily(repo, token.FamilyID, now)
+		}
+
+		user, err := s.userRepository.FindByUsername(token.Username)
+		if err != nil {
+			return ErrInvalidRefreshToken
+		}
+		if user.IsBlockedAt(now) {
+			refusal = ErrUserBanned
+			return s.revokeFamily(repo, token.FamilyID, now)
+		}
+
+		err = repo.MarkRefreshTokenUsed(token.ID, now)
+		if err != nil {
+			return err
+		}
+		response, err = s.issue(repo, user, token.FamilyID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refusal != nil {
+		return nil, refusal
+	}
+	return response, nil
+}
+
+// Logout revokes the caller's access token and, when a refresh token is
+// given, the login it belongs to. With all set every login of the user is
+// revoked.
+func (s *SessionService) Logout(username string, accessTokenID string, refreshToken string, all bool) error {
+	now := time.Now()
+
+	if accessTokenID != "" {
+		lifetime, err := accessTokenLifetime()
+		if err != nil {
+			return err
+		}
+		// The token's own expiry is not known here; it is at most one
+		// lifetime away.
+		err = s.repository.RevokeAccessToken(&RevokedToken{
+			JTI:       accessTokenID,
+			Username:  username,
+			ExpiresAt: now.Add(lifetime),
+			RevokedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if all {
+		return s.RevokeUserSessions(username)
+	}
+	if refreshToken == "" {
+		return nil
+	}
+
+	token, err := s.repository.GetRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if token.Username != username {
+		return ErrInvalidRefreshToken
+	}
+	return s.repository.Transaction(func(repo *SessionRepository) error {
+		return s.revokeFamily(repo, token.FamilyID, now)
+	})
+}
+
+// RevokeUserSessions ends every login of the user: no refresh token of
+// theirs can be used again and their unexpired access tokens are revoked.
+func (s *SessionService) RevokeUserSessions(username string) error {
+	now := time.Now()
+	return s.repository.Transaction(func(repo *SessionRepository) error {
+		tokens, err := repo.RevokeUserRefreshTokens(username, now)
+		if err != nil {
+			return err
+		}
+		return s.revokeAccessTokens(repo, tokens, now)
+	})
+}
+
+func (s *SessionService) revokeFamily(repo *SessionRepository, familyID string, now time.Time) error {
+	tokens, err := repo.RevokeFamily(familyID, now)
+	if err != nil {
+		return err
+	}
+	return s.revokeAccessTokens(repo, tokens, now)
+}
+
+// revokeAccessTokens revokes the access tokens issued with the given
+// refresh tokens that have not expired yet.
+func (s *SessionService) revokeAccessTokens(repo *SessionRepository, tokens []RefreshToken, now time.Time) error {
+	for _, token := range tokens {
+		if token.AccessTokenID == "" || !token.AccessExpiresAt.After(now) {
+			continue
+		}
+		err := repo.RevokeAccessToken(&RevokedToken{
+			JTI:       token.AccessTokenID,
+			Username:  token.Username,
+			ExpiresAt: token.AccessExpiresAt,
+			RevokedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRevokedTokens returns the access tokens that are revoked and not yet
+// expired, only those revoked at or after since when it is set.
+func (s *SessionService) GetRevokedTokens(since *time.Time) ([]RevokedToken, error) {
+	return s.repository.GetRevokedTokens(since, time.Now())
+}
+
+func (s *SessionService) IsRevoked(jti string) (bool, error) {
+	return s.repository.IsRevoked(jti)
+}
+
+// StartCleanup removes expired refresh tokens and revocations every
+// interval.
+func (s *SessionService) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.repository.DeleteExpired(time.Now())
+		if err != nil {
+			authLogger.Error("Failed to delete expired sessions", err)
+			continue
+		}
+		if deleted > 0 {
+			authLogger.InfoWithFields("Deleted expired sessions", map[string]interface{}{
+				"count": deleted,
+			})
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"authz"
+)
+
+type TwoFactorHandler struct {
+	service *TwoFactorService
+}
+
+// writeTwoFactorError answers with the status matching a two-factor error.
+func writeTwoFactorError(w http.ResponseWriter, err error, action string) {
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		if errors.Is(err, ErrAccountLocked) {
+			http.Error(w, err.Error(), http.StatusLocked)
+		} else {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		}
+	} else if errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrInvalidLoginChallenge) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	} else if errors.Is(err, ErrUserBanned) || errors.Is(err, ErrTwoFactorRequired) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	} else if errors.Is(err, ErrTwoFactorAlreadyEnabled) || errors.Is(err, ErrTwoFactorNotEnrolled) {
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else if errors.Is(err, ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else if errors.Is(err, ErrRoleNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	} else {
+		authLogger.Error("Two-factor request failed", err)
+		http.Error(w, "error "+action+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CompleteLogin answers the challenge /login returned with a TOTP or
+// recovery code.
+func (h *TwoFactorHandler) CompleteLogin(w http.ResponseWriter, r *http.Request) {
+	var loginReq TwoFactorLoginRequest
+	err := json.NewDecoder(r.Body).Decode(&loginReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(loginReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := LoginClient{IP: clientIP(r), UserAgent: r.UserAgent()}
+	response, err := h.service.CompleteLogin(r.Context(), loginReq.ChallengeToken, loginReq.Code, client)
+	if err != nil {
+		authLogger.Warn("Two-factor login failed: " + err.Error() + " from " + client.IP)
+		writeTwoFactorError(w, err, "authenticating user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// EnrollDuringLogin starts enrolment for a user whose role requires
+// two-factor authentication, with the challenge /login returned. The code
+// of the new secret then completes the login.
+func (h *TwoFactorHandler) EnrollDuringLogin(w http.ResponseWriter, r *http.Request) {
+	var enrollReq TwoFactorChallengeRequest
+	err := json.NewDecoder(r.Body).Decode(&enrollReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(enrollReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	enrolment, err := h.service.EnrollWithChallenge(enrollReq.ChallengeToken)
+	if err != nil {
+		writeTwoFactorError(w, err, "enrolling two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(enrolment)
+}
+
+func (h *TwoFactorHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := h.service.GetStatus(username)
+	if err != nil {
+		writeTwoFactorError(w, err, "getting two-factor status")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+// Enroll creates a secret for the caller to add to an authenticator app.
+// It takes effect once confirmed with a code.
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrolment, err := h.service.Enroll(username)
+	if err != nil {
+		writeTwoFactorError(w, err, "enrolling two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(enrolment)
+}
+
+func (h *TwoFactorHandler) decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var codeReq TwoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&codeReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return "", false
+	}
+
+	if err := validate.Struct(codeReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return codeReq.Code, true
+}
+
+// Confirm enables two-factor authentication and returns the recovery
+// codes, which are not shown again.
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.Confirm(username, code)
+	if err != nil {
+		writeTwoFactorError(w, err, "confirming two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(username, code)
+	if err != nil {
+		writeTwoFactorError(w, err, "regenerating recovery codes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.Disable(username, code)
+	if err != nil {
+		writeTwoFactorError(w, err, "disabling two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPolicies lists the roles two-factor authentication was configured
+// for. Roles without a policy leave it optional.
+func (h *TwoFactorHandler) GetPolicies(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.SecurityManage) {
+		http.Error(w, "forbidden: requires permission "+authz.SecurityManage, http.StatusForbidden)
+		return
+	}
+
+	policies, err := h.service.GetPolicies()
+	if err != nil {
+		http.Error(w, "error getting two-factor policies: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(policies)
+}
+
+func (h *TwoFactorHandler) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.SecurityManage) {
+		http.Error(w, "forbidden: requires permission "+authz.SecurityManage, http.StatusForbidden)
+		return
+	}
+
+	var policyReq TwoFactorPolicyRequest
+	err := json.NewDecoder(r.Body).Decode(&policyReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(policyReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	policy, err := h.service.SetPolicy(policyReq.Role, policyReq.Required, r.Header.Get("x-username"))
+	if err != nil {
+		writeTwoFactorError(w, err, "changing two-factor policy")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(policy)
+}
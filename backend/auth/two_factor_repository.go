@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TwoFactorRepository struct {
+	database *gorm.DB
+}
+
+// Transaction runs fn with a repository bound to a single transaction.
+func (r *TwoFactorRepository) Transaction(fn func(repo *TwoFactorRepository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		return fn(&TwoFactorRepository{database: tx})
+	})
+}
+
+// FindSecret returns the TOTP secret of the user, nil when there is none.
+func (r *TwoFactorRepository) FindSecret(username string) (*TwoFactorSecret, error) {
+	var secrets []TwoFactorSecret
+	err := r.database.Where("username = ?", username).Limit(1).Find(&secrets).Error
+	if err != nil || len(secrets) == 0 {
+		return nil, err
+	}
+	return &secrets[0], nil
+}
+
+// LockSecret loads the TOTP secret of the user and locks it until the
+// transaction ends, so that a code is only accepted once.
+func (r *TwoFactorRepository) LockSecret(username string) (*TwoFactorSecret, error) {
+	var secret TwoFactorSecret
+	err := r.database.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("username = ?", username).
+		First(&secret).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// SaveSecret creates or replaces the TOTP secret of the user.
+func (r *TwoFactorRepository) SaveSecret(secret *TwoFactorSecret) error {
+	return r.database.Save(secret).Error
+}
+
+func (r *TwoFactorRepository) DeleteSecret(username string) error {
+	return r.database.Where("username = ?", username).Delete(&TwoFactorSecret{}).Error
+}
+
+// ReplaceRecoveryCodes drops the recovery codes of the user and stores the
+// given hashes instead.
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(username string, hashes []string) error {
+	err := r.database.Where("username = ?", username).Delete(&RecoveryCode{}).Error
+	if err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		codes[i] = RecoveryCode{Username: username, CodeHash: hash}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return r.database.Create(&codes).Error
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used and
+// tells whether there was one.
+func (r *TwoFactorRepository) UseRecoveryCode(username string, codeHash string, at time.Time) (bool, error) {
+	result := r.database.Model(&RecoveryCode{}).
+		Where("username = ? AND code_hash = ? AND used_at IS NULL", username, codeHash).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *TwoFactorRepository) CountRecoveryCodes(username string) (int64, error) {
+	var count int64
+	err := r.database.Model(&RecoveryCode{}).
+		Where("username = ? AND used_at IS NULL", username).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *TwoFactorRepository) CreateChallenge(challenge *LoginChallenge) error {
+	return r.database.Create(challenge).Error
+}
+
+// LockChallenge loads a login challenge by its hash and locks it until the
+// transaction ends.
+func (r *TwoFactorRepository) LockChallenge(tokenHash string) (*LoginChallenge, error) {
+	var challenge LoginChallenge
+	err := r.database.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", tokenHash).
+		First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidLoginChallenge
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *TwoFactorRepository) GetChallenge(tokenHash string) (*LoginChallenge, error) {
+	var challenge LoginChallenge
+	err := r.database.Where("token_hash = ?", tokenHash).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidLoginChallenge
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *TwoFactorRepository) CountChallengeAttempt(tokenHash string) error {
+	return r.database.Model(&LoginChallenge{}).
+		Where("token_hash = ?", tokenHash).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (r *TwoFactorRepository) DeleteChallenge(tokenHash string) error {
+	return r.database.Where("token_hash = ?", tokenHash).Delete(&LoginChallenge{}).Error
+}
+
+// DeleteExpiredChallenges removes login challenges that have expired.
+func (r *TwoFactorRepository) DeleteExpiredChallenges(now time.Time) (int64, error) {
+	result := r.database.Where("expires_at < ?", now).Delete(&LoginChallenge{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *TwoFactorRepository) FindPolicies() ([]TwoFactorPolicy, error) {
+	policies := []TwoFactorPolicy{}
+	err := r.database.Order("role").Find(&policies).Error
+	return policies, err
+}
+
+// IsRequired tells whether two-factor authentication is mandatory for the
+// role.
+func (r *TwoFactorRepository) IsRequired(role string) (bool, error) {
+	var count int64
+	err := r.database.Model(&TwoFactorPolicy{}).
+		Where("role = ? AND required = ?", role, true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *TwoFactorRepository) SavePolicy(policy *TwoFactorPolicy) error {
+	return r.database.Save(policy).Error
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxChallengeAttempts is how many wrong codes a login challenge takes
+	// before the password has to be entered again.
+	maxChallengeAttempts = 5
+)
+
+// TwoFactorService manages TOTP two-factor authentication. A user enrols a
+// secret, confirms it with a first code and gets one-time recovery codes.
+// From then on a right password only earns a login challenge, which a code
+// turns into a session. Roles can be made to require two-factor
+// authentication; their users enrol during their next login.
+type TwoFactorService struct {
+	repository     *TwoFactorRepository
+	userRepository *UserRepository
+	sessions       *SessionService
+	guard          *LoginGuard
+	roles          *RoleRepository
+}
+
+// challengeLifetime is how long a login challenge can be answered, from
+// TWO_FACTOR_CHALLENGE_EXPIRATION.
+func challengeLifetime() (time.Duration, error) {
+	return time.ParseDuration(GetEnvOrDefault("TWO_FACTOR_CHALLENGE_EXPIRATION", "5m"))
+}
+
+// generateRecoveryCodes returns new codes like 3f9a-07c2-b1e4-5d68 and the
+// hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		token, err := randomToken(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = fmt.Sprintf("%s-%s-%s-%s", token[0:4], token[4:8], token[8:12], token[12:16])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, dashes and spaces, which users may type
+// differently.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return hashToken(code)
+}
+
+func (s *TwoFactorService) GetStatus(username string) (*TwoFactorStatus, error) {
+	user, err := s.userRepository.FindByUsername(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	secret, err := s.repository.FindSecret(username)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.repository.IsRequired(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	left, err := s.repository.CountRecoveryCodes(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorStatus{
+		Enabled:           secret != nil && secret.ConfirmedAt != nil,
+		Pending:           secret != nil && secret.ConfirmedAt == nil,
+		Required:          required,
+		RecoveryCodesLeft: left,
+	}, nil
+}
+
+// Enroll creates a new secret for the user, which takes effect once it is
+// confirmed. Enrolling again before that replaces the pending secret.
+func (s *TwoFactorService) Enroll(username string) (*TwoFactorEnrolment, error) {
+	existing, err := s.repository.FindSecret(username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repository.SaveSecret(&TwoFactorSecret{
+		Username:  username,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrolment{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(secret, username),
+	}, nil
+}
+
+// Confirm enables two-factor authentication with the first code from the
+// user's authenticator and returns their recovery codes.
+func (s *TwoFactorService) Confirm(username string, code string) ([]string, error) {
+	var codes []string
+	err := s.repository.Transaction(func(repo *TwoFactorRepository) error {
+		var err error
+		codes, err = s.confirm(repo, username, code, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authLogger.InfoWithFields("Two-factor authentication enabled", map[string]interface{}{
+		"username": username,
+	})
+	return codes, nil
+}
+
+func (s *TwoFactorService) confirm(repo *TwoFactorRepository, username string, code string, now time.Time) ([]string, error) {
+	secret, err := repo.LockSecret(username)
+	if err != nil {
+		return nil, err
+	}
+	if secret.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	step, ok := verifyTOTP(secret.Secret, code, now, secret.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	secret.ConfirmedAt = &now
+	secret.LastUsedStep = step
+	err = repo.SaveSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return codes, repo.ReplaceRecoveryCodes(username, hashes)
+}
+
+// verify accepts a TOTP code of an enabled secret or, with recovery set,
+// an unused recovery code.
+func (s *TwoFactorService) verify(repo *TwoFactorRepository, username string, code string, recovery bool, now time.Time) error {
+	secret, err := repo.LockSecret(username)
+	if err != nil {
+		return err
+	}
+	if secret.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if step, ok := verifyTOTP(secret.Secret, code, now, secret.LastUsedStep); ok {
+		secret.LastUsedStep = step
+		return repo.SaveSecret(secret)
+	}
+	if recovery {
+		used, err := repo.UseRecoveryCode(username, hashRecoveryCode(code), now)
+		if err != nil {
+			return err
+		}
+		if used {
+			authLogger.InfoWithFields("Recovery code used", map[string]interface{}{
+				"username": username,
+			})
+			return nil
+		}
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// a TOTP code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(username string, code string) ([]string, error) {
+	var codes []string
+	err := s.repository.Transaction(func(repo *TwoFactorRepository) error {
+		err := s.verify(repo, username, code, false, time.Now())
+		if err != nil {
+			return err
+		}
+		var hashes []string
+		codes, hashes, err = generateRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		return repo.ReplaceRecoveryCodes(username, hashes)
+	})
+	return codes, err
+}
+
+// Disable turns two-factor authentication off after checking a TOTP or
+// recovery code, unless the user's role requires it.
+func (s *TwoFactorService) Disable(username string, code string) error {
+	user, err := s.userRepository.FindByUsername(username)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	required, err := s.repository.IsRequired(user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+
+	err = s.repository.Transaction(func(repo *TwoFactorRepository) error {
+		err := s.verify(repo, username, code, true, time.Now())
+		if err != nil {
+			return err
+		}
+		err = repo.DeleteSecret(username)
+		if err != nil {
+			return err
+		}
+		return repo.ReplaceRecoveryCodes(username, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	authLogger.InfoWithFields("Two-factor authentication disabled", map[string]interface{}{
+		"username": username,
+	})
+	return nil
+}
+
+// BeginLogin returns a login challenge when the user has two-factor
+// authentication or their role requires it, and nil otherwise.
+func (s *TwoFactorService) BeginLogin(user *User) (*TwoFactorChallenge, error) {
+	secret, err := s.repository.FindSecret(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	enabled := secret != nil && secret.ConfirmedAt != nil
+	if !enabled {
+		required, err := s.repository.IsRequired(user.Role)
+		if err != nil {
+			return nil, err
+		}
+		if !required {
+			return nil, nil
+		}
+	}
+
+	lifetime, err := challengeLifetime()
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	challenge := &LoginChallenge{
+		TokenHash: hashToken(token),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	err = s.repository.CreateChallenge(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallenge{
+		ChallengeToken:    token,
+		ExpiresAt:         challenge.ExpiresAt,
+		EnrolmentRequired: !enabled,
+	}, nil
+}
+
+func (s *TwoFactorService) getChallenge(token string, now time.Time) (*LoginChallenge, error) {
+	challenge, err := s.repository.GetChallenge(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if !challengeUsable(challenge, now) {
+		return nil, ErrInvalidLoginChallenge
+	}
+	return challenge, nil
+}
+
+// challengeUsable reports whether a login challenge may still be answered.
+func challengeUsable(challenge *LoginChallenge, now time.Time) bool {
+	return challenge.ExpiresAt.After(now) && challenge.Attempts < maxChallengeAttempts
+}
+
+// EnrollWithChallenge lets a user whose role requires two-factor
+// authentication enrol in the middle of logging in.
+func (s *TwoFactorService) EnrollWithChallenge(token string) (*TwoFactorEnrolment, error) {
+	challenge, err := s.getChallenge(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.Enroll(challenge.Username)
+}
+
+// CompleteLogin answers a login challenge with a TOTP or recovery code and
+// starts the session. When the user enrolled during the login, the code
+// confirms the new secret and their recovery codes are returned too.
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, token string, code string, client LoginClient) (*TwoFactorLoginResponse, error) {
+	now := time.Now()
+	challenge, err := s.getChallenge(token, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.guard.Check(ctx, challenge.Username, client, now)
+	if err != nil {
+		reason := FailedLoginThrottled
+		if errors.Is(err, ErrAccountLocked) {
+			reason = FailedLoginLocked
+		}
+		s.guard.RecordFailure(ctx, challenge.Username, client, reason, now)
+		return nil, err
+	}
+
+	user, err := s.userRepository.FindByUsername(challenge.Username)
+	if err != nil {
+		return nil, ErrInvalidLoginChallenge
+	}
+	if user.IsBlockedAt(now) {
+		return nil, ErrUserBanned
+	}
+
+	// The attempt is counted on the locked challenge before the code is
+	// checked, and a wrong code still commits it, so concurrent guesses
+	// cannot get past maxChallengeAttempts.
+	var recoveryCodes []string
+	var codeErr error
+	err = s.repository.Transaction(func(repo *TwoFactorRepository) error {
+		locked, err := repo.LockChallenge(challenge.TokenHash)
+		if err != nil {
+			return err
+		}
+		if !challengeUsable(locked, now) {
+			return ErrInvalidLoginChallenge
+		}
+		err = repo.CountChallengeAttempt(locked.TokenHash)
+		if err != nil {
+			return err
+		}
+
+		secret, err := repo.FindSecret(user.Username)
+		if err != nil {
+			return err
+		}
+		if secret != nil && secret.ConfirmedAt == nil {
+			recoveryCodes, codeErr = s.confirm(repo, user.Username, code, now)
+		} else {
+			codeErr = s.verify(repo, user.Username, code, true, now)
+		}
+		if errors.Is(codeErr, ErrInvalidTwoFactorCode) {
+			return nil
+		}
+		if codeErr != nil {
+			return codeErr
+		}
+		return repo.DeleteChallenge(locked.TokenHash)
+	})
+	if err == nil {
+		err = codeErr
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.guard.RecordFailure(ctx, user.Username, client, FailedLoginInvalidCode, now)
+		}
+		return nil, err
+	}
+
+	s.guard.RecordSuccess(ctx, user.Username)
+	tokens, err := s.sessions.StartSession(user)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorLoginResponse{JWTResponse: tokens, RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *TwoFactorService) GetPolicies() ([]TwoFactorPolicy, error) {
+	return s.repository.FindPolicies()
+}
+
+// SetPolicy makes two-factor authentication required or optional for a
+// role.
+func (s *TwoFactorService) SetPolicy(role string, required bool, admin string) (*TwoFactorPolicy, error) {
+	exists, err := s.roles.Exists(role)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrRoleNotFound
+	}
+
+	policy := &TwoFactorPolicy{
+		Role:      role,
+		Required:  required,
+		UpdatedBy: admin,
+		UpdatedAt: time.Now(),
+	}
+	err = s.repository.SavePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	authLogger.InfoWithFields("Two-factor policy changed", map[string]interface{}{
+		"role":     role,
+		"required": required,
+		"admin":    admin,
+	})
+	return policy, nil
+}
+
+// StartCleanup removes expired login challenges every interval.
+func (s *TwoFactorService) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.repository.DeleteExpiredChallenges(time.Now())
+		if err != nil {
+			authLogger.Error("Failed to delete expired login challenges", err)
+			continue
+		}
+		if deleted > 0 {
+			authLogger.InfoWithFields("Deleted expired login challenges", map[string]interface{}{
+				"count": deleted,
+			})
+		}
+	}
+}
@@ -3,7 +3,14 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"authz"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -73,9 +80,19 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString, err := h.service.AuthenticateUser(loginReq.Username, loginReq.Password)
+	client := LoginClient{IP: clientIP(r), UserAgent: r.UserAgent()}
+	tokens, err := h.service.AuthenticateUser(loginReq.Username, loginReq.Password, client)
 	if err != nil {
-		if errors.Is(err, ErrInvalidCredentials) {
+		var throttled *LoginThrottledError
+		if errors.As(err, &throttled) {
+			authLogger.Warn("Login refused: " + err.Error() + " for user " + loginReq.Username + " from " + client.IP)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			if errors.Is(err, ErrAccountLocked) {
+				http.Error(w, err.Error(), http.StatusLocked)
+			} else {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+			}
+		} else if errors.Is(err, ErrInvalidCredentials) {
 			// recordLoginFailure() // UKLONJENO - nema metrics
 			authLogger.Warn("Login failed: invalid credentials for user " + loginReq.Username)
 			http.Error(w, err.Error(), http.StatusUnauthorized)
@@ -91,21 +108,27 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Record successful login
-	// recordLoginSuccess() // UKLONJENO - nema metrics
-	authLogger.InfoWithFields("User logged in successfully", map[string]interface{}{
-		"username": loginReq.Username,
-	})
+	if tokens.TwoFactorChallenge != nil {
+		authLogger.InfoWithFields("Two-factor challenge issued", map[string]interface{}{
+			"username":           loginReq.Username,
+			"enrolment_required": tokens.EnrolmentRequired,
+		})
+	} else {
+		// Record successful login
+		// recordLoginSuccess() // UKLONJENO - nema metrics
+		authLogger.InfoWithFields("User logged in successfully", map[string]interface{}{
+			"username": loginReq.Username,
+		})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(JWTResponse{Token: tokenString})
+	json.NewEncoder(w).Encode(tokens)
 }
 
 func (h *UserHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	userRole := r.Header.Get("x-user-role")
-	if userRole != "admin" {
-		http.Error(w, "unauthorized: Only admins can view all users", http.StatusForbidden)
+	if !authz.Has(r, authz.UserRead) {
+		http.Error(w, "forbidden: requires permission "+authz.UserRead, http.StatusForbidden)
 		return
 	}
 
@@ -121,9 +144,8 @@ func (h *UserHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *UserHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
-	userRole := r.Header.Get("x-user-role")
-	if userRole != "admin" {
-		http.Error(w, "unauthorized: Only admins can block users", http.StatusForbidden)
+	if !authz.Has(r, authz.UserBlock) {
+		http.Error(w, "forbidden: requires permission "+authz.UserBlock, http.StatusForbidden)
 		return
 	}
 
@@ -139,17 +161,176 @@ func (h *UserHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.service.BlockUser(blockReq.Username)
+	err = h.service.BlockUser(blockReq.Username, blockReq.Reason, blockReq.ExpiresAt, r.Header.Get("x-username"))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else if errors.Is(err, ErrAlreadyBlocked) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else if errors.Is(err, ErrCannotBlockSelf) || errors.Is(err, ErrInvalidBlockExpiry) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "error blocking user: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.UserBlock) {
+		http.Error(w, "forbidden: requires permission "+authz.UserBlock, http.StatusForbidden)
+		return
+	}
+
+	var unblockReq UnblockUserRequest
+	err := json.NewDecoder(r.Body).Decode(&unblockReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(unblockReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.UnblockUser(unblockReq.Username, unblockReq.Reason, r.Header.Get("x-username"))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else if errors.Is(err, ErrNotBlocked) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, "error unblocking user: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// UnlockUser lifts the lockout of an account after failed logins.
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.UserUnlock) {
+		http.Error(w, "forbidden: requires permission "+authz.UserUnlock, http.StatusForbidden)
+		return
+	}
+
+	var unlockReq UnlockUserRequest
+	err := json.NewDecoder(r.Body).Decode(&unlockReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(unlockReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.UnlockUser(unlockReq.Username, r.Header.Get("x-username"))
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			http.Error(w, err.Error(), http.StatusNotFound)
 		} else {
-			http.Error(w, "error toggling user block status: "+err.Error(), http.StatusInternalServerError)
+			http.Error(w, "error unlocking user: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetFailedLogins lists the newest failed logins for admins, filtered by
+// ?username= and ?ip=, at most ?limit= (default 100, at most 1000).
+func (h *UserHandler) GetFailedLogins(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.LoginAudit) {
+		http.Error(w, "forbidden: requires permission "+authz.LoginAudit, http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	attempts, err := h.service.GetFailedLogins(query.Get("username"), query.Get("ip"), limit)
+	if err != nil {
+		http.Error(w, "error retrieving failed logins", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(attempts)
+}
+
+// GetAdminActions lists the newest admin actions on accounts, filtered by
+// ?target=, ?admin=, ?action= and ?since= (RFC 3339), at most ?limit=
+// (default 100, at most 1000). Whoever can list users can see what was
+// done to them.
+func (h *UserHandler) GetAdminActions(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.UserRead) {
+		http.Error(w, "forbidden: requires permission "+authz.UserRead, http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := AdminActionFilter{
+		Target: query.Get("target"),
+		Admin:  query.Get("admin"),
+		Action: query.Get("action"),
+		Limit:  100,
+	}
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
 		}
+		filter.Limit = parsed
+	}
+	if value := query.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		filter.Since = &since
+	}
+
+	actions, err := h.service.GetAdminActions(filter)
+	if err != nil {
+		http.Error(w, "error retrieving admin actions", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(actions)
+}
+
+// clientIP is the address a request came from. The gateway appends the
+// address it received the request from to X-Forwarded-For, so only the
+// last entry can be trusted.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		parts := strings.Split(forwarded, ",")
+		return strings.TrimSpace(parts[len(parts)-1])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 func (h *UserHandler) Ping(w http.ResponseWriter, _ *http.Request) {
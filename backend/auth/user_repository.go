@@ -2,6 +2,7 @@ package main
 
 import (
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -10,6 +11,19 @@ type UserRepository struct {
 	database *gorm.DB
 }
 
+// Transaction runs fn with a repository bound to a single transaction.
+func (r *UserRepository) Transaction(fn func(repo *UserRepository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		return fn(&UserRepository{database: tx})
+	})
+}
+
+// Audit returns the admin audit repository on the same connection or
+// transaction.
+func (r *UserRepository) Audit() *AdminAuditRepository {
+	return &AdminAuditRepository{database: r.database}
+}
+
 func (r *UserRepository) Create(user *User) error {
 	err := r.database.Create(user).Error
 
@@ -40,6 +54,16 @@ func (r *UserRepository) FindByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+func (r *UserRepository) FindByEmail(email string) (*User, error) {
+	var user User
+	err := r.database.Where("email = ?", email).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 func (r *UserRepository) FindAll() ([]*User, error) {
 	var users []*User
 	err := r.database.Find(&users).Error
@@ -48,3 +72,42 @@ func (r *UserRepository) FindAll() ([]*User, error) {
 	}
 	return users, nil
 }
+
+// Block blocks the user unless they already are. It tells whether the user
+// was blocked by this call.
+func (r *UserRepository) Block(username string, reason string, admin string, at time.Time, until *time.Time) (bool, error) {
+	result := r.database.Model(&User{}).
+		Where("username = ? AND (is_blocked = ? OR blocked_until <= ?)", username, false, at).
+		Updates(map[string]interface{}{
+			"is_blocked":    true,
+			"block_reason":  reason,
+			"blocked_by":    admin,
+			"blocked_at":    at,
+			"blocked_until": until,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Unblock lifts the block of the user. With expiredBy set, only a block
+// that expired by then is lifted. It tells whether a block was lifted.
+func (r *UserRepository) Unblock(username string, expiredBy *time.Time) (bool, error) {
+	query := r.database.Model(&User{}).Where("username = ? AND is_blocked = ?", username, true)
+	if expiredBy != nil {
+		query = query.Where("blocked_until <= ?", *expiredBy)
+	}
+	result := query.Updates(map[string]interface{}{
+		"is_blocked":    false,
+		"block_reason":  "",
+		"blocked_by":    "",
+		"blocked_at":    nil,
+		"blocked_until": nil,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindExpiredBlocks returns the users whose block expired by now.
+func (r *UserRepository) FindExpiredBlocks(now time.Time) ([]User, error) {
+	users := []User{}
+	err := r.database.Where("is_blocked = ? AND blocked_until <= ?", true, now).Find(&users).Error
+	return users, err
+}
@@ -2,17 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService struct {
-	repository *UserRepository
+	repository   *UserRepository
+	sessions     *SessionService
+	verification *VerificationService
+	guard        *LoginGuard
+	twoFactor    *TwoFactorService
+	audit        *AdminAuditService
 }
 
 func (s *UserService) RegisterUser(req RegisterRequest) error {
@@ -30,6 +38,7 @@ func (s *UserService) RegisterUser(req RegisterRequest) error {
 		Password: string(hashedPassword),
 		Email:    req.Email,
 		Role:     req.Role,
+		Status:   UserStatusPendingVerification,
 	}
 
 	err = s.repository.Create(user)
@@ -37,6 +46,12 @@ func (s *UserService) RegisterUser(req RegisterRequest) error {
 		return err
 	}
 
+	// The user can ask for another mail if this one does not arrive
+	err = s.verification.SendVerification(context.Background(), user)
+	if err != nil {
+		authLogger.Error("Failed to send verification mail to "+user.Username, err)
+	}
+
 	err = s.registerUserInFollowerService(user.Username, user.Role)
 	if err != nil {
 		log.Fatalf("%v", err)
@@ -122,27 +137,86 @@ func (s *UserService) registerUserInStakeholderService(username string) error {
 	return nil
 }
 
-func (s *UserService) AuthenticateUser(username, password string) (string, error) {
+// AuthenticateUser logs a user in. Attempts are refused with a
+// LoginThrottledError while the username or client has to back off after
+// failed ones. Users with two-factor authentication get a challenge
+// instead of a session.
+func (s *UserService) AuthenticateUser(username, password string, client LoginClient) (*LoginResponse, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	err := s.guard.Check(ctx, username, client, now)
+	if err != nil {
+		reason := FailedLoginThrottled
+		if errors.Is(err, ErrAccountLocked) {
+			reason = FailedLoginLocked
+		}
+		s.guard.RecordFailure(ctx, username, client, reason, now)
+		return nil, err
+	}
+
 	user, err := s.repository.FindByUsername(username)
 	if err != nil {
-		return "", ErrInvalidCredentials
+		s.guard.RecordFailure(ctx, username, client, FailedLoginInvalidCredentials, now)
+		return nil, ErrInvalidCredentials
 	}
 
-	if user.IsBlocked {
-		return "", ErrUserBanned
+	if user.IsBlockedAt(now) {
+		s.guard.RecordFailure(ctx, username, client, FailedLoginBlocked, now)
+		return nil, ErrUserBanned
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return "", ErrInvalidCredentials
+		s.guard.RecordFailure(ctx, username, client, FailedLoginInvalidCredentials, now)
+		return nil, ErrInvalidCredentials
 	}
 
-	token, err := CreateJWT(user.Username, user.Role)
+	challenge, err := s.twoFactor.BeginLogin(user)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if challenge != nil {
+		return &LoginResponse{TwoFactorChallenge: challenge}, nil
 	}
 
-	return token, nil
+	s.guard.RecordSuccess(ctx, username)
+	tokens, err := s.sessions.StartSession(user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResponse{JWTResponse: tokens}, nil
+}
+
+// UnlockUser lifts a lockout after failed logins.
+func (s *UserService) UnlockUser(username string, admin string) error {
+	_, err := s.repository.FindByUsername(username)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	err = s.guard.Unlock(context.Background(), username)
+	if err != nil {
+		return err
+	}
+
+	// The lockout lives in the attempt counter, outside the user's
+	// transaction, so the unlock is reported as failed if it cannot be
+	// recorded
+	action := &AdminAction{
+		Action: AdminActionUnlock,
+		Target: username,
+		Admin:  admin,
+	}
+	err = s.audit.Record(s.repository.Audit(), action)
+	if err != nil {
+		return err
+	}
+	s.audit.Log(action)
+	return nil
+}
+
+func (s *UserService) GetFailedLogins(username string, ip string, limit int) ([]FailedLogin, error) {
+	return s.guard.GetFailedLogins(username, ip, limit)
 }
 
 func (s *UserService) GetAllUsers() ([]*User, error) {
@@ -153,17 +227,131 @@ func (s *UserService) GetAllUsers() ([]*User, error) {
 	return users, nil
 }
 
-func (s *UserService) BlockUser(username string) error {
-	user, err := s.repository.FindByUsername(username)
+// BlockUser blocks a user for the reason, until the time when it is set
+// and for good otherwise. A blocked user is logged out everywhere.
+func (s *UserService) BlockUser(username string, reason string, until *time.Time, admin string) error {
+	if username == admin {
+		return ErrCannotBlockSelf
+	}
+	now := time.Now()
+	if until != nil && !until.After(now) {
+		return ErrInvalidBlockExpiry
+	}
+	_, err := s.repository.FindByUsername(username)
 	if err != nil {
 		return ErrUserNotFound
 	}
 
-	user.IsBlocked = !user.IsBlocked
-	err = s.repository.Update(user)
+	action := &AdminAction{
+		Action:    AdminActionBlock,
+		Target:    username,
+		Admin:     admin,
+		Reason:    reason,
+		ExpiresAt: until,
+		CreatedAt: now,
+	}
+	err = s.repository.Transaction(func(repo *UserRepository) error {
+		blocked, err := repo.Block(username, reason, admin, now, until)
+		if err != nil {
+			return err
+		}
+		if !blocked {
+			return ErrAlreadyBlocked
+		}
+		return s.audit.Record(repo.Audit(), action)
+	})
 	if err != nil {
 		return err
 	}
+	s.audit.Log(action)
+
+	return s.sessions.RevokeUserSessions(username)
+}
+
+// UnblockUser lifts the block of a user before it expires.
+func (s *UserService) UnblockUser(username string, reason string, admin string) error {
+	user, err := s.repository.FindByUsername(username)
+	if err != nil {
+		return ErrUserNotFound
+	}
 
+	action := &AdminAction{
+		Action:  AdminActionUnblock,
+		Target:  username,
+		Admin:   admin,
+		Reason:  reason,
+		Details: blockDetails(user),
+	}
+	err = s.repository.Transaction(func(repo *UserRepository) error {
+		unblocked, err := repo.Unblock(username, nil)
+		if err != nil {
+			return err
+		}
+		if !unblocked {
+			return ErrNotBlocked
+		}
+		return s.audit.Record(repo.Audit(), action)
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Log(action)
 	return nil
 }
+
+// blockDetails describes the block an unblock lifts.
+func blockDetails(user *User) string {
+	if user.BlockedBy == "" {
+		return ""
+	}
+	return "blocked by " + user.BlockedBy + ": " + user.BlockReason
+}
+
+// liftExpiredBlocks unblocks the users whose block expired.
+func (s *UserService) liftExpiredBlocks(now time.Time) {
+	users, err := s.repository.FindExpiredBlocks(now)
+	if err != nil {
+		authLogger.Error("Failed to find expired blocks", err)
+		return
+	}
+	for _, user := range users {
+		action := &AdminAction{
+			Action:  AdminActionUnblock,
+			Target:  user.Username,
+			Admin:   SystemActor,
+			Reason:  "block expired",
+			Details: blockDetails(&user),
+		}
+		unblocked := false
+		err := s.repository.Transaction(func(repo *UserRepository) error {
+			var err error
+			unblocked, err = repo.Unblock(user.Username, &now)
+			if err != nil || !unblocked {
+				return err
+			}
+			return s.audit.Record(repo.Audit(), action)
+		})
+		if err != nil {
+			authLogger.Error("Failed to lift expired block of "+user.Username, err)
+			continue
+		}
+		if unblocked {
+			s.audit.Log(action)
+		}
+	}
+}
+
+// StartCleanup lifts expired blocks every interval. Logins already ignore
+// them before that.
+func (s *UserService) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.liftExpiredBlocks(time.Now())
+	}
+}
+
+func (s *UserService) GetAdminActions(filter AdminActionFilter) ([]AdminAction, error) {
+	return s.audit.Find(filter)
+}
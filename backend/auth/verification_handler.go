@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type VerificationHandler struct {
+	service *VerificationService
+}
+
+// VerifyEmail activates the account a verification token was mailed for.
+// The caller needs a new access token, e.g. from /refresh, before it shows
+// the email as verified.
+func (h *VerificationHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var verifyReq VerifyEmailRequest
+	err := json.NewDecoder(r.Body).Decode(&verifyReq)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(verifyReq); err != nil {
+		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username, err := h.service.VerifyEmail(verifyReq.Token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidVerificationToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			authLogger.Error("Email verification failed", err)
+			http.Error(w, "error verifying email: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(VerifyEmailResponse{Username: username, Status: UserStatusActive})
+}
+
+// ResendVerification mails the caller a new verification link. Too many
+// requests are answered with 429 and a Retry-After header.
+func (h *VerificationHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	retryAfter, err := h.service.ResendVerification(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, ErrVerificationResendLimit) {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		} else if errors.Is(err, ErrAlreadyVerified) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			authLogger.Error("Resending verification mail failed", err)
+			http.Error(w, "error sending verification email: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// MarkVerified activates a user without a mailed token. It is internal,
+// for the seeder.
+func (h *VerificationHandler) MarkVerified(w http.ResponseWriter, r *http.Request) {
+	err := h.service.MarkVerified(mux.Vars(r)["username"])
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "error verifying user: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
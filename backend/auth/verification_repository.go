@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type VerificationRepository struct {
+	database *gorm.DB
+}
+
+// Transaction runs fn with a repository bound to a single transaction.
+func (r *VerificationRepository) Transaction(fn func(repo *VerificationRepository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		return fn(&VerificationRepository{database: tx})
+	})
+}
+
+func (r *VerificationRepository) CreateToken(token *EmailVerificationToken) error {
+	return r.database.Create(token).Error
+}
+
+// LockToken loads a verification token by its hash and locks it until the
+// transaction ends, so that a token can only be used once.
+func (r *VerificationRepository) LockToken(tokenHash string) (*EmailVerificationToken, error) {
+	var token EmailVerificationToken
+	err := r.database.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseTokens marks every unused verification token of the user as used.
+func (r *VerificationRepository) UseTokens(username string, at time.Time) error {
+	return r.database.Model(&EmailVerificationToken{}).
+		Where("username = ? AND used_at IS NULL", username).
+		Update("used_at", at).Error
+}
+
+// FindSentSince returns the verification tokens sent to the user after
+// since, newest first.
+func (r *VerificationRepository) FindSentSince(username string, since time.Time) ([]EmailVerificationToken, error) {
+	var tokens []EmailVerificationToken
+	err := r.database.Where("username = ? AND created_at > ?", username, since).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *VerificationRepository) UpdateUserStatus(username string, status string) error {
+	return r.database.Model(&User{}).Where("username = ?", username).Update("status", status).Error
+}
+
+// DeleteExpiredTokens removes verification tokens that have expired.
+func (r *VerificationRepository) DeleteExpiredTokens(now time.Time) (int64, error) {
+	result := r.database.Where("expires_at < ?", now).Delete(&EmailVerificationToken{})
+	return result.RowsAffected, result.Error
+}
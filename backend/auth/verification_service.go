@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxVerificationMailsPerHour caps how many verification mails a user can
+// get within an hour, on top of the wait between two of them.
+const maxVerificationMailsPerHour = 5
+
+// VerificationService confirms the emails of newly registered users. A
+// user stays pending_verification until they open the link mailed to them.
+type VerificationService struct {
+	repository     *VerificationRepository
+	userRepository *UserRepository
+	mailer         Mailer
+}
+
+// verificationTokenLifetime is how long a verification link works, from
+// EMAIL_VERIFICATION_TOKEN_EXPIRATION.
+func verificationTokenLifetime() (time.Duration, error) {
+	return time.ParseDuration(GetEnvOrDefault("EMAIL_VERIFICATION_TOKEN_EXPIRATION", "48h"))
+}
+
+// verificationResendInterval is how long a user has to wait before another
+// verification mail, from EMAIL_VERIFICATION_RESEND_INTERVAL.
+func verificationResendInterval() (time.Duration, error) {
+	return time.ParseDuration(GetEnvOrDefault("EMAIL_VERIFICATION_RESEND_INTERVAL", "1m"))
+}
+
+// SendVerification mails the user a new verification link. Links sent
+// before keep working until they expire.
+func (s *VerificationService) SendVerification(ctx context.Context, user *User) error {
+	lifetime, err := verificationTokenLifetime()
+	if err != nil {
+		return err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.CreateToken(&EmailVerificationToken{
+		Username:  user.Username,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(lifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := GetEnvOrDefault("EMAIL_VERIFICATION_URL", "http://localhost:3000/verify-email") + "?token=" + token
+	err = s.mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Confirm your Tour Discoverer email",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to Tour Discoverer! Confirm your email with the link below to publish and buy tours. It expires in %s.\n\n%s",
+			user.Username, lifetime, link),
+	})
+	if err != nil {
+		return fmt.Errorf("sending verification mail via %s: %w", s.mailer.Name(), err)
+	}
+
+	authLogger.InfoWithFields("Verification mail sent", map[string]interface{}{
+		"username": user.Username,
+	})
+	return nil
+}
+
+// ResendVerification mails a pending user a new verification link. When
+// the user has to wait, it returns ErrVerificationResendLimit and how long.
+func (s *VerificationService) ResendVerification(ctx context.Context, username string) (time.Duration, error) {
+	user, err := s.userRepository.FindByUsername(username)
+	if err != nil {
+		return 0, ErrUserNotFound
+	}
+	if user.IsVerified() {
+		return 0, ErrAlreadyVerified
+	}
+
+	interval, err := verificationResendInterval()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	sent, err := s.repository.FindSentSince(username, now.Add(-time.Hour))
+	if err != nil {
+		return 0, err
+	}
+	if len(sent) > 0 {
+		if wait := sent[0].CreatedAt.Add(interval).Sub(now); wait > 0 {
+			return wait, ErrVerificationResendLimit
+		}
+	}
+	if len(sent) >= maxVerificationMailsPerHour {
+		oldest := sent[maxVerificationMailsPerHour-1]
+		return oldest.CreatedAt.Add(time.Hour).Sub(now), ErrVerificationResendLimit
+	}
+
+	return 0, s.SendVerification(ctx, user)
+}
+
+// VerifyEmail activates the user a verification token was sent to. The
+// token and any other outstanding ones of the user are used up.
+func (s *VerificationService) VerifyEmail(token string) (string, error) {
+	now := time.Now()
+	var username string
+	err := s.repository.Transaction(func(repo *VerificationRepository) error {
+		verification, err := repo.LockToken(hashToken(token))
+		if err != nil {
+			return err
+		}
+		if verification.UsedAt != nil || !verification.ExpiresAt.After(now) {
+			return ErrInvalidVerificationToken
+		}
+
+		err = repo.UpdateUserStatus(verification.Username, UserStatusActive)
+		if err != nil {
+			return err
+		}
+		username = verification.Username
+		return repo.UseTokens(verification.Username, now)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	authLogger.InfoWithFields("Email verified", map[string]interface{}{
+		"username": username,
+	})
+	return username, nil
+}
+
+// MarkVerified activates a user without a verification token, for users
+// created by the seeder.
+func (s *VerificationService) MarkVerified(username string) error {
+	_, err := s.userRepository.FindByUsername(username)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	return s.repository.Transaction(func(repo *VerificationRepository) error {
+		err := repo.UpdateUserStatus(username, UserStatusActive)
+		if err != nil {
+			return err
+		}
+		return repo.UseTokens(username, time.Now())
+	})
+}
+
+// StartCleanup removes expired verification tokens every interval.
+func (s *VerificationService) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.repository.DeleteExpiredTokens(time.Now())
+		if err != nil {
+			authLogger.Error("Failed to delete expired verification tokens", err)
+			continue
+		}
+		if deleted > 0 {
+			authLogger.InfoWithFields("Deleted expired verification tokens", map[string]interface{}{
+				"count": deleted,
+			})
+		}
+	}
+}
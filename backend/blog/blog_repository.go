@@ -38,6 +38,34 @@ func (r *BlogRepository) GetAll() ([]Blog, error) {
 	return blogs, nil
 }
 
+// GetByAuthor returns the blogs the user wrote.
+func (r *BlogRepository) GetByAuthor(author string) ([]Blog, error) {
+	return r.find(bson.M{"author": author})
+}
+
+// GetLikedBy returns the blogs the user liked.
+func (r *BlogRepository) GetLikedBy(username string) ([]Blog, error) {
+	return r.find(bson.M{"likes": username})
+}
+
+func (r *BlogRepository) find(filter bson.M) ([]Blog, error) {
+	cursor, err := r.collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	blogs := []Blog{}
+	for cursor.Next(context.Background()) {
+		var blog Blog
+		if err := cursor.Decode(&blog); err != nil {
+			return nil, err
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, nil
+}
+
 func (r *BlogRepository) GetByID(id string) (*Blog, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -57,6 +57,14 @@ func (s *BlogService) GetAllBlogs(username string) ([]Blog, error) {
 	return filteredBlogs, nil
 }
 
+func (s *BlogService) GetBlogsByAuthor(author string) ([]Blog, error) {
+	return s.repository.GetByAuthor(author)
+}
+
+func (s *BlogService) GetLikedBlogs(username string) ([]Blog, error) {
+	return s.repository.GetLikedBy(username)
+}
+
 func (s *BlogService) GetBlogByID(id string) (*Blog, error) {
 	return s.repository.GetByID(id)
 }
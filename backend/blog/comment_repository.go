@@ -35,3 +35,22 @@ func (r *CommentRepository) GetByBlogID(blogID string) ([]Comment, error) {
 	}
 	return comments, nil
 }
+
+// GetByAuthor returns the comments the user wrote, on any blog.
+func (r *CommentRepository) GetByAuthor(author string) ([]Comment, error) {
+	cursor, err := r.collection.Find(context.Background(), map[string]interface{}{"author": author})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	comments := []Comment{}
+	for cursor.Next(context.Background()) {
+		var comment Comment
+		if err := cursor.Decode(&comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
@@ -11,3 +11,7 @@ func (s *CommentService) CreateComment(comment *Comment) error {
 func (s *CommentService) GetComments(blogID string) ([]Comment, error) {
 	return s.repository.GetByBlogID(blogID)
 }
+
+func (s *CommentService) GetCommentsByAuthor(author string) ([]Comment, error) {
+	return s.repository.GetByAuthor(author)
+}
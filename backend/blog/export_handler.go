@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// UserDataExport is the blog service's part of a user's data export: the
+// blogs and comments they wrote and the IDs of the blogs they liked.
+type UserDataExport struct {
+	Username     string    `json:"username"`
+	Blogs        []Blog    `json:"blogs"`
+	Comments     []Comment `json:"comments"`
+	LikedBlogIDs []string  `json:"liked_blog_ids"`
+}
+
+type ExportHandler struct {
+	blogService    *BlogService
+	commentService *CommentService
+}
+
+// ExportUserData returns the user's blog data for the data export. Internal
+// only: the username comes from the calling service, not a token.
+func (h *ExportHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	blogs, err := h.blogService.GetBlogsByAuthor(username)
+	if err != nil {
+		http.Error(w, "failed to fetch blogs", http.StatusInternalServerError)
+		return
+	}
+	comments, err := h.commentService.GetCommentsByAuthor(username)
+	if err != nil {
+		http.Error(w, "failed to fetch comments", http.StatusInternalServerError)
+		return
+	}
+	liked, err := h.blogService.GetLikedBlogs(username)
+	if err != nil {
+		http.Error(w, "failed to fetch liked blogs", http.StatusInternalServerError)
+		return
+	}
+
+	likedIDs := make([]string, len(liked))
+	for i, blog := range liked {
+		likedIDs[i] = blog.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserDataExport{
+		Username:     username,
+		Blogs:        blogs,
+		Comments:     comments,
+		LikedBlogIDs: likedIDs,
+	})
+}
@@ -47,6 +47,9 @@ func main() {
 	r.HandleFunc("/comment", commentHandler.CreateComment).Methods(http.MethodPost)
 	r.HandleFunc("/comments", commentHandler.GetComments).Methods(http.MethodGet)
 
+	exportHandler := &ExportHandler{blogService: service, commentService: commentService}
+	r.HandleFunc("/internal/export/{username}", exportHandler.ExportUserData).Methods(http.MethodGet)
+
 	// Pokretanje RPC servera u goroutine
 	rpcServer := NewBlogRPCServer(service)
 	rpcPort := os.Getenv("RPC_PORT")
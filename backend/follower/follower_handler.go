@@ -139,6 +139,26 @@ func (h *FollowerHandler) IsFollowing(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ExportUserData returns who the user follows and who follows them, for the
+// user's data export.
+func (h *FollowerHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	followers, err := h.service.GetFollowers(username)
+	if err != nil {
+		http.Error(w, "error retrieving followers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	following, err := h.service.GetFollowing(username)
+	if err != nil {
+		http.Error(w, "error retrieving following: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserDataExport{Username: username, Followers: followers, Following: following})
+}
+
 func (h *FollowerHandler) Ping(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
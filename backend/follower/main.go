@@ -31,6 +31,7 @@ func main() {
 
 	r.HandleFunc("/internal/user", handler.CreateUser).Methods(http.MethodPost)
 	r.HandleFunc("/internal/ping", handler.Ping).Methods(http.MethodGet)
+	r.HandleFunc("/internal/export/{username}", handler.ExportUserData).Methods(http.MethodGet)
 
 	port := os.Getenv("PORT")
 	if port == "" {
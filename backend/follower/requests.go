@@ -19,3 +19,9 @@ type UnfollowUserRequest struct {
 	Follower string `json:"follower" validate:"required"`
 	Followee string `json:"followee" validate:"required"`
 }
+
+type UserDataExport struct {
+	Username  string `json:"username"`
+	Followers []User `json:"followers"`
+	Following []User `json:"following"`
+}
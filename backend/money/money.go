@@ -0,0 +1,25 @@
+// Package money holds what the services must agree on about amounts in
+// minor units, so that a price converted by one service means the same in
+// another.
+//
+// The package is its own module, which the services require through a
+// replace directive pointing at this directory.
+package money
+
+// Exponents lists the currencies whose minor unit is not 1/100.
+var Exponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"HUF": 2,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+// MinorUnitExponent is the number of decimal places of the currency's minor
+// unit.
+func MinorUnitExponent(currency string) int {
+	if exponent, ok := Exponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
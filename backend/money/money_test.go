@@ -0,0 +1,25 @@
+package money
+
+import "testing"
+
+func TestMinorUnitExponent(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     int
+	}{
+		{"EUR", 2},
+		{"USD", 2},
+		{"HUF", 2},
+		{"JPY", 0},
+		{"KRW", 0},
+		{"BHD", 3},
+		{"KWD", 3},
+		{"", 2},
+	}
+
+	for _, test := range tests {
+		if got := MinorUnitExponent(test.currency); got != test.want {
+			t.Errorf("MinorUnitExponent(%q) = %d, want %d", test.currency, got, test.want)
+		}
+	}
+}
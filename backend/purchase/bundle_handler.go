@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"authz"
+
+	"github.com/gorilla/mux"
+)
+
+type BundleHandler struct {
+	service *BundleService
+}
+
+func NewBundleHandler(service *BundleService) *BundleHandler {
+	return &BundleHandler{service: service}
+}
+
+func (h *BundleHandler) CreateBundle(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	if !authz.Has(r, authz.BundleWrite) {
+		h.sendErrorResponse(w, "You are not allowed to create bundles", http.StatusForbidden)
+		return
+	}
+
+	var request CreateBundleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	bundle, err := h.service.CreateBundle(&request, username)
+	if err != nil {
+		h.handleBundleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(BundleResponse{Bundle: bundle, Message: "Bundle created successfully"})
+}
+
+// GetBundles lists bundles on sale, filtered by guide with ?author=.
+func (h *BundleHandler) GetBundles(w http.ResponseWriter, r *http.Request) {
+	bundles, err := h.service.GetBundles(r.URL.Query().Get("author"))
+	if err != nil {
+		h.handleBundleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(BundlesResponse{Bundles: bundles, Message: "Bundles retrieved successfully"})
+}
+
+func (h *BundleHandler) GetBundle(w http.ResponseWriter, r *http.Request) {
+	bundleID, err := strconv.ParseUint(mux.Vars(r)["bundleId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid bundle ID", http.StatusBadRequest)
+		return
+	}
+
+	bundle, err := h.service.GetBundle(uint(bundleID))
+	if err != nil {
+		h.handleBundleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(BundleResponse{Bundle: bundle, Message: "Bundle retrieved successfully"})
+}
+
+func (h *BundleHandler) ArchiveBundle(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	bundleID, err := strconv.ParseUint(mux.Vars(r)["bundleId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid bundle ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.ArchiveBundle(uint(bundleID), username, authz.Has(r, authz.BundleManage))
+	if err != nil {
+		h.handleBundleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bundle archived successfully"})
+}
+
+func (h *BundleHandler) handleBundleError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrUnauthorized:
+		h.sendErrorResponse(w, "Only the guide who authored the tours can manage this bundle", http.StatusForbidden)
+	case ErrBundleNotFound:
+		h.sendErrorResponse(w, "Bundle not found", http.StatusNotFound)
+	case ErrInvalidBundle:
+		h.sendErrorResponse(w, "A bundle needs a name, a price and at least two tours priced in the same currency", http.StatusBadRequest)
+	case ErrTourNotPublished:
+		h.sendErrorResponse(w, "Only published tours can be bundled", http.StatusBadRequest)
+	default:
+		h.sendErrorResponse(w, "Bundle operation failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *BundleHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
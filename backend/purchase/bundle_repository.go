@@ -0,0 +1,51 @@
+package main
+
+import (
+	"gorm.io/gorm"
+)
+
+type BundleRepository struct {
+	database *Database
+}
+
+func NewBundleRepository(db *Database) *BundleRepository {
+	return &BundleRepository{database: db}
+}
+
+// CreateBundle stores the bundle together with its tours.
+func (r *BundleRepository) CreateBundle(bundle *Bundle) error {
+	result := r.database.db.Create(bundle)
+	return result.Error
+}
+
+func (r *BundleRepository) GetBundleByID(id uint) (*Bundle, error) {
+	var bundle Bundle
+	result := r.database.db.Preload("Tours").Where("id = ?", id).First(&bundle)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrBundleNotFound
+		}
+		return nil, result.Error
+	}
+	return &bundle, nil
+}
+
+// GetActiveBundles lists the bundles on sale, optionally only those of one
+// guide when author is not empty.
+func (r *BundleRepository) GetActiveBundles(author string) ([]Bundle, error) {
+	var bundles []Bundle
+	query := r.database.db.Preload("Tours").Where("status = ?", BundleStatusActive)
+	if author != "" {
+		query = query.Where("author_username = ?", author)
+	}
+	result := query.Order("created_at DESC").Find(&bundles)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return bundles, nil
+}
+
+func (r *BundleRepository) UpdateBundleStatus(bundleID uint, status string) error {
+	result := r.database.db.Model(&Bundle{}).Where("id = ?", bundleID).Update("status", status)
+	return result.Error
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+)
+
+type BundleService struct {
+	bundleRepository *BundleRepository
+}
+
+func NewBundleService(bundleRepo *BundleRepository) *BundleService {
+	return &BundleService{bundleRepository: bundleRepo}
+}
+
+// CreateBundle groups published tours of the guide into a bundle and splits
+// the bundle price across them in proportion to their current prices. All
+// tours must be priced in the same currency, which the bundle price is in.
+func (s *BundleService) CreateBundle(request *CreateBundleRequest, username string) (*Bundle, error) {
+	name := strings.TrimSpace(request.Name)
+	if name == "" || request.Price <= 0 {
+		return nil, ErrInvalidBundle
+	}
+
+	seen := make(map[uint]bool)
+	var tourIDs []uint
+	for _, tourID := range request.TourIDs {
+		if !seen[tourID] {
+			seen[tourID] = true
+			tourIDs = append(tourIDs, tourID)
+		}
+	}
+	if len(tourIDs) < 2 {
+		return nil, ErrInvalidBundle
+	}
+
+	bundle := &Bundle{
+		Name:           name,
+		Description:    request.Description,
+		AuthorUsername: username,
+		Price:          request.Price,
+		Status:         BundleStatusActive,
+	}
+
+	var weights []int64
+	for _, tourID := range tourIDs {
+		tourInfo, err := fetchTourInfo(tourID)
+		if err != nil {
+			return nil, err
+		}
+		if tourInfo.AuthorUsername != username {
+			return nil, ErrUnauthorized
+		}
+		if tourInfo.Status != "published" {
+			return nil, ErrTourNotPublished
+		}
+		if bundle.Currency == "" {
+			bundle.Currency = tourInfo.Currency
+		}
+		if tourInfo.Currency != bundle.Currency {
+			return nil, ErrInvalidBundle
+		}
+
+		bundle.Tours = append(bundle.Tours, BundleTour{
+			TourID:    tourID,
+			TourName:  tourInfo.Name,
+			ListPrice: tourInfo.Price,
+		})
+		weights = append(weights, tourInfo.Price)
+	}
+
+	for i, share := range splitAmount(bundle.Price, weights) {
+		bundle.Tours[i].AllocatedPrice = share
+	}
+
+	err := s.bundleRepository.CreateBundle(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+func (s *BundleService) GetBundles(author string) ([]Bundle, error) {
+	return s.bundleRepository.GetActiveBundles(author)
+}
+
+func (s *BundleService) GetBundle(bundleID uint) (*Bundle, error) {
+	return s.bundleRepository.GetBundleByID(bundleID)
+}
+
+// ArchiveBundle takes a bundle off sale. Only its author can, unless
+// anyBundle is set. Carts that already hold it keep it until checkout, which
+// then rejects it.
+func (s *BundleService) ArchiveBundle(bundleID uint, username string, anyBundle bool) error {
+	bundle, err := s.bundleRepository.GetBundleByID(bundleID)
+	if err != nil {
+		return err
+	}
+
+	if !anyBundle && bundle.AuthorUsername != username {
+		return ErrUnauthorized
+	}
+
+	return s.bundleRepository.UpdateBundleStatus(bundle.ID, BundleStatusArchived)
+}
@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+type CartEventRepository struct {
+	database *Database
+}
+
+func NewCartEventRepository(db *Database) *CartEventRepository {
+	return &CartEventRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *CartEventRepository) WithTx(tx *Database) *CartEventRepository {
+	return &CartEventRepository{database: tx}
+}
+
+func (r *CartEventRepository) CreateEvent(event *CartEvent) error {
+	result := r.database.db.Create(event)
+	return result.Error
+}
+
+// GetUnpublishedEvents returns up to limit events still waiting for
+// delivery, oldest first.
+func (r *CartEventRepository) GetUnpublishedEvents(limit int) ([]CartEvent, error) {
+	var events []CartEvent
+	result := r.database.db.Where("published_at IS NULL").Order("id").Limit(limit).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+func (r *CartEventRepository) MarkPublished(eventID uint, at time.Time) error {
+	result := r.database.db.Model(&CartEvent{}).Where("id = ?", eventID).Update("published_at", at)
+	return result.Error
+}
@@ -54,16 +54,7 @@ func (h *CartHandler) AddToCart(w http.ResponseWriter, r *http.Request) {
 
 	err := h.service.AddToCart(userID, request.TourID)
 	if err != nil {
-		switch err {
-		case ErrTourAlreadyInCart:
-			h.sendErrorResponse(w, "Tour is already in cart", http.StatusConflict)
-		case ErrTourNotPublished:
-			h.sendErrorResponse(w, "Tour is not published", http.StatusBadRequest)
-		case ErrTourArchived:
-			h.sendErrorResponse(w, "Tour is archived and cannot be purchased", http.StatusBadRequest)
-		default:
-			h.sendErrorResponse(w, "Failed to add tour to cart: "+err.Error(), http.StatusInternalServerError)
-		}
+		h.handleAddTourError(w, err)
 		return
 	}
 
@@ -105,6 +96,62 @@ func (h *CartHandler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Tour removed from cart successfully"})
 }
 
+func (h *CartHandler) AddBundleToCart(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	var request AddBundleToCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.AddBundleToCart(userID, request.BundleID)
+	if err != nil {
+		h.handleAddBundleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bundle added to cart successfully"})
+}
+
+func (h *CartHandler) RemoveBundleFromCart(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	bundleID, err := strconv.ParseUint(vars["bundleId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid bundle ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.RemoveBundleFromCart(userID, uint(bundleID))
+	if err != nil {
+		switch err {
+		case ErrCartNotFound:
+			h.sendErrorResponse(w, "Cart not found", http.StatusNotFound)
+		case ErrItemNotFound:
+			h.sendErrorResponse(w, "Bundle not found in cart", http.StatusNotFound)
+		default:
+			h.sendErrorResponse(w, "Failed to remove bundle from cart: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bundle removed from cart successfully"})
+}
+
 func (h *CartHandler) ClearCart(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("x-username")
 	if userID == "" {
@@ -128,8 +175,379 @@ func (h *CartHandler) ClearCart(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Cart cleared successfully"})
 }
 
+func (h *CartHandler) ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	var request ApplyCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.ApplyCoupon(userID, request.Code)
+	if err != nil {
+		switch err {
+		case ErrCartNotFound:
+			h.sendErrorResponse(w, "Cart not found", http.StatusNotFound)
+		case ErrCouponNotFound:
+			h.sendErrorResponse(w, "Coupon not found", http.StatusNotFound)
+		case ErrCouponAlreadyApplied:
+			h.sendErrorResponse(w, "Coupon is already applied to the cart", http.StatusConflict)
+		case ErrCouponUnavailable:
+			h.sendErrorResponse(w, "Coupon is expired or has reached its usage limit", http.StatusBadRequest)
+		case ErrCouponNotApplicable:
+			h.sendErrorResponse(w, "Coupon does not apply to any tour in the cart", http.StatusBadRequest)
+		default:
+			h.sendErrorResponse(w, "Failed to apply coupon: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Coupon applied successfully"})
+}
+
+func (h *CartHandler) RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.service.RemoveCoupon(userID, mux.Vars(r)["code"])
+	if err != nil {
+		switch err {
+		case ErrCartNotFound:
+			h.sendErrorResponse(w, "Cart not found", http.StatusNotFound)
+		case ErrCouponNotFound:
+			h.sendErrorResponse(w, "Coupon is not applied to the cart", http.StatusNotFound)
+		default:
+			h.sendErrorResponse(w, "Failed to remove coupon: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Coupon removed successfully"})
+}
+
+// ========== GUEST CARTS ==========
+// Guest carts belong to the X-Client-ID the browser sends, not to a user.
+
+func (h *CartHandler) GetGuestCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.service.GetGuestCart(r.Header.Get("X-Client-ID"))
+	if err != nil {
+		h.handleGuestCartError(w, err, "Failed to get cart")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CartResponse{Cart: cart, Message: "Cart retrieved successfully"})
+}
+
+func (h *CartHandler) AddToGuestCart(w http.ResponseWriter, r *http.Request) {
+	var request AddToCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.AddToGuestCart(r.Header.Get("X-Client-ID"), request.TourID)
+	if err != nil {
+		h.handleAddTourError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Tour added to cart successfully"})
+}
+
+func (h *CartHandler) RemoveFromGuestCart(w http.ResponseWriter, r *http.Request) {
+	tourID, err := strconv.ParseUint(mux.Vars(r)["tourId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid tour ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.RemoveFromGuestCart(r.Header.Get("X-Client-ID"), uint(tourID))
+	if err != nil {
+		h.handleGuestCartError(w, err, "Failed to remove tour from cart")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Tour removed from cart successfully"})
+}
+
+func (h *CartHandler) AddBundleToGuestCart(w http.ResponseWriter, r *http.Request) {
+	var request AddBundleToCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.AddBundleToGuestCart(r.Header.Get("X-Client-ID"), request.BundleID)
+	if err != nil {
+		h.handleAddBundleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bundle added to cart successfully"})
+}
+
+func (h *CartHandler) RemoveBundleFromGuestCart(w http.ResponseWriter, r *http.Request) {
+	bundleID, err := strconv.ParseUint(mux.Vars(r)["bundleId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid bundle ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.RemoveBundleFromGuestCart(r.Header.Get("X-Client-ID"), uint(bundleID))
+	if err != nil {
+		h.handleGuestCartError(w, err, "Failed to remove bundle from cart")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bundle removed from cart successfully"})
+}
+
+func (h *CartHandler) ClearGuestCart(w http.ResponseWriter, r *http.Request) {
+	err := h.service.ClearGuestCart(r.Header.Get("X-Client-ID"))
+	if err != nil {
+		h.handleGuestCartError(w, err, "Failed to clear cart")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Cart cleared successfully"})
+}
+
+// MergeGuestCart moves the guest cart of the X-Client-ID into the logged in
+// user's cart.
+func (h *CartHandler) MergeGuestCart(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	cart, skipped, err := h.service.MergeGuestCart(userID, r.Header.Get("X-Client-ID"))
+	if err != nil {
+		h.handleGuestCartError(w, err, "Failed to merge cart")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MergeCartResponse{Cart: cart, Skipped: skipped, Message: "Cart merged successfully"})
+}
+
+// ========== SAVED FOR LATER ==========
+
+func (h *CartHandler) SaveForLater(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	tourID, err := strconv.ParseUint(mux.Vars(r)["tourId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid tour ID", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.service.SaveForLater(userID, uint(tourID))
+	if err != nil {
+		h.handleSavedItemError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(SavedItemResponse{SavedItem: saved, Message: "Tour saved for later"})
+}
+
+func (h *CartHandler) SaveBundleForLater(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	bundleID, err := strconv.ParseUint(mux.Vars(r)["bundleId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid bundle ID", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.service.SaveBundleForLater(userID, uint(bundleID))
+	if err != nil {
+		h.handleSavedItemError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(SavedItemResponse{SavedItem: saved, Message: "Bundle saved for later"})
+}
+
+func (h *CartHandler) GetSavedItems(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := h.service.GetSavedItems(userID)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get saved items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(SavedItemsResponse{SavedItems: items, Message: "Saved items retrieved successfully"})
+}
+
+// MoveSavedItemToCart puts a saved item back into the cart at today's price.
+func (h *CartHandler) MoveSavedItemToCart(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	itemID, err := strconv.ParseUint(mux.Vars(r)["itemId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid saved item ID", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.service.MoveToCart(userID, uint(itemID))
+	if err != nil {
+		switch {
+		case saved == nil:
+			h.handleSavedItemError(w, err)
+		case saved.BundleID != nil:
+			h.handleAddBundleError(w, err)
+		default:
+			h.handleAddTourError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Saved item moved to cart"})
+}
+
+func (h *CartHandler) RemoveSavedItem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	itemID, err := strconv.ParseUint(mux.Vars(r)["itemId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid saved item ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.RemoveSavedItem(userID, uint(itemID))
+	if err != nil {
+		h.handleSavedItemError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Saved item removed"})
+}
+
+func (h *CartHandler) handleAddTourError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvalidClientID:
+		h.sendErrorResponse(w, "A valid X-Client-ID header is required", http.StatusBadRequest)
+	case ErrTourAlreadyInCart:
+		h.sendErrorResponse(w, "Tour is already in cart", http.StatusConflict)
+	case ErrTourNotFound:
+		h.sendErrorResponse(w, "Tour not found", http.StatusNotFound)
+	case ErrTourNotPublished:
+		h.sendErrorResponse(w, "Tour is not published", http.StatusBadRequest)
+	case ErrTourArchived:
+		h.sendErrorResponse(w, "Tour is archived and cannot be purchased", http.StatusBadRequest)
+	case ErrUnsupportedCurrency:
+		h.sendErrorResponse(w, "Tour is priced in a currency that cannot be sold", http.StatusBadRequest)
+	default:
+		h.sendErrorResponse(w, "Failed to add tour to cart: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *CartHandler) handleAddBundleError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvalidClientID:
+		h.sendErrorResponse(w, "A valid X-Client-ID header is required", http.StatusBadRequest)
+	case ErrBundleNotFound:
+		h.sendErrorResponse(w, "Bundle not found", http.StatusNotFound)
+	case ErrBundleAlreadyInCart:
+		h.sendErrorResponse(w, "Bundle is already in cart", http.StatusConflict)
+	case ErrTourAlreadyInCart:
+		h.sendErrorResponse(w, "A tour from this bundle is already in cart", http.StatusConflict)
+	case ErrBundleUnavailable:
+		h.sendErrorResponse(w, "Bundle is no longer on sale", http.StatusBadRequest)
+	case ErrTourNotPublished:
+		h.sendErrorResponse(w, "A tour from this bundle is not published", http.StatusBadRequest)
+	case ErrUnsupportedCurrency:
+		h.sendErrorResponse(w, "Bundle is priced in a currency that cannot be sold", http.StatusBadRequest)
+	default:
+		h.sendErrorResponse(w, "Failed to add bundle to cart: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *CartHandler) handleGuestCartError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case ErrInvalidClientID:
+		h.sendErrorResponse(w, "A valid X-Client-ID header is required", http.StatusBadRequest)
+	case ErrCartNotFound:
+		h.sendErrorResponse(w, "Cart not found", http.StatusNotFound)
+	case ErrItemNotFound:
+		h.sendErrorResponse(w, "Item not found in cart", http.StatusNotFound)
+	default:
+		h.sendErrorResponse(w, message+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *CartHandler) handleSavedItemError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrCartNotFound:
+		h.sendErrorResponse(w, "Cart not found", http.StatusNotFound)
+	case ErrItemNotFound:
+		h.sendErrorResponse(w, "Item not found in cart", http.StatusNotFound)
+	case ErrSavedItemNotFound:
+		h.sendErrorResponse(w, "Saved item not found", http.StatusNotFound)
+	default:
+		h.sendErrorResponse(w, "Saved item request failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (h *CartHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
\ No newline at end of file
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// CartLifecycleService looks after carts nobody is using: it records a
+// cart.abandoned event for user carts left with items in them, so that the
+// user can be reminded, and removes carts that have been inactive for too
+// long. Guest carts are kept for a shorter time than user carts. Saved items
+// are not part of the cart and are never removed.
+type CartLifecycleService struct {
+	database        *Database
+	cartRepository  *CartRepository
+	eventRepository *CartEventRepository
+	publisher       EventPublisher
+	reminderAfter   time.Duration
+	cartTTL         time.Duration
+	guestCartTTL    time.Duration
+}
+
+func NewCartLifecycleService(db *Database, cartRepo *CartRepository, eventRepo *CartEventRepository, publisher EventPublisher) *CartLifecycleService {
+	return &CartLifecycleService{
+		database:        db,
+		cartRepository:  cartRepo,
+		eventRepository: eventRepo,
+		publisher:       publisher,
+		reminderAfter:   durationEnv("CART_REMINDER_AFTER", "24h", true),
+		cartTTL:         durationEnv("CART_TTL", "720h", false),
+		guestCartTTL:    durationEnv("GUEST_CART_TTL", "168h", false),
+	}
+}
+
+// Start runs a sweep every interval until ctx is cancelled.
+func (s *CartLifecycleService) Start(ctx context.Context, interval time.Duration) {
+	log.Printf("Cart sweeper running every %s: reminders after %s, carts kept for %s, guest carts for %s",
+		interval, s.reminderAfter, s.cartTTL, s.guestCartTTL)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep removes expired carts, records reminders for abandoned ones and
+// publishes pending cart events. Failures are logged and retried on the
+// next sweep.
+func (s *CartLifecycleService) Sweep(ctx context.Context) {
+	now := time.Now()
+
+	// Expire first so carts about to be removed are not reminded about
+	expired, err := s.ExpireCarts(now)
+	if err != nil {
+		log.Printf("Cart sweep: failed to expire carts: %v", err)
+	}
+
+	reminded, err := s.RemindAbandonedCarts(now)
+	if err != nil {
+		log.Printf("Cart sweep: failed to record reminders: %v", err)
+	}
+
+	published, err := s.PublishPendingEvents(ctx)
+	if err != nil {
+		log.Printf("Cart sweep: failed to publish events: %v", err)
+	}
+
+	if expired > 0 || reminded > 0 || published > 0 {
+		log.Printf("Cart sweep: %d expired, %d abandoned, %d events published", expired, reminded, published)
+	}
+}
+
+// ExpireCarts removes user and guest carts that have been inactive for
+// longer than their time to live, with their items and applied codes.
+func (s *CartLifecycleService) ExpireCarts(now time.Time) (int, error) {
+	total := 0
+	for _, guest := range []bool{false, true} {
+		ttl := s.cartTTL
+		if guest {
+			ttl = s.guestCartTTL
+		}
+
+		count, err := sweepBatches(s.database, func(tx *Database) (int, error) {
+			cartRepo := s.cartRepository.WithTx(tx)
+
+			carts, err := cartRepo.LockInactiveCarts(guest, now.Add(-ttl), sweepBatchSize)
+			if err != nil || len(carts) == 0 {
+				return 0, err
+			}
+			return len(carts), cartRepo.DeleteCarts(cartIDs(carts))
+		})
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// RemindAbandonedCarts records a cart.abandoned event, once per period of
+// inactivity, for every user cart with items that has not changed for the
+// reminder delay.
+func (s *CartLifecycleService) RemindAbandonedCarts(now time.Time) (int, error) {
+	if s.reminderAfter == 0 {
+		return 0, nil
+	}
+
+	return sweepBatches(s.database, func(tx *Database) (int, error) {
+		cartRepo := s.cartRepository.WithTx(tx)
+		eventRepo := s.eventRepository.WithTx(tx)
+
+		carts, err := cartRepo.LockAbandonedCarts(now.Add(-s.reminderAfter), sweepBatchSize)
+		if err != nil || len(carts) == 0 {
+			return 0, err
+		}
+		items, err := cartRepo.GetItemsByCartIDs(cartIDs(carts))
+		if err != nil {
+			return 0, err
+		}
+
+		names := make(map[uint][]string)
+		for _, item := range items {
+			names[item.CartID] = append(names[item.CartID], item.TourName)
+		}
+		for _, cart := range carts {
+			err := eventRepo.CreateEvent(&CartEvent{
+				Type:       CartEventAbandoned,
+				CartID:     cart.ID,
+				UserID:     cart.UserID,
+				ItemCount:  len(names[cart.ID]),
+				TourNames:  names[cart.ID],
+				Total:      cart.Total,
+				Currency:   cart.Currency,
+				ActiveAt:   cart.ActiveAt,
+				OccurredAt: now,
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		return len(carts), cartRepo.MarkReminderSent(cartIDs(carts), now)
+	})
+}
+
+// PublishPendingEvents hands queued cart events to the publisher in order. It
+// stops at the first failure so events are never delivered out of order.
+func (s *CartLifecycleService) PublishPendingEvents(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		events, err := s.eventRepository.GetUnpublishedEvents(sweepBatchSize)
+		if err != nil || len(events) == 0 {
+			return published, err
+		}
+
+		for i := range events {
+			err := s.publisher.Publish(ctx, &events[i])
+			if err != nil {
+				return published, err
+			}
+			err = s.eventRepository.MarkPublished(events[i].ID, time.Now())
+			if err != nil {
+				return published, err
+			}
+			published++
+		}
+	}
+}
+
+// durationEnv reads a duration setting, falling back to the default when it
+// is invalid. Zero is only accepted where it turns a feature off.
+func durationEnv(name string, fallback string, zeroAllowed bool) time.Duration {
+	value := GetEnv(name, fallback)
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 || duration == 0 && !zeroAllowed {
+		log.Printf("Invalid %s, using %s", name, fallback)
+		duration, _ = time.ParseDuration(fallback)
+	}
+	return duration
+}
+
+func cartIDs(carts []ShoppingCart) []uint {
+	ids := make([]uint, len(carts))
+	for i, cart := range carts {
+		ids[i] = cart.ID
+	}
+	return ids
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CartRepository struct {
@@ -12,9 +15,28 @@ func NewCartRepository(db *Database) *CartRepository {
 	return &CartRepository{database: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *CartRepository) WithTx(tx *Database) *CartRepository {
+	return &CartRepository{database: tx}
+}
+
 func (r *CartRepository) GetCartByUserID(userID string) (*ShoppingCart, error) {
 	var cart ShoppingCart
-	result := r.database.db.Preload("Items").Where("user_id = ?", userID).First(&cart)
+	result := r.database.db.Preload("Items.Bundle.Tours").Preload("Coupons").Where("user_id = ?", userID).First(&cart)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrCartNotFound
+		}
+		return nil, result.Error
+	}
+	return &cart, nil
+}
+
+// LockCartByUserID loads the user's cart and locks its row until the
+// surrounding transaction ends, serializing concurrent checkouts.
+func (r *CartRepository) LockCartByUserID(userID string) (*ShoppingCart, error) {
+	var cart ShoppingCart
+	result := r.database.db.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items.Bundle.Tours").Preload("Coupons").Where("user_id = ?", userID).First(&cart)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			return nil, ErrCartNotFound
@@ -26,7 +48,7 @@ func (r *CartRepository) GetCartByUserID(userID string) (*ShoppingCart, error) {
 
 func (r *CartRepository) GetCartByID(cartID uint) (*ShoppingCart, error) {
 	var cart ShoppingCart
-	result := r.database.db.Preload("Items").Where("id = ?", cartID).First(&cart)
+	result := r.database.db.Preload("Items.Bundle.Tours").Preload("Coupons").Where("id = ?", cartID).First(&cart)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			return nil, ErrCartNotFound
@@ -38,15 +60,16 @@ func (r *CartRepository) GetCartByID(cartID uint) (*ShoppingCart, error) {
 
 func (r *CartRepository) CreateCart(userID string) (*ShoppingCart, error) {
 	cart := &ShoppingCart{
-		UserID: userID,
-		Total:  0,
+		UserID:   userID,
+		Total:    0,
+		ActiveAt: time.Now(),
 	}
-	
+
 	result := r.database.db.Create(cart)
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	
+
 	return cart, nil
 }
 
@@ -58,6 +81,106 @@ func (r *CartRepository) GetOrCreateCart(userID string) (*ShoppingCart, error) {
 	return cart, err
 }
 
+func (r *CartRepository) GetCartByClientID(clientID string) (*ShoppingCart, error) {
+	var cart ShoppingCart
+	result := r.database.db.Preload("Items.Bundle.Tours").Preload("Coupons").Where("client_id = ?", clientID).First(&cart)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrCartNotFound
+		}
+		return nil, result.Error
+	}
+	return &cart, nil
+}
+
+// GetOrCreateGuestCart returns the guest cart of a client, creating it on
+// first use. Concurrent first requests end up with the same cart.
+func (r *CartRepository) GetOrCreateGuestCart(clientID string) (*ShoppingCart, error) {
+	cart := &ShoppingCart{ClientID: &clientID, ActiveAt: time.Now()}
+	result := r.database.db.Clauses(clause.OnConflict{DoNothing: true}).Create(cart)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return r.GetCartByClientID(clientID)
+}
+
+// TouchCart records activity on a cart, which postpones its expiry and
+// allows another reminder once it is abandoned again.
+func (r *CartRepository) TouchCart(cartID uint, at time.Time) error {
+	result := r.database.db.Model(&ShoppingCart{}).Where("id = ?", cartID).Updates(map[string]interface{}{
+		"active_at":        at,
+		"reminder_sent_at": nil,
+	})
+	return result.Error
+}
+
+// LockAbandonedCarts locks up to limit user carts with items that have seen
+// no activity since before and were not reminded about yet, oldest first.
+// Rows locked by another sweep are skipped.
+func (r *CartRepository) LockAbandonedCarts(before time.Time, limit int) ([]ShoppingCart, error) {
+	var carts []ShoppingCart
+	result := r.database.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("client_id IS NULL AND reminder_sent_at IS NULL AND active_at <= ?", before).
+		Where("EXISTS (SELECT 1 FROM order_items WHERE order_items.cart_id = shopping_carts.id)").
+		Order("active_at").Limit(limit).Find(&carts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return carts, nil
+}
+
+// GetItemsByCartIDs returns the items of the given carts.
+func (r *CartRepository) GetItemsByCartIDs(cartIDs []uint) ([]OrderItem, error) {
+	var items []OrderItem
+	result := r.database.db.Where("cart_id IN ?", cartIDs).Order("id").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return items, nil
+}
+
+func (r *CartRepository) MarkReminderSent(cartIDs []uint, at time.Time) error {
+	result := r.database.db.Model(&ShoppingCart{}).Where("id IN ?", cartIDs).Update("reminder_sent_at", at)
+	return result.Error
+}
+
+// LockInactiveCarts locks up to limit guest or user carts that have seen no
+// activity since before, skipping rows locked by another sweep.
+func (r *CartRepository) LockInactiveCarts(guest bool, before time.Time, limit int) ([]ShoppingCart, error) {
+	var carts []ShoppingCart
+	query := r.database.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("active_at <= ?", before)
+	if guest {
+		query = query.Where("client_id IS NOT NULL")
+	} else {
+		query = query.Where("client_id IS NULL")
+	}
+	result := query.Order("active_at").Limit(limit).Find(&carts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return carts, nil
+}
+
+// DeleteCarts removes carts together with their items and applied codes.
+func (r *CartRepository) DeleteCarts(cartIDs []uint) error {
+	err := r.database.db.Where("cart_id IN ?", cartIDs).Delete(&OrderItem{}).Error
+	if err != nil {
+		return err
+	}
+	err = r.database.db.Where("cart_id IN ?", cartIDs).Delete(&CartCoupon{}).Error
+	if err != nil {
+		return err
+	}
+	return r.database.db.Where("id IN ?", cartIDs).Delete(&ShoppingCart{}).Error
+}
+
+// MoveItem puts an item into another cart.
+func (r *CartRepository) MoveItem(itemID uint, cartID uint) error {
+	result := r.database.db.Model(&OrderItem{}).Where("id = ?", itemID).Update("cart_id", cartID)
+	return result.Error
+}
+
 func (r *CartRepository) AddItemToCart(cartID uint, item *OrderItem) error {
 	item.CartID = cartID
 	result := r.database.db.Create(item)
@@ -65,15 +188,63 @@ func (r *CartRepository) AddItemToCart(cartID uint, item *OrderItem) error {
 }
 
 func (r *CartRepository) RemoveItemFromCart(cartID uint, tourID uint) error {
-	result := r.database.db.Where("cart_id = ? AND tour_id = ?", cartID, tourID).Delete(&OrderItem{})
+	result := r.database.db.Where("cart_id = ? AND tour_id = ? AND bundle_id IS NULL", cartID, tourID).Delete(&OrderItem{})
 	if result.RowsAffected == 0 {
 		return ErrItemNotFound
 	}
 	return result.Error
 }
 
-func (r *CartRepository) UpdateCartTotal(cartID uint, total float64) error {
-	result := r.database.db.Model(&ShoppingCart{}).Where("id = ?", cartID).Update("total", total)
+func (r *CartRepository) RemoveBundleFromCart(cartID uint, bundleID uint) error {
+	result := r.database.db.Where("cart_id = ? AND bundle_id = ?", cartID, bundleID).Delete(&OrderItem{})
+	if result.RowsAffected == 0 {
+		return ErrItemNotFound
+	}
+	return result.Error
+}
+
+func (r *CartRepository) RemoveItemByID(itemID uint) error {
+	result := r.database.db.Where("id = ?", itemID).Delete(&OrderItem{})
+	return result.Error
+}
+
+// UpdateItemTerms refreshes the name and base price captured when the item
+// was added to the cart.
+func (r *CartRepository) UpdateItemTerms(itemID uint, name string, price int64, currency string) error {
+	result := r.database.db.Model(&OrderItem{}).Where("id = ?", itemID).Updates(map[string]interface{}{
+		"tour_name":     name,
+		"base_price":    price,
+		"base_currency": currency,
+	})
+	return result.Error
+}
+
+func (r *CartRepository) UpdateCartTotal(cartID uint, total int64, currency string) error {
+	result := r.database.db.Model(&ShoppingCart{}).Where("id = ?", cartID).Updates(map[string]interface{}{
+		"total":    total,
+		"currency": currency,
+	})
+	return result.Error
+}
+
+// RemoveCheckedOut removes the items and coupons a paid order was taken
+// from, keeping anything added to the cart while it was being paid.
+func (r *CartRepository) RemoveCheckedOut(cartID uint, itemIDs []uint, couponIDs []uint) error {
+	if len(itemIDs) > 0 {
+		err := r.database.db.Where("cart_id = ? AND id IN ?", cartID, itemIDs).Delete(&OrderItem{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(couponIDs) > 0 {
+		err := r.database.db.Where("cart_id = ? AND id IN ?", cartID, couponIDs).Delete(&CartCoupon{}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	// The total is worked out again when the cart is next priced
+	result := r.database.db.Model(&ShoppingCart{}).Where("id = ?", cartID).Update("total", 0)
 	return result.Error
 }
 
@@ -83,7 +254,14 @@ func (r *CartRepository) ClearCart(cartID uint) error {
 	if err != nil {
 		return err
 	}
-	
+
+	// Drop applied coupon codes
+	err = r.database.db.Where("cart_id = ?", cartID).Delete(&CartCoupon{}).Error
+	if err != nil {
+		return err
+	}
+
 	// Reset total to 0
-	return r.UpdateCartTotal(cartID, 0)
-}
\ No newline at end of file
+	result := r.database.db.Model(&ShoppingCart{}).Where("id = ?", cartID).Update("total", 0)
+	return result.Error
+}
@@ -1,30 +1,51 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"time"
 )
 
 type CartService struct {
-	cartRepository *CartRepository
+	database            *Database
+	cartRepository      *CartRepository
+	bundleRepository    *BundleRepository
+	savedItemRepository *SavedItemRepository
+	couponService       *CouponService
+	currencyService     *CurrencyService
+	taxService          *TaxService
 }
 
-func NewCartService(cartRepo *CartRepository) *CartService {
+func NewCartService(db *Database, cartRepo *CartRepository, bundleRepo *BundleRepository, savedItemRepo *SavedItemRepository, couponService *CouponService, currencyService *CurrencyService, taxService *TaxService) *CartService {
 	return &CartService{
-		cartRepository: cartRepo,
+		database:            db,
+		cartRepository:      cartRepo,
+		bundleRepository:    bundleRepo,
+		savedItemRepository: savedItemRepo,
+		couponService:       couponService,
+		currencyService:     currencyService,
+		taxService:          taxService,
 	}
 }
 
 func (s *CartService) GetCart(userID string) (*ShoppingCart, error) {
-	return s.cartRepository.GetOrCreateCart(userID)
+	cart, err := s.cartRepository.GetOrCreateCart(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sales may have started or ended since the cart was last changed
+	err = s.couponService.PriceCart(cart, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.taxService.QuoteCart(cart)
+
+	return cart, nil
 }
 
 func (s *CartService) AddToCart(userID string, tourID uint) error {
 	log.Printf("AddToCart: userID=%s, tourID=%d", userID, tourID)
-	
+
 	// Get or create cart
 	cart, err := s.cartRepository.GetOrCreateCart(userID)
 	if err != nil {
@@ -32,6 +53,10 @@ func (s *CartService) AddToCart(userID string, tourID uint) error {
 		return err
 	}
 
+	return s.addTour(cart, tourID)
+}
+
+func (s *CartService) addTour(cart *ShoppingCart, tourID uint) error {
 	// Check if tour is already in cart
 	if cart.HasTour(tourID) {
 		log.Printf("AddToCart: tour %d already in cart", tourID)
@@ -39,14 +64,14 @@ func (s *CartService) AddToCart(userID string, tourID uint) error {
 	}
 
 	// Fetch tour details from tour service
-	tourInfo, err := s.fetchTourInfo(tourID)
+	tourInfo, err := fetchTourInfo(tourID)
 	if err != nil {
 		log.Printf("AddToCart: failed to fetch tour info: %v", err)
 		return err
 	}
 
-	log.Printf("AddToCart: fetched tour info - ID=%d, Name=%s, Status=%s, Price=%f", 
-		tourInfo.ID, tourInfo.Name, tourInfo.Status, tourInfo.Price)
+	log.Printf("AddToCart: fetched tour info - ID=%d, Name=%s, Status=%s, Price=%d %s",
+		tourInfo.ID, tourInfo.Name, tourInfo.Status, tourInfo.Price, tourInfo.Currency)
 
 	// Validate tour status
 	if tourInfo.Status != "published" {
@@ -54,11 +79,18 @@ func (s *CartService) AddToCart(userID string, tourID uint) error {
 		return ErrTourNotPublished
 	}
 
+	if !s.currencyService.IsSupported(tourInfo.Currency) {
+		log.Printf("AddToCart: tour %d is priced in unsupported currency %s", tourID, tourInfo.Currency)
+		return ErrUnsupportedCurrency
+	}
+
 	// Create order item
 	item := &OrderItem{
-		TourID:   tourID,
-		TourName: tourInfo.Name,
-		Price:    tourInfo.Price,
+		TourID:         tourID,
+		TourName:       tourInfo.Name,
+		AuthorUsername: tourInfo.AuthorUsername,
+		BasePrice:      tourInfo.Price,
+		BaseCurrency:   tourInfo.Currency,
 	}
 
 	// Add item to cart
@@ -78,8 +110,12 @@ func (s *CartService) RemoveFromCart(userID string, tourID uint) error {
 		return err
 	}
 
+	return s.removeTour(cart, tourID)
+}
+
+func (s *CartService) removeTour(cart *ShoppingCart, tourID uint) error {
 	// Remove item
-	err = s.cartRepository.RemoveItemFromCart(cart.ID, tourID)
+	err := s.cartRepository.RemoveItemFromCart(cart.ID, tourID)
 	if err != nil {
 		return err
 	}
@@ -88,64 +124,565 @@ func (s *CartService) RemoveFromCart(userID string, tourID uint) error {
 	return s.recalculateCartTotal(cart.ID)
 }
 
+// AddBundleToCart adds a bundle as a single item. None of its tours may
+// already be in the cart, on their own or through another bundle.
+func (s *CartService) AddBundleToCart(userID string, bundleID uint) error {
+	log.Printf("AddBundleToCart: userID=%s, bundleID=%d", userID, bundleID)
+
+	cart, err := s.cartRepository.GetOrCreateCart(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.addBundle(cart, bundleID)
+}
+
+func (s *CartService) addBundle(cart *ShoppingCart, bundleID uint) error {
+	if cart.HasBundle(bundleID) {
+		return ErrBundleAlreadyInCart
+	}
+
+	bundle, err := s.bundleRepository.GetBundleByID(bundleID)
+	if err != nil {
+		return err
+	}
+	if bundle.Status != BundleStatusActive {
+		return ErrBundleUnavailable
+	}
+	if !s.currencyService.IsSupported(bundle.Currency) {
+		return ErrUnsupportedCurrency
+	}
+
+	for _, tour := range bundle.Tours {
+		if cart.HasTour(tour.TourID) {
+			log.Printf("AddBundleToCart: tour %d already in cart", tour.TourID)
+			return ErrTourAlreadyInCart
+		}
+
+		tourInfo, err := fetchTourInfo(tour.TourID)
+		if err != nil {
+			log.Printf("AddBundleToCart: failed to fetch tour info: %v", err)
+			return err
+		}
+		if tourInfo.Status != "published" {
+			log.Printf("AddBundleToCart: tour %d is not published (status: %s)", tour.TourID, tourInfo.Status)
+			return ErrTourNotPublished
+		}
+	}
+
+	item := &OrderItem{
+		TourName:       bundle.Name,
+		AuthorUsername: bundle.AuthorUsername,
+		BundleID:       &bundle.ID,
+		BasePrice:      bundle.Price,
+		BaseCurrency:   bundle.Currency,
+	}
+
+	err = s.cartRepository.AddItemToCart(cart.ID, item)
+	if err != nil {
+		return err
+	}
+
+	return s.recalculateCartTotal(cart.ID)
+}
+
+func (s *CartService) RemoveBundleFromCart(userID string, bundleID uint) error {
+	cart, err := s.cartRepository.GetCartByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.removeBundle(cart, bundleID)
+}
+
+func (s *CartService) removeBundle(cart *ShoppingCart, bundleID uint) error {
+	err := s.cartRepository.RemoveBundleFromCart(cart.ID, bundleID)
+	if err != nil {
+		return err
+	}
+
+	return s.recalculateCartTotal(cart.ID)
+}
+
 func (s *CartService) ClearCart(userID string) error {
 	cart, err := s.cartRepository.GetCartByUserID(userID)
 	if err != nil {
 		return err
 	}
 
-	return s.cartRepository.ClearCart(cart.ID)
+	return s.clearCart(cart)
 }
 
-func (s *CartService) recalculateCartTotal(cartID uint) error {
-	cart, err := s.cartRepository.GetCartByID(cartID)
+func (s *CartService) clearCart(cart *ShoppingCart) error {
+	err := s.cartRepository.ClearCart(cart.ID)
+	if err != nil {
+		return err
+	}
+	return s.cartRepository.TouchCart(cart.ID, time.Now())
+}
+
+func (s *CartService) ApplyCoupon(userID string, code string) error {
+	cart, err := s.cartRepository.GetCartByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.couponService.ApplyCode(cart, userID, code)
+	if err != nil {
+		return err
+	}
+
+	return s.recalculateCartTotal(cart.ID)
+}
+
+func (s *CartService) RemoveCoupon(userID string, code string) error {
+	cart, err := s.cartRepository.GetCartByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.couponService.RemoveCode(cart, code)
+	if err != nil {
+		return err
+	}
+
+	return s.recalculateCartTotal(cart.ID)
+}
+
+// GetGuestCart returns the cart of a visitor who is not logged in. A client
+// without a cart gets an empty one, which is only stored once something is
+// added to it.
+func (s *CartService) GetGuestCart(clientID string) (*ShoppingCart, error) {
+	err := validateClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := s.cartRepository.GetCartByClientID(clientID)
+	if err == ErrCartNotFound {
+		cart = &ShoppingCart{ClientID: &clientID, Items: []OrderItem{}}
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = s.couponService.PriceCart(cart, "")
+	if err != nil {
+		return nil, err
+	}
+	s.taxService.QuoteCart(cart)
+
+	return cart, nil
+}
+
+func (s *CartService) AddToGuestCart(clientID string, tourID uint) error {
+	cart, err := s.getOrCreateGuestCart(clientID)
+	if err != nil {
+		return err
+	}
+	return s.addTour(cart, tourID)
+}
+
+func (s *CartService) RemoveFromGuestCart(clientID string, tourID uint) error {
+	cart, err := s.getGuestCart(clientID)
+	if err != nil {
+		return err
+	}
+	return s.removeTour(cart, tourID)
+}
+
+func (s *CartService) AddBundleToGuestCart(clientID string, bundleID uint) error {
+	cart, err := s.getOrCreateGuestCart(clientID)
+	if err != nil {
+		return err
+	}
+	return s.addBundle(cart, bundleID)
+}
+
+func (s *CartService) RemoveBundleFromGuestCart(clientID string, bundleID uint) error {
+	cart, err := s.getGuestCart(clientID)
+	if err != nil {
+		return err
+	}
+	return s.removeBundle(cart, bundleID)
+}
+
+func (s *CartService) ClearGuestCart(clientID string) error {
+	cart, err := s.getGuestCart(clientID)
 	if err != nil {
 		return err
 	}
+	return s.clearCart(cart)
+}
+
+func (s *CartService) getGuestCart(clientID string) (*ShoppingCart, error) {
+	err := validateClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return s.cartRepository.GetCartByClientID(clientID)
+}
+
+func (s *CartService) getOrCreateGuestCart(clientID string) (*ShoppingCart, error) {
+	err := validateClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return s.cartRepository.GetOrCreateGuestCart(clientID)
+}
+
+// MergeGuestCart moves the items of a client's guest cart into the user's
+// cart after they log in, then removes the guest cart. Items the user's cart
+// already holds, alone or through a bundle, are dropped and returned as
+// skipped. Merging a client without a cart does nothing.
+func (s *CartService) MergeGuestCart(userID string, clientID string) (*ShoppingCart, []OrderItem, error) {
+	err := validateClientID(clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var skipped []OrderItem
+	merged := 0
+	err = s.database.Transaction(func(tx *Database) error {
+		cartRepo := s.cartRepository.WithTx(tx)
+
+		guestCart, err := cartRepo.GetCartByClientID(clientID)
+		if err == ErrCartNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = cartRepo.GetOrCreateCart(userID)
+		if err != nil {
+			return err
+		}
+		cart, err := cartRepo.LockCartByUserID(userID)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range guestCart.Items {
+			if cart.Overlaps(item) {
+				skipped = append(skipped, item)
+				continue
+			}
+			err := cartRepo.MoveItem(item.ID, cart.ID)
+			if err != nil {
+				return err
+			}
+			cart.Items = append(cart.Items, item)
+			merged++
+		}
+
+		return cartRepo.DeleteCarts([]uint{guestCart.ID})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if merged > 0 {
+		cart, err := s.cartRepository.GetCartByUserID(userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = s.recalculateCartTotal(cart.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("MergeGuestCart: moved %d items into the cart of %s, skipped %d", merged, userID, len(skipped))
+	}
+
+	cart, err := s.GetCart(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cart, skipped, nil
+}
+
+// SaveForLater moves a tour out of the user's cart into their saved items.
+func (s *CartService) SaveForLater(userID string, tourID uint) (*SavedItem, error) {
+	return s.saveForLater(userID, func(item OrderItem) bool {
+		return item.BundleID == nil && item.TourID == tourID
+	})
+}
+
+// SaveBundleForLater moves a bundle out of the user's cart into their saved
+// items.
+func (s *CartService) SaveBundleForLater(userID string, bundleID uint) (*SavedItem, error) {
+	return s.saveForLater(userID, func(item OrderItem) bool {
+		return item.BundleID != nil && *item.BundleID == bundleID
+	})
+}
+
+func (s *CartService) saveForLater(userID string, matches func(OrderItem) bool) (*SavedItem, error) {
+	cart, err := s.cartRepository.GetCartByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var item *OrderItem
+	for i := range cart.Items {
+		if matches(cart.Items[i]) {
+			item = &cart.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, ErrItemNotFound
+	}
+
+	saved := &SavedItem{
+		UserID:         userID,
+		TourID:         item.TourID,
+		TourName:       item.TourName,
+		AuthorUsername: item.AuthorUsername,
+		BundleID:       item.BundleID,
+		BasePrice:      item.BasePrice,
+		BaseCurrency:   item.BaseCurrency,
+	}
+	err = s.database.Transaction(func(tx *Database) error {
+		savedItemRepo := s.savedItemRepository.WithTx(tx)
+
+		// Saving twice only takes the item out of the cart
+		exists, err := savedItemRepo.IsSaved(userID, item.TourID, item.BundleID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			err = savedItemRepo.CreateSavedItem(saved)
+			if err != nil {
+				return err
+			}
+		}
+		return s.cartRepository.WithTx(tx).RemoveItemByID(item.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, s.recalculateCartTotal(cart.ID)
+}
+
+func (s *CartService) GetSavedItems(userID string) ([]SavedItem, error) {
+	return s.savedItemRepository.GetSavedItems(userID)
+}
+
+// MoveToCart puts a saved item back into the user's cart at the current
+// price and takes it off the saved list. It fails like adding the tour or
+// bundle to the cart would, leaving the item saved. The saved item is
+// returned whenever it was found.
+func (s *CartService) MoveToCart(userID string, savedItemID uint) (*SavedItem, error) {
+	saved, err := s.getSavedItem(userID, savedItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := s.cartRepository.GetOrCreateCart(userID)
+	if err != nil {
+		return saved, err
+	}
+	if saved.BundleID != nil {
+		err = s.addBundle(cart, *saved.BundleID)
+	} else {
+		err = s.addTour(cart, saved.TourID)
+	}
+	if err != nil {
+		return saved, err
+	}
+
+	return saved, s.savedItemRepository.DeleteSavedItem(saved.ID)
+}
 
-	cart.CalculateTotal()
-	return s.cartRepository.UpdateCartTotal(cartID, cart.Total)
+func (s *CartService) RemoveSavedItem(userID string, savedItemID uint) error {
+	saved, err := s.getSavedItem(userID, savedItemID)
+	if err != nil {
+		return err
+	}
+	return s.savedItemRepository.DeleteSavedItem(saved.ID)
 }
 
-// Helper function to fetch tour info from tour service
-func (s *CartService) fetchTourInfo(tourID uint) (*TourInfo, error) {
-	tourServiceURL := GetEnv("TOUR_SERVICE_URL", "http://tour-service:3006")
-	url := fmt.Sprintf("%s/%d", tourServiceURL, tourID)
-	
-	log.Printf("fetchTourInfo: requesting URL: %s", url)
+// getSavedItem loads a saved item of the user. Other users' items are
+// reported as not found.
+func (s *CartService) getSavedItem(userID string, savedItemID uint) (*SavedItem, error) {
+	saved, err := s.savedItemRepository.GetSavedItemByID(savedItemID)
+	if err != nil {
+		return nil, err
+	}
+	if saved.UserID != userID {
+		return nil, ErrSavedItemNotFound
+	}
+	return saved, nil
+}
 
-	resp, err := http.Get(url)
+// RevalidateCart compares every item with the tour service and brings the
+// cart up to date: re-priced or renamed tours are updated and tours or
+// bundles that can no longer be bought are removed. It returns what changed
+// together with the refreshed cart; no changes means the cart can be bought
+// as it stands.
+func (s *CartService) RevalidateCart(userID string) ([]CartChange, *ShoppingCart, error) {
+	cart, err := s.cartRepository.GetCartByUserID(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch tour info: %v", err)
+		return nil, nil, err
+	}
+
+	var changes []CartChange
+	for _, item := range cart.Items {
+		var itemChanges []CartChange
+		if item.BundleID != nil {
+			itemChanges, err = s.checkBundleItem(item)
+		} else {
+			itemChanges, err = s.checkTourItem(item)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, itemChanges...)
 	}
-	defer resp.Body.Close()
 
-	log.Printf("fetchTourInfo: tour service response status: %d", resp.StatusCode)
+	if len(changes) == 0 {
+		return nil, cart, nil
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("tour service returned status: %d", resp.StatusCode)
+	err = s.recalculateCartTotal(cart.ID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	cart, err = s.GetCart(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read tour response: %v", err)
+		return nil, nil, err
 	}
+	return changes, cart, nil
+}
 
-	log.Printf("fetchTourInfo: response body: %s", string(body))
+func (s *CartService) checkTourItem(item OrderItem) ([]CartChange, error) {
+	tourInfo, err := fetchTourInfo(item.TourID)
+	if err != nil && err != ErrTourNotFound {
+		return nil, err
+	}
 
-	var tourInfo TourInfo
-	err = json.Unmarshal(body, &tourInfo)
+	if err == ErrTourNotFound || tourInfo.Status != "published" || !s.currencyService.IsSupported(tourInfo.Currency) {
+		status := "deleted"
+		if tourInfo != nil {
+			status = tourInfo.Status
+		}
+		log.Printf("RevalidateCart: tour %d can no longer be bought (status: %s)", item.TourID, status)
+		change := CartChange{
+			ItemID:      item.ID,
+			TourID:      item.TourID,
+			Kind:        CartChangeUnavailable,
+			OldName:     item.TourName,
+			OldPrice:    item.BasePrice,
+			OldCurrency: item.BaseCurrency,
+			Status:      status,
+		}
+		return []CartChange{change}, s.cartRepository.RemoveItemByID(item.ID)
+	}
+
+	var changes []CartChange
+	if tourInfo.Name != item.TourName {
+		changes = append(changes, CartChange{
+			ItemID:  item.ID,
+			TourID:  item.TourID,
+			Kind:    CartChangeName,
+			OldName: item.TourName,
+			NewName: tourInfo.Name,
+		})
+	}
+	if tourInfo.Price != item.BasePrice || tourInfo.Currency != item.BaseCurrency {
+		log.Printf("RevalidateCart: tour %d price changed from %d %s to %d %s", item.TourID, item.BasePrice, item.BaseCurrency, tourInfo.Price, tourInfo.Currency)
+		changes = append(changes, CartChange{
+			ItemID:      item.ID,
+			TourID:      item.TourID,
+			Kind:        CartChangePrice,
+			OldName:     item.TourName,
+			NewName:     tourInfo.Name,
+			OldPrice:    item.BasePrice,
+			OldCurrency: item.BaseCurrency,
+			NewPrice:    tourInfo.Price,
+			NewCurrency: tourInfo.Currency,
+		})
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, s.cartRepository.UpdateItemTerms(item.ID, tourInfo.Name, tourInfo.Price, tourInfo.Currency)
+}
+
+// checkBundleItem keeps a bundle only while it is on sale and every tour in
+// it is still published. The bundle price itself never changes.
+func (s *CartService) checkBundleItem(item OrderItem) ([]CartChange, error) {
+	status := BundleStatusArchived
+	if item.Bundle != nil {
+		status = item.Bundle.Status
+	}
+
+	if status == BundleStatusActive {
+		for _, tour := range item.Bundle.Tours {
+			tourInfo, err := fetchTourInfo(tour.TourID)
+			if err == ErrTourNotFound {
+				status = "tour deleted"
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if tourInfo.Status != "published" {
+				status = "tour " + tourInfo.Status
+				break
+			}
+		}
+	}
+
+	if status == BundleStatusActive {
+		return nil, nil
+	}
+
+	log.Printf("RevalidateCart: bundle %d can no longer be bought (status: %s)", *item.BundleID, status)
+	change := CartChange{
+		ItemID:      item.ID,
+		BundleID:    item.BundleID,
+		Kind:        CartChangeUnavailable,
+		OldName:     item.TourName,
+		OldPrice:    item.BasePrice,
+		OldCurrency: item.BaseCurrency,
+		Status:      status,
+	}
+	return []CartChange{change}, s.cartRepository.RemoveItemByID(item.ID)
+}
+
+func (s *CartService) recalculateCartTotal(cartID uint) error {
+	cart, err := s.cartRepository.GetCartByID(cartID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse tour info: %v", err)
+		return err
 	}
 
-	return &tourInfo, nil
+	err = s.couponService.PriceCart(cart, cart.UserID)
+	if err != nil {
+		return err
+	}
+	s.taxService.QuoteCart(cart)
+	err = s.cartRepository.UpdateCartTotal(cartID, cart.Total, cart.Currency)
+	if err != nil {
+		return err
+	}
+
+	// Every change to a cart goes through here, so it counts as activity
+	return s.cartRepository.TouchCart(cartID, time.Now())
 }
 
-// TourInfo represents basic tour information from tour service
-type TourInfo struct {
-	ID     uint    `json:"id"`
-	Name   string  `json:"name"`
-	Price  float64 `json:"price"`
-	Status string  `json:"status"`
-}
\ No newline at end of file
+// validateClientID accepts the random IDs browsers make up for guest carts:
+// 16 to 64 letters, digits, dashes or underscores.
+func validateClientID(clientID string) error {
+	if len(clientID) < 16 || len(clientID) > 64 {
+		return ErrInvalidClientID
+	}
+	for _, c := range clientID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return ErrInvalidClientID
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+const (
+	TokenStatusActive   = "active"
+	TokenStatusExpired  = "expired"
+	TokenStatusUsed     = "used"
+	TokenStatusRefunded = "refunded"
+)
+
+// Types of TokenEvent
+const (
+	TokenEventExpiringSoon = "token.expiring_soon"
+	TokenEventExpired      = "token.expired"
+	TokenEventUsed         = "token.used"
+)
+
+// Types of CartEvent
+const (
+	CartEventAbandoned = "cart.abandoned"
+)
+
+// Types of WishlistEvent
+const (
+	WishlistEventPriceDropped = "wishlist.price_dropped"
+	WishlistEventOnSale       = "wishlist.on_sale"
+)
+
+const (
+	GiftStatusPending  = "pending"
+	GiftStatusRedeemed = "redeemed"
+)
+
+const (
+	PaymentStatusPending    = "pending"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusFailed     = "failed"
+	PaymentStatusRefunded   = "refunded"
+)
+
+const (
+	OrderStatusPending           = "pending"
+	OrderStatusPaid              = "paid"
+	OrderStatusFailed            = "failed"
+	OrderStatusRefunded          = "refunded"
+	OrderStatusPartiallyRefunded = "partially_refunded"
+)
+
+const (
+	RefundStatusRequested = "requested"
+	RefundStatusApproved  = "approved"
+	RefundStatusRejected  = "rejected"
+	// RefundStatusPaymentReturned is a refund whose money is back with the
+	// customer but whose order and ledger are not updated yet. The refund
+	// sweep completes it.
+	RefundStatusPaymentReturned = "payment_returned"
+	RefundStatusCompleted       = "completed"
+	RefundStatusFailed          = "failed"
+)
+
+// Product types that tax rules can match
+const (
+	ProductTypeTour   = "tour"
+	ProductTypeBundle = "bundle"
+)
+
+// Kinds of Invoice
+const (
+	InvoiceKindInvoice    = "invoice"
+	InvoiceKindCreditNote = "credit_note"
+)
+
+// Types of LedgerAccount
+const (
+	LedgerAccountGuide    = "guide"
+	LedgerAccountPlatform = "platform_fees"
+	LedgerAccountClearing = "clearing"
+	LedgerAccountTax      = "tax_payable"
+)
+
+// Kinds of LedgerTransaction
+const (
+	LedgerKindSale   = "sale"
+	LedgerKindRefund = "refund"
+	LedgerKindPayout = "payout"
+)
+
+const (
+	DiscountPercentage = "percentage"
+	DiscountFixed      = "fixed"
+)
+
+const (
+	CouponScopeTour  = "tour"
+	CouponScopeGuide = "guide"
+	CouponScopeCart  = "cart"
+)
+
+// Kinds of CartChange found when a cart is revalidated before checkout
+const (
+	CartChangePrice       = "price_changed"
+	CartChangeName        = "name_changed"
+	CartChangeUnavailable = "unavailable"
+)
+
+const (
+	BundleStatusActive   = "active"
+	BundleStatusArchived = "archived"
+)
+
+// Outcomes of collecting a service's part of a full data export
+const (
+	ExportStatusOK     = "ok"
+	ExportStatusFailed = "failed"
+)
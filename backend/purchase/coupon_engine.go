@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// IsLive reports whether the coupon is active and inside its validity window.
+// Usage limits are checked separately because they depend on the user.
+func (c *Coupon) IsLive(now time.Time) bool {
+	if !c.Active || now.Before(c.ValidFrom) {
+		return false
+	}
+	return c.ValidUntil == nil || now.Before(*c.ValidUntil)
+}
+
+// AppliesTo reports whether an item-scoped coupon discounts the item.
+// Cart-wide coupons apply to every item. Bundles are already sold at a
+// reduced price, so tour coupons skip them.
+func (c *Coupon) AppliesTo(item OrderItem) bool {
+	switch c.Scope {
+	case CouponScopeTour:
+		if item.BundleID != nil {
+			return false
+		}
+		for _, tourID := range c.TourIDs {
+			if tourID == item.TourID {
+				return true
+			}
+		}
+		return false
+	case CouponScopeGuide:
+		return item.AuthorUsername != "" && item.AuthorUsername == c.GuideUsername
+	default:
+		return true
+	}
+}
+
+// CalculateDiscounts works out which of the given coupons to apply to items
+// and how much each one takes off. Coupons are assumed live and within their
+// usage limits, and fixed amounts already converted into the currency of the
+// item prices.
+//
+// Stacking: all stackable coupons combine with each other, while a
+// non-stackable coupon is used alone. Whichever of the two options saves the
+// tourist more wins. Tour and guide scoped coupons are applied before
+// cart-wide ones, and no item is ever discounted below zero.
+func CalculateDiscounts(items []OrderItem, coupons []Coupon) []DiscountLine {
+	var stackable []Coupon
+	var best []DiscountLine
+	bestAmount := int64(0)
+
+	for _, coupon := range coupons {
+		if coupon.Stackable {
+			stackable = append(stackable, coupon)
+			continue
+		}
+		lines := applyCoupons(items, []Coupon{coupon})
+		if amount := sumDiscounts(lines); amount > bestAmount {
+			best, bestAmount = lines, amount
+		}
+	}
+
+	if lines := applyCoupons(items, stackable); sumDiscounts(lines) >= bestAmount && len(lines) > 0 {
+		return lines
+	}
+	return best
+}
+
+// applyCoupons applies coupons one after another, each on what is left of
+// the item prices after the previous ones.
+func applyCoupons(items []OrderItem, coupons []Coupon) []DiscountLine {
+	ordered := make([]Coupon, len(coupons))
+	copy(ordered, coupons)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Scope != CouponScopeCart && ordered[j].Scope == CouponScopeCart
+	})
+
+	remaining := make(map[uint]int64, len(items))
+	for _, item := range items {
+		remaining[item.ID] = item.Price
+	}
+
+	var lines []DiscountLine
+	for _, coupon := range ordered {
+		line := DiscountLine{
+			CouponID:    coupon.ID,
+			Description: coupon.Description,
+			Allocations: make(map[uint]int64),
+		}
+		if coupon.Code != nil {
+			line.Code = *coupon.Code
+		}
+
+		if coupon.Scope == CouponScopeCart {
+			applyCartCoupon(coupon, items, remaining, &line)
+		} else {
+			for _, item := range items {
+				if !coupon.AppliesTo(item) || remaining[item.ID] <= 0 {
+					continue
+				}
+				amount := coupon.Amount
+				if coupon.DiscountType == DiscountPercentage {
+					amount = percentOf(remaining[item.ID], coupon.Value)
+				}
+				allocate(&line, remaining, item.ID, amount)
+			}
+		}
+
+		if line.Amount > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// applyCartCoupon spreads a cart-wide discount over the items in proportion
+// to what is left of their prices.
+func applyCartCoupon(coupon Coupon, items []OrderItem, remaining map[uint]int64, line *DiscountLine) {
+	base := int64(0)
+	weights := make([]int64, len(items))
+	for i, item := range items {
+		weights[i] = remaining[item.ID]
+		base += weights[i]
+	}
+	if base <= 0 {
+		return
+	}
+
+	total := min(coupon.Amount, base)
+	if coupon.DiscountType == DiscountPercentage {
+		total = percentOf(base, coupon.Value)
+	}
+
+	for i, share := range splitAmount(total, weights) {
+		allocate(line, remaining, items[i].ID, share)
+	}
+}
+
+func allocate(line *DiscountLine, remaining map[uint]int64, itemID uint, amount int64) {
+	amount = min(amount, remaining[itemID])
+	if amount <= 0 {
+		return
+	}
+	remaining[itemID] -= amount
+	line.Allocations[itemID] += amount
+	line.Amount += amount
+}
+
+func sumDiscounts(lines []DiscountLine) int64 {
+	total := int64(0)
+	for _, line := range lines {
+		total += line.Amount
+	}
+	return total
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalculateDiscounts(t *testing.T) {
+	items := []OrderItem{
+		{ID: 1, TourID: 10, AuthorUsername: "ana", Price: 1000},
+		{ID: 2, TourID: 20, AuthorUsername: "ana", Price: 3000},
+		{ID: 3, TourID: 30, AuthorUsername: "marko", Price: 2000},
+	}
+	bundleID := uint(7)
+	bundled := append(items[:2:2], OrderItem{ID: 4, TourID: 10, BundleID: &bundleID, Price: 1000})
+
+	percentCart := func(id uint, value float64, stackable bool) Coupon {
+		return Coupon{ID: id, DiscountType: DiscountPercentage, Value: value, Scope: CouponScopeCart, Stackable: stackable}
+	}
+	fixedCart := func(id uint, amount int64, stackable bool) Coupon {
+		return Coupon{ID: id, DiscountType: DiscountFixed, Amount: amount, Scope: CouponScopeCart, Stackable: stackable}
+	}
+	fixedTour := func(id uint, amount int64, stackable bool, tourIDs ...uint) Coupon {
+		return Coupon{ID: id, DiscountType: DiscountFixed, Amount: amount, Scope: CouponScopeTour, TourIDs: tourIDs, Stackable: stackable}
+	}
+	percentGuide := func(id uint, value float64, stackable bool, guide string) Coupon {
+		return Coupon{ID: id, DiscountType: DiscountPercentage, Value: value, Scope: CouponScopeGuide, GuideUsername: guide, Stackable: stackable}
+	}
+
+	tests := []struct {
+		name    string
+		items   []OrderItem
+		coupons []Coupon
+		want    map[uint]map[uint]int64 // coupon ID -> item ID -> discount
+	}{
+		{
+			name:    "no coupons",
+			items:   items,
+			coupons: nil,
+			want:    map[uint]map[uint]int64{},
+		},
+		{
+			name:    "cart percentage is spread over the items",
+			items:   items,
+			coupons: []Coupon{percentCart(1, 10, false)},
+			want:    map[uint]map[uint]int64{1: {1: 100, 2: 300, 3: 200}},
+		},
+		{
+			name:    "cart fixed amount is split by price",
+			items:   items,
+			coupons: []Coupon{fixedCart(1, 100, false)},
+			want:    map[uint]map[uint]int64{1: {1: 17, 2: 50, 3: 33}},
+		},
+		{
+			name:    "cart fixed amount is capped at the total",
+			items:   items,
+			coupons: []Coupon{fixedCart(1, 10000, false)},
+			want:    map[uint]map[uint]int64{1: {1: 1000, 2: 3000, 3: 2000}},
+		},
+		{
+			name:    "tour coupon is capped at the item price",
+			items:   items,
+			coupons: []Coupon{fixedTour(1, 1500, false, 10)},
+			want:    map[uint]map[uint]int64{1: {1: 1000}},
+		},
+		{
+			name:    "tour coupon skips bundled items",
+			items:   bundled,
+			coupons: []Coupon{fixedTour(1, 500, false, 10)},
+			want:    map[uint]map[uint]int64{1: {1: 500}},
+		},
+		{
+			name:    "guide coupon only takes the guide's tours",
+			items:   items,
+			coupons: []Coupon{percentGuide(1, 50, false, "ana")},
+			want:    map[uint]map[uint]int64{1: {1: 500, 2: 1500}},
+		},
+		{
+			name:    "stackable coupons combine, scoped before cart",
+			items:   items,
+			coupons: []Coupon{percentCart(1, 10, true), fixedTour(2, 500, true, 20)},
+			want: map[uint]map[uint]int64{
+				2: {2: 500},
+				1: {1: 100, 2: 250, 3: 200},
+			},
+		},
+		{
+			name:    "best non-stackable coupon is used alone",
+			items:   items,
+			coupons: []Coupon{percentCart(1, 10, false), percentCart(2, 20, false)},
+			want:    map[uint]map[uint]int64{2: {1: 200, 2: 600, 3: 400}},
+		},
+		{
+			name:    "non-stackable wins over a smaller stack",
+			items:   items,
+			coupons: []Coupon{percentCart(1, 5, true), fixedTour(2, 100, true, 10), percentCart(3, 25, false)},
+			want:    map[uint]map[uint]int64{3: {1: 250, 2: 750, 3: 500}},
+		},
+		{
+			name:    "stack wins over a smaller non-stackable coupon",
+			items:   items,
+			coupons: []Coupon{percentCart(1, 10, true), fixedTour(2, 500, true, 30), fixedCart(3, 700, false)},
+			want: map[uint]map[uint]int64{
+				2: {3: 500},
+				1: {1: 100, 2: 300, 3: 150},
+			},
+		},
+		{
+			name:    "stack wins a tie",
+			items:   items,
+			coupons: []Coupon{fixedCart(1, 600, true), fixedCart(2, 600, false)},
+			want:    map[uint]map[uint]int64{1: {1: 100, 2: 300, 3: 200}},
+		},
+		{
+			name:    "coupon matching nothing gives no line",
+			items:   items,
+			coupons: []Coupon{fixedTour(1, 500, true, 99)},
+			want:    map[uint]map[uint]int64{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := CalculateDiscounts(test.items, test.coupons)
+
+			got := map[uint]map[uint]int64{}
+			for _, line := range lines {
+				sum := int64(0)
+				for _, amount := range line.Allocations {
+					sum += amount
+				}
+				if sum != line.Amount {
+					t.Errorf("coupon %d: allocations add up to %d, amount is %d", line.CouponID, sum, line.Amount)
+				}
+				got[line.CouponID] = line.Allocations
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CalculateDiscounts() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
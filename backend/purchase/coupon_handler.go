@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"authz"
+
+	"github.com/gorilla/mux"
+)
+
+type CouponHandler struct {
+	service *CouponService
+}
+
+func NewCouponHandler(service *CouponService) *CouponHandler {
+	return &CouponHandler{service: service}
+}
+
+func (h *CouponHandler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	anyCoupon := authz.Has(r, authz.CouponManage)
+	if !anyCoupon && !authz.Has(r, authz.CouponWrite) {
+		h.sendErrorResponse(w, "You are not allowed to create coupons", http.StatusForbidden)
+		return
+	}
+
+	var request CreateCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	coupon, err := h.service.CreateCoupon(&request, username, anyCoupon)
+	if err != nil {
+		h.handleCouponError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CouponResponse{Coupon: coupon, Message: "Coupon created successfully"})
+}
+
+func (h *CouponHandler) GetCoupons(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	allCoupons := authz.Has(r, authz.CouponManage)
+	if !allCoupons && !authz.Has(r, authz.CouponWrite) {
+		h.sendErrorResponse(w, "You are not allowed to view coupons", http.StatusForbidden)
+		return
+	}
+
+	coupons, err := h.service.GetCoupons(username, allCoupons)
+	if err != nil {
+		h.handleCouponError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CouponsResponse{Coupons: coupons, Message: "Coupons retrieved successfully"})
+}
+
+func (h *CouponHandler) DeactivateCoupon(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	couponID, err := strconv.ParseUint(mux.Vars(r)["couponId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid coupon ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.DeactivateCoupon(uint(couponID), username, authz.Has(r, authz.CouponManage))
+	if err != nil {
+		h.handleCouponError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Coupon deactivated successfully"})
+}
+
+func (h *CouponHandler) handleCouponError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrUnauthorized:
+		h.sendErrorResponse(w, "Not allowed to manage this coupon", http.StatusForbidden)
+	case ErrCouponNotFound:
+		h.sendErrorResponse(w, "Coupon not found", http.StatusNotFound)
+	case ErrCouponCodeTaken:
+		h.sendErrorResponse(w, "Coupon code is already in use", http.StatusConflict)
+	case ErrInvalidCoupon:
+		h.sendErrorResponse(w, "Invalid coupon definition", http.StatusBadRequest)
+	case ErrUnsupportedCurrency:
+		h.sendErrorResponse(w, "Coupon currency is not supported", http.StatusBadRequest)
+	default:
+		h.sendErrorResponse(w, "Coupon operation failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *CouponHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
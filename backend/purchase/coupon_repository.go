@@ -0,0 +1,149 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CouponRepository struct {
+	database *Database
+}
+
+func NewCouponRepository(db *Database) *CouponRepository {
+	return &CouponRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *CouponRepository) WithTx(tx *Database) *CouponRepository {
+	return &CouponRepository{database: tx}
+}
+
+func (r *CouponRepository) CreateCoupon(coupon *Coupon) error {
+	result := r.database.db.Create(coupon)
+	return result.Error
+}
+
+func (r *CouponRepository) DeactivateCoupon(couponID uint) error {
+	result := r.database.db.Model(&Coupon{}).Where("id = ?", couponID).Update("active", false)
+	return result.Error
+}
+
+func (r *CouponRepository) GetCouponByID(id uint) (*Coupon, error) {
+	var coupon Coupon
+	result := r.database.db.Where("id = ?", id).First(&coupon)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrCouponNotFound
+		}
+		return nil, result.Error
+	}
+	return &coupon, nil
+}
+
+func (r *CouponRepository) GetCouponByCode(code string) (*Coupon, error) {
+	var coupon Coupon
+	result := r.database.db.Where("code = ?", code).First(&coupon)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrCouponNotFound
+		}
+		return nil, result.Error
+	}
+	return &coupon, nil
+}
+
+func (r *CouponRepository) GetCouponsByIDs(ids []uint) ([]Coupon, error) {
+	var coupons []Coupon
+	if len(ids) == 0 {
+		return coupons, nil
+	}
+	result := r.database.db.Where("id IN ?", ids).Find(&coupons)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return coupons, nil
+}
+
+// GetLiveAutomaticCoupons returns the sales that are running at now.
+func (r *CouponRepository) GetLiveAutomaticCoupons(now time.Time) ([]Coupon, error) {
+	var coupons []Coupon
+	result := r.database.db.
+		Where("automatic = ? AND active = ? AND valid_from <= ?", true, true, now).
+		Where("valid_until IS NULL OR valid_until > ?", now).
+		Find(&coupons)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return coupons, nil
+}
+
+func (r *CouponRepository) GetAllCoupons() ([]Coupon, error) {
+	var coupons []Coupon
+	result := r.database.db.Order("created_at DESC").Find(&coupons)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return coupons, nil
+}
+
+func (r *CouponRepository) GetCouponsByCreator(username string) ([]Coupon, error) {
+	var coupons []Coupon
+	result := r.database.db.Where("created_by = ?", username).Order("created_at DESC").Find(&coupons)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return coupons, nil
+}
+
+func (r *CouponRepository) CountUserRedemptions(couponID uint, userID string) (int64, error) {
+	var count int64
+	result := r.database.db.Model(&CouponRedemption{}).Where("coupon_id = ? AND user_id = ?", couponID, userID).Count(&count)
+	return count, result.Error
+}
+
+// IncrementUsage counts one more use of the coupon unless that would exceed
+// its global limit, in which case ErrCouponUnavailable is returned.
+func (r *CouponRepository) IncrementUsage(couponID uint) error {
+	result := r.database.db.Model(&Coupon{}).
+		Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", couponID).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCouponUnavailable
+	}
+	return nil
+}
+
+// DecrementUsage gives back one use of the coupon.
+func (r *CouponRepository) DecrementUsage(couponID uint) error {
+	result := r.database.db.Model(&Coupon{}).
+		Where("id = ? AND used_count > 0", couponID).
+		Update("used_count", gorm.Expr("used_count - 1"))
+	return result.Error
+}
+
+func (r *CouponRepository) DeleteRedemptions(orderID uint) error {
+	result := r.database.db.Where("order_id = ?", orderID).Delete(&CouponRedemption{})
+	return result.Error
+}
+
+func (r *CouponRepository) CreateRedemption(redemption *CouponRedemption) error {
+	result := r.database.db.Create(redemption)
+	return result.Error
+}
+
+func (r *CouponRepository) AddCartCoupon(cartCoupon *CartCoupon) error {
+	result := r.database.db.Create(cartCoupon)
+	return result.Error
+}
+
+func (r *CouponRepository) RemoveCartCoupon(cartID uint, code string) error {
+	result := r.database.db.Where("cart_id = ? AND code = ?", cartID, code).Delete(&CartCoupon{})
+	if result.RowsAffected == 0 {
+		return ErrCouponNotFound
+	}
+	return result.Error
+}
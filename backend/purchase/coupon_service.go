@@ -0,0 +1,369 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+type CouponService struct {
+	couponRepository *CouponRepository
+	currencyService  *CurrencyService
+}
+
+func NewCouponService(couponRepo *CouponRepository, currencyService *CurrencyService) *CouponService {
+	return &CouponService{
+		couponRepository: couponRepo,
+		currencyService:  currencyService,
+	}
+}
+
+// CreateCoupon validates and stores a coupon. With anyCoupon set it may be
+// any coupon; otherwise it may only discount the creator's own tours, either
+// by listing them or with a guide-wide scope.
+func (s *CouponService) CreateCoupon(request *CreateCouponRequest, username string, anyCoupon bool) (*Coupon, error) {
+	currency := strings.ToUpper(strings.TrimSpace(request.Currency))
+	switch request.DiscountType {
+	case DiscountPercentage:
+		if request.Value <= 0 || request.Value > 100 {
+			return nil, ErrInvalidCoupon
+		}
+		request.Amount, currency = 0, ""
+	case DiscountFixed:
+		if request.Amount <= 0 {
+			return nil, ErrInvalidCoupon
+		}
+		if currency == "" {
+			currency = s.currencyService.DefaultCurrency()
+		}
+		if !s.currencyService.IsSupported(currency) {
+			return nil, ErrUnsupportedCurrency
+		}
+		request.Value = 0
+	default:
+		return nil, ErrInvalidCoupon
+	}
+	if request.ValidUntil != nil && request.ValidFrom != nil && !request.ValidUntil.After(*request.ValidFrom) {
+		return nil, ErrInvalidCoupon
+	}
+	if request.MaxUses < 0 || request.MaxUsesPerUser < 0 {
+		return nil, ErrInvalidCoupon
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(request.Code))
+	if code == "" && !request.Automatic {
+		return nil, ErrInvalidCoupon
+	}
+
+	coupon := &Coupon{
+		Description:    request.Description,
+		DiscountType:   request.DiscountType,
+		Value:          request.Value,
+		Amount:         request.Amount,
+		Currency:       currency,
+		Scope:          request.Scope,
+		TourIDs:        request.TourIDs,
+		GuideUsername:  request.GuideUsername,
+		ValidFrom:      time.Now(),
+		ValidUntil:     request.ValidUntil,
+		MaxUses:        request.MaxUses,
+		MaxUsesPerUser: request.MaxUsesPerUser,
+		Stackable:      request.Stackable,
+		Automatic:      request.Automatic,
+		Active:         true,
+		CreatedBy:      username,
+	}
+	if code != "" {
+		coupon.Code = &code
+	}
+	if request.ValidFrom != nil {
+		coupon.ValidFrom = *request.ValidFrom
+	}
+
+	switch coupon.Scope {
+	case CouponScopeTour:
+		if len(coupon.TourIDs) == 0 {
+			return nil, ErrInvalidCoupon
+		}
+		coupon.GuideUsername = ""
+	case CouponScopeGuide:
+		coupon.TourIDs = nil
+	case CouponScopeCart:
+		coupon.TourIDs = nil
+		coupon.GuideUsername = ""
+	default:
+		return nil, ErrInvalidCoupon
+	}
+
+	if !anyCoupon {
+		err := s.checkGuideScope(coupon, username)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if coupon.Scope == CouponScopeGuide && coupon.GuideUsername == "" {
+		return nil, ErrInvalidCoupon
+	}
+
+	if coupon.Code != nil {
+		if _, err := s.couponRepository.GetCouponByCode(code); err == nil {
+			return nil, ErrCouponCodeTaken
+		}
+	}
+
+	err := s.couponRepository.CreateCoupon(coupon)
+	if err != nil {
+		return nil, err
+	}
+
+	return coupon, nil
+}
+
+// checkGuideScope restricts a guide's coupon to tours they authored.
+func (s *CouponService) checkGuideScope(coupon *Coupon, username string) error {
+	switch coupon.Scope {
+	case CouponScopeGuide:
+		coupon.GuideUsername = username
+		return nil
+	case CouponScopeTour:
+		for _, tourID := range coupon.TourIDs {
+			tourInfo, err := fetchTourInfo(tourID)
+			if err != nil {
+				return err
+			}
+			if tourInfo.AuthorUsername != username {
+				return ErrUnauthorized
+			}
+		}
+		return nil
+	default:
+		return ErrUnauthorized
+	}
+}
+
+// GetCoupons returns the coupons the user created, or every coupon with
+// allCoupons set.
+func (s *CouponService) GetCoupons(username string, allCoupons bool) ([]Coupon, error) {
+	if allCoupons {
+		return s.couponRepository.GetAllCoupons()
+	}
+	return s.couponRepository.GetCouponsByCreator(username)
+}
+
+func (s *CouponService) DeactivateCoupon(couponID uint, username string, anyCoupon bool) error {
+	coupon, err := s.couponRepository.GetCouponByID(couponID)
+	if err != nil {
+		return err
+	}
+
+	if !anyCoupon && coupon.CreatedBy != username {
+		return ErrUnauthorized
+	}
+
+	return s.couponRepository.DeactivateCoupon(coupon.ID)
+}
+
+// ApplyCode attaches a coupon code to the cart after checking that it is
+// live, within its limits for the user and discounts something in the cart.
+func (s *CouponService) ApplyCode(cart *ShoppingCart, userID string, code string) error {
+	coupon, err := s.couponRepository.GetCouponByCode(strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		return err
+	}
+
+	if cart.HasCoupon(coupon.ID) {
+		return ErrCouponAlreadyApplied
+	}
+
+	usable, err := s.isUsable(coupon, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !usable {
+		return ErrCouponUnavailable
+	}
+
+	quote, err := s.quoteItems(cart, s.currencyService.PreferredCurrency(userID))
+	if err != nil {
+		return err
+	}
+	converted, err := convertCoupon(*coupon, quote)
+	if err != nil {
+		return err
+	}
+	if len(applyCoupons(cart.Items, []Coupon{converted})) == 0 {
+		return ErrCouponNotApplicable
+	}
+
+	return s.couponRepository.AddCartCoupon(&CartCoupon{
+		CartID:   cart.ID,
+		CouponID: coupon.ID,
+		Code:     *coupon.Code,
+	})
+}
+
+func (s *CouponService) RemoveCode(cart *ShoppingCart, code string) error {
+	return s.couponRepository.RemoveCartCoupon(cart.ID, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// PriceCart quotes the cart in the user's preferred currency and sets the
+// discount lines and totals on it from the codes applied to it and any sales
+// running right now. Codes that have expired or run out are skipped rather
+// than failing the whole cart.
+func (s *CouponService) PriceCart(cart *ShoppingCart, userID string) error {
+	return s.PriceCartIn(cart, userID, s.currencyService.PreferredCurrency(userID))
+}
+
+// PriceCartIn is PriceCart in a currency the caller already looked up.
+func (s *CouponService) PriceCartIn(cart *ShoppingCart, userID string, currency string) error {
+	now := time.Now()
+
+	quote, err := s.quoteItems(cart, currency)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint
+	for _, cartCoupon := range cart.Coupons {
+		ids = append(ids, cartCoupon.CouponID)
+	}
+	coupons, err := s.couponRepository.GetCouponsByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	sales, err := s.couponRepository.GetLiveAutomaticCoupons(now)
+	if err != nil {
+		return err
+	}
+	coupons = append(coupons, sales...)
+
+	var usable []Coupon
+	for i := range coupons {
+		ok, err := s.isUsable(&coupons[i], userID, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		converted, err := convertCoupon(coupons[i], quote)
+		if err != nil {
+			return err
+		}
+		usable = append(usable, converted)
+	}
+
+	cart.Discounts = CalculateDiscounts(cart.Items, usable)
+	cart.CalculateTotal()
+	cart.Rates = quote.Rates()
+	return nil
+}
+
+// quoteItems converts the base prices of the cart items into currency, which
+// becomes the cart currency.
+func (s *CouponService) quoteItems(cart *ShoppingCart, currency string) (*Quote, error) {
+	quote := s.currencyService.NewQuote(currency)
+
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		price, err := quote.Convert(item.BasePrice, item.BaseCurrency)
+		if err != nil {
+			return nil, err
+		}
+		item.Price = price
+	}
+
+	cart.Currency = quote.Currency
+	return quote, nil
+}
+
+// convertCoupon returns a copy of a fixed amount coupon with its amount in
+// the quote currency.
+func convertCoupon(coupon Coupon, quote *Quote) (Coupon, error) {
+	if coupon.DiscountType != DiscountFixed {
+		return coupon, nil
+	}
+	amount, err := quote.Convert(coupon.Amount, coupon.Currency)
+	if err != nil {
+		return coupon, err
+	}
+	coupon.Amount = amount
+	coupon.Currency = quote.Currency
+	return coupon, nil
+}
+
+// Redeem counts the discount lines of a paid order against their coupons'
+// limits. It runs in the checkout transaction so a coupon that ran out in the
+// meantime aborts the checkout.
+func (s *CouponService) Redeem(tx *Database, userID string, order *Order) error {
+	couponRepo := s.couponRepository.WithTx(tx)
+
+	for _, line := range order.Discounts {
+		coupon, err := couponRepo.GetCouponByID(line.CouponID)
+		if err != nil {
+			return err
+		}
+
+		if coupon.MaxUsesPerUser > 0 {
+			used, err := couponRepo.CountUserRedemptions(coupon.ID, userID)
+			if err != nil {
+				return err
+			}
+			if used >= int64(coupon.MaxUsesPerUser) {
+				return ErrCouponUnavailable
+			}
+		}
+
+		err = couponRepo.IncrementUsage(coupon.ID)
+		if err != nil {
+			return err
+		}
+
+		err = couponRepo.CreateRedemption(&CouponRedemption{
+			CouponID: coupon.ID,
+			UserID:   userID,
+			OrderID:  order.ID,
+			Amount:   line.Amount,
+			Currency: order.Currency,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Release gives back the coupon uses Redeem counted for an order that was
+// not paid.
+func (s *CouponService) Release(tx *Database, order *Order) error {
+	couponRepo := s.couponRepository.WithTx(tx)
+
+	for _, line := range order.Discounts {
+		err := couponRepo.DecrementUsage(line.CouponID)
+		if err != nil {
+			return err
+		}
+	}
+	return couponRepo.DeleteRedemptions(order.ID)
+}
+
+func (s *CouponService) isUsable(coupon *Coupon, userID string, now time.Time) (bool, error) {
+	if !coupon.IsLive(now) {
+		return false, nil
+	}
+	if coupon.MaxUses > 0 && coupon.UsedCount >= coupon.MaxUses {
+		return false, nil
+	}
+	if coupon.MaxUsesPerUser > 0 {
+		used, err := s.couponRepository.CountUserRedemptions(coupon.ID, userID)
+		if err != nil {
+			return false, err
+		}
+		if used >= int64(coupon.MaxUsesPerUser) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
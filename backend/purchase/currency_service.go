@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+type CurrencyService struct {
+	provider        RateProvider
+	defaultCurrency string
+}
+
+func NewCurrencyService(provider RateProvider) *CurrencyService {
+	return &CurrencyService{
+		provider:        provider,
+		defaultCurrency: GetEnv("DEFAULT_CURRENCY", "EUR"),
+	}
+}
+
+// DefaultCurrency is used for users without a preference and for prices
+// recorded before currencies were introduced.
+func (s *CurrencyService) DefaultCurrency() string {
+	return s.defaultCurrency
+}
+
+// IsSupported reports whether the rate provider can convert currency.
+func (s *CurrencyService) IsSupported(currency string) bool {
+	if !isCurrencyCode(currency) {
+		return false
+	}
+	_, err := s.provider.Rate(context.Background(), currency, s.defaultCurrency)
+	return err == nil
+}
+
+// PreferredCurrency returns the currency the user wants carts quoted in,
+// falling back to the default when the profile has none, names a currency
+// that cannot be converted or cannot be reached.
+func (s *CurrencyService) PreferredCurrency(userID string) string {
+	currency, err := fetchPreferredCurrency(userID)
+	if err != nil {
+		log.Printf("PreferredCurrency: using %s for %s: %v", s.defaultCurrency, userID, err)
+		return s.defaultCurrency
+	}
+	if currency == "" || !s.IsSupported(currency) {
+		return s.defaultCurrency
+	}
+	return currency
+}
+
+// NewQuote starts pricing in currency. A quote fetches each rate once, so
+// everything priced with it uses the same rates.
+func (s *CurrencyService) NewQuote(currency string) *Quote {
+	return &Quote{
+		Currency: currency,
+		provider: s.provider,
+		rates:    make(map[string]ExchangeRate),
+	}
+}
+
+// Quote converts amounts into one currency and remembers the rates used.
+type Quote struct {
+	Currency string
+	provider RateProvider
+	rates    map[string]ExchangeRate
+}
+
+// Convert turns minor units of from into minor units of the quote currency.
+func (q *Quote) Convert(amount int64, from string) (int64, error) {
+	if from == q.Currency {
+		return amount, nil
+	}
+
+	rate, ok := q.rates[from]
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		value, err := q.provider.Rate(ctx, from, q.Currency)
+		if err != nil {
+			return 0, err
+		}
+		rate = ExchangeRate{
+			From:      from,
+			To:        q.Currency,
+			Rate:      value,
+			Provider:  q.provider.Name(),
+			FetchedAt: time.Now(),
+		}
+		q.rates[from] = rate
+	}
+
+	return convertAmount(amount, rate), nil
+}
+
+// Rates lists the rates the quote has used so far.
+func (q *Quote) Rates() []ExchangeRate {
+	rates := make([]ExchangeRate, 0, len(q.rates))
+	for _, rate := range q.rates {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].From < rates[j].From
+	})
+	return rates
+}
@@ -17,6 +17,15 @@ func (d *Database) GetDB() *gorm.DB {
 	return d.db
 }
 
+// Transaction runs fn inside a single database transaction. The Database passed
+// to fn is bound to that transaction, so repositories created from it with
+// WithTx share it and are committed or rolled back together.
+func (d *Database) Transaction(fn func(tx *Database) error) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&Database{db: tx})
+	})
+}
+
 func InitDatabase() (*Database, error) {
 	// Get database configuration from environment variables
 	host := GetEnv("DB_HOST", "localhost")
@@ -36,12 +45,44 @@ func InitDatabase() (*Database, error) {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
+	// Move amounts stored before currencies existed to minor units
+	defaultCurrency := GetEnv("DEFAULT_CURRENCY", "EUR")
+	err = migrateLegacyMoney(db, defaultCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate money columns: %v", err)
+	}
+
+	err = migrateCheckoutRecords(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate checkout records: %v", err)
+	}
+
 	// Auto-migrate the schema
-	err = db.AutoMigrate(&ShoppingCart{}, &OrderItem{}, &TourPurchaseToken{})
+	err = db.AutoMigrate(&Bundle{}, &BundleTour{}, &ShoppingCart{}, &OrderItem{}, &TourPurchaseToken{}, &CheckoutRecord{}, &Payment{}, &Order{}, &OrderLine{}, &Refund{}, &Coupon{}, &CartCoupon{}, &CouponRedemption{}, &TokenTransfer{}, &Gift{}, &TokenEvent{}, &LedgerAccount{}, &LedgerTransaction{}, &LedgerEntry{}, &Payout{}, &Invoice{}, &InvoiceSequence{}, &SavedItem{}, &CartEvent{}, &WishlistItem{}, &WishlistEvent{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
 
+	err = fillLegacyCurrencies(db, defaultCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate money columns: %v", err)
+	}
+
+	err = fillTokenPurchasers(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate purchase tokens: %v", err)
+	}
+
+	err = fillLineNetAmounts(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate order lines: %v", err)
+	}
+
+	err = fillCartActivity(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate shopping carts: %v", err)
+	}
+
 	log.Println("✅ Connected to purchase database successfully")
 
 	return &Database{db: db}, nil
@@ -52,4 +93,4 @@ func GetEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
@@ -3,14 +3,62 @@ package main
 import "errors"
 
 var (
-	ErrCartNotFound       = errors.New("shopping cart not found")
-	ErrItemNotFound       = errors.New("item not found in cart")
-	ErrTourAlreadyInCart  = errors.New("tour already in shopping cart")
-	ErrTourNotPublished   = errors.New("tour is not published")
-	ErrTourArchived       = errors.New("tour is archived and cannot be purchased")
-	ErrEmptyCart          = errors.New("shopping cart is empty")
-	ErrTokenNotFound      = errors.New("purchase token not found")
-	ErrTokenExpired       = errors.New("purchase token has expired")
-	ErrTokenInvalid       = errors.New("purchase token is invalid")
-	ErrUnauthorized       = errors.New("unauthorized access")
-)
\ No newline at end of file
+	ErrCartNotFound            = errors.New("shopping cart not found")
+	ErrItemNotFound            = errors.New("item not found in cart")
+	ErrTourAlreadyInCart       = errors.New("tour already in shopping cart")
+	ErrTourNotPublished        = errors.New("tour is not published")
+	ErrTourNotFound            = errors.New("tour not found")
+	ErrTourArchived            = errors.New("tour is archived and cannot be purchased")
+	ErrEmptyCart               = errors.New("shopping cart is empty")
+	ErrTokenNotFound           = errors.New("purchase token not found")
+	ErrTokenExpired            = errors.New("purchase token has expired")
+	ErrTokenInvalid            = errors.New("purchase token is invalid")
+	ErrUnauthorized            = errors.New("unauthorized access")
+	ErrCheckoutNotFound        = errors.New("checkout record not found")
+	ErrCheckoutInProgress      = errors.New("a checkout is already in progress")
+	ErrInvalidIdempotencyKey   = errors.New("idempotency key is invalid")
+	ErrPaymentNotFound         = errors.New("payment not found")
+	ErrPaymentDeclined         = errors.New("payment was declined")
+	ErrPaymentTimeout          = errors.New("payment provider timed out")
+	ErrPaymentFailed           = errors.New("payment failed")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrOrderNotFound           = errors.New("order not found")
+	ErrOrderNotPending         = errors.New("order is no longer pending")
+	ErrRefundNotFound          = errors.New("refund not found")
+	ErrRefundNotPending        = errors.New("refund is not awaiting a decision")
+	ErrRefundAlreadyRequested  = errors.New("refund already requested for this purchase")
+	ErrTokenNotRefundable      = errors.New("purchase token cannot be refunded")
+	ErrTokenGivenAway          = errors.New("purchase token is held by someone else")
+	ErrCouponNotFound          = errors.New("coupon not found")
+	ErrCouponUnavailable       = errors.New("coupon is expired or has reached its usage limit")
+	ErrCouponNotApplicable     = errors.New("coupon does not apply to any item in the cart")
+	ErrCouponAlreadyApplied    = errors.New("coupon already applied to cart")
+	ErrCouponCodeTaken         = errors.New("coupon code already exists")
+	ErrInvalidCoupon           = errors.New("invalid coupon definition")
+	ErrBundleNotFound          = errors.New("bundle not found")
+	ErrBundleUnavailable       = errors.New("bundle is no longer on sale")
+	ErrBundleAlreadyInCart     = errors.New("bundle already in shopping cart")
+	ErrCartChanged             = errors.New("cart changed since items were added")
+	ErrCartModified            = errors.New("cart was modified during checkout")
+	ErrUnsupportedCurrency     = errors.New("currency is not supported")
+	ErrInvalidBundle           = errors.New("invalid bundle definition")
+	ErrInvalidGift             = errors.New("invalid gift")
+	ErrRecipientNotFound       = errors.New("recipient not found")
+	ErrGiftNotFound            = errors.New("gift code not found")
+	ErrGiftAlreadyRedeemed     = errors.New("gift code has already been redeemed")
+	ErrTokenNotTransferable    = errors.New("only active, unused tokens can be transferred")
+	ErrGuideNotFound           = errors.New("tour has no guide to credit")
+	ErrLedgerEntryNotFound     = errors.New("ledger transaction not found")
+	ErrInvalidPayout           = errors.New("invalid payout")
+	ErrInsufficientBalance     = errors.New("payout exceeds the guide's balance")
+	ErrInvalidPeriod           = errors.New("invalid statement period")
+	ErrInvoiceNotFound         = errors.New("invoice not found")
+	ErrInvoiceImmutable        = errors.New("issued invoices cannot be changed")
+	ErrOrderNotInvoiceable     = errors.New("order has not been paid")
+	ErrInvalidCreditNote       = errors.New("invalid credit note")
+	ErrAlreadyCredited         = errors.New("invoice line has already been credited")
+	ErrInvalidClientID         = errors.New("invalid client ID")
+	ErrSavedItemNotFound       = errors.New("saved item not found")
+	ErrWishlistItemNotFound    = errors.New("tour is not in the wishlist")
+	ErrEmailNotVerified        = errors.New("email address is not verified")
+)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Event is an outbox entry that an EventPublisher can deliver, such as a
+// TokenEvent, CartEvent or WishlistEvent.
+type Event interface {
+	// EventID identifies the event across all outboxes.
+	EventID() string
+	// EventType is one of the TokenEvent, CartEvent or WishlistEvent type
+	// constants.
+	EventType() string
+}
+
+// EventPublisher delivers token, cart and wishlist events to the services that react
+// to them, such as notifications. Events are handed over in the order they
+// occurred and may be delivered more than once, so consumers should dedupe
+// on the event ID. Implementations must be safe for concurrent use.
+type EventPublisher interface {
+	// Name identifies the publisher in logs.
+	Name() string
+	// Publish delivers one event; an error leaves it queued for the next run.
+	Publish(ctx context.Context, event Event) error
+}
+
+// Token events keep their plain IDs, which consumers already dedupe on.
+func (event *TokenEvent) EventID() string {
+	return fmt.Sprint(event.ID)
+}
+
+func (event *TokenEvent) EventType() string {
+	return event.Type
+}
+
+func (event *CartEvent) EventID() string {
+	return fmt.Sprintf("cart-%d", event.ID)
+}
+
+func (event *CartEvent) EventType() string {
+	return event.Type
+}
+
+func (event *WishlistEvent) EventID() string {
+	return fmt.Sprintf("wishlist-%d", event.ID)
+}
+
+func (event *WishlistEvent) EventType() string {
+	return event.Type
+}
+
+// NewEventPublisher picks the publisher configured by EVENT_PUBLISHER: "log"
+// writes events to the service log, "webhook" posts them to
+// EVENT_WEBHOOK_URL.
+func NewEventPublisher() EventPublisher {
+	name := GetEnv("EVENT_PUBLISHER", "log")
+	switch name {
+	case "webhook":
+		url := GetEnv("EVENT_WEBHOOK_URL", "")
+		if url != "" {
+			return NewWebhookEventPublisher(url, GetEnv("EVENT_WEBHOOK_SECRET", ""))
+		}
+		log.Printf("EVENT_WEBHOOK_URL is not set, falling back to log publisher")
+	case "log":
+	default:
+		log.Printf("Unknown event publisher %q, falling back to log publisher", name)
+	}
+	return NewLogEventPublisher()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var exportClient = &http.Client{Timeout: 10 * time.Second}
+
+// ExportSource is another service that holds part of a user's data and
+// serves it at /internal/export/{username}.
+type ExportSource struct {
+	Name string
+	URL  string
+}
+
+// exportSources lists the services asked for their part of a full export,
+// in the order they appear in the archive.
+func exportSources() []ExportSource {
+	return []ExportSource{
+		{Name: "tour", URL: GetEnv("TOUR_SERVICE_URL", "http://tour-service:3006")},
+		{Name: "review", URL: GetEnv("REVIEW_SERVICE_URL", "http://review-service:3007")},
+		{Name: "blog", URL: GetEnv("BLOG_SERVICE_URL", "http://blog-service:3002")},
+		{Name: "follower", URL: GetEnv("FOLLOWER_SERVICE_URL", "http://follower-service:3005")},
+		{Name: "stakeholder", URL: GetEnv("STAKEHOLDER_SERVICE_URL", "http://stakeholder-service:3003")},
+	}
+}
+
+// fetchServiceExport returns a service's export of the user as the JSON it
+// sent, so that it ends up in the archive unchanged.
+func fetchServiceExport(ctx context.Context, source ExportSource, username string) (json.RawMessage, error) {
+	endpoint := fmt.Sprintf("%s/internal/export/%s", source.URL, url.PathEscape(username))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := exportClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s export: %v", source.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s service returned status: %d", source.Name, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s export: %v", source.Name, err)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%s service returned invalid JSON", source.Name)
+	}
+	return body, nil
+}
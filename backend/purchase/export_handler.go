@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type ExportHandler struct {
+	service *ExportService
+}
+
+func NewExportHandler(service *ExportService) *ExportHandler {
+	return &ExportHandler{service: service}
+}
+
+// ExportPurchases sends the caller's purchase data as a zip download.
+func (h *ExportHandler) ExportPurchases(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, false)
+}
+
+// ExportAll sends the caller's data from every service as a zip download.
+// Services that cannot be reached are listed as failed in manifest.json.
+func (h *ExportHandler) ExportAll(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, true)
+}
+
+func (h *ExportHandler) export(w http.ResponseWriter, r *http.Request, full bool) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := h.service.GetPurchaseData(userID)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to collect purchase data: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	var archive bytes.Buffer
+	err = h.service.WriteArchive(r.Context(), &archive, data, full, now)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to build export: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	kind := "purchases"
+	if full {
+		kind = "data"
+	}
+	filename := fmt.Sprintf("%s-%s-%s.zip", kind, userID, now.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive.Bytes())
+}
+
+func (h *ExportHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ExportService builds the data export a user is entitled to: a zip archive
+// with what the purchase service keeps about them, as JSON and as CSV. A
+// full export also holds the user's data from the other services, collected
+// over their internal export endpoints.
+type ExportService struct {
+	cartRepository      *CartRepository
+	savedItemRepository *SavedItemRepository
+	wishlistRepository  *WishlistRepository
+	orderRepository     *OrderRepository
+	purchaseRepository  *PurchaseRepository
+	refundRepository    *RefundRepository
+	giftRepository      *GiftRepository
+}
+
+func NewExportService(cartRepo *CartRepository, savedItemRepo *SavedItemRepository, wishlistRepo *WishlistRepository, orderRepo *OrderRepository, purchaseRepo *PurchaseRepository, refundRepo *RefundRepository, giftRepo *GiftRepository) *ExportService {
+	return &ExportService{
+		cartRepository:      cartRepo,
+		savedItemRepository: savedItemRepo,
+		wishlistRepository:  wishlistRepo,
+		orderRepository:     orderRepo,
+		purchaseRepository:  purchaseRepo,
+		refundRepository:    refundRepo,
+		giftRepository:      giftRepo,
+	}
+}
+
+// GetPurchaseData collects the user's carts, orders, tokens, refunds and the
+// gifts they bought. The cart is exported as stored, without pricing it
+// again.
+func (s *ExportService) GetPurchaseData(userID string) (*PurchaseDataExport, error) {
+	data := &PurchaseDataExport{Username: userID}
+
+	cart, err := s.cartRepository.GetCartByUserID(userID)
+	if err != nil && err != ErrCartNotFound {
+		return nil, err
+	}
+	data.Cart = cart
+
+	if data.SavedItems, err = s.savedItemRepository.GetSavedItems(userID); err != nil {
+		return nil, err
+	}
+	if data.Wishlist, err = s.wishlistRepository.GetItems(userID); err != nil {
+		return nil, err
+	}
+	if data.Orders, err = s.orderRepository.GetOrdersByUserID(userID); err != nil {
+		return nil, err
+	}
+	if data.Tokens, err = s.purchaseRepository.GetTokensByUserID(userID); err != nil {
+		return nil, err
+	}
+	if data.Refunds, err = s.refundRepository.GetRefundsByUserID(userID); err != nil {
+		return nil, err
+	}
+	if data.Gifts, err = s.giftRepository.GetGiftsByPurchaser(userID); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteArchive writes the zip archive of data to w. With full set the other
+// services are asked for their part first; a service that fails is recorded
+// in the manifest instead of failing the export.
+func (s *ExportService) WriteArchive(ctx context.Context, w io.Writer, data *PurchaseDataExport, full bool, now time.Time) error {
+	manifest := ExportManifest{Username: data.Username, ExportedAt: now.UTC()}
+
+	var services []json.RawMessage
+	if full {
+		services, manifest.Services = s.collectServiceExports(ctx, data.Username)
+	}
+
+	archive := &exportArchive{writer: zip.NewWriter(w), manifest: &manifest, modified: now}
+	archive.writeJSON("purchases/purchases.json", data)
+	archive.writeCSV("purchases/orders.csv", orderRows(data.Orders))
+	archive.writeCSV("purchases/tokens.csv", tokenRows(data.Tokens))
+	archive.writeCSV("purchases/refunds.csv", refundRows(data.Refunds))
+	archive.writeCSV("purchases/cart.csv", cartRows(data))
+	for i, status := range manifest.Services {
+		if services[i] != nil {
+			archive.writeRaw(status.File, services[i])
+		}
+	}
+	archive.writeJSON("manifest.json", manifest)
+
+	if archive.err != nil {
+		return archive.err
+	}
+	return archive.writer.Close()
+}
+
+// collectServiceExports asks every export source for the user's data at
+// once. Exports are returned in the order of exportSources, nil where the
+// service failed.
+func (s *ExportService) collectServiceExports(ctx context.Context, username string) ([]json.RawMessage, []ServiceExportStatus) {
+	sources := exportSources()
+	exports := make([]json.RawMessage, len(sources))
+	statuses := make([]ServiceExportStatus, len(sources))
+
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source ExportSource) {
+			defer wg.Done()
+
+			export, err := fetchServiceExport(ctx, source, username)
+			if err != nil {
+				log.Printf("Export: no %s data for %s: %v", source.Name, username, err)
+				statuses[i] = ServiceExportStatus{Service: source.Name, Status: ExportStatusFailed, Error: err.Error()}
+				return
+			}
+			exports[i] = export
+			statuses[i] = ServiceExportStatus{Service: source.Name, Status: ExportStatusOK, File: "services/" + source.Name + ".json"}
+		}(i, source)
+	}
+	wg.Wait()
+
+	return exports, statuses
+}
+
+// exportArchive writes files into a zip and lists them in the manifest. The
+// first error stops all further writes.
+type exportArchive struct {
+	writer   *zip.Writer
+	manifest *ExportManifest
+	modified time.Time
+	err      error
+}
+
+func (a *exportArchive) create(name string) io.Writer {
+	if a.err != nil {
+		return nil
+	}
+	file, err := a.writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.modified})
+	if err != nil {
+		a.err = err
+		return nil
+	}
+	if name != "manifest.json" {
+		a.manifest.Files = append(a.manifest.Files, name)
+	}
+	return file
+}
+
+func (a *exportArchive) writeJSON(name string, v interface{}) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		a.err = err
+		return
+	}
+	a.writeRaw(name, body)
+}
+
+func (a *exportArchive) writeRaw(name string, body []byte) {
+	file := a.create(name)
+	if file == nil {
+		return
+	}
+	_, a.err = file.Write(body)
+}
+
+func (a *exportArchive) writeCSV(name string, rows [][]string) {
+	file := a.create(name)
+	if file == nil {
+		return
+	}
+	writer := csv.NewWriter(file)
+	writer.WriteAll(rows)
+	a.err = writer.Error()
+}
+
+// orderRows has one row per order line, amounts in major units of the order
+// currency.
+func orderRows(orders []Order) [][]string {
+	rows := [][]string{{"order_id", "status", "ordered_at", "paid_at", "line_id", "tour_id", "tour_name", "bundle_name", "unit_price", "discount", "tax", "total", "currency"}}
+	for _, order := range orders {
+		for _, line := range order.Lines {
+			rows = append(rows, []string{
+				formatID(order.ID),
+				order.Status,
+				formatTime(&order.CreatedAt),
+				formatTime(order.PaidAt),
+				formatID(line.ID),
+				formatID(line.TourID),
+				line.TourName,
+				line.BundleName,
+				formatMinorUnits(line.UnitPrice, order.Currency),
+				formatMinorUnits(line.Discount, order.Currency),
+				formatMinorUnits(line.Tax, order.Currency),
+				formatMinorUnits(line.Total, order.Currency),
+				order.Currency,
+			})
+		}
+	}
+	return rows
+}
+
+func tokenRows(tokens []TourPurchaseToken) [][]string {
+	rows := [][]string{{"token", "tour_id", "tour_name", "status", "purchased_by", "order_id", "purchased_at", "expires_at", "used_at"}}
+	for _, token := range tokens {
+		orderID := ""
+		if token.OrderID != nil {
+			orderID = formatID(*token.OrderID)
+		}
+		rows = append(rows, []string{
+			token.Token,
+			formatID(token.TourID),
+			token.TourName,
+			token.Status,
+			token.PurchasedBy,
+			orderID,
+			formatTime(&token.CreatedAt),
+			formatTime(&token.ExpiresAt),
+			formatTime(token.UsedAt),
+		})
+	}
+	return rows
+}
+
+func refundRows(refunds []Refund) [][]string {
+	rows := [][]string{{"refund_id", "order_id", "tour_id", "tour_name", "amount", "currency", "reason", "status", "requested_at", "completed_at"}}
+	for _, refund := range refunds {
+		rows = append(rows, []string{
+			formatID(refund.ID),
+			formatID(refund.OrderID),
+			formatID(refund.TourID),
+			refund.TourName,
+			formatMinorUnits(refund.Amount, refund.Currency),
+			refund.Currency,
+			refund.Reason,
+			refund.Status,
+			formatTime(&refund.CreatedAt),
+			formatTime(refund.CompletedAt),
+		})
+	}
+	return rows
+}
+
+// cartRows lists the tours in the cart, saved for later and in the wishlist,
+// with the guide's price as last seen.
+func cartRows(data *PurchaseDataExport) [][]string {
+	rows := [][]string{{"list", "tour_id", "tour_name", "bundle_id", "price", "currency", "added_at"}}
+	if data.Cart != nil {
+		for _, item := range data.Cart.Items {
+			rows = append(rows, []string{"cart", formatID(item.TourID), item.TourName, formatOptionalID(item.BundleID), formatMinorUnits(item.BasePrice, item.BaseCurrency), item.BaseCurrency, formatTime(&item.CreatedAt)})
+		}
+	}
+	for _, item := range data.SavedItems {
+		rows = append(rows, []string{"saved", formatID(item.TourID), item.TourName, formatOptionalID(item.BundleID), formatMinorUnits(item.BasePrice, item.BaseCurrency), item.BaseCurrency, formatTime(&item.CreatedAt)})
+	}
+	for _, item := range data.Wishlist {
+		rows = append(rows, []string{"wishlist", formatID(item.TourID), item.TourName, "", formatMinorUnits(item.LastPrice, item.LastCurrency), item.LastCurrency, formatTime(&item.CreatedAt)})
+	}
+	return rows
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func formatOptionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return formatID(*id)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FakeBehaviorApprove = "approve" // every payment succeeds
+	FakeBehaviorDecline = "decline" // authorization is declined
+	FakeBehaviorTimeout = "timeout" // calls hang until the caller's deadline
+)
+
+// FakePaymentProvider is an in-memory gateway for local development and
+// tests. Its behavior is fixed at construction, see the FakeBehavior constants.
+type FakePaymentProvider struct {
+	mu            sync.Mutex
+	intents       map[string]*PaymentIntent
+	keys          map[string]string // idempotency key -> intent ID
+	behavior      string
+	webhookSecret string
+}
+
+func NewFakePaymentProvider(behavior string, webhookSecret string) *FakePaymentProvider {
+	return &FakePaymentProvider{
+		intents:       make(map[string]*PaymentIntent),
+		keys:          make(map[string]string),
+		behavior:      behavior,
+		webhookSecret: webhookSecret,
+	}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakePaymentProvider) Authorize(ctx context.Context, request AuthorizeRequest) (*PaymentIntent, error) {
+	if err := p.simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if intentID, ok := p.keys[request.IdempotencyKey]; ok && request.IdempotencyKey != "" {
+		return p.result(p.intents[intentID])
+	}
+
+	intent := &PaymentIntent{
+		ID:        "pi_" + uuid.New().String(),
+		Reference: request.Reference,
+		Amount:    request.Amount,
+		Currency:  request.Currency,
+		Status:    PaymentStatusAuthorized,
+	}
+	if p.behavior == FakeBehaviorDecline {
+		intent.Status = PaymentStatusFailed
+		intent.FailureReason = "card declined"
+	}
+	p.intents[intent.ID] = intent
+	if request.IdempotencyKey != "" {
+		p.keys[request.IdempotencyKey] = intent.ID
+	}
+
+	return p.result(intent)
+}
+
+func (p *FakePaymentProvider) Capture(ctx context.Context, intentID string) (*PaymentIntent, error) {
+	if err := p.simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment intent %s", intentID)
+	}
+	if intent.Status != PaymentStatusAuthorized && intent.Status != PaymentStatusCaptured {
+		return nil, fmt.Errorf("payment intent %s cannot be captured in status %s", intentID, intent.Status)
+	}
+	intent.Status = PaymentStatusCaptured
+
+	return p.result(intent)
+}
+
+func (p *FakePaymentProvider) Refund(ctx context.Context, intentID string, amount int64) (*PaymentIntent, error) {
+	if err := p.simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment intent %s", intentID)
+	}
+	if intent.Status != PaymentStatusCaptured {
+		return nil, fmt.Errorf("payment intent %s cannot be refunded in status %s", intentID, intent.Status)
+	}
+	if amount <= 0 || intent.RefundedAmount+amount > intent.Amount {
+		return nil, fmt.Errorf("refund amount %d exceeds refundable balance", amount)
+	}
+	intent.RefundedAmount += amount
+	if intent.RefundedAmount >= intent.Amount {
+		intent.Status = PaymentStatusRefunded
+	}
+
+	return p.result(intent)
+}
+
+// ParseWebhook expects a JSON PaymentEvent signed with the hex encoded
+// HMAC-SHA256 of the payload under the webhook secret.
+func (p *FakePaymentProvider) ParseWebhook(payload []byte, signature string) (*PaymentEvent, error) {
+	if !hmac.Equal([]byte(p.Sign(payload)), []byte(signature)) {
+		return nil, ErrInvalidWebhookSignature
+	}
+
+	var event PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %v", err)
+	}
+
+	p.mu.Lock()
+	if intent, ok := p.intents[event.IntentID]; ok {
+		intent.Status = event.Status
+		intent.FailureReason = event.FailureReason
+	}
+	p.mu.Unlock()
+
+	return &event, nil
+}
+
+// Sign computes the webhook signature for payload, for use by local tooling.
+func (p *FakePaymentProvider) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.webhookSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// result returns a snapshot of intent so callers never share provider state.
+func (p *FakePaymentProvider) result(intent *PaymentIntent) (*PaymentIntent, error) {
+	snapshot := *intent
+	if snapshot.Status == PaymentStatusFailed {
+		return &snapshot, ErrPaymentDeclined
+	}
+	return &snapshot, nil
+}
+
+func (p *FakePaymentProvider) simulate(ctx context.Context) error {
+	if p.behavior == FakeBehaviorTimeout {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type GiftHandler struct {
+	service *GiftService
+}
+
+func NewGiftHandler(service *GiftService) *GiftHandler {
+	return &GiftHandler{service: service}
+}
+
+func (h *GiftHandler) RedeemGift(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	var request RedeemGiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	gift, token, err := h.service.RedeemGift(userID, request.Code)
+	if err != nil {
+		switch err {
+		case ErrGiftNotFound:
+			h.sendErrorResponse(w, "Gift code not found", http.StatusNotFound)
+		case ErrGiftAlreadyRedeemed:
+			h.sendErrorResponse(w, "Gift code has already been redeemed", http.StatusConflict)
+		default:
+			h.sendErrorResponse(w, "Failed to redeem gift: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(GiftResponse{Gift: gift, Token: token, Message: "Gift redeemed successfully"})
+}
+
+// GetGifts lists the gifts the user sent, or received with ?received=true.
+func (h *GiftHandler) GetGifts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	var gifts []Gift
+	var err error
+	if r.URL.Query().Get("received") == "true" {
+		gifts, err = h.service.GetReceivedGifts(userID)
+	} else {
+		gifts, err = h.service.GetSentGifts(userID)
+	}
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get gifts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(GiftsResponse{Gifts: gifts, Message: "Gifts retrieved successfully"})
+}
+
+func (h *GiftHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GiftRepository struct {
+	database *Database
+}
+
+func NewGiftRepository(db *Database) *GiftRepository {
+	return &GiftRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *GiftRepository) WithTx(tx *Database) *GiftRepository {
+	return &GiftRepository{database: tx}
+}
+
+func (r *GiftRepository) CreateGift(gift *Gift) error {
+	result := r.database.db.Create(gift)
+	return result.Error
+}
+
+func (r *GiftRepository) UpdateGift(gift *Gift) error {
+	result := r.database.db.Save(gift)
+	return result.Error
+}
+
+// LockGiftByCode loads a gift and locks its row until the surrounding
+// transaction ends, so a code cannot be redeemed twice concurrently.
+func (r *GiftRepository) LockGiftByCode(code string) (*Gift, error) {
+	var gift Gift
+	result := r.database.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&gift)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrGiftNotFound
+		}
+		return nil, result.Error
+	}
+	return &gift, nil
+}
+
+func (r *GiftRepository) GetGiftsByOrderID(orderID uint) ([]Gift, error) {
+	var gifts []Gift
+	result := r.database.db.Where("order_id = ?", orderID).Order("id").Find(&gifts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return gifts, nil
+}
+
+func (r *GiftRepository) GetGiftsByPurchaser(username string) ([]Gift, error) {
+	var gifts []Gift
+	result := r.database.db.Where("purchased_by = ?", username).Order("created_at DESC").Find(&gifts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return gifts, nil
+}
+
+func (r *GiftRepository) GetGiftsByRecipient(username string) ([]Gift, error) {
+	var gifts []Gift
+	result := r.database.db.Where("recipient = ?", username).Order("created_at DESC").Find(&gifts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return gifts, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+)
+
+const maxGiftMessageLength = 500
+
+// giftCodeAlphabet leaves out characters that are easy to mistake for one
+// another when a code is read out or typed.
+const giftCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+type GiftService struct {
+	database           *Database
+	giftRepository     *GiftRepository
+	purchaseRepository *PurchaseRepository
+	orderRepository    *OrderRepository
+}
+
+func NewGiftService(db *Database, giftRepo *GiftRepository, purchaseRepo *PurchaseRepository, orderRepo *OrderRepository) *GiftService {
+	return &GiftService{
+		database:           db,
+		giftRepository:     giftRepo,
+		purchaseRepository: purchaseRepo,
+		orderRepository:    orderRepo,
+	}
+}
+
+// RedeemGift issues the purchase token of a pending gift code to userID.
+func (s *GiftService) RedeemGift(userID string, code string) (*Gift, *TourPurchaseToken, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	var gift *Gift
+	var token *TourPurchaseToken
+	err := s.database.Transaction(func(tx *Database) error {
+		giftRepo := s.giftRepository.WithTx(tx)
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+		orderRepo := s.orderRepository.WithTx(tx)
+
+		var err error
+		gift, err = giftRepo.LockGiftByCode(code)
+		if err != nil {
+			return err
+		}
+		if gift.Status != GiftStatusPending {
+			return ErrGiftAlreadyRedeemed
+		}
+
+		line := &OrderLine{ID: gift.OrderLineID, TourID: gift.TourID, TourName: gift.TourName}
+		token, err = issueToken(purchaseRepo, orderRepo, userID, gift.PurchasedBy, gift.OrderID, line)
+		if err != nil {
+			return err
+		}
+
+		redeemedAt := time.Now()
+		gift.Status = GiftStatusRedeemed
+		gift.Recipient = userID
+		gift.TokenID = &token.ID
+		gift.RedeemedAt = &redeemedAt
+		return giftRepo.UpdateGift(gift)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return gift, token, nil
+}
+
+func (s *GiftService) GetSentGifts(userID string) ([]Gift, error) {
+	return s.giftRepository.GetGiftsByPurchaser(userID)
+}
+
+func (s *GiftService) GetReceivedGifts(userID string) ([]Gift, error) {
+	return s.giftRepository.GetGiftsByRecipient(userID)
+}
+
+// validateGift checks a gift before checkout. A named recipient must be a
+// registered user other than the buyer.
+func validateGift(userID string, gift *GiftRequest) error {
+	gift.Recipient = strings.TrimSpace(gift.Recipient)
+	if gift.Recipient == userID || len(gift.Message) > maxGiftMessageLength {
+		return ErrInvalidGift
+	}
+	if gift.Recipient == "" {
+		return nil
+	}
+	return checkUserExists(gift.Recipient)
+}
+
+// generateGiftCode returns a random code such as "K7QD-M2XA-9HPT".
+func generateGiftCode() string {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+
+	var code strings.Builder
+	for i, b := range random {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(giftCodeAlphabet[int(b)%len(giftCodeAlphabet)])
+	}
+	return code.String()
+}
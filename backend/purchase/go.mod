@@ -3,11 +3,13 @@ module purchase
 go 1.21
 
 require (
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
 	github.com/rs/cors v1.10.1
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
 	gorm.io/driver/postgres v1.5.4
 	gorm.io/gorm v1.25.5
-	github.com/google/uuid v1.5.0
 )
 
 require (
@@ -17,7 +19,20 @@ require (
 	github.com/jackc/puddle/v2 v2.2.1 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
-	golang.org/x/crypto v0.15.0 // indirect
-	golang.org/x/sync v0.5.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
-)
\ No newline at end of file
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
+
+require (
+	authz v0.0.0
+	money v0.0.0
+)
+
+replace (
+	authz => ../authz
+	money => ../money
+)
@@ -0,0 +1,173 @@
+package main
+
+//go:generate protoc --go_out=. --go-grpc_out=. purchase.proto
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"purchase/purchasepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// PurchaseGRPCServer serves the PurchaseService from purchase.proto. Errors
+// are returned as gRPC status codes, and calls that arrive without a
+// deadline get a default one.
+type PurchaseGRPCServer struct {
+	purchasepb.UnimplementedPurchaseServiceServer
+	service        *PurchaseService
+	defaultTimeout time.Duration
+}
+
+func NewPurchaseGRPCServer(service *PurchaseService) *PurchaseGRPCServer {
+	timeout, err := time.ParseDuration(GetEnv("GRPC_DEFAULT_TIMEOUT", "10s"))
+	if err != nil || timeout <= 0 {
+		log.Printf("Invalid GRPC_DEFAULT_TIMEOUT, using 10s")
+		timeout = 10 * time.Second
+	}
+	return &PurchaseGRPCServer{service: service, defaultTimeout: timeout}
+}
+
+func (s *PurchaseGRPCServer) Checkout(ctx context.Context, req *purchasepb.CheckoutRequest) (*purchasepb.CheckoutResponse, error) {
+	if req.Username == "" {
+		return nil, status.Error(codes.InvalidArgument, "username is required")
+	}
+
+	// Callers acting for a user forward the verification from their token
+	// the way the gateway does over HTTP
+	emailVerified := false
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		values := md.Get("x-email-verified")
+		emailVerified = len(values) > 0 && values[0] == "true"
+	}
+
+	result, err := s.service.Checkout(req.Username, emailVerified, req.IdempotencyKey, nil)
+	if err != nil {
+		return nil, checkoutStatus(err)
+	}
+
+	tokens := make([]string, 0, len(result.Tokens))
+	for _, token := range result.Tokens {
+		tokens = append(tokens, token.Token)
+	}
+	return &purchasepb.CheckoutResponse{
+		Success: true,
+		Message: "Checkout successful",
+		Tokens:  tokens,
+	}, nil
+}
+
+func (s *PurchaseGRPCServer) GetPurchasedTours(ctx context.Context, req *purchasepb.GetPurchasedToursRequest) (*purchasepb.GetPurchasedToursResponse, error) {
+	if req.Username == "" {
+		return nil, status.Error(codes.InvalidArgument, "username is required")
+	}
+
+	tokens, err := s.service.GetUserTokens(req.Username)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get purchased tours")
+	}
+
+	messages := make([]*purchasepb.TokenMessage, 0, len(tokens))
+	for _, token := range tokens {
+		messages = append(messages, &purchasepb.TokenMessage{
+			Token:       token.Token,
+			TourId:      uint64(token.TourID),
+			TourName:    token.TourName,
+			PurchasedAt: token.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return &purchasepb.GetPurchasedToursResponse{Tokens: messages}, nil
+}
+
+// ValidateAccess answers whether the user holds a usable token for the
+// tour: NOT_FOUND without a purchase, FAILED_PRECONDITION when the purchase
+// expired or was revoked.
+func (s *PurchaseGRPCServer) ValidateAccess(ctx context.Context, req *purchasepb.ValidateAccessRequest) (*purchasepb.ValidateAccessResponse, error) {
+	if req.Username == "" || req.TourId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "username and tour_id are required")
+	}
+
+	token, err := s.service.ValidateAccess(req.Username, uint(req.TourId))
+	if err != nil {
+		switch err {
+		case ErrTokenNotFound:
+			return nil, status.Error(codes.NotFound, "no valid purchase found for this tour")
+		case ErrTokenExpired:
+			return nil, status.Error(codes.FailedPrecondition, "purchase token has expired")
+		case ErrTokenInvalid:
+			return nil, status.Error(codes.FailedPrecondition, "purchase token is invalid")
+		default:
+			return nil, status.Error(codes.Internal, "access validation failed")
+		}
+	}
+
+	return &purchasepb.ValidateAccessResponse{
+		Token:     token.Token,
+		Status:    token.Status,
+		ExpiresAt: token.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+func checkoutStatus(err error) error {
+	switch err {
+	case ErrCartNotFound, ErrTourNotFound, ErrRecipientNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case ErrEmptyCart, ErrInvalidIdempotencyKey, ErrInvalidGift:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case ErrEmailNotVerified:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case ErrCheckoutInProgress:
+		return status.Error(codes.Aborted, err.Error())
+	case ErrCartChanged, ErrCartModified, ErrBundleUnavailable, ErrCouponUnavailable, ErrPaymentDeclined, ErrPaymentFailed:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case ErrUnsupportedCurrency:
+		return status.Error(codes.Unavailable, err.Error())
+	case ErrPaymentTimeout:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, "checkout failed")
+	}
+}
+
+// withDeadline gives calls without a deadline the default one and turns
+// away calls whose deadline has already passed.
+func (s *PurchaseGRPCServer) withDeadline(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.defaultTimeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	resp, err := handler(ctx, req)
+	if err == nil && ctx.Err() != nil {
+		// The caller gave up, it never sees this response
+		log.Printf("gRPC %s finished after its deadline", info.FullMethod)
+	}
+	return resp, err
+}
+
+func (s *PurchaseGRPCServer) Start(port string) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Failed to start gRPC server: %v", err)
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(s.withDeadline))
+	purchasepb.RegisterPurchaseServiceServer(server, s)
+	reflection.Register(server)
+
+	log.Printf("Purchase gRPC server listening on port %s", port)
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("gRPC server stopped: %v", err)
+	}
+}
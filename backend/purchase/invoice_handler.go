@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"authz"
+
+	"github.com/gorilla/mux"
+)
+
+type InvoiceHandler struct {
+	service *InvoiceService
+}
+
+func NewInvoiceHandler(service *InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{service: service}
+}
+
+func (h *InvoiceHandler) GetInvoices(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	invoices, err := h.service.GetInvoices(username)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get invoices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(InvoicesResponse{Invoices: invoices, Message: "Invoices retrieved successfully"})
+}
+
+// GetInvoice returns an invoice or credit note as JSON or, with ?format=pdf,
+// as a PDF download.
+func (h *InvoiceHandler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	invoiceID, err := strconv.ParseUint(mux.Vars(r)["invoiceId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	invoice, err := h.service.GetInvoice(uint(invoiceID), username, authz.Has(r, authz.OrderRead))
+	if err != nil {
+		h.handleInvoiceError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "pdf" {
+		h.sendPDF(w, invoice.Number+".pdf", renderInvoicePDF(invoice))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(InvoiceResponse{Invoice: invoice, Message: "Invoice retrieved successfully"})
+}
+
+func (h *InvoiceHandler) GetOrderInvoices(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	orderID, err := strconv.ParseUint(mux.Vars(r)["orderId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	invoices, err := h.service.GetOrderInvoices(uint(orderID), username, authz.Has(r, authz.OrderRead))
+	if err != nil {
+		h.handleInvoiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(InvoicesResponse{Invoices: invoices, Message: "Invoices retrieved successfully"})
+}
+
+// GetReceipt returns the receipt of an order as JSON or, with ?format=pdf,
+// as a PDF download.
+func (h *InvoiceHandler) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	orderID, err := strconv.ParseUint(mux.Vars(r)["orderId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := h.service.GetReceipt(uint(orderID), username, authz.Has(r, authz.OrderRead))
+	if err != nil {
+		h.handleInvoiceError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "pdf" {
+		h.sendPDF(w, fmt.Sprintf("receipt-%d.pdf", receipt.OrderID), renderReceiptPDF(receipt))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ReceiptResponse{Receipt: receipt, Message: "Receipt retrieved successfully"})
+}
+
+func (h *InvoiceHandler) CreateCreditNote(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.InvoiceCredit) {
+		h.sendErrorResponse(w, "You are not allowed to issue credit notes", http.StatusForbidden)
+		return
+	}
+
+	invoiceID, err := strconv.ParseUint(mux.Vars(r)["invoiceId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var request CreateCreditNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.service.CreateCreditNote(uint(invoiceID), request.OrderLineIDs, request.Reason, r.Header.Get("x-username"))
+	if err != nil {
+		h.handleInvoiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(InvoiceResponse{Invoice: note, Message: "Credit note issued successfully"})
+}
+
+func (h *InvoiceHandler) handleInvoiceError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvoiceNotFound:
+		h.sendErrorResponse(w, "Invoice not found", http.StatusNotFound)
+	case ErrOrderNotFound:
+		h.sendErrorResponse(w, "Order not found", http.StatusNotFound)
+	case ErrUnauthorized:
+		h.sendErrorResponse(w, "Access denied", http.StatusForbidden)
+	case ErrOrderNotInvoiceable:
+		h.sendErrorResponse(w, "Order has not been paid", http.StatusConflict)
+	case ErrInvalidCreditNote:
+		h.sendErrorResponse(w, "A credit note needs a reason and lines of the invoice it corrects", http.StatusBadRequest)
+	case ErrAlreadyCredited:
+		h.sendErrorResponse(w, "Invoice line has already been credited", http.StatusConflict)
+	default:
+		h.sendErrorResponse(w, "Invoice request failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *InvoiceHandler) sendPDF(w http.ResponseWriter, filename string, pdf []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+func (h *InvoiceHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
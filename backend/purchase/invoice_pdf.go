@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// renderInvoicePDF lays out an invoice or credit note as a PDF.
+func renderInvoicePDF(invoice *Invoice) []byte {
+	money := func(amount int64) string {
+		return formatMinorUnits(amount, invoice.Currency)
+	}
+
+	doc := newPDFDocument()
+	title := "INVOICE"
+	if invoice.Kind == InvoiceKindCreditNote {
+		title = "CREDIT NOTE"
+	}
+	doc.Bold(pdfColumnsLR(title, invoice.Number, 14), 14)
+	doc.Blank()
+	doc.Line(fmt.Sprintf("Issued: %s", invoice.IssuedAt.Format("2006-01-02")))
+	doc.Line(fmt.Sprintf("Order:  %d", invoice.OrderID))
+	if invoice.Kind == InvoiceKindCreditNote {
+		doc.Line(fmt.Sprintf("Corrects invoice: %s", invoice.CorrectsNumber))
+		doc.Line(fmt.Sprintf("Reason: %s", invoice.Reason))
+	}
+	doc.Blank()
+	doc.Line("Seller: " + invoice.Seller.DisplayName())
+	doc.Line("Buyer:  " + invoice.Buyer.DisplayName())
+	doc.Blank()
+
+	doc.Bold(pdfRow("Description", "Price", "Discount", "Tax", "Amount"), pdfFontSize)
+	doc.Rule()
+	for _, line := range invoice.Lines {
+		doc.Line(pdfRow(line.Description, money(line.UnitPrice), money(line.Discount), pdfTaxRate(line.TaxRule, line.TaxRate), money(line.Total)))
+	}
+	doc.Rule()
+	doc.Line(pdfRow("Subtotal", "", "", "", money(invoice.Subtotal)))
+	doc.Line(pdfRow("Discounts", "", "", "", money(-invoice.DiscountTotal)))
+	doc.Line(pdfRow("Tax", "", "", "", money(invoice.TaxTotal)))
+	label := "Total"
+	if invoice.Kind == InvoiceKindCreditNote {
+		label = "Total credited"
+	}
+	doc.Bold(pdfRow(label, "", "", "", money(invoice.Total)+" "+invoice.Currency), pdfFontSize)
+
+	if len(invoice.Taxes) > 0 {
+		doc.Blank()
+		doc.Bold(pdfRow("Tax summary", "Rate", "Net", "Tax", ""), pdfFontSize)
+		for _, tax := range invoice.Taxes {
+			doc.Line(pdfRow("  "+tax.Rule, pdfTaxRate(tax.Rule, tax.Rate), money(tax.Net), money(tax.Tax), ""))
+		}
+	}
+
+	if len(invoice.Discounts) > 0 {
+		doc.Blank()
+		doc.Line("Discounts applied:")
+		for _, discount := range invoice.Discounts {
+			name := discount.Description
+			if discount.Code != "" {
+				name = discount.Code + " - " + name
+			}
+			doc.Line(pdfRow("  "+name, "", "", "", money(-discount.Amount)))
+		}
+	}
+
+	return doc.Bytes()
+}
+
+// renderReceiptPDF lays out a receipt as a PDF.
+func renderReceiptPDF(receipt *Receipt) []byte {
+	money := func(amount int64) string {
+		return formatMinorUnits(amount, receipt.Currency)
+	}
+
+	doc := newPDFDocument()
+	doc.Bold(pdfColumnsLR("RECEIPT", fmt.Sprintf("Order %d", receipt.OrderID), 14), 14)
+	doc.Blank()
+	if receipt.PaidAt != nil {
+		doc.Line("Paid:    " + receipt.PaidAt.Format("2006-01-02 15:04 MST"))
+	}
+	doc.Line("Buyer:   " + receipt.Buyer.DisplayName())
+	if receipt.PaymentProvider != "" {
+		doc.Line(fmt.Sprintf("Payment: %s %s", receipt.PaymentProvider, receipt.PaymentReference))
+	}
+	doc.Blank()
+
+	doc.Bold(pdfRow("Tour", "Price", "Discount", "Tax", "Amount"), pdfFontSize)
+	doc.Rule()
+	for _, line := range receipt.Lines {
+		description := line.TourName
+		if line.GuideUsername != "" {
+			description = fmt.Sprintf("%s, by %s", line.TourName, line.GuideUsername)
+		}
+		doc.Line(pdfRow(description, money(line.UnitPrice), money(line.Discount), money(line.Tax), money(line.Total)))
+	}
+	doc.Rule()
+	doc.Line(pdfRow("Subtotal", "", "", "", money(receipt.Subtotal)))
+	doc.Line(pdfRow("Discounts", "", "", "", money(-receipt.DiscountTotal)))
+	doc.Line(pdfRow("Tax", "", "", "", money(receipt.TaxTotal)))
+	doc.Bold(pdfRow("Total paid", "", "", "", money(receipt.Total)+" "+receipt.Currency), pdfFontSize)
+
+	if len(receipt.Refunds) > 0 {
+		doc.Blank()
+		doc.Line("Refunds:")
+		for _, refund := range receipt.Refunds {
+			date := refund.CreatedAt
+			if refund.CompletedAt != nil {
+				date = *refund.CompletedAt
+			}
+			doc.Line(pdfRow(fmt.Sprintf("  %s %s", date.Format("2006-01-02"), refund.TourName), "", "", "", money(-refund.Amount)))
+		}
+		doc.Bold(pdfRow("Net paid", "", "", "", money(receipt.Total-receipt.RefundedTotal)+" "+receipt.Currency), pdfFontSize)
+	}
+
+	doc.Blank()
+	doc.Line("Generated " + time.Now().UTC().Format("2006-01-02 15:04 MST"))
+
+	return doc.Bytes()
+}
+
+// pdfRow lays out a description and four right-aligned amount columns,
+// cutting the description short if it would run into them.
+func pdfRow(description string, price string, discount string, tax string, amount string) string {
+	const width = pdfColumns - 4*14
+	runes := []rune(description)
+	if len(runes) > width-1 {
+		description = string(runes[:width-4]) + "..."
+	}
+	return fmt.Sprintf("%-*s%14s%14s%14s%14s", width, description, price, discount, tax, amount)
+}
+
+// pdfTaxRate shows the rate of a tax rule, or nothing for untaxed lines.
+func pdfTaxRate(rule string, rate float64) string {
+	if rule == "" {
+		return ""
+	}
+	return strconv.FormatFloat(rate, 'f', -1, 64) + "%"
+}
+
+// pdfColumnsLR puts left and right on one line of the given font size.
+func pdfColumnsLR(left string, right string, size float64) string {
+	columns := int(float64(pdfColumns) * pdfFontSize / size)
+	gap := columns - len([]rune(left)) - len([]rune(right))
+	if gap < 1 {
+		gap = 1
+	}
+	return left + strings.Repeat(" ", gap) + right
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InvoiceRepository struct {
+	database *Database
+}
+
+func NewInvoiceRepository(db *Database) *InvoiceRepository {
+	return &InvoiceRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *InvoiceRepository) WithTx(tx *Database) *InvoiceRepository {
+	return &InvoiceRepository{database: tx}
+}
+
+// NextNumber takes the next number of the series, such as INV-2026-000042.
+// The sequence row stays locked until the transaction ends, so numbers are
+// handed out in order and a rolled back invoice leaves no gap.
+func (r *InvoiceRepository) NextNumber(series string) (string, error) {
+	sequence := InvoiceSequence{Series: series}
+	result := r.database.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&sequence)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	result = r.database.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("series = ?", series).First(&sequence)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	sequence.LastNumber++
+	result = r.database.db.Model(&InvoiceSequence{}).Where("series = ?", series).Update("last_number", sequence.LastNumber)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	return fmt.Sprintf("%s-%06d", series, sequence.LastNumber), nil
+}
+
+func (r *InvoiceRepository) CreateInvoice(invoice *Invoice) error {
+	result := r.database.db.Create(invoice)
+	return result.Error
+}
+
+func (r *InvoiceRepository) GetInvoiceByID(id uint) (*Invoice, error) {
+	var invoice Invoice
+	result := r.database.db.Where("id = ?", id).First(&invoice)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, result.Error
+	}
+	return &invoice, nil
+}
+
+// LockInvoice reads the invoice and locks its row until the transaction
+// ends, so credit notes against it are issued one at a time.
+func (r *InvoiceRepository) LockInvoice(id uint) (*Invoice, error) {
+	var invoice Invoice
+	result := r.database.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&invoice)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, result.Error
+	}
+	return &invoice, nil
+}
+
+// HasReference reports whether a document was already issued for the event
+// the reference names.
+func (r *InvoiceRepository) HasReference(reference string) (bool, error) {
+	var count int64
+	result := r.database.db.Model(&Invoice{}).Where("reference = ?", reference).Count(&count)
+	return count > 0, result.Error
+}
+
+// GetInvoicesByOrderID returns the invoices and credit notes of an order in
+// the order they were issued.
+func (r *InvoiceRepository) GetInvoicesByOrderID(orderID uint) ([]Invoice, error) {
+	var invoices []Invoice
+	result := r.database.db.Where("order_id = ?", orderID).Order("id").Find(&invoices)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return invoices, nil
+}
+
+// GetCreditNotes returns the credit notes issued against an invoice.
+func (r *InvoiceRepository) GetCreditNotes(invoiceID uint) ([]Invoice, error) {
+	var notes []Invoice
+	result := r.database.db.Where("corrects_id = ?", invoiceID).Order("id").Find(&notes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return notes, nil
+}
+
+// GetInvoicesByParty returns the documents the user bought or, for a
+// guide, sold, newest first.
+func (r *InvoiceRepository) GetInvoicesByParty(username string) ([]Invoice, error) {
+	var invoices []Invoice
+	result := r.database.db.Where("buyer_username = ? OR seller_username = ?", username, username).Order("id DESC").Find(&invoices)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return invoices, nil
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// InvoiceService issues invoices, credit notes and receipts from order data.
+// A paid order gets one invoice per guide whose tours it contains, since each
+// guide is the seller of their own tours. Invoices are numbered from a gapless
+// yearly series and never change once issued; refunds and corrections are
+// issued as credit notes against them.
+type InvoiceService struct {
+	database          *Database
+	invoiceRepository *InvoiceRepository
+	orderRepository   *OrderRepository
+	refundRepository  *RefundRepository
+}
+
+func NewInvoiceService(db *Database, invoiceRepo *InvoiceRepository, orderRepo *OrderRepository, refundRepo *RefundRepository) *InvoiceService {
+	return &InvoiceService{
+		database:          db,
+		invoiceRepository: invoiceRepo,
+		orderRepository:   orderRepo,
+		refundRepository:  refundRepo,
+	}
+}
+
+// Receipt confirms what was paid for an order and what was refunded since.
+// It is built from the order whenever it is requested and is not numbered.
+type Receipt struct {
+	OrderID          uint           `json:"order_id"`
+	Buyer            InvoiceParty   `json:"buyer"`
+	Currency         string         `json:"currency"`
+	Lines            []OrderLine    `json:"lines"`
+	Discounts        []DiscountLine `json:"discounts,omitempty"`
+	Subtotal         int64          `json:"subtotal"`
+	DiscountTotal    int64          `json:"discount_total"`
+	TaxTotal         int64          `json:"tax_total"`
+	Total            int64          `json:"total"`
+	PaidAt           *time.Time     `json:"paid_at"`
+	PaymentProvider  string         `json:"payment_provider,omitempty"`
+	PaymentReference string         `json:"payment_reference,omitempty"`
+	Refunds          []Refund       `json:"refunds,omitempty"`
+	RefundedTotal    int64          `json:"refunded_total"`
+}
+
+// IssueInvoices issues the invoices of a paid order that have not been issued
+// yet and returns all of the order's invoices and credit notes. It is safe to
+// call again, for example when issuing failed right after checkout.
+func (s *InvoiceService) IssueInvoices(orderID uint) ([]Invoice, error) {
+	order, err := s.orderRepository.GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.PaidAt == nil {
+		return nil, ErrOrderNotInvoiceable
+	}
+
+	// Orders from before guides were recorded on their lines
+	for _, line := range order.Lines {
+		if line.GuideUsername == "" {
+			err = resolveGuides(order.Lines)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	var guides []string
+	linesByGuide := make(map[string][]OrderLine)
+	for _, line := range order.Lines {
+		if _, ok := linesByGuide[line.GuideUsername]; !ok {
+			guides = append(guides, line.GuideUsername)
+		}
+		linesByGuide[line.GuideUsername] = append(linesByGuide[line.GuideUsername], line)
+	}
+
+	var buyer *InvoiceParty
+	for _, guide := range guides {
+		reference := fmt.Sprintf("order:%d:%s", order.ID, guide)
+		issued, err := s.invoiceRepository.HasReference(reference)
+		if err != nil {
+			return nil, err
+		}
+		if issued {
+			continue
+		}
+
+		if buyer == nil {
+			buyer, err = invoiceParty(order.UserID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		seller, err := invoiceParty(guide)
+		if err != nil {
+			return nil, err
+		}
+
+		invoice := buildInvoice(order, linesByGuide[guide], *seller, *buyer)
+		invoice.Reference = &reference
+
+		err = s.database.Transaction(func(tx *Database) error {
+			return issue(s.invoiceRepository.WithTx(tx), invoice)
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Invoice %s issued for order %d by %s", invoice.Number, order.ID, guide)
+	}
+
+	if order.InvoicedAt == nil {
+		err = s.orderRepository.MarkInvoiced(order.ID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.invoiceRepository.GetInvoicesByOrderID(order.ID)
+}
+
+// CreditRefund issues the credit note for a completed refund against the
+// invoice of the refunded line, issuing the order's invoices first if
+// needed. A refund is credited only once.
+func (s *InvoiceService) CreditRefund(refund *Refund) error {
+	reference := fmt.Sprintf("refund:%d", refund.ID)
+	credited, err := s.invoiceRepository.HasReference(reference)
+	if err != nil || credited {
+		return err
+	}
+
+	invoices, err := s.IssueInvoices(refund.OrderID)
+	if err != nil {
+		return err
+	}
+
+	for _, invoice := range invoices {
+		if invoice.Kind != InvoiceKindInvoice {
+			continue
+		}
+		for _, line := range invoice.Lines {
+			if line.OrderLineID == refund.OrderLineID {
+				reason := "Refund"
+				if refund.Reason != "" {
+					reason = "Refund: " + refund.Reason
+				}
+				refundID := refund.ID
+				_, err := s.issueCreditNote(invoice.ID, []uint{line.OrderLineID}, reason, &refundID, refund.DecidedBy, &reference)
+				return err
+			}
+		}
+	}
+	return ErrInvoiceNotFound
+}
+
+// CreateCreditNote corrects an invoice by crediting some of its lines, or all
+// lines not credited yet when orderLineIDs is empty.
+func (s *InvoiceService) CreateCreditNote(invoiceID uint, orderLineIDs []uint, reason string, createdBy string) (*Invoice, error) {
+	if reason == "" {
+		return nil, ErrInvalidCreditNote
+	}
+	return s.issueCreditNote(invoiceID, orderLineIDs, reason, nil, createdBy, nil)
+}
+
+func (s *InvoiceService) issueCreditNote(invoiceID uint, orderLineIDs []uint, reason string, refundID *uint, createdBy string, reference *string) (*Invoice, error) {
+	var note *Invoice
+	err := s.database.Transaction(func(tx *Database) error {
+		invoiceRepo := s.invoiceRepository.WithTx(tx)
+
+		invoice, err := invoiceRepo.LockInvoice(invoiceID)
+		if err != nil {
+			return err
+		}
+		if invoice.Kind != InvoiceKindInvoice {
+			return ErrInvalidCreditNote
+		}
+
+		notes, err := invoiceRepo.GetCreditNotes(invoice.ID)
+		if err != nil {
+			return err
+		}
+		credited := make(map[uint]bool)
+		for _, note := range notes {
+			for _, line := range note.Lines {
+				credited[line.OrderLineID] = true
+			}
+		}
+
+		lines, err := creditedLines(invoice, orderLineIDs, credited)
+		if err != nil {
+			return err
+		}
+
+		note = &Invoice{
+			Kind:           InvoiceKindCreditNote,
+			Reference:      reference,
+			OrderID:        invoice.OrderID,
+			CorrectsID:     &invoice.ID,
+			CorrectsNumber: invoice.Number,
+			RefundID:       refundID,
+			Reason:         reason,
+			Seller:         invoice.Seller,
+			SellerUsername: invoice.SellerUsername,
+			Buyer:          invoice.Buyer,
+			BuyerUsername:  invoice.BuyerUsername,
+			Currency:       invoice.Currency,
+			Lines:          lines,
+			CreatedBy:      createdBy,
+		}
+		note.sumLines()
+
+		return issue(invoiceRepo, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Credit note %s issued against %s", note.Number, note.CorrectsNumber)
+	return note, nil
+}
+
+// GetInvoice returns an invoice or credit note to its buyer, its seller or,
+// with anyOrder, to anyone.
+func (s *InvoiceService) GetInvoice(invoiceID uint, username string, anyOrder bool) (*Invoice, error) {
+	invoice, err := s.invoiceRepository.GetInvoiceByID(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if !anyOrder && invoice.BuyerUsername != username && invoice.SellerUsername != username {
+		return nil, ErrInvoiceNotFound
+	}
+	return invoice, nil
+}
+
+// GetOrderInvoices returns the invoices and credit notes of an order to its
+// buyer or, with anyOrder, to anyone. Invoices that failed to be issued at checkout or refund
+// time show up once the sweep has issued them.
+func (s *InvoiceService) GetOrderInvoices(orderID uint, username string, anyOrder bool) ([]Invoice, error) {
+	order, err := s.orderRepository.GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !anyOrder && order.UserID != username {
+		return nil, ErrUnauthorized
+	}
+	return s.invoiceRepository.GetInvoicesByOrderID(order.ID)
+}
+
+const invoiceSweepBatchSize = 100
+
+// Start runs a sweep every interval until ctx is cancelled.
+func (s *InvoiceService) Start(ctx context.Context, interval time.Duration) {
+	log.Printf("Invoice sweeper running every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep issues the invoices of paid orders and the credit notes of completed
+// refunds that failed to be issued when they happened, for example while the
+// stakeholder service was down. Failures are logged and retried on the next
+// sweep.
+func (s *InvoiceService) Sweep() {
+	orderIDs, err := s.orderRepository.GetUninvoicedOrderIDs(invoiceSweepBatchSize)
+	if err != nil {
+		log.Printf("Invoice sweep: failed to list uninvoiced orders: %v", err)
+	}
+	for _, orderID := range orderIDs {
+		_, err := s.IssueInvoices(orderID)
+		if err != nil {
+			log.Printf("Invoice sweep: failed to issue invoices for order %d: %v", orderID, err)
+		}
+	}
+
+	refunds, err := s.refundRepository.GetUncreditedRefunds(invoiceSweepBatchSize)
+	if err != nil {
+		log.Printf("Invoice sweep: failed to list uncredited refunds: %v", err)
+	}
+	for i := range refunds {
+		err := s.CreditRefund(&refunds[i])
+		if err != nil {
+			log.Printf("Invoice sweep: failed to credit refund %d: %v", refunds[i].ID, err)
+		}
+	}
+}
+
+// GetInvoices returns the invoices and credit notes the user bought or sold.
+func (s *InvoiceService) GetInvoices(username string) ([]Invoice, error) {
+	return s.invoiceRepository.GetInvoicesByParty(username)
+}
+
+// GetReceipt builds the receipt of a paid order for its buyer or, with
+// anyOrder, for anyone.
+func (s *InvoiceService) GetReceipt(orderID uint, username string, anyOrder bool) (*Receipt, error) {
+	order, err := s.orderRepository.GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !anyOrder && order.UserID != username {
+		return nil, ErrUnauthorized
+	}
+	if order.PaidAt == nil {
+		return nil, ErrOrderNotInvoiceable
+	}
+
+	// The receipt does not need more than the username to be useful
+	buyer, err := invoiceParty(order.UserID)
+	if err != nil {
+		log.Printf("Receipt for order %d: failed to fetch buyer profile: %v", order.ID, err)
+		buyer = &InvoiceParty{Username: order.UserID}
+	}
+
+	receipt := &Receipt{
+		OrderID:       order.ID,
+		Buyer:         *buyer,
+		Currency:      order.Currency,
+		Lines:         order.Lines,
+		Discounts:     order.Discounts,
+		Subtotal:      order.Subtotal,
+		DiscountTotal: order.DiscountTotal,
+		TaxTotal:      order.TaxTotal,
+		Total:         order.Total,
+		PaidAt:        order.PaidAt,
+	}
+	if order.Payment != nil {
+		receipt.PaymentProvider = order.Payment.Provider
+		receipt.PaymentReference = order.Payment.IntentID
+	}
+
+	receipt.Refunds, err = s.refundRepository.GetRefundsByOrderID(order.ID, RefundStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	for _, refund := range receipt.Refunds {
+		receipt.RefundedTotal += refund.Amount
+	}
+
+	return receipt, nil
+}
+
+// issue numbers the invoice from its kind's series for the current year and
+// stores it.
+func issue(invoiceRepo *InvoiceRepository, invoice *Invoice) error {
+	invoice.IssuedAt = time.Now()
+
+	prefix := "INV"
+	if invoice.Kind == InvoiceKindCreditNote {
+		prefix = "CN"
+	}
+	number, err := invoiceRepo.NextNumber(fmt.Sprintf("%s-%d", prefix, invoice.IssuedAt.Year()))
+	if err != nil {
+		return err
+	}
+	invoice.Number = number
+
+	return invoiceRepo.CreateInvoice(invoice)
+}
+
+// buildInvoice turns one guide's lines of an order into an invoice, with the
+// share of each order discount that went to those lines.
+func buildInvoice(order *Order, lines []OrderLine, seller InvoiceParty, buyer InvoiceParty) *Invoice {
+	invoice := &Invoice{
+		Kind:           InvoiceKindInvoice,
+		OrderID:        order.ID,
+		Seller:         seller,
+		SellerUsername: seller.Username,
+		Buyer:          buyer,
+		BuyerUsername:  buyer.Username,
+		Currency:       order.Currency,
+	}
+
+	for _, line := range lines {
+		description := line.TourName
+		if line.BundleName != "" {
+			description = fmt.Sprintf("%s (%s)", line.TourName, line.BundleName)
+		}
+		invoiceLine := InvoiceLine{
+			OrderLineID: line.ID,
+			TourID:      line.TourID,
+			Description: description,
+			UnitPrice:   line.UnitPrice,
+			Discount:    line.Discount,
+			Net:         line.Net,
+			Tax:         line.Tax,
+			Total:       line.Total,
+		}
+		if line.Taxation != nil {
+			invoiceLine.TaxRule = line.Taxation.Rule
+			invoiceLine.TaxRate = line.Taxation.Rate
+		}
+		invoice.Lines = append(invoice.Lines, invoiceLine)
+	}
+	invoice.sumLines()
+
+	for _, discount := range order.Discounts {
+		amount := int64(0)
+		for _, line := range lines {
+			amount += discount.Allocations[line.TourID]
+		}
+		if amount > 0 {
+			invoice.Discounts = append(invoice.Discounts, InvoiceDiscount{
+				Code:        discount.Code,
+				Description: discount.Description,
+				Amount:      amount,
+			})
+		}
+	}
+
+	return invoice
+}
+
+// creditedLines picks the invoice lines a credit note covers. Lines that
+// were credited before cannot be credited again.
+func creditedLines(invoice *Invoice, orderLineIDs []uint, credited map[uint]bool) ([]InvoiceLine, error) {
+	if len(orderLineIDs) == 0 {
+		var lines []InvoiceLine
+		for _, line := range invoice.Lines {
+			if !credited[line.OrderLineID] {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			return nil, ErrAlreadyCredited
+		}
+		return lines, nil
+	}
+
+	var lines []InvoiceLine
+	for _, id := range orderLineIDs {
+		if credited[id] {
+			return nil, ErrAlreadyCredited
+		}
+		found := false
+		for _, line := range invoice.Lines {
+			if line.OrderLineID == id {
+				lines = append(lines, line)
+				credited[id] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrInvalidCreditNote
+		}
+	}
+	return lines, nil
+}
+
+// invoiceParty names a user as their stakeholder profile does.
+func invoiceParty(username string) (*InvoiceParty, error) {
+	profile, err := fetchProfile(username)
+	if err != nil {
+		return nil, err
+	}
+
+	party := &InvoiceParty{Username: username}
+	if profile != nil {
+		party.FirstName = profile.FirstName
+		party.LastName = profile.LastName
+	}
+	return party, nil
+}
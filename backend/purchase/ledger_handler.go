@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"authz"
+)
+
+type LedgerHandler struct {
+	service *LedgerService
+}
+
+func NewLedgerHandler(service *LedgerService) *LedgerHandler {
+	return &LedgerHandler{service: service}
+}
+
+func (h *LedgerHandler) GetBalances(w http.ResponseWriter, r *http.Request) {
+	guide, ok := h.guideFor(w, r)
+	if !ok {
+		return
+	}
+
+	balances, err := h.service.GetBalances(guide)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get balances: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(BalancesResponse{Balances: balances, Message: "Balances retrieved successfully"})
+}
+
+// GetStatement returns a guide's statement for ?from= to ?to= (both dates,
+// inclusive, defaulting to the current month) in ?currency=, as JSON or, with
+// ?format=csv, as a CSV download.
+func (h *LedgerHandler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	guide, ok := h.guideFor(w, r)
+	if !ok {
+		return
+	}
+	if guide == "" {
+		h.sendErrorResponse(w, "Guide is required", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parsePeriod(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid period, use dates like 2006-01-02", http.StatusBadRequest)
+		return
+	}
+
+	currency := strings.ToUpper(r.URL.Query().Get("currency"))
+	if currency == "" {
+		currency = GetEnv("DEFAULT_CURRENCY", "EUR")
+	}
+
+	statement, err := h.service.GetStatement(guide, currency, from, to)
+	if err != nil {
+		h.handleLedgerError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		filename := fmt.Sprintf("statement-%s-%s-%s.csv", guide, currency, from.Format("2006-01-02"))
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		writeStatementCSV(w, statement)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(StatementResponse{Statement: statement, Message: "Statement retrieved successfully"})
+}
+
+func (h *LedgerHandler) CreatePayout(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.PayoutCreate) {
+		h.sendErrorResponse(w, "You are not allowed to record payouts", http.StatusForbidden)
+		return
+	}
+
+	var request CreatePayoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Currency = strings.ToUpper(request.Currency)
+
+	payout, err := h.service.CreatePayout(r.Header.Get("x-username"), request)
+	if err != nil {
+		h.handleLedgerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PayoutResponse{Payout: payout, Message: "Payout recorded successfully"})
+}
+
+func (h *LedgerHandler) GetPayouts(w http.ResponseWriter, r *http.Request) {
+	guide, ok := h.guideFor(w, r)
+	if !ok {
+		return
+	}
+
+	payouts, err := h.service.GetPayouts(guide)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get payouts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PayoutsResponse{Payouts: payouts, Message: "Payouts retrieved successfully"})
+}
+
+// guideFor returns whose ledger the caller may see: sellers only see their
+// own, auditors see the one named by ?guide= or, where allowed, everyone's.
+func (h *LedgerHandler) guideFor(w http.ResponseWriter, r *http.Request) (string, bool) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return "", false
+	}
+
+	switch {
+	case authz.Has(r, authz.SalesAudit):
+		return r.URL.Query().Get("guide"), true
+	case authz.Has(r, authz.SalesRead):
+		return username, true
+	default:
+		h.sendErrorResponse(w, "You are not allowed to view earnings", http.StatusForbidden)
+		return "", false
+	}
+}
+
+// parsePeriod turns an inclusive range of dates into [from, to). Missing
+// bounds default to the first and last day of the current month.
+func parsePeriod(fromParam string, toParam string) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	var err error
+	if fromParam != "" {
+		from, err = time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			return from, to, err
+		}
+	}
+	if toParam != "" {
+		to, err = time.Parse("2006-01-02", toParam)
+		if err != nil {
+			return from, to, err
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// writeStatementCSV writes the statement with amounts in major units of its
+// currency, between an opening and a closing balance row.
+func writeStatementCSV(w http.ResponseWriter, statement *Statement) {
+	amount := func(minor int64) string {
+		return formatMinorUnits(minor, statement.Currency)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"date", "kind", "reference", "description", "memo", "order_id", "debit", "credit", "balance", "currency"})
+	writer.Write([]string{statement.From.Format("2006-01-02"), "opening", "", "Opening balance", "", "", "", "", amount(statement.Opening), statement.Currency})
+	for _, line := range statement.Lines {
+		orderID := ""
+		if line.OrderID != nil {
+			orderID = strconv.FormatUint(uint64(*line.OrderID), 10)
+		}
+		writer.Write([]string{
+			line.Date.UTC().Format(time.RFC3339),
+			line.Kind,
+			line.Reference,
+			line.Description,
+			line.Memo,
+			orderID,
+			amount(line.Debit),
+			amount(line.Credit),
+			amount(line.Balance),
+			statement.Currency,
+		})
+	}
+	closingDate := statement.To.AddDate(0, 0, -1).Format("2006-01-02")
+	writer.Write([]string{closingDate, "closing", "", "Closing balance", "", "", "", "", amount(statement.Closing), statement.Currency})
+	writer.Flush()
+}
+
+func (h *LedgerHandler) handleLedgerError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvalidPayout:
+		h.sendErrorResponse(w, "Payout needs a guide, a currency and a non-negative amount", http.StatusBadRequest)
+	case ErrInsufficientBalance:
+		h.sendErrorResponse(w, "Payout exceeds the guide's balance", http.StatusConflict)
+	case ErrInvalidPeriod:
+		h.sendErrorResponse(w, "Statement period must end after it starts", http.StatusBadRequest)
+	case ErrUnsupportedCurrency:
+		h.sendErrorResponse(w, "Invalid currency", http.StatusBadRequest)
+	default:
+		h.sendErrorResponse(w, "Ledger request failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *LedgerHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LedgerRepository struct {
+	database *Database
+}
+
+func NewLedgerRepository(db *Database) *LedgerRepository {
+	return &LedgerRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *LedgerRepository) WithTx(tx *Database) *LedgerRepository {
+	return &LedgerRepository{database: tx}
+}
+
+// GetOrCreateAccount returns the account of the given type, owner and
+// currency, opening it on first use. Concurrent callers get the same account.
+func (r *LedgerRepository) GetOrCreateAccount(accountType string, owner string, currency string) (*LedgerAccount, error) {
+	account := LedgerAccount{Type: accountType, Owner: owner, Currency: currency}
+	result := r.database.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&account)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if account.ID != 0 {
+		return &account, nil
+	}
+
+	result = r.database.db.Where("type = ? AND owner = ? AND currency = ?", accountType, owner, currency).First(&account)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &account, nil
+}
+
+// LockAccount opens the account if needed and locks its row until the
+// transaction ends, so balance checks against it are serialized.
+func (r *LedgerRepository) LockAccount(accountType string, owner string, currency string) (*LedgerAccount, error) {
+	account, err := r.GetOrCreateAccount(accountType, owner, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	result := r.database.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", account.ID).First(account)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return account, nil
+}
+
+// GetAccount returns the account, or nil if nothing was ever posted to it.
+func (r *LedgerRepository) GetAccount(accountType string, owner string, currency string) (*LedgerAccount, error) {
+	var account LedgerAccount
+	result := r.database.db.Where("type = ? AND owner = ? AND currency = ?", accountType, owner, currency).First(&account)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &account, nil
+}
+
+// CreateTransaction stores the transaction together with its entries.
+func (r *LedgerRepository) CreateTransaction(transaction *LedgerTransaction) error {
+	result := r.database.db.Create(transaction)
+	return result.Error
+}
+
+func (r *LedgerRepository) GetTransactionByReference(reference string) (*LedgerTransaction, error) {
+	var transaction LedgerTransaction
+	result := r.database.db.Preload("Entries").Where("reference = ?", reference).First(&transaction)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrLedgerEntryNotFound
+		}
+		return nil, result.Error
+	}
+	return &transaction, nil
+}
+
+// GetBalance sums the account's entries posted before the given time.
+func (r *LedgerRepository) GetBalance(accountID uint, before time.Time) (int64, error) {
+	var balance int64
+	result := r.database.db.Model(&LedgerEntry{}).
+		Select("COALESCE(SUM(credit - debit), 0)").
+		Where("account_id = ? AND created_at < ?", accountID, before).
+		Scan(&balance)
+	return balance, result.Error
+}
+
+// GetGuideBalances returns the balance of every guide account, or only of
+// the given guide's accounts when guideUsername is set.
+func (r *LedgerRepository) GetGuideBalances(guideUsername string) ([]GuideBalance, error) {
+	var balances []GuideBalance
+	query := r.database.db.Table("ledger_accounts").
+		Select("ledger_accounts.owner AS guide_username, ledger_accounts.currency, COALESCE(SUM(ledger_entries.credit - ledger_entries.debit), 0) AS balance").
+		Joins("LEFT JOIN ledger_entries ON ledger_entries.account_id = ledger_accounts.id").
+		Where("ledger_accounts.type = ?", LedgerAccountGuide)
+	if guideUsername != "" {
+		query = query.Where("ledger_accounts.owner = ?", guideUsername)
+	}
+	result := query.Group("ledger_accounts.owner, ledger_accounts.currency").
+		Order("ledger_accounts.owner, ledger_accounts.currency").
+		Scan(&balances)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return balances, nil
+}
+
+// GetStatementLines returns the account's entries posted in [from, to) in
+// posting order, without running balances.
+func (r *LedgerRepository) GetStatementLines(accountID uint, from time.Time, to time.Time) ([]StatementLine, error) {
+	var lines []StatementLine
+	result := r.database.db.Table("ledger_entries").
+		Select("ledger_entries.id AS entry_id, ledger_entries.created_at AS date, ledger_transactions.kind, ledger_transactions.reference, ledger_transactions.description, ledger_entries.memo, ledger_transactions.order_id, ledger_entries.debit, ledger_entries.credit").
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Where("ledger_entries.account_id = ? AND ledger_entries.created_at >= ? AND ledger_entries.created_at < ?", accountID, from, to).
+		Order("ledger_entries.created_at, ledger_entries.id").
+		Scan(&lines)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return lines, nil
+}
+
+func (r *LedgerRepository) CreatePayout(payout *Payout) error {
+	result := r.database.db.Create(payout)
+	return result.Error
+}
+
+// GetPayouts returns the payouts made to a guide, or to every guide when
+// guideUsername is empty, newest first.
+func (r *LedgerRepository) GetPayouts(guideUsername string) ([]Payout, error) {
+	var payouts []Payout
+	query := r.database.db.Order("created_at DESC")
+	if guideUsername != "" {
+		query = query.Where("guide_username = ?", guideUsername)
+	}
+	result := query.Find(&payouts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return payouts, nil
+}
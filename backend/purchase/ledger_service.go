@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// LedgerService keeps the double-entry ledger of what the platform owes its
+// guides. Every paid order line credits the tour's guide with the amount
+// paid and debits the platform fee from it, a refund reverses the sale of its
+// line and a payout moves the guide's balance out of the platform. Customer
+// money passes through the clearing account, so it holds what was received
+// and not yet paid out or refunded.
+type LedgerService struct {
+	database         *Database
+	ledgerRepository *LedgerRepository
+	feePercent       float64
+}
+
+func NewLedgerService(db *Database, ledgerRepo *LedgerRepository) *LedgerService {
+	percent, err := strconv.ParseFloat(GetEnv("PLATFORM_FEE_PERCENT", "10"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		log.Printf("Invalid PLATFORM_FEE_PERCENT, using 10")
+		percent = 10
+	}
+
+	return &LedgerService{
+		database:         db,
+		ledgerRepository: ledgerRepo,
+		feePercent:       percent,
+	}
+}
+
+// RecordSale posts the sale of every paid line of the order as part of the
+// checkout transaction tx. Lines that were free are not posted. The guide is
+// credited the net amount and the tax goes to the tax account, so the fee is
+// only taken from what the guide earns.
+func (s *LedgerService) RecordSale(tx *Database, order *Order) error {
+	ledgerRepo := s.ledgerRepository.WithTx(tx)
+
+	for _, line := range order.Lines {
+		if line.Total <= 0 {
+			continue
+		}
+		if line.GuideUsername == "" {
+			return ErrGuideNotFound
+		}
+
+		orderID := order.ID
+		lineID := line.ID
+		transaction := &LedgerTransaction{
+			Kind:        LedgerKindSale,
+			Reference:   saleReference(line.ID),
+			Description: fmt.Sprintf("Order %d: %s", order.ID, line.TourName),
+			Currency:    order.Currency,
+			OrderID:     &orderID,
+			OrderLineID: &lineID,
+		}
+
+		fee := percentOf(line.Net, s.feePercent)
+		postings := []posting{
+			{LedgerAccountClearing, "", line.Total, 0, "Payment received"},
+			{LedgerAccountGuide, line.GuideUsername, 0, line.Net, "Sale"},
+			{LedgerAccountGuide, line.GuideUsername, fee, 0, "Platform fee"},
+			{LedgerAccountPlatform, "", 0, fee, fmt.Sprintf("Fee from %s", line.GuideUsername)},
+			{LedgerAccountTax, "", 0, line.Tax, taxMemo(line.Taxation)},
+		}
+
+		err := s.post(ledgerRepo, transaction, postings)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordRefund reverses the sale of the refunded line as part of the refund
+// transaction tx, fee included. Lines sold before the ledger existed have no
+// sale to reverse and are skipped.
+func (s *LedgerService) RecordRefund(tx *Database, refund *Refund) error {
+	ledgerRepo := s.ledgerRepository.WithTx(tx)
+
+	sale, err := ledgerRepo.GetTransactionByReference(saleReference(refund.OrderLineID))
+	if err == ErrLedgerEntryNotFound {
+		log.Printf("Refund %d: no ledger sale for order line %d, nothing to reverse", refund.ID, refund.OrderLineID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	refundID := refund.ID
+	transaction := &LedgerTransaction{
+		Kind:        LedgerKindRefund,
+		Reference:   fmt.Sprintf("refund:%d", refund.ID),
+		Description: fmt.Sprintf("Refund %d: %s", refund.ID, refund.TourName),
+		Currency:    sale.Currency,
+		OrderID:     sale.OrderID,
+		OrderLineID: sale.OrderLineID,
+		RefundID:    &refundID,
+	}
+	for _, entry := range sale.Entries {
+		transaction.Entries = append(transaction.Entries, LedgerEntry{
+			AccountID: entry.AccountID,
+			Debit:     entry.Credit,
+			Credit:    entry.Debit,
+			Memo:      "Reversal: " + entry.Memo,
+		})
+	}
+
+	return ledgerRepo.CreateTransaction(transaction)
+}
+
+// CreatePayout records money paid out to a guide and moves it off their
+// balance. The guide's account is locked while the balance is checked, so
+// concurrent payouts cannot take out more than it holds.
+func (s *LedgerService) CreatePayout(adminUsername string, request CreatePayoutRequest) (*Payout, error) {
+	if request.GuideUsername == "" || !isCurrencyCode(request.Currency) || request.Amount < 0 {
+		return nil, ErrInvalidPayout
+	}
+
+	var payout *Payout
+	err := s.database.Transaction(func(tx *Database) error {
+		ledgerRepo := s.ledgerRepository.WithTx(tx)
+
+		account, err := ledgerRepo.LockAccount(LedgerAccountGuide, request.GuideUsername, request.Currency)
+		if err != nil {
+			return err
+		}
+		balance, err := ledgerRepo.GetBalance(account.ID, time.Now())
+		if err != nil {
+			return err
+		}
+
+		amount := request.Amount
+		if amount == 0 {
+			amount = balance
+		}
+		if amount <= 0 || amount > balance {
+			return ErrInsufficientBalance
+		}
+
+		payout = &Payout{
+			GuideUsername: request.GuideUsername,
+			Amount:        amount,
+			Currency:      request.Currency,
+			Reference:     request.Reference,
+			Note:          request.Note,
+			CreatedBy:     adminUsername,
+		}
+		err = ledgerRepo.CreatePayout(payout)
+		if err != nil {
+			return err
+		}
+
+		payoutID := payout.ID
+		transaction := &LedgerTransaction{
+			Kind:        LedgerKindPayout,
+			Reference:   fmt.Sprintf("payout:%d", payout.ID),
+			Description: fmt.Sprintf("Payout %d to %s", payout.ID, payout.GuideUsername),
+			Currency:    payout.Currency,
+			PayoutID:    &payoutID,
+		}
+		memo := "Payout"
+		if payout.Reference != "" {
+			memo = "Payout " + payout.Reference
+		}
+		postings := []posting{
+			{LedgerAccountGuide, payout.GuideUsername, amount, 0, memo},
+			{LedgerAccountClearing, "", 0, amount, memo},
+		}
+		return s.post(ledgerRepo, transaction, postings)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Payout %d: %d %s to %s by %s", payout.ID, payout.Amount, payout.Currency, payout.GuideUsername, adminUsername)
+	return payout, nil
+}
+
+func (s *LedgerService) GetPayouts(guideUsername string) ([]Payout, error) {
+	return s.ledgerRepository.GetPayouts(guideUsername)
+}
+
+// GetBalances returns the guide's balances, or every guide's when
+// guideUsername is empty.
+func (s *LedgerService) GetBalances(guideUsername string) ([]GuideBalance, error) {
+	return s.ledgerRepository.GetGuideBalances(guideUsername)
+}
+
+// GetStatement builds the guide's statement in currency for [from, to).
+func (s *LedgerService) GetStatement(guideUsername string, currency string, from time.Time, to time.Time) (*Statement, error) {
+	if !from.Before(to) {
+		return nil, ErrInvalidPeriod
+	}
+	if !isCurrencyCode(currency) {
+		return nil, ErrUnsupportedCurrency
+	}
+
+	statement := &Statement{
+		GuideUsername: guideUsername,
+		Currency:      currency,
+		From:          from,
+		To:            to,
+		Lines:         []StatementLine{},
+	}
+
+	account, err := s.ledgerRepository.GetAccount(LedgerAccountGuide, guideUsername, currency)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return statement, nil
+	}
+
+	statement.Opening, err = s.ledgerRepository.GetBalance(account.ID, from)
+	if err != nil {
+		return nil, err
+	}
+	statement.Lines, err = s.ledgerRepository.GetStatementLines(account.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := statement.Opening
+	for i := range statement.Lines {
+		line := &statement.Lines[i]
+		balance += line.Credit - line.Debit
+		line.Balance = balance
+
+		switch line.Kind {
+		case LedgerKindSale:
+			statement.GrossSales += line.Credit
+			statement.Fees += line.Debit
+		case LedgerKindRefund:
+			statement.Refunds += line.Debit
+			statement.Fees -= line.Credit
+		case LedgerKindPayout:
+			statement.Payouts += line.Debit
+		}
+	}
+	statement.Closing = balance
+
+	return statement, nil
+}
+
+// posting is one side of a ledger transaction before its account is known.
+type posting struct {
+	accountType string
+	owner       string
+	debit       int64
+	credit      int64
+	memo        string
+}
+
+// post opens the accounts of the postings as needed and stores the
+// transaction, refusing it if its debits and credits do not balance.
+func (s *LedgerService) post(ledgerRepo *LedgerRepository, transaction *LedgerTransaction, postings []posting) error {
+	debits, credits := int64(0), int64(0)
+	for _, p := range postings {
+		if p.debit == 0 && p.credit == 0 {
+			continue
+		}
+		account, err := ledgerRepo.GetOrCreateAccount(p.accountType, p.owner, transaction.Currency)
+		if err != nil {
+			return err
+		}
+		transaction.Entries = append(transaction.Entries, LedgerEntry{
+			AccountID: account.ID,
+			Debit:     p.debit,
+			Credit:    p.credit,
+			Memo:      p.memo,
+		})
+		debits += p.debit
+		credits += p.credit
+	}
+
+	if debits != credits {
+		return fmt.Errorf("ledger transaction %s does not balance: debits %d, credits %d", transaction.Reference, debits, credits)
+	}
+	return ledgerRepo.CreateTransaction(transaction)
+}
+
+func taxMemo(taxation *Taxation) string {
+	if taxation == nil {
+		return "Tax"
+	}
+	return fmt.Sprintf("%s %v%%", taxation.Rule, taxation.Rate)
+}
+
+func saleReference(orderLineID uint) string {
+	return fmt.Sprintf("sale:%d", orderLineID)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// LogEventPublisher writes events to the service log. It is the default for
+// local development, where nothing consumes events yet.
+type LogEventPublisher struct{}
+
+func NewLogEventPublisher() *LogEventPublisher {
+	return &LogEventPublisher{}
+}
+
+func (p *LogEventPublisher) Name() string {
+	return "log"
+}
+
+func (p *LogEventPublisher) Publish(_ context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	log.Printf("Event %s: %s", event.EventType(), payload)
+	return nil
+}
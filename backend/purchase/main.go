@@ -1,72 +1,252 @@
 package main
 
 import (
-    "log"
-    "net/http"
-    "github.com/gorilla/mux"
-    "github.com/rs/cors"
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
 )
 
 func main() {
-    // Initialize database
-    db, err := InitDatabase()
-    if err != nil {
-        log.Fatal("Failed to initialize database:", err)
-    }
-    
-    // Initialize repositories
-    cartRepo := NewCartRepository(db)
-    purchaseRepo := NewPurchaseRepository(db)
-    
-    // Initialize services
-    cartService := NewCartService(cartRepo)
-    purchaseService := NewPurchaseService(purchaseRepo, cartRepo)
-    
-    // Initialize handlers
-    cartHandler := NewCartHandler(cartService)
-    purchaseHandler := NewPurchaseHandler(purchaseService)
-    
-    // Setup router
-    router := mux.NewRouter()
-    
-    // ========== CART ROUTES ==========
-    // Gateway: /api/purchases/cart/* -> strips /api/purchases -> /cart/*
-    router.HandleFunc("/cart", cartHandler.GetCart).Methods("GET")                    // /api/purchases/cart
-    router.HandleFunc("/cart/items", cartHandler.AddToCart).Methods("POST")           // /api/purchases/cart/items
-    router.HandleFunc("/cart/items/{tourId}", cartHandler.RemoveFromCart).Methods("DELETE") // /api/purchases/cart/items/{tourId}
-    router.HandleFunc("/cart", cartHandler.ClearCart).Methods("DELETE")              // /api/purchases/cart
-    router.HandleFunc("/cart/checkout", purchaseHandler.Checkout).Methods("POST")     // /api/purchases/cart/checkout
-    
-    // ========== PURCHASE ROUTES ==========  
-    // Gateway: /api/purchases/* -> strips /api/purchases -> /*
-    router.HandleFunc("/tokens", purchaseHandler.GetUserTokens).Methods("GET")         // /api/purchases/tokens
-    router.HandleFunc("/tokens/{token}", purchaseHandler.GetTokenDetails).Methods("GET") // /api/purchases/tokens/{token}
-    router.HandleFunc("/validate/{tourId}", purchaseHandler.ValidateAccess).Methods("GET") // /api/purchases/validate/{tourId}
-    
-    // Health check
-    router.HandleFunc("/ping", purchaseHandler.Ping).Methods("GET")
-    
-    // Setup CORS
-    c := cors.New(cors.Options{
-        AllowedOrigins:   []string{"*"},
-        AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        AllowedHeaders:   []string{"*"},
-        AllowCredentials: true,
-    })
-    
-    // Apply CORS middleware
-    handler := c.Handler(router)
-    
-    // Pokretanje RPC servera u goroutine
-    rpcServer := NewPurchaseRPCServer(purchaseService)
-    rpcPort := GetEnv("RPC_PORT", "3013")
-    go func() {
-        log.Printf("Starting Purchase RPC server on port %s", rpcPort)
-        rpcServer.StartRPCServer(rpcPort)
-    }()
-    
-    // Get port from environment or default
-    port := GetEnv("PORT", "8084")
-    log.Printf("🚀 Purchase service starting on port %s", port)
-    log.Fatal(http.ListenAndServe(":"+port, handler))
-}
\ No newline at end of file
+	// Initialize database
+	db, err := InitDatabase()
+	if err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+
+	// Initialize repositories
+	cartRepo := NewCartRepository(db)
+	purchaseRepo := NewPurchaseRepository(db)
+	paymentRepo := NewPaymentRepository(db)
+	orderRepo := NewOrderRepository(db)
+	refundRepo := NewRefundRepository(db)
+	couponRepo := NewCouponRepository(db)
+	bundleRepo := NewBundleRepository(db)
+	giftRepo := NewGiftRepository(db)
+	tokenEventRepo := NewTokenEventRepository(db)
+	ledgerRepo := NewLedgerRepository(db)
+	invoiceRepo := NewInvoiceRepository(db)
+	savedItemRepo := NewSavedItemRepository(db)
+	cartEventRepo := NewCartEventRepository(db)
+	wishlistRepo := NewWishlistRepository(db)
+	wishlistEventRepo := NewWishlistEventRepository(db)
+
+	// Initialize services
+	currencyService := NewCurrencyService(NewRateProvider())
+	couponService := NewCouponService(couponRepo, currencyService)
+	bundleService := NewBundleService(bundleRepo)
+	taxService, err := NewTaxService(GetEnv("TAX_RULES_FILE", "tax_rules.json"))
+	if err != nil {
+		log.Fatal("Failed to load tax rules:", err)
+	}
+	cartService := NewCartService(db, cartRepo, bundleRepo, savedItemRepo, couponService, currencyService, taxService)
+	paymentService := NewPaymentService(paymentRepo, NewPaymentProvider())
+	ledgerService := NewLedgerService(db, ledgerRepo)
+	invoiceService := NewInvoiceService(db, invoiceRepo, orderRepo, refundRepo)
+	purchaseService := NewPurchaseService(db, purchaseRepo, cartRepo, orderRepo, giftRepo, cartService, paymentService, couponService, ledgerService, invoiceService, taxService, currencyService)
+	giftService := NewGiftService(db, giftRepo, purchaseRepo, orderRepo)
+	eventPublisher := NewEventPublisher()
+	tokenLifecycleService := NewTokenLifecycleService(db, purchaseRepo, tokenEventRepo, eventPublisher)
+	cartLifecycleService := NewCartLifecycleService(db, cartRepo, cartEventRepo, eventPublisher)
+	wishlistService := NewWishlistService(db, wishlistRepo, wishlistEventRepo, eventPublisher)
+	orderService := NewOrderService(orderRepo, purchaseRepo)
+	refundService := NewRefundService(db, refundRepo, purchaseRepo, orderRepo, paymentService, ledgerService, invoiceService)
+	exportService := NewExportService(cartRepo, savedItemRepo, wishlistRepo, orderRepo, purchaseRepo, refundRepo, giftRepo)
+
+	// Initialize handlers
+	cartHandler := NewCartHandler(cartService)
+	purchaseHandler := NewPurchaseHandler(purchaseService)
+	paymentHandler := NewPaymentHandler(paymentService)
+	orderHandler := NewOrderHandler(orderService)
+	refundHandler := NewRefundHandler(refundService)
+	couponHandler := NewCouponHandler(couponService)
+	bundleHandler := NewBundleHandler(bundleService)
+	giftHandler := NewGiftHandler(giftService)
+	tokenEventHandler := NewTokenEventHandler(tokenLifecycleService)
+	ledgerHandler := NewLedgerHandler(ledgerService)
+	invoiceHandler := NewInvoiceHandler(invoiceService)
+	wishlistHandler := NewWishlistHandler(wishlistService)
+	exportHandler := NewExportHandler(exportService)
+
+	// Setup router
+	router := mux.NewRouter()
+
+	// ========== CART ROUTES ==========
+	// Gateway: /api/purchases/cart/* -> strips /api/purchases -> /cart/*
+	router.HandleFunc("/cart", cartHandler.GetCart).Methods("GET")                                     // /api/purchases/cart
+	router.HandleFunc("/cart/items", cartHandler.AddToCart).Methods("POST")                            // /api/purchases/cart/items
+	router.HandleFunc("/cart/items/{tourId}", cartHandler.RemoveFromCart).Methods("DELETE")            // /api/purchases/cart/items/{tourId}
+	router.HandleFunc("/cart", cartHandler.ClearCart).Methods("DELETE")                                // /api/purchases/cart
+	router.HandleFunc("/cart/checkout", purchaseHandler.Checkout).Methods("POST")                      // /api/purchases/cart/checkout
+	router.HandleFunc("/cart/bundles", cartHandler.AddBundleToCart).Methods("POST")                    // /api/purchases/cart/bundles
+	router.HandleFunc("/cart/bundles/{bundleId}", cartHandler.RemoveBundleFromCart).Methods("DELETE")  // /api/purchases/cart/bundles/{bundleId}
+	router.HandleFunc("/cart/coupons", cartHandler.ApplyCoupon).Methods("POST")                        // /api/purchases/cart/coupons
+	router.HandleFunc("/cart/coupons/{code}", cartHandler.RemoveCoupon).Methods("DELETE")              // /api/purchases/cart/coupons/{code}
+	router.HandleFunc("/cart/merge", cartHandler.MergeGuestCart).Methods("POST")                       // after login, with X-Client-ID
+	router.HandleFunc("/cart/items/{tourId}/save", cartHandler.SaveForLater).Methods("POST")           // move out of the cart
+	router.HandleFunc("/cart/bundles/{bundleId}/save", cartHandler.SaveBundleForLater).Methods("POST") // move out of the cart
+
+	// ========== SAVED FOR LATER ROUTES ==========
+	router.HandleFunc("/saved", cartHandler.GetSavedItems).Methods("GET")                              // /api/purchases/saved
+	router.HandleFunc("/saved/{itemId}/move-to-cart", cartHandler.MoveSavedItemToCart).Methods("POST") // at the current price
+	router.HandleFunc("/saved/{itemId}", cartHandler.RemoveSavedItem).Methods("DELETE")                // /api/purchases/saved/{itemId}
+
+	// ========== WISHLIST ROUTES ==========
+	router.HandleFunc("/wishlist", wishlistHandler.GetWishlist).Methods("GET")                    // with live tour data
+	router.HandleFunc("/wishlist", wishlistHandler.AddToWishlist).Methods("POST")                 // /api/purchases/wishlist
+	router.HandleFunc("/wishlist/counts", wishlistHandler.GetFavouriteCounts).Methods("GET")      // guides: own tours, admins: ?author=
+	router.HandleFunc("/wishlist/{tourId}", wishlistHandler.RemoveFromWishlist).Methods("DELETE") // /api/purchases/wishlist/{tourId}
+
+	// ========== GUEST CART ROUTES ==========
+	// Gateway: /api/purchases/guest-cart/* is public; carts are keyed by the X-Client-ID header
+	router.HandleFunc("/guest-cart", cartHandler.GetGuestCart).Methods("GET")
+	router.HandleFunc("/guest-cart", cartHandler.ClearGuestCart).Methods("DELETE")
+	router.HandleFunc("/guest-cart/items", cartHandler.AddToGuestCart).Methods("POST")
+	router.HandleFunc("/guest-cart/items/{tourId}", cartHandler.RemoveFromGuestCart).Methods("DELETE")
+	router.HandleFunc("/guest-cart/bundles", cartHandler.AddBundleToGuestCart).Methods("POST")
+	router.HandleFunc("/guest-cart/bundles/{bundleId}", cartHandler.RemoveBundleFromGuestCart).Methods("DELETE")
+
+	// ========== PURCHASE ROUTES ==========
+	// Gateway: /api/purchases/* -> strips /api/purchases -> /*
+	router.HandleFunc("/tokens", purchaseHandler.GetUserTokens).Methods("GET")                       // /api/purchases/tokens
+	router.HandleFunc("/tokens/{token}", purchaseHandler.GetTokenDetails).Methods("GET")             // /api/purchases/tokens/{token}
+	router.HandleFunc("/tokens/{token}/transfer", purchaseHandler.TransferToken).Methods("POST")     // holder only
+	router.HandleFunc("/tokens/{token}/transfers", purchaseHandler.GetTokenTransfers).Methods("GET") // holder, purchaser or admin
+	router.HandleFunc("/validate/{tourId}", purchaseHandler.ValidateAccess).Methods("GET")           // /api/purchases/validate/{tourId}
+
+	// ========== GIFT ROUTES ==========
+	router.HandleFunc("/gifts", giftHandler.GetGifts).Methods("GET")           // /api/purchases/gifts?received=true
+	router.HandleFunc("/gifts/redeem", giftHandler.RedeemGift).Methods("POST") // /api/purchases/gifts/redeem
+
+	// ========== ORDER ROUTES ==========
+	router.HandleFunc("/orders", orderHandler.GetUserOrders).Methods("GET")                         // /api/purchases/orders
+	router.HandleFunc("/orders/{orderId}", orderHandler.GetOrder).Methods("GET")                    // /api/purchases/orders/{orderId}
+	router.HandleFunc("/orders/{orderId}/invoices", invoiceHandler.GetOrderInvoices).Methods("GET") // buyer or admin
+	router.HandleFunc("/orders/{orderId}/receipt", invoiceHandler.GetReceipt).Methods("GET")        // ?format=pdf
+
+	// ========== INVOICE ROUTES ==========
+	router.HandleFunc("/invoices", invoiceHandler.GetInvoices).Methods("GET")                                // bought or sold by the caller
+	router.HandleFunc("/invoices/{invoiceId}", invoiceHandler.GetInvoice).Methods("GET")                     // ?format=pdf
+	router.HandleFunc("/invoices/{invoiceId}/credit-notes", invoiceHandler.CreateCreditNote).Methods("POST") // admin only
+
+	// ========== REFUND ROUTES ==========
+	router.HandleFunc("/refunds", refundHandler.RequestRefund).Methods("POST")                   // /api/purchases/refunds
+	router.HandleFunc("/refunds", refundHandler.GetUserRefunds).Methods("GET")                   // /api/purchases/refunds
+	router.HandleFunc("/refunds/pending", refundHandler.GetPendingRefunds).Methods("GET")        // admin only
+	router.HandleFunc("/refunds/{refundId}/approve", refundHandler.ApproveRefund).Methods("PUT") // admin only
+	router.HandleFunc("/refunds/{refundId}/reject", refundHandler.RejectRefund).Methods("PUT")   // admin only
+
+	// ========== COUPON ROUTES ==========
+	router.HandleFunc("/coupons", couponHandler.CreateCoupon).Methods("POST")                  // guides and admins
+	router.HandleFunc("/coupons", couponHandler.GetCoupons).Methods("GET")                     // guides and admins
+	router.HandleFunc("/coupons/{couponId}", couponHandler.DeactivateCoupon).Methods("DELETE") // creator or admin
+
+	// ========== BUNDLE ROUTES ==========
+	router.HandleFunc("/bundles", bundleHandler.CreateBundle).Methods("POST")               // guides only
+	router.HandleFunc("/bundles", bundleHandler.GetBundles).Methods("GET")                  // /api/purchases/bundles?author=
+	router.HandleFunc("/bundles/{bundleId}", bundleHandler.GetBundle).Methods("GET")        // /api/purchases/bundles/{bundleId}
+	router.HandleFunc("/bundles/{bundleId}", bundleHandler.ArchiveBundle).Methods("DELETE") // author or admin
+
+	// ========== LEDGER ROUTES ==========
+	router.HandleFunc("/ledger/balances", ledgerHandler.GetBalances).Methods("GET")   // guides: own, admins: all or ?guide=
+	router.HandleFunc("/ledger/statement", ledgerHandler.GetStatement).Methods("GET") // ?from=&to=&currency=&guide=&format=csv
+	router.HandleFunc("/payouts", ledgerHandler.CreatePayout).Methods("POST")         // admin only
+	router.HandleFunc("/payouts", ledgerHandler.GetPayouts).Methods("GET")            // guides: own, admins: all or ?guide=
+
+	// ========== PAYMENT ROUTES ==========
+	router.HandleFunc("/payments", paymentHandler.GetUserPayments).Methods("GET")        // /api/purchases/payments
+	router.HandleFunc("/payments/webhook", paymentHandler.Webhook).Methods("POST")       // called by the payment provider
+	router.HandleFunc("/payments/{paymentId}", paymentHandler.GetPayment).Methods("GET") // /api/purchases/payments/{paymentId}
+
+	// ========== EXPORT ROUTES ==========
+	router.HandleFunc("/export", exportHandler.ExportPurchases).Methods("GET") // zip of the caller's purchase data
+	router.HandleFunc("/export/full", exportHandler.ExportAll).Methods("GET")  // plus their data from every other service
+
+	// ========== INTERNAL ROUTES ==========
+	// Blocked by the gateway, only reachable by other services
+	router.HandleFunc("/internal/tokens/used", tokenEventHandler.MarkTokenUsed).Methods("POST") // tour service, on completed executions
+	router.HandleFunc("/internal/token-events", tokenEventHandler.GetEvents).Methods("GET")     // ?after=<event ID>&limit=
+
+	// Health check
+	router.HandleFunc("/ping", purchaseHandler.Ping).Methods("GET")
+
+	// Setup CORS
+	c := cors.New(cors.Options{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"*"},
+		AllowCredentials: true,
+	})
+
+	// Apply CORS middleware
+	handler := c.Handler(router)
+
+	// gRPC server for purchase.proto, used by the tour service. It trusts the
+	// usernames it is given, so it is only reachable on the service network.
+	grpcServer := NewPurchaseGRPCServer(purchaseService)
+	go grpcServer.Start(GetEnv("GRPC_PORT", "3015"))
+
+	// Expire tokens and publish lifecycle events in the background
+	sweepInterval, err := time.ParseDuration(GetEnv("TOKEN_SWEEP_INTERVAL", "1h"))
+	if err != nil || sweepInterval <= 0 {
+		log.Printf("Invalid TOKEN_SWEEP_INTERVAL, using 1h")
+		sweepInterval = time.Hour
+	}
+	go tokenLifecycleService.Start(context.Background(), sweepInterval)
+
+	// Remind about abandoned carts and remove expired ones in the background
+	cartSweepInterval, err := time.ParseDuration(GetEnv("CART_SWEEP_INTERVAL", "1h"))
+	if err != nil || cartSweepInterval <= 0 {
+		log.Printf("Invalid CART_SWEEP_INTERVAL, using 1h")
+		cartSweepInterval = time.Hour
+	}
+	go cartLifecycleService.Start(context.Background(), cartSweepInterval)
+
+	// Tell users when their favourite tours drop in price or go on sale
+	wishlistCheckInterval, err := time.ParseDuration(GetEnv("WISHLIST_CHECK_INTERVAL", "1h"))
+	if err != nil || wishlistCheckInterval <= 0 {
+		log.Printf("Invalid WISHLIST_CHECK_INTERVAL, using 1h")
+		wishlistCheckInterval = time.Hour
+	}
+	go wishlistService.Start(context.Background(), wishlistCheckInterval)
+
+	// Issue invoices and credit notes that failed when the order was paid or refunded
+	invoiceSweepInterval, err := time.ParseDuration(GetEnv("INVOICE_SWEEP_INTERVAL", "15m"))
+	if err != nil || invoiceSweepInterval <= 0 {
+		log.Printf("Invalid INVOICE_SWEEP_INTERVAL, using 15m")
+		invoiceSweepInterval = 15 * time.Minute
+	}
+	go invoiceService.Start(context.Background(), invoiceSweepInterval)
+
+	// Finish or give up checkouts left pending, for example by a restart
+	checkoutSweepInterval, err := time.ParseDuration(GetEnv("CHECKOUT_SWEEP_INTERVAL", "1m"))
+	if err != nil || checkoutSweepInterval <= 0 {
+		log.Printf("Invalid CHECKOUT_SWEEP_INTERVAL, using 1m")
+		checkoutSweepInterval = time.Minute
+	}
+	go purchaseService.Start(context.Background(), checkoutSweepInterval)
+
+	// Complete refunds whose payment was returned but could not be recorded
+	refundSweepInterval, err := time.ParseDuration(GetEnv("REFUND_SWEEP_INTERVAL", "5m"))
+	if err != nil || refundSweepInterval <= 0 {
+		log.Printf("Invalid REFUND_SWEEP_INTERVAL, using 5m")
+		refundSweepInterval = 5 * time.Minute
+	}
+	go refundService.Start(context.Background(), refundSweepInterval)
+
+	// Pick up changes to the tax rules without a restart
+	taxReloadInterval, err := time.ParseDuration(GetEnv("TAX_RULES_RELOAD_INTERVAL", "1m"))
+	if err != nil || taxReloadInterval <= 0 {
+		log.Printf("Invalid TAX_RULES_RELOAD_INTERVAL, using 1m")
+		taxReloadInterval = time.Minute
+	}
+	go taxService.Watch(context.Background(), taxReloadInterval)
+
+	// Get port from environment or default
+	port := GetEnv("PORT", "8084")
+	log.Printf("🚀 Purchase service starting on port %s", port)
+	log.Fatal(http.ListenAndServe(":"+port, handler))
+}
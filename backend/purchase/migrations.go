@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"money"
+
+	"gorm.io/gorm"
+)
+
+// migrateLegacyMoney converts the cart columns that held float amounts with
+// no currency, from before money was kept in minor units. It runs before
+// AutoMigrate and skips columns that are already integers, so it is safe on
+// every start. Legacy amounts are taken to be in defaultCurrency.
+func migrateLegacyMoney(db *gorm.DB, defaultCurrency string) error {
+	migrator := db.Migrator()
+	scale := math.Pow10(money.MinorUnitExponent(defaultCurrency))
+
+	if migrator.HasColumn(&OrderItem{}, "price") && !migrator.HasColumn(&OrderItem{}, "base_price") {
+		log.Println("Migrating order_items.price to base_price")
+		err := migrator.RenameColumn(&OrderItem{}, "price", "base_price")
+		if err != nil {
+			return err
+		}
+	}
+
+	columns := []struct {
+		model  interface{}
+		table  string
+		column string
+	}{
+		{&ShoppingCart{}, "shopping_carts", "total"},
+		{&OrderItem{}, "order_items", "base_price"},
+	}
+	for _, c := range columns {
+		isFloat, err := isFloatColumn(db, c.model, c.column)
+		if err != nil {
+			return err
+		}
+		if !isFloat {
+			continue
+		}
+
+		log.Printf("Converting %s.%s to minor units of %s", c.table, c.column, defaultCurrency)
+		err = db.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE bigint USING ROUND(%s * %v)",
+			c.table, c.column, c.column, scale)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateCheckoutRecords links checkout records to orders, from before
+// checkouts created orders. The column is added without NOT NULL, filled,
+// and only then tightened, so that AutoMigrate does not fail on existing
+// rows. It runs before AutoMigrate. Records from before orders have no order
+// to answer a retry with; they only guard retries made right after their
+// checkout, so they are dropped.
+func migrateCheckoutRecords(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&CheckoutRecord{}) || migrator.HasColumn(&CheckoutRecord{}, "order_id") {
+		return nil
+	}
+
+	log.Println("Adding checkout_records.order_id")
+	err := db.Exec("ALTER TABLE checkout_records ADD COLUMN order_id bigint").Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec("DELETE FROM checkout_records WHERE order_id IS NULL").Error
+	if err != nil {
+		return err
+	}
+	return db.Exec("ALTER TABLE checkout_records ALTER COLUMN order_id SET NOT NULL").Error
+}
+
+// fillLegacyCurrencies sets defaultCurrency on cart rows created before
+// currencies existed. It runs after AutoMigrate has added the columns.
+func fillLegacyCurrencies(db *gorm.DB, defaultCurrency string) error {
+	err := db.Model(&OrderItem{}).Where("base_currency IS NULL OR base_currency = ''").Update("base_currency", defaultCurrency).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&ShoppingCart{}).Where("currency IS NULL OR currency = ''").Update("currency", defaultCurrency).Error
+}
+
+// fillTokenPurchasers records the holder as the purchaser of tokens issued
+// before gifts and transfers existed, when the two were always the same.
+func fillTokenPurchasers(db *gorm.DB) error {
+	return db.Model(&TourPurchaseToken{}).Where("purchased_by IS NULL OR purchased_by = ''").Update("purchased_by", gorm.Expr("user_id")).Error
+}
+
+// fillLineNetAmounts sets the net amount of order lines from before taxes
+// were recorded, when the whole total was net.
+func fillLineNetAmounts(db *gorm.DB) error {
+	return db.Model(&OrderLine{}).Where("net = 0 AND tax = 0 AND total <> 0").Update("net", gorm.Expr("total")).Error
+}
+
+// fillCartActivity dates the last activity of carts from before it was
+// tracked to their last update, so that they do not all expire at once.
+func fillCartActivity(db *gorm.DB) error {
+	return db.Model(&ShoppingCart{}).Where("active_at IS NULL").Update("active_at", gorm.Expr("updated_at")).Error
+}
+
+func isFloatColumn(db *gorm.DB, model interface{}, column string) (bool, error) {
+	if !db.Migrator().HasTable(model) {
+		return false, nil
+	}
+
+	columnTypes, err := db.Migrator().ColumnTypes(model)
+	if err != nil {
+		return false, err
+	}
+	for _, columnType := range columnTypes {
+		if columnType.Name() != column {
+			continue
+		}
+		name := strings.ToLower(columnType.DatabaseTypeName())
+		return strings.HasPrefix(name, "float") || strings.HasPrefix(name, "double") ||
+			name == "numeric" || name == "real", nil
+	}
+	return false, nil
+}
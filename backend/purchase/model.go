@@ -1,61 +1,710 @@
 package main
 
 import (
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// ShoppingCart amounts are minor units of Currency, the tourist's preferred
+// currency at the time the cart was last priced. Rates lists the exchange
+// rates that pricing used. A guest cart has no UserID and is found by the
+// ClientID the browser sent instead, until it is merged into the user's cart
+// on login. Carts that see no changes for a while are reminded about and
+// eventually removed; ActiveAt is when the cart last changed.
 type ShoppingCart struct {
-	ID        uint        `json:"id" gorm:"primaryKey"`
-	UserID    string      `json:"user_id" gorm:"not null;index"`
-	Items     []OrderItem `json:"items" gorm:"foreignKey:CartID"`
-	Total     float64     `json:"total" gorm:"default:0"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	UserID         string         `json:"user_id" gorm:"not null;index"`
+	ClientID       *string        `json:"client_id,omitempty" gorm:"uniqueIndex"`
+	Items          []OrderItem    `json:"items" gorm:"foreignKey:CartID"`
+	Coupons        []CartCoupon   `json:"coupons" gorm:"foreignKey:CartID"`
+	Currency       string         `json:"currency" gorm:"size:3"`
+	Subtotal       int64          `json:"subtotal" gorm:"-"`
+	Discounts      []DiscountLine `json:"discounts" gorm:"-"`
+	TaxTotal       int64          `json:"tax_total" gorm:"-"`
+	Total          int64          `json:"total" gorm:"default:0"`
+	Rates          []ExchangeRate `json:"rates,omitempty" gorm:"-"`
+	ActiveAt       time.Time      `json:"active_at" gorm:"index"`
+	ReminderSentAt *time.Time     `json:"-"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// SavedItem is a tour or bundle a user moved out of their cart to buy later.
+// Saved items are kept apart from the cart, so they survive its expiry, and
+// are priced again when moved back. BasePrice is the price when saved.
+type SavedItem struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         string    `json:"user_id" gorm:"not null;index"`
+	TourID         uint      `json:"tour_id"`
+	TourName       string    `json:"tour_name" gorm:"not null"`
+	AuthorUsername string    `json:"author_username"`
+	BundleID       *uint     `json:"bundle_id,omitempty"`
+	BasePrice      int64     `json:"base_price"`
+	BaseCurrency   string    `json:"base_currency" gorm:"size:3"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CartEvent is an entry in the outbox of cart events, published the same way
+// as TokenEvent. Total is the cart total in Currency when the event occurred.
+type CartEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Type        string     `json:"type" gorm:"not null;index"`
+	CartID      uint       `json:"cart_id" gorm:"not null;index"`
+	UserID      string     `json:"user_id" gorm:"not null;index"`
+	ItemCount   int        `json:"item_count"`
+	TourNames   []string   `json:"tour_names" gorm:"type:jsonb;serializer:json"`
+	Total       int64      `json:"total"`
+	Currency    string     `json:"currency" gorm:"size:3"`
+	ActiveAt    time.Time  `json:"active_at"`
+	OccurredAt  time.Time  `json:"occurred_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty" gorm:"index"`
+}
+
+// WishlistItem is a tour a user marked as a favourite. Unlike a SavedItem it
+// was never in the cart. LastPrice, LastCurrency and LastStatus are what the
+// wishlist watcher last saw of the tour, so that a price drop or the tour
+// going on sale is reported once.
+type WishlistItem struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         string    `json:"user_id" gorm:"not null;uniqueIndex:idx_wishlist_user_tour"`
+	TourID         uint      `json:"tour_id" gorm:"not null;uniqueIndex:idx_wishlist_user_tour;index"`
+	TourName       string    `json:"tour_name" gorm:"not null"`
+	AuthorUsername string    `json:"author_username" gorm:"index"`
+	LastPrice      int64     `json:"last_price"`
+	LastCurrency   string    `json:"last_currency" gorm:"size:3"`
+	LastStatus     string    `json:"last_status"`
+	Tour           *TourInfo `json:"tour,omitempty" gorm:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// WishlistEvent is an entry in the outbox of wishlist events, published the
+// same way as CartEvent. Prices are in minor units of Currency.
+type WishlistEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Type        string     `json:"type" gorm:"not null;index"`
+	UserID      string     `json:"user_id" gorm:"not null;index"`
+	TourID      uint       `json:"tour_id" gorm:"not null"`
+	TourName    string     `json:"tour_name"`
+	OldPrice    int64      `json:"old_price"`
+	NewPrice    int64      `json:"new_price"`
+	Currency    string     `json:"currency" gorm:"size:3"`
+	OccurredAt  time.Time  `json:"occurred_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty" gorm:"index"`
 }
 
+// OrderItem is a tour in the cart, or a whole bundle when BundleID is set.
+// Bundle items have no TourID of their own; TourName holds the bundle name.
+// BasePrice is what the guide asks, in the guide's BaseCurrency; Price is
+// that amount converted into the cart currency when the cart is priced.
 type OrderItem struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CartID         uint      `json:"cart_id" gorm:"not null"`
+	TourID         uint      `json:"tour_id" gorm:"not null"`
+	TourName       string    `json:"tour_name" gorm:"not null"`
+	AuthorUsername string    `json:"author_username"`
+	BundleID       *uint     `json:"bundle_id,omitempty" gorm:"index"`
+	Bundle         *Bundle   `json:"bundle,omitempty" gorm:"foreignKey:BundleID"`
+	BasePrice      int64     `json:"base_price" gorm:"not null;default:0"`
+	BaseCurrency   string    `json:"base_currency" gorm:"size:3"`
+	Price          int64     `json:"price" gorm:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Bundle is a set of a guide's tours sold together at one price, in minor
+// units of the tours' Currency. Bundles are not edited once created; a guide
+// archives one and creates another instead. Status follows the BundleStatus
+// constants.
+type Bundle struct {
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	Name           string       `json:"name" gorm:"not null"`
+	Description    string       `json:"description"`
+	AuthorUsername string       `json:"author_username" gorm:"not null;index"`
+	Price          int64        `json:"price" gorm:"not null"`
+	Currency       string       `json:"currency" gorm:"size:3"`
+	Status         string       `json:"status" gorm:"default:'active';index"`
+	Tours          []BundleTour `json:"tours" gorm:"foreignKey:BundleID"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// BundleTour is a tour contained in a bundle. AllocatedPrice is the tour's
+// share of the bundle price, split in proportion to the tours' list prices
+// when the bundle was created, and is what the tour earns when sold in it.
+type BundleTour struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	BundleID       uint   `json:"bundle_id" gorm:"not null;index"`
+	TourID         uint   `json:"tour_id" gorm:"not null"`
+	TourName       string `json:"tour_name" gorm:"not null"`
+	ListPrice      int64  `json:"list_price" gorm:"not null"`
+	AllocatedPrice int64  `json:"allocated_price" gorm:"not null"`
+}
+
+// Coupon is a discount that is either entered as a code or, for Automatic
+// coupons such as a guide's sale, applied to matching carts by itself.
+// DiscountType and Scope follow the Discount and CouponScope constants.
+// Percentage coupons take Value percent off; fixed coupons take Amount minor
+// units of Currency off, converted into the cart currency when applied.
+type Coupon struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Code           *string    `json:"code,omitempty" gorm:"uniqueIndex"`
+	Description    string     `json:"description"`
+	DiscountType   string     `json:"discount_type" gorm:"not null"`
+	Value          float64    `json:"value,omitempty" gorm:"default:0"`
+	Amount         int64      `json:"amount,omitempty" gorm:"default:0"`
+	Currency       string     `json:"currency,omitempty" gorm:"size:3"`
+	Scope          string     `json:"scope" gorm:"not null"`
+	TourIDs        []uint     `json:"tour_ids,omitempty" gorm:"type:jsonb;serializer:json"`
+	GuideUsername  string     `json:"guide_username,omitempty" gorm:"index"`
+	ValidFrom      time.Time  `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	MaxUses        int        `json:"max_uses" gorm:"default:0"`          // 0 means unlimited
+	MaxUsesPerUser int        `json:"max_uses_per_user" gorm:"default:0"` // 0 means unlimited
+	UsedCount      int        `json:"used_count" gorm:"default:0"`
+	Stackable      bool       `json:"stackable"`
+	Automatic      bool       `json:"automatic" gorm:"index"`
+	Active         bool       `json:"active" gorm:"default:true"`
+	CreatedBy      string     `json:"created_by" gorm:"not null"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CartCoupon is a code the user entered on their cart.
+type CartCoupon struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	CartID    uint      `json:"cart_id" gorm:"not null"`
-	TourID    uint      `json:"tour_id" gorm:"not null"`
-	TourName  string    `json:"tour_name" gorm:"not null"`
-	Price     float64   `json:"price" gorm:"not null"`
+	CartID    uint      `json:"cart_id" gorm:"not null;index"`
+	CouponID  uint      `json:"coupon_id" gorm:"not null"`
+	Code      string    `json:"code" gorm:"not null"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-type TourPurchaseToken struct {
+// CouponRedemption records a coupon used by a paid order and backs the
+// per-user usage limit.
+type CouponRedemption struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
+	CouponID  uint      `json:"coupon_id" gorm:"not null;index"`
 	UserID    string    `json:"user_id" gorm:"not null;index"`
-	TourID    uint      `json:"tour_id" gorm:"not null"`
-	TourName  string    `json:"tour_name" gorm:"not null"`
-	Token     string    `json:"token" gorm:"uniqueIndex;not null"`
-	Status    string    `json:"status" gorm:"default:'active'"` // active, expired, used
+	OrderID   uint      `json:"order_id" gorm:"not null"`
+	Amount    int64     `json:"amount" gorm:"not null"`
+	Currency  string    `json:"currency" gorm:"size:3"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DiscountLine is one coupon's effect on a cart or order. Allocations split
+// Amount across what was discounted: keyed by cart item ID on a cart and by
+// tour ID on an order.
+type DiscountLine struct {
+	CouponID    uint           `json:"coupon_id"`
+	Code        string         `json:"code,omitempty"`
+	Description string         `json:"description"`
+	Amount      int64          `json:"amount"`
+	Allocations map[uint]int64 `json:"allocations"`
+}
+
+// CartChange describes a cart item whose terms no longer match the tour
+// service. Kind follows the CartChange constants; unavailable items are
+// removed from the cart, others are updated to the current values. Prices
+// are the guide's base prices in minor units of their own currencies.
+type CartChange struct {
+	ItemID      uint   `json:"item_id"`
+	TourID      uint   `json:"tour_id,omitempty"`
+	BundleID    *uint  `json:"bundle_id,omitempty"`
+	Kind        string `json:"kind"`
+	OldName     string `json:"old_name,omitempty"`
+	NewName     string `json:"new_name,omitempty"`
+	OldPrice    int64  `json:"old_price,omitempty"`
+	OldCurrency string `json:"old_currency,omitempty"`
+	NewPrice    int64  `json:"new_price,omitempty"`
+	NewCurrency string `json:"new_currency,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+// TourPurchaseToken grants UserID access to a tour. UserID is the current
+// holder; PurchasedBy is who paid for it and differs for gifts and
+// transferred tokens.
+type TourPurchaseToken struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         string     `json:"user_id" gorm:"not null;index"`
+	PurchasedBy    string     `json:"purchased_by" gorm:"index"`
+	OrderID        *uint      `json:"order_id,omitempty" gorm:"index"`
+	TourID         uint       `json:"tour_id" gorm:"not null"`
+	TourName       string     `json:"tour_name" gorm:"not null"`
+	Token          string     `json:"token" gorm:"uniqueIndex;not null"`
+	Status         string     `json:"status" gorm:"default:'active'"` // active, expired, used, refunded
+	TransferredAt  *time.Time `json:"transferred_at,omitempty"`
+	UsedAt         *time.Time `json:"used_at,omitempty"`
+	ExpiryWarnedAt *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+}
+
+// TokenEvent is an entry in the outbox of token lifecycle events. Events are
+// written in the same transaction as the change they describe and handed to
+// the EventPublisher afterwards; PublishedAt is set once delivered.
+type TokenEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Type        string     `json:"type" gorm:"not null;index"`
+	TokenID     uint       `json:"token_id" gorm:"not null;index"`
+	UserID      string     `json:"user_id" gorm:"not null;index"`
+	TourID      uint       `json:"tour_id" gorm:"not null"`
+	TourName    string     `json:"tour_name"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	OccurredAt  time.Time  `json:"occurred_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty" gorm:"index"`
+}
+
+// TokenTransfer is the audit trail of a purchase token changing hands.
+type TokenTransfer struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TokenID   uint      `json:"token_id" gorm:"not null;index"`
+	FromUser  string    `json:"from_user" gorm:"not null"`
+	ToUser    string    `json:"to_user" gorm:"not null"`
+	Note      string    `json:"note"`
 	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Gift is one tour of an order bought for someone else. A gift to a named
+// recipient gets its token at checkout; a gift code stays pending until it
+// is redeemed, and the token is issued to whoever redeems it.
+type Gift struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	OrderID     uint       `json:"order_id" gorm:"not null;index"`
+	OrderLineID uint       `json:"order_line_id" gorm:"not null"`
+	PurchasedBy string     `json:"purchased_by" gorm:"not null;index"`
+	Recipient   string     `json:"recipient,omitempty" gorm:"index"`
+	Code        *string    `json:"code,omitempty" gorm:"uniqueIndex;size:32"`
+	TourID      uint       `json:"tour_id" gorm:"not null"`
+	TourName    string     `json:"tour_name" gorm:"not null"`
+	Message     string     `json:"message"`
+	Status      string     `json:"status" gorm:"not null"`
+	TokenID     *uint      `json:"token_id,omitempty"`
+	RedeemedAt  *time.Time `json:"redeemed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Payment tracks a charge made through the PaymentProvider. IntentID is the
+// provider's identifier; Status follows the PaymentStatus constants. Amounts
+// are minor units of Currency.
+type Payment struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         string    `json:"user_id" gorm:"not null;index"`
+	Provider       string    `json:"provider" gorm:"not null"`
+	IntentID       string    `json:"intent_id" gorm:"index"`
+	Amount         int64     `json:"amount" gorm:"not null"`
+	RefundedAmount int64     `json:"refunded_amount" gorm:"default:0"`
+	Currency       string    `json:"currency" gorm:"not null"`
+	Status         string    `json:"status" gorm:"default:'pending'"`
+	FailureReason  string    `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Order is the permanent record of a checkout: what was bought, at which
+// price, and how it was paid. Status follows the OrderStatus constants.
+// Amounts are minor units of Currency, which the order was charged in, and
+// ExchangeRates keeps the rates used to convert the guides' prices into it.
+// InvoicedAt is set once every guide's invoice for the order was issued.
+// Checkout keeps what finishing the order needs while it is pending.
+type Order struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	UserID        string         `json:"user_id" gorm:"not null;index"`
+	Status        string         `json:"status" gorm:"default:'pending'"`
+	Currency      string         `json:"currency" gorm:"not null"`
+	Subtotal      int64          `json:"subtotal" gorm:"not null"`
+	DiscountTotal int64          `json:"discount_total" gorm:"default:0"`
+	Discounts     []DiscountLine `json:"discounts,omitempty" gorm:"type:jsonb;serializer:json"`
+	TaxTotal      int64          `json:"tax_total" gorm:"default:0"`
+	Total         int64          `json:"total" gorm:"not null"`
+	ExchangeRates []ExchangeRate `json:"exchange_rates,omitempty" gorm:"type:jsonb;serializer:json"`
+	PaymentID     *uint          `json:"payment_id,omitempty"`
+	Payment       *Payment       `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
+	Lines         []OrderLine    `json:"lines" gorm:"foreignKey:OrderID"`
+	Checkout      *CheckoutState `json:"-" gorm:"type:jsonb;serializer:json"`
+	PaidAt        *time.Time     `json:"paid_at,omitempty"`
+	InvoicedAt    *time.Time     `json:"-" gorm:"index"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// CheckoutState records where a pending order came from: the cart items and
+// coupons it was taken from, which are removed from the cart once it is paid,
+// and the gift it was bought as.
+type CheckoutState struct {
+	CartID    uint         `json:"cart_id"`
+	ItemIDs   []uint       `json:"item_ids"`
+	CouponIDs []uint       `json:"coupon_ids,omitempty"`
+	Gift      *GiftRequest `json:"gift,omitempty"`
+}
+
+// OrderLine snapshots a purchased tour at checkout time and points at the
+// token issued for it once the order is paid. A bundle becomes one line per
+// contained tour, priced at the tour's share of the bundle. BasePrice is the
+// guide's price in BaseCurrency; the other amounts are in the order currency.
+// Total is what was charged for the line, Net plus Tax, and Taxation records
+// how the tax was worked out.
+type OrderLine struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	OrderID       uint      `json:"order_id" gorm:"not null;index"`
+	TourID        uint      `json:"tour_id" gorm:"not null"`
+	TourName      string    `json:"tour_name" gorm:"not null"`
+	BundleID      *uint     `json:"bundle_id,omitempty" gorm:"index"`
+	BundleName    string    `json:"bundle_name,omitempty"`
+	BasePrice     int64     `json:"base_price" gorm:"default:0"`
+	BaseCurrency  string    `json:"base_currency" gorm:"size:3"`
+	UnitPrice     int64     `json:"unit_price" gorm:"not null"`
+	Discount      int64     `json:"discount" gorm:"default:0"`
+	Net           int64     `json:"net" gorm:"default:0"`
+	Tax           int64     `json:"tax" gorm:"default:0"`
+	Taxation      *Taxation `json:"taxation,omitempty" gorm:"type:jsonb;serializer:json"`
+	Total         int64     `json:"total" gorm:"not null"`
+	TokenID       *uint     `json:"token_id,omitempty"`
+	GuideUsername string    `json:"guide_username,omitempty" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Taxation is the tax rule applied to an order line and what it was
+// matched on. Rate is in percent.
+type Taxation struct {
+	Rule          string  `json:"rule"`
+	Rate          float64 `json:"rate"`
+	Inclusive     bool    `json:"inclusive"`
+	SellerCountry string  `json:"seller_country,omitempty"`
+	BuyerCountry  string  `json:"buyer_country,omitempty"`
+	ProductType   string  `json:"product_type"`
+}
+
+// Refund is a tourist's request to give back a single purchased tour. It is
+// approved by an admin or automatically by policy, after which the payment is
+// refunded and the token revoked. Status follows the RefundStatus constants.
+type Refund struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        string     `json:"user_id" gorm:"not null;index"`
+	OrderID       uint       `json:"order_id" gorm:"not null;index"`
+	OrderLineID   uint       `json:"order_line_id" gorm:"not null"`
+	TokenID       uint       `json:"token_id" gorm:"not null;index"`
+	TourID        uint       `json:"tour_id" gorm:"not null"`
+	TourName      string     `json:"tour_name"`
+	Amount        int64      `json:"amount" gorm:"not null"`
+	Currency      string     `json:"currency" gorm:"not null"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status" gorm:"default:'requested';index"`
+	DecidedBy     string     `json:"decided_by,omitempty"`
+	DecisionNote  string     `json:"decision_note,omitempty"`
+	FailureReason string     `json:"failure_reason,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// LedgerAccount is one balance of the double-entry ledger: a guide's
+// earnings, the platform's fees, or the clearing account that customer money
+// comes in through and payouts leave from. There is one account per owner and
+// currency, and its balance is the sum of its entries, credits minus debits.
+type LedgerAccount struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Type      string    `json:"type" gorm:"not null;uniqueIndex:idx_ledger_account"`
+	Owner     string    `json:"owner" gorm:"not null;default:'';uniqueIndex:idx_ledger_account"`
+	Currency  string    `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_ledger_account"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LedgerTransaction groups the entries posted for one event: the sale of an
+// order line, a refund or a payout. Its debits always add up to its credits.
+// Reference is unique so the same event can never be posted twice.
+type LedgerTransaction struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	Kind        string        `json:"kind" gorm:"not null;index"`
+	Reference   string        `json:"reference" gorm:"not null;uniqueIndex"`
+	Description string        `json:"description"`
+	Currency    string        `json:"currency" gorm:"size:3;not null"`
+	OrderID     *uint         `json:"order_id,omitempty" gorm:"index"`
+	OrderLineID *uint         `json:"order_line_id,omitempty"`
+	RefundID    *uint         `json:"refund_id,omitempty"`
+	PayoutID    *uint         `json:"payout_id,omitempty"`
+	Entries     []LedgerEntry `json:"entries" gorm:"foreignKey:TransactionID"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// LedgerEntry moves an amount in minor units of the account's currency.
+// Exactly one of Debit and Credit is set.
+type LedgerEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TransactionID uint      `json:"transaction_id" gorm:"not null;index"`
+	AccountID     uint      `json:"account_id" gorm:"not null;index"`
+	Debit         int64     `json:"debit" gorm:"default:0"`
+	Credit        int64     `json:"credit" gorm:"default:0"`
+	Memo          string    `json:"memo"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Payout records money paid out to a guide outside the platform, such as a
+// bank transfer. Reference is the transfer's reference for reconciliation.
+type Payout struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	GuideUsername string    `json:"guide_username" gorm:"not null;index"`
+	Amount        int64     `json:"amount" gorm:"not null"`
+	Currency      string    `json:"currency" gorm:"size:3;not null"`
+	Reference     string    `json:"reference,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Invoice is an invoice issued by one guide for their tours in an order, or
+// a credit note correcting such an invoice. Seller and buyer are snapshots
+// of their profiles at issue time. Once issued an invoice never changes;
+// mistakes and refunds are corrected by issuing a credit note that points at
+// it through CorrectsID. Amounts are minor units of Currency; on a credit
+// note they are the amounts credited back.
+type Invoice struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	Number         string            `json:"number" gorm:"not null;uniqueIndex"`
+	Kind           string            `json:"kind" gorm:"not null"`
+	Reference      *string           `json:"-" gorm:"uniqueIndex"`
+	OrderID        uint              `json:"order_id" gorm:"not null;index"`
+	CorrectsID     *uint             `json:"corrects_id,omitempty" gorm:"index"`
+	CorrectsNumber string            `json:"corrects_number,omitempty"`
+	RefundID       *uint             `json:"refund_id,omitempty"`
+	Reason         string            `json:"reason,omitempty"`
+	Seller         InvoiceParty      `json:"seller" gorm:"type:jsonb;serializer:json"`
+	SellerUsername string            `json:"-" gorm:"not null;index"`
+	Buyer          InvoiceParty      `json:"buyer" gorm:"type:jsonb;serializer:json"`
+	BuyerUsername  string            `json:"-" gorm:"not null;index"`
+	Currency       string            `json:"currency" gorm:"size:3;not null"`
+	Lines          []InvoiceLine     `json:"lines" gorm:"type:jsonb;serializer:json"`
+	Discounts      []InvoiceDiscount `json:"discounts,omitempty" gorm:"type:jsonb;serializer:json"`
+	Subtotal       int64             `json:"subtotal"`
+	DiscountTotal  int64             `json:"discount_total"`
+	Taxes          []InvoiceTax      `json:"taxes,omitempty" gorm:"type:jsonb;serializer:json"`
+	TaxTotal       int64             `json:"tax_total"`
+	Total          int64             `json:"total"`
+	IssuedAt       time.Time         `json:"issued_at"`
+	CreatedBy      string            `json:"created_by,omitempty"`
+}
+
+// InvoiceParty is the seller or buyer as named on an invoice.
+type InvoiceParty struct {
+	Username  string `json:"username"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+}
+
+// InvoiceLine is an order line as invoiced. Total is Net plus Tax.
+type InvoiceLine struct {
+	OrderLineID uint    `json:"order_line_id"`
+	TourID      uint    `json:"tour_id"`
+	Description string  `json:"description"`
+	UnitPrice   int64   `json:"unit_price"`
+	Discount    int64   `json:"discount"`
+	Net         int64   `json:"net"`
+	TaxRule     string  `json:"tax_rule,omitempty"`
+	TaxRate     float64 `json:"tax_rate"`
+	Tax         int64   `json:"tax"`
+	Total       int64   `json:"total"`
+}
+
+// InvoiceTax sums the lines of an invoice taxed by one rule.
+type InvoiceTax struct {
+	Rule string  `json:"rule"`
+	Rate float64 `json:"rate"`
+	Net  int64   `json:"net"`
+	Tax  int64   `json:"tax"`
+}
+
+// InvoiceDiscount is the part of an order discount that went to the lines of
+// one invoice.
+type InvoiceDiscount struct {
+	Code        string `json:"code,omitempty"`
+	Description string `json:"description"`
+	Amount      int64  `json:"amount"`
+}
+
+// InvoiceSequence hands out gapless invoice numbers for one series, such as
+// the invoices or credit notes of a year.
+type InvoiceSequence struct {
+	Series     string `gorm:"primaryKey"`
+	LastNumber int64  `gorm:"not null"`
+}
+
+// CheckoutRecord remembers the order created by a successful checkout made
+// with an Idempotency-Key so that retries return it instead of purchasing the
+// cart again.
+type CheckoutRecord struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         string    `json:"user_id" gorm:"not null;uniqueIndex:idx_checkout_user_key"`
+	IdempotencyKey string    `json:"idempotency_key" gorm:"not null;uniqueIndex:idx_checkout_user_key"`
+	OrderID        uint      `json:"order_id" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 // Methods for ShoppingCart
+
+// CalculateTotal sums the items into Subtotal and subtracts the discount
+// lines currently set on the cart.
 func (cart *ShoppingCart) CalculateTotal() {
-	total := 0.0
+	subtotal := int64(0)
 	for _, item := range cart.Items {
-		total += item.Price
+		subtotal += item.Price
+	}
+	discount := int64(0)
+	for _, line := range cart.Discounts {
+		discount += line.Amount
+	}
+	cart.Subtotal = subtotal
+	cart.Total = max(subtotal-discount, 0)
+}
+
+func (cart *ShoppingCart) HasCoupon(couponID uint) bool {
+	for _, coupon := range cart.Coupons {
+		if coupon.CouponID == couponID {
+			return true
+		}
 	}
-	cart.Total = total
+	return false
 }
 
+// HasTour reports whether the tour is in the cart on its own or as part of
+// a bundle.
 func (cart *ShoppingCart) HasTour(tourID uint) bool {
 	for _, item := range cart.Items {
-		if item.TourID == tourID {
+		if item.BundleID == nil && item.TourID == tourID {
+			return true
+		}
+		if item.Bundle != nil && item.Bundle.HasTour(tourID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps reports whether the cart already holds the item's tour or bundle,
+// or any tour of its bundle.
+func (cart *ShoppingCart) Overlaps(item OrderItem) bool {
+	if item.BundleID == nil {
+		return cart.HasTour(item.TourID)
+	}
+	if cart.HasBundle(*item.BundleID) {
+		return true
+	}
+	if item.Bundle != nil {
+		for _, tour := range item.Bundle.Tours {
+			if cart.HasTour(tour.TourID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cart *ShoppingCart) HasBundle(bundleID uint) bool {
+	for _, item := range cart.Items {
+		if item.BundleID != nil && *item.BundleID == bundleID {
 			return true
 		}
 	}
 	return false
 }
 
+// Methods for Bundle
+
+func (bundle *Bundle) HasTour(tourID uint) bool {
+	for _, tour := range bundle.Tours {
+		if tour.TourID == tourID {
+			return true
+		}
+	}
+	return false
+}
+
+// Methods for Order
+
+// CalculateTotals derives line totals and order totals from unit prices,
+// the per-line discounts and the lines' taxation. Inclusive tax is part of
+// the discounted price, exclusive tax is charged on top of it.
+func (order *Order) CalculateTotals() {
+	subtotal := int64(0)
+	discount := int64(0)
+	tax := int64(0)
+	total := int64(0)
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		amount := line.UnitPrice - line.Discount
+		line.Net, line.Tax = amount, 0
+		if line.Taxation != nil {
+			line.Net, line.Tax = splitTax(amount, line.Taxation.Rate, line.Taxation.Inclusive)
+		}
+		line.Total = line.Net + line.Tax
+		subtotal += line.UnitPrice
+		discount += line.Discount
+		tax += line.Tax
+		total += line.Total
+	}
+	order.Subtotal = subtotal
+	order.DiscountTotal = discount
+	order.TaxTotal = tax
+	order.Total = total
+}
+
+// Methods for Invoice
+
+// sumLines derives the totals and the tax summary of an invoice from its
+// lines.
+func (invoice *Invoice) sumLines() {
+	invoice.Subtotal, invoice.DiscountTotal, invoice.TaxTotal, invoice.Total = 0, 0, 0, 0
+	invoice.Taxes = nil
+	for _, line := range invoice.Lines {
+		invoice.Subtotal += line.UnitPrice
+		invoice.DiscountTotal += line.Discount
+		invoice.TaxTotal += line.Tax
+		invoice.Total += line.Total
+		if line.TaxRule == "" {
+			continue
+		}
+
+		found := false
+		for i := range invoice.Taxes {
+			tax := &invoice.Taxes[i]
+			if tax.Rule == line.TaxRule && tax.Rate == line.TaxRate {
+				tax.Net += line.Net
+				tax.Tax += line.Tax
+				found = true
+				break
+			}
+		}
+		if !found {
+			invoice.Taxes = append(invoice.Taxes, InvoiceTax{Rule: line.TaxRule, Rate: line.TaxRate, Net: line.Net, Tax: line.Tax})
+		}
+	}
+}
+
+// BeforeUpdate keeps issued invoices immutable.
+func (invoice *Invoice) BeforeUpdate(tx *gorm.DB) error {
+	return ErrInvoiceImmutable
+}
+
+// BeforeDelete keeps issued invoices from being removed.
+func (invoice *Invoice) BeforeDelete(tx *gorm.DB) error {
+	return ErrInvoiceImmutable
+}
+
+// DisplayName is the party's full name, or the username without one.
+func (party InvoiceParty) DisplayName() string {
+	name := strings.TrimSpace(party.FirstName + " " + party.LastName)
+	if name == "" {
+		return party.Username
+	}
+	return name + " (" + party.Username + ")"
+}
+
 // Methods for TourPurchaseToken
+// IsValid reports whether the token still grants access to its tour. Used
+// tokens keep access until they expire; they just can no longer be
+// transferred or refunded automatically.
 func (token *TourPurchaseToken) IsValid() bool {
-	return token.Status == "active" && time.Now().Before(token.ExpiresAt)
+	return (token.Status == TokenStatusActive || token.Status == TokenStatusUsed) && time.Now().Before(token.ExpiresAt)
 }
 
 func (token *TourPurchaseToken) IsExpired() bool {
 	return time.Now().After(token.ExpiresAt)
-}
\ No newline at end of file
+}
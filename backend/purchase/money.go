@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"money"
+)
+
+// Money is kept as int64 minor units (cents for EUR) next to an ISO 4217
+// currency code. Amounts are only converted between currencies through an
+// ExchangeRate so that every conversion can be traced back to a rate.
+
+// isCurrencyCode reports whether code looks like an ISO 4217 code.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// convertAmount converts minor units of rate.From into minor units of rate.To,
+// rounding half away from zero once at the end.
+func convertAmount(amount int64, rate ExchangeRate) int64 {
+	if rate.From == rate.To {
+		return amount
+	}
+	major := float64(amount) / math.Pow10(money.MinorUnitExponent(rate.From))
+	return int64(math.Round(major * rate.Rate * math.Pow10(money.MinorUnitExponent(rate.To))))
+}
+
+// formatMinorUnits renders minor units as a decimal amount in major units,
+// such as "12.34" for 1234 EUR.
+func formatMinorUnits(amount int64, currency string) string {
+	exponent := money.MinorUnitExponent(currency)
+	if exponent == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	divisor := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/divisor, exponent, amount%divisor)
+}
+
+// percentOf returns percent of amount, rounded to a whole minor unit.
+func percentOf(amount int64, percent float64) int64 {
+	return int64(math.Round(float64(amount) * percent / 100))
+}
+
+// splitTax splits amount into its net part and the tax at rate percent. An
+// inclusive amount already contains the tax; otherwise the tax comes on top.
+func splitTax(amount int64, rate float64, inclusive bool) (int64, int64) {
+	if inclusive {
+		net := int64(math.Round(float64(amount) * 100 / (100 + rate)))
+		return net, amount - net
+	}
+	return amount, percentOf(amount, rate)
+}
+
+// splitAmount divides amount into parts proportional to weights using the
+// largest remainder method, so the parts always add up to amount exactly and
+// none is more than one minor unit away from its exact share. Equal weights
+// are used when all weights are zero.
+func splitAmount(amount int64, weights []int64) []int64 {
+	parts := make([]int64, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	base := int64(0)
+	for _, weight := range weights {
+		base += weight
+	}
+	if base <= 0 {
+		weights = make([]int64, len(parts))
+		for i := range weights {
+			weights[i] = 1
+		}
+		base = int64(len(weights))
+	}
+
+	remainders := make([]int64, len(weights))
+	allocated := int64(0)
+	for i, weight := range weights {
+		parts[i] = amount * weight / base
+		remainders[i] = amount * weight % base
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; allocated < amount; i++ {
+		parts[order[i%len(order)]]++
+		allocated++
+	}
+
+	return parts
+}
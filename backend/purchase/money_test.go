@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		rate   ExchangeRate
+		want   int64
+	}{
+		{"same currency", 1234, ExchangeRate{From: "EUR", To: "EUR", Rate: 2}, 1234},
+		{"cents to cents", 1000, ExchangeRate{From: "EUR", To: "USD", Rate: 1.1}, 1100},
+		{"cents to yen", 1000, ExchangeRate{From: "EUR", To: "JPY", Rate: 160.5}, 1605},
+		{"yen to cents", 1605, ExchangeRate{From: "JPY", To: "EUR", Rate: 1 / 160.5}, 1000},
+		{"cents to fils", 1000, ExchangeRate{From: "EUR", To: "KWD", Rate: 0.33}, 3300},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := convertAmount(test.amount, test.rate); got != test.want {
+				t.Errorf("convertAmount(%d, %+v) = %d, want %d", test.amount, test.rate, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{1234, "EUR", "12.34"},
+		{5, "EUR", "0.05"},
+		{-1234, "EUR", "-12.34"},
+		{-5, "EUR", "-0.05"},
+		{1605, "JPY", "1605"},
+		{1234, "KWD", "1.234"},
+		{0, "USD", "0.00"},
+	}
+
+	for _, test := range tests {
+		if got := formatMinorUnits(test.amount, test.currency); got != test.want {
+			t.Errorf("formatMinorUnits(%d, %s) = %q, want %q", test.amount, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestSplitTax(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    int64
+		rate      float64
+		inclusive bool
+		net       int64
+		tax       int64
+	}{
+		{"exclusive", 1000, 20, false, 1000, 200},
+		{"exclusive rounds half away from zero", 1005, 10, false, 1005, 101},
+		{"exclusive rounds down", 1004, 10, false, 1004, 100},
+		{"inclusive", 1200, 20, true, 1000, 200},
+		{"inclusive rounds the net", 999, 19, true, 839, 160},
+		{"inclusive keeps the total", 1, 20, true, 1, 0},
+		{"zero rate", 1000, 0, true, 1000, 0},
+		{"yen", 1605, 10, false, 1605, 161},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			net, tax := splitTax(test.amount, test.rate, test.inclusive)
+			if net != test.net || tax != test.tax {
+				t.Errorf("splitTax(%d, %v, %v) = %d, %d, want %d, %d", test.amount, test.rate, test.inclusive, net, tax, test.net, test.tax)
+			}
+			if test.inclusive && net+tax != test.amount {
+				t.Errorf("inclusive parts add up to %d, want %d", net+tax, test.amount)
+			}
+		})
+	}
+}
+
+func TestSplitAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"no weights", 100, nil, []int64{}},
+		{"exact", 100, []int64{1, 1}, []int64{50, 50}},
+		{"remainder to the largest remainders", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"proportional", 1000, []int64{1500, 500}, []int64{750, 250}},
+		{"uneven", 10, []int64{3, 3, 4}, []int64{3, 3, 4}},
+		{"largest remainder first", 10, []int64{1, 2, 4}, []int64{1, 3, 6}},
+		{"zero weights split equally", 5, []int64{0, 0}, []int64{3, 2}},
+		{"zero weight gets nothing", 99, []int64{0, 1}, []int64{0, 99}},
+		{"zero amount", 0, []int64{2, 3}, []int64{0, 0}},
+		{"one part", 7, []int64{5}, []int64{7}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitAmount(test.amount, test.weights)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("splitAmount(%d, %v) = %v, want %v", test.amount, test.weights, got, test.want)
+			}
+			total := int64(0)
+			for _, part := range got {
+				total += part
+			}
+			if len(got) > 0 && total != test.amount {
+				t.Errorf("parts add up to %d, want %d", total, test.amount)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type OrderHandler struct {
+	service *OrderService
+}
+
+func NewOrderHandler(service *OrderService) *OrderHandler {
+	return &OrderHandler{service: service}
+}
+
+func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	orders, err := h.service.GetUserOrders(userID)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get orders: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := OrdersResponse{
+		Orders:  orders,
+		Message: "Orders retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseUint(vars["orderId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.service.GetOrder(uint(orderID), userID)
+	if err != nil {
+		h.handleOrderError(w, err)
+		return
+	}
+
+	tokens, err := h.service.GetOrderTokens(order.ID, userID)
+	if err != nil {
+		h.handleOrderError(w, err)
+		return
+	}
+
+	response := OrderResponse{
+		Order:   order,
+		Tokens:  tokens,
+		Message: "Order retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OrderHandler) handleOrderError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrOrderNotFound, ErrUnauthorized:
+		h.sendErrorResponse(w, "Order not found", http.StatusNotFound)
+	default:
+		h.sendErrorResponse(w, "Failed to get order: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *OrderHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
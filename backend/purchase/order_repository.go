@@ -0,0 +1,122 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OrderRepository struct {
+	database *Database
+}
+
+func NewOrderRepository(db *Database) *OrderRepository {
+	return &OrderRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *OrderRepository) WithTx(tx *Database) *OrderRepository {
+	return &OrderRepository{database: tx}
+}
+
+// CreateOrder inserts the order together with its lines.
+func (r *OrderRepository) CreateOrder(order *Order) error {
+	result := r.database.db.Create(order)
+	return result.Error
+}
+
+func (r *OrderRepository) UpdateOrderStatus(order *Order) error {
+	result := r.database.db.Model(&Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"status":     order.Status,
+		"payment_id": order.PaymentID,
+		"paid_at":    order.PaidAt,
+	})
+	return result.Error
+}
+
+// SetPayment links the order to the payment charging it.
+func (r *OrderRepository) SetPayment(orderID uint, paymentID uint) error {
+	result := r.database.db.Model(&Order{}).Where("id = ?", orderID).Update("payment_id", paymentID)
+	return result.Error
+}
+
+// ClaimPending moves a pending order to status and reports
+// ErrOrderNotPending if it was no longer pending, so a checkout is finished
+// or given up only once.
+func (r *OrderRepository) ClaimPending(orderID uint, status string, paidAt *time.Time) error {
+	result := r.database.db.Model(&Order{}).Where("id = ? AND status = ?", orderID, OrderStatusPending).Updates(map[string]interface{}{
+		"status":  status,
+		"paid_at": paidAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrderNotPending
+	}
+	return nil
+}
+
+// HasPendingOrder reports whether the user has a checkout in progress.
+func (r *OrderRepository) HasPendingOrder(userID string) (bool, error) {
+	var count int64
+	result := r.database.db.Model(&Order{}).Where("user_id = ? AND status = ?", userID, OrderStatusPending).Count(&count)
+	return count > 0, result.Error
+}
+
+// GetStalePendingOrderIDs returns up to limit orders that have been pending
+// since before, oldest first.
+func (r *OrderRepository) GetStalePendingOrderIDs(before time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	result := r.database.db.Model(&Order{}).
+		Where("status = ? AND created_at < ?", OrderStatusPending, before).
+		Order("id").Limit(limit).Pluck("id", &ids)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return ids, nil
+}
+
+func (r *OrderRepository) SetLineToken(lineID uint, tokenID uint) error {
+	result := r.database.db.Model(&OrderLine{}).Where("id = ?", lineID).Update("token_id", tokenID)
+	return result.Error
+}
+
+func (r *OrderRepository) GetOrderByID(id uint) (*Order, error) {
+	var order Order
+	result := r.database.db.Preload("Lines").Preload("Payment").Where("id = ?", id).First(&order)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrOrderNotFound
+		}
+		return nil, result.Error
+	}
+	return &order, nil
+}
+
+func (r *OrderRepository) GetOrdersByUserID(userID string) ([]Order, error) {
+	var orders []Order
+	result := r.database.db.Preload("Lines").Preload("Payment").Where("user_id = ?", userID).Order("created_at DESC").Find(&orders)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return orders, nil
+}
+
+// GetUninvoicedOrderIDs returns up to limit paid orders whose invoices have
+// not all been issued, oldest first.
+func (r *OrderRepository) GetUninvoicedOrderIDs(limit int) ([]uint, error) {
+	var ids []uint
+	result := r.database.db.Model(&Order{}).
+		Where("paid_at IS NOT NULL AND invoiced_at IS NULL").
+		Order("id").Limit(limit).Pluck("id", &ids)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return ids, nil
+}
+
+func (r *OrderRepository) MarkInvoiced(orderID uint, at time.Time) error {
+	result := r.database.db.Model(&Order{}).Where("id = ?", orderID).Update("invoiced_at", at)
+	return result.Error
+}
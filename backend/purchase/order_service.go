@@ -0,0 +1,40 @@
+package main
+
+type OrderService struct {
+	orderRepository    *OrderRepository
+	purchaseRepository *PurchaseRepository
+}
+
+func NewOrderService(orderRepo *OrderRepository, purchaseRepo *PurchaseRepository) *OrderService {
+	return &OrderService{
+		orderRepository:    orderRepo,
+		purchaseRepository: purchaseRepo,
+	}
+}
+
+func (s *OrderService) GetUserOrders(userID string) ([]Order, error) {
+	return s.orderRepository.GetOrdersByUserID(userID)
+}
+
+func (s *OrderService) GetOrder(orderID uint, userID string) (*Order, error) {
+	order, err := s.orderRepository.GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	return order, nil
+}
+
+// GetOrderTokens returns the purchase tokens issued for an order.
+func (s *OrderService) GetOrderTokens(orderID uint, userID string) ([]TourPurchaseToken, error) {
+	_, err := s.GetOrder(orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.purchaseRepository.GetTokensByOrderID(orderID)
+}
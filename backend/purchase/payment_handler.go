@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type PaymentHandler struct {
+	service *PaymentService
+}
+
+func NewPaymentHandler(service *PaymentService) *PaymentHandler {
+	return &PaymentHandler{service: service}
+}
+
+func (h *PaymentHandler) GetUserPayments(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	payments, err := h.service.GetUserPayments(userID)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := PaymentsResponse{
+		Payments: payments,
+		Message:  "Payments retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	paymentID, err := strconv.ParseUint(vars["paymentId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	payment, err := h.service.GetPayment(uint(paymentID), userID)
+	if err != nil {
+		switch err {
+		case ErrPaymentNotFound, ErrUnauthorized:
+			h.sendErrorResponse(w, "Payment not found", http.StatusNotFound)
+		default:
+			h.sendErrorResponse(w, "Failed to get payment: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := PaymentResponse{
+		Payment: payment,
+		Message: "Payment retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Webhook receives status notifications from the payment provider. It is
+// called by the provider directly and is not exposed through the gateway.
+func (h *PaymentHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.HandleWebhook(payload, r.Header.Get("X-Payment-Signature"))
+	if err != nil {
+		switch err {
+		case ErrInvalidWebhookSignature:
+			h.sendErrorResponse(w, "Invalid webhook signature", http.StatusUnauthorized)
+		case ErrPaymentNotFound:
+			h.sendErrorResponse(w, "Payment not found", http.StatusNotFound)
+		default:
+			h.sendErrorResponse(w, "Failed to process webhook: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook processed"})
+}
+
+func (h *PaymentHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
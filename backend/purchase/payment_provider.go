@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// PaymentProvider is the gateway used to charge tourists at checkout.
+// Implementations must be safe for concurrent use.
+type PaymentProvider interface {
+	// Name identifies the provider on stored payments.
+	Name() string
+	// Authorize reserves the amount without moving money yet.
+	Authorize(ctx context.Context, request AuthorizeRequest) (*PaymentIntent, error)
+	// Capture collects a previously authorized intent.
+	Capture(ctx context.Context, intentID string) (*PaymentIntent, error)
+	// Refund returns amount of a captured intent to the payer.
+	Refund(ctx context.Context, intentID string, amount int64) (*PaymentIntent, error)
+	// ParseWebhook verifies and decodes an asynchronous status notification.
+	ParseWebhook(payload []byte, signature string) (*PaymentEvent, error)
+}
+
+// AuthorizeRequest amounts, like all provider amounts, are minor units of
+// Currency.
+type AuthorizeRequest struct {
+	Amount         int64
+	Currency       string
+	Reference      string // our payment ID, echoed back in webhook events
+	IdempotencyKey string
+}
+
+type PaymentIntent struct {
+	ID             string `json:"id"`
+	Reference      string `json:"reference"`
+	Amount         int64  `json:"amount"`
+	RefundedAmount int64  `json:"refunded_amount"`
+	Currency       string `json:"currency"`
+	Status         string `json:"status"`
+	FailureReason  string `json:"failure_reason,omitempty"`
+}
+
+type PaymentEvent struct {
+	IntentID      string `json:"intent_id"`
+	Reference     string `json:"reference"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// NewPaymentProvider picks the provider configured by PAYMENT_PROVIDER.
+// Only the in-process fake gateway exists for now.
+func NewPaymentProvider() PaymentProvider {
+	name := GetEnv("PAYMENT_PROVIDER", "fake")
+	if name != "fake" {
+		log.Printf("Unknown payment provider %q, falling back to fake gateway", name)
+	}
+	return NewFakePaymentProvider(
+		GetEnv("FAKE_PAYMENT_BEHAVIOR", FakeBehaviorApprove),
+		GetEnv("PAYMENT_WEBHOOK_SECRET", "fake_webhook_secret"),
+	)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"gorm.io/gorm"
+)
+
+type PaymentRepository struct {
+	database *Database
+}
+
+func NewPaymentRepository(db *Database) *PaymentRepository {
+	return &PaymentRepository{database: db}
+}
+
+func (r *PaymentRepository) CreatePayment(payment *Payment) error {
+	result := r.database.db.Create(payment)
+	return result.Error
+}
+
+func (r *PaymentRepository) UpdatePayment(payment *Payment) error {
+	result := r.database.db.Save(payment)
+	return result.Error
+}
+
+func (r *PaymentRepository) GetPaymentByID(id uint) (*Payment, error) {
+	var payment Payment
+	result := r.database.db.Where("id = ?", id).First(&payment)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, result.Error
+	}
+	return &payment, nil
+}
+
+func (r *PaymentRepository) GetPaymentByIntentID(intentID string) (*Payment, error) {
+	var payment Payment
+	result := r.database.db.Where("intent_id = ?", intentID).First(&payment)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, result.Error
+	}
+	return &payment, nil
+}
+
+func (r *PaymentRepository) GetPaymentsByUserID(userID string) ([]Payment, error) {
+	var payments []Payment
+	result := r.database.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&payments)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return payments, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+)
+
+type PaymentService struct {
+	paymentRepository *PaymentRepository
+	provider          PaymentProvider
+	timeout           time.Duration
+}
+
+func NewPaymentService(paymentRepo *PaymentRepository, provider PaymentProvider) *PaymentService {
+	timeout, err := time.ParseDuration(GetEnv("PAYMENT_TIMEOUT", "10s"))
+	if err != nil {
+		log.Printf("Invalid PAYMENT_TIMEOUT, using 10s: %v", err)
+		timeout = 10 * time.Second
+	}
+
+	return &PaymentService{
+		paymentRepository: paymentRepo,
+		provider:          provider,
+		timeout:           timeout,
+	}
+}
+
+// Authorize records a pending payment and reserves amount, in minor units of
+// currency, with the provider. The payment is persisted even when
+// authorization fails so failed attempts stay visible.
+func (s *PaymentService) Authorize(userID string, amount int64, currency string, idempotencyKey string) (*Payment, error) {
+	payment := &Payment{
+		UserID:   userID,
+		Provider: s.provider.Name(),
+		Amount:   amount,
+		Currency: currency,
+		Status:   PaymentStatusPending,
+	}
+
+	err := s.paymentRepository.CreatePayment(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	intent, err := s.provider.Authorize(ctx, AuthorizeRequest{
+		Amount:         amount,
+		Currency:       currency,
+		Reference:      strconv.FormatUint(uint64(payment.ID), 10),
+		IdempotencyKey: idempotencyKey,
+	})
+	if intent != nil {
+		payment.IntentID = intent.ID
+	}
+	if err != nil {
+		return payment, s.fail(payment, "authorization", err)
+	}
+
+	payment.Status = PaymentStatusAuthorized
+	return payment, s.paymentRepository.UpdatePayment(payment)
+}
+
+// Capture collects an authorized payment. On timeout the outcome at the
+// provider is unknown; the payment is marked failed and, should a webhook later
+// report it captured, HandleWebhook refunds it.
+func (s *PaymentService) Capture(payment *Payment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	_, err := s.provider.Capture(ctx, payment.IntentID)
+	if err != nil {
+		return s.fail(payment, "capture", err)
+	}
+
+	payment.Status = PaymentStatusCaptured
+	payment.FailureReason = ""
+	return s.paymentRepository.UpdatePayment(payment)
+}
+
+// Refund returns amount of a captured payment to the tourist.
+func (s *PaymentService) Refund(payment *Payment, amount int64) error {
+	if payment.Status != PaymentStatusCaptured {
+		return ErrPaymentFailed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	intent, err := s.provider.Refund(ctx, payment.IntentID, amount)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrPaymentTimeout
+		}
+		log.Printf("Refund of payment %d failed: %v", payment.ID, err)
+		return ErrPaymentFailed
+	}
+
+	payment.RefundedAmount = intent.RefundedAmount
+	payment.Status = intent.Status
+	return s.paymentRepository.UpdatePayment(payment)
+}
+
+// HandleWebhook applies an asynchronous status change reported by the
+// provider. A capture that arrives for a payment we already gave up on is
+// refunded, because no tokens were issued for it.
+func (s *PaymentService) HandleWebhook(payload []byte, signature string) error {
+	event, err := s.provider.ParseWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+
+	payment, err := s.paymentRepository.GetPaymentByIntentID(event.IntentID)
+	if err == ErrPaymentNotFound && event.Reference != "" {
+		id, parseErr := strconv.ParseUint(event.Reference, 10, 32)
+		if parseErr == nil {
+			payment, err = s.paymentRepository.GetPaymentByID(uint(id))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Payment webhook: payment %d %s -> %s", payment.ID, payment.Status, event.Status)
+
+	if payment.IntentID == "" {
+		payment.IntentID = event.IntentID
+	}
+
+	switch event.Status {
+	case PaymentStatusCaptured:
+		if payment.Status == PaymentStatusFailed {
+			payment.Status = PaymentStatusCaptured
+			return s.Refund(payment, payment.Amount-payment.RefundedAmount)
+		}
+		payment.Status = PaymentStatusCaptured
+	case PaymentStatusFailed:
+		if payment.Status == PaymentStatusCaptured {
+			// Never downgrade a payment we already issued tokens for
+			return nil
+		}
+		payment.Status = PaymentStatusFailed
+		payment.FailureReason = event.FailureReason
+	case PaymentStatusRefunded:
+		payment.Status = PaymentStatusRefunded
+		payment.RefundedAmount = payment.Amount
+	default:
+		payment.Status = event.Status
+	}
+
+	return s.paymentRepository.UpdatePayment(payment)
+}
+
+// Abandon marks a payment whose checkout was given up as failed, unless it
+// was captured. Should the provider still capture it, HandleWebhook refunds
+// it.
+func (s *PaymentService) Abandon(payment *Payment) error {
+	if payment.Status == PaymentStatusCaptured || payment.Status == PaymentStatusFailed {
+		return nil
+	}
+	payment.Status = PaymentStatusFailed
+	payment.FailureReason = "checkout abandoned"
+	return s.paymentRepository.UpdatePayment(payment)
+}
+
+func (s *PaymentService) GetPayment(id uint, userID string) (*Payment, error) {
+	payment, err := s.paymentRepository.GetPaymentByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	return payment, nil
+}
+
+func (s *PaymentService) GetUserPayments(userID string) ([]Payment, error) {
+	return s.paymentRepository.GetPaymentsByUserID(userID)
+}
+
+// fail records why a provider call failed and maps it to a service error.
+func (s *PaymentService) fail(payment *Payment, step string, err error) error {
+	result := ErrPaymentFailed
+	payment.Status = PaymentStatusFailed
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		result = ErrPaymentTimeout
+		payment.FailureReason = step + " timed out"
+	case errors.Is(err, ErrPaymentDeclined):
+		result = ErrPaymentDeclined
+		payment.FailureReason = step + " declined"
+	default:
+		payment.FailureReason = step + " failed: " + err.Error()
+	}
+
+	log.Printf("Payment %d %s: %v", payment.ID, payment.FailureReason, err)
+
+	if updateErr := s.paymentRepository.UpdatePayment(payment); updateErr != nil {
+		log.Printf("Failed to record payment %d failure: %v", payment.ID, updateErr)
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// pdfDocument writes a plain, text-only A4 PDF in Courier. Being monospaced,
+// columns can be laid out by padding strings, which is all invoices and
+// receipts need, so no PDF library is required.
+type pdfDocument struct {
+	pages   [][]pdfLine
+	current []pdfLine
+	y       float64
+}
+
+type pdfLine struct {
+	y    float64
+	size float64
+	bold bool
+	text string
+}
+
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+	pdfFontSize   = 9.0
+
+	// pdfColumns is how many Courier characters fit between the margins
+	pdfColumns = 90
+)
+
+func newPDFDocument() *pdfDocument {
+	return &pdfDocument{y: pdfPageHeight - pdfMargin}
+}
+
+// Line writes one line of text at the default size.
+func (d *pdfDocument) Line(text string) {
+	d.write(text, pdfFontSize, false)
+}
+
+// Bold writes one line of bold text at the given size.
+func (d *pdfDocument) Bold(text string, size float64) {
+	d.write(text, size, true)
+}
+
+// Blank leaves an empty line.
+func (d *pdfDocument) Blank() {
+	d.write("", pdfFontSize, false)
+}
+
+// Rule draws a horizontal line of dashes across the page.
+func (d *pdfDocument) Rule() {
+	d.write(strings.Repeat("-", pdfColumns), pdfFontSize, false)
+}
+
+func (d *pdfDocument) write(text string, size float64, bold bool) {
+	leading := size * 1.4
+	if d.y-leading < pdfMargin {
+		d.pages = append(d.pages, d.current)
+		d.current = nil
+		d.y = pdfPageHeight - pdfMargin
+	}
+	d.y -= leading
+	d.current = append(d.current, pdfLine{y: d.y, size: size, bold: bold, text: text})
+}
+
+// Bytes renders the document.
+func (d *pdfDocument) Bytes() []byte {
+	pages := append(d.pages, d.current)
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are the catalog, the page tree and the two fonts; every
+	// page then takes two objects, the page and its content stream.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		var content bytes.Buffer
+		for _, line := range lines {
+			font := "F1"
+			if line.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, line.size, pdfMargin, line.y, pdfEscape(line.text))
+		}
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// pdfTransliterations spells letters WinAnsi lacks, as found in the names
+// of our users, with the closest letter it has.
+var pdfTransliterations = map[rune]string{
+	'č': "c", 'ć': "c", 'đ': "dj", 'Č': "C", 'Ć': "C", 'Đ': "Dj",
+}
+
+// pdfWinAnsi maps the letters WinAnsi places outside Latin-1.
+var pdfWinAnsi = map[rune]byte{
+	'š': 0x9A, 'Š': 0x8A, 'ž': 0x9E, 'Ž': 0x8E, '€': 0x80,
+}
+
+// pdfEscape encodes text as a WinAnsi PDF string literal body.
+func pdfEscape(text string) string {
+	var out bytes.Buffer
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r < 0x80:
+			out.WriteRune(r)
+		case pdfWinAnsi[r] != 0:
+			out.WriteByte(pdfWinAnsi[r])
+		case pdfTransliterations[r] != "":
+			out.WriteString(pdfTransliterations[r])
+		case r >= 0xA0 && r <= 0xFF:
+			out.WriteByte(byte(r))
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
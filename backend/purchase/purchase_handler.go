@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 
+	"authz"
+
 	"github.com/gorilla/mux"
 )
 
@@ -22,13 +25,61 @@ func (h *PurchaseHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := h.service.Checkout(userID)
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+
+	// The body is optional and only needed for gift purchases
+	var request CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Set by the gateway from the access token
+	emailVerified := r.Header.Get("x-email-verified") == "true"
+
+	result, err := h.service.Checkout(userID, emailVerified, idempotencyKey, request.Gift)
+	if err == ErrCartChanged {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(CartChangedResponse{
+			Error:   "Some tours in your cart have changed, please review your cart before checking out",
+			Changes: result.Changes,
+			Cart:    result.Cart,
+		})
+		return
+	}
 	if err != nil {
 		switch err {
+		case ErrEmailNotVerified:
+			h.sendErrorResponse(w, "Verify your email before buying tours", http.StatusForbidden)
 		case ErrCartNotFound:
 			h.sendErrorResponse(w, "Cart not found", http.StatusNotFound)
 		case ErrEmptyCart:
 			h.sendErrorResponse(w, "Cart is empty", http.StatusBadRequest)
+		case ErrTourNotFound:
+			h.sendErrorResponse(w, "Tour not found", http.StatusNotFound)
+		case ErrInvalidIdempotencyKey:
+			h.sendErrorResponse(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+		case ErrInvalidGift:
+			h.sendErrorResponse(w, "A gift needs a recipient other than yourself and a message of at most 500 characters", http.StatusBadRequest)
+		case ErrRecipientNotFound:
+			h.sendErrorResponse(w, "Gift recipient not found", http.StatusNotFound)
+		case ErrCheckoutInProgress:
+			h.sendErrorResponse(w, "A checkout is already in progress, please wait for it to finish", http.StatusConflict)
+		case ErrCartModified:
+			h.sendErrorResponse(w, "Your cart changed during checkout, please try again", http.StatusConflict)
+		case ErrBundleUnavailable:
+			h.sendErrorResponse(w, "A bundle in the cart is no longer on sale", http.StatusConflict)
+		case ErrCouponUnavailable:
+			h.sendErrorResponse(w, "A coupon in the cart is no longer available", http.StatusConflict)
+		case ErrUnsupportedCurrency:
+			h.sendErrorResponse(w, "No exchange rate available for the cart currency", http.StatusServiceUnavailable)
+		case ErrPaymentDeclined:
+			h.sendErrorResponse(w, "Payment was declined", http.StatusPaymentRequired)
+		case ErrPaymentFailed:
+			h.sendErrorResponse(w, "Payment failed", http.StatusPaymentRequired)
+		case ErrPaymentTimeout:
+			h.sendErrorResponse(w, "Payment provider did not respond in time", http.StatusGatewayTimeout)
 		default:
 			h.sendErrorResponse(w, "Checkout failed: "+err.Error(), http.StatusInternalServerError)
 		}
@@ -36,7 +87,9 @@ func (h *PurchaseHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := CheckoutResponse{
-		Tokens:  tokens,
+		Order:   result.Order,
+		Tokens:  result.Tokens,
+		Gifts:   result.Gifts,
 		Message: "Checkout completed successfully",
 	}
 
@@ -106,7 +159,7 @@ func (h *PurchaseHandler) ValidateAccess(w http.ResponseWriter, r *http.Request)
 
 	vars := mux.Vars(r)
 	tourIDStr := vars["tourId"]
-	
+
 	// Parse tour ID from string to uint
 	var tourID uint
 	if err := json.Unmarshal([]byte(tourIDStr), &tourID); err != nil {
@@ -139,6 +192,63 @@ func (h *PurchaseHandler) ValidateAccess(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
+func (h *PurchaseHandler) TransferToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	var request TransferTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Recipient == "" {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.service.TransferToken(userID, mux.Vars(r)["token"], request.Recipient, request.Note)
+	if err != nil {
+		switch err {
+		case ErrTokenNotFound:
+			h.sendErrorResponse(w, "Token not found", http.StatusNotFound)
+		case ErrTokenNotTransferable:
+			h.sendErrorResponse(w, "Only active, unused tokens can be transferred", http.StatusConflict)
+		case ErrInvalidGift:
+			h.sendErrorResponse(w, "A transfer needs a recipient other than yourself and a note of at most 500 characters", http.StatusBadRequest)
+		case ErrRecipientNotFound:
+			h.sendErrorResponse(w, "Recipient not found", http.StatusNotFound)
+		default:
+			h.sendErrorResponse(w, "Failed to transfer token: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TokenResponse{Token: token, Message: "Token transferred successfully"})
+}
+
+func (h *PurchaseHandler) GetTokenTransfers(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	transfers, err := h.service.GetTokenTransfers(userID, authz.Has(r, authz.OrderRead), mux.Vars(r)["token"])
+	if err != nil {
+		if err == ErrTokenNotFound {
+			h.sendErrorResponse(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		h.sendErrorResponse(w, "Failed to get token transfers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TransfersResponse{Transfers: transfers, Message: "Token transfers retrieved successfully"})
+}
+
 func (h *PurchaseHandler) Ping(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -149,4 +259,4 @@ func (h *PurchaseHandler) sendErrorResponse(w http.ResponseWriter, message strin
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
\ No newline at end of file
+}
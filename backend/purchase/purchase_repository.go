@@ -1,7 +1,10 @@
 package main
 
 import (
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PurchaseRepository struct {
@@ -12,6 +15,11 @@ func NewPurchaseRepository(db *Database) *PurchaseRepository {
 	return &PurchaseRepository{database: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *PurchaseRepository) WithTx(tx *Database) *PurchaseRepository {
+	return &PurchaseRepository{database: tx}
+}
+
 func (r *PurchaseRepository) CreatePurchaseToken(token *TourPurchaseToken) error {
 	result := r.database.db.Create(token)
 	return result.Error
@@ -29,6 +37,29 @@ func (r *PurchaseRepository) GetTokenByID(tokenStr string) (*TourPurchaseToken,
 	return &token, nil
 }
 
+// LockToken reads a token and holds its row lock until the transaction
+// ends. It must run inside a transaction.
+func (r *PurchaseRepository) LockToken(tokenStr string) (*TourPurchaseToken, error) {
+	return r.lockToken("token = ?", tokenStr)
+}
+
+// LockTokenByRowID is LockToken by the token's primary key.
+func (r *PurchaseRepository) LockTokenByRowID(tokenID uint) (*TourPurchaseToken, error) {
+	return r.lockToken("id = ?", tokenID)
+}
+
+func (r *PurchaseRepository) lockToken(query string, arg interface{}) (*TourPurchaseToken, error) {
+	var token TourPurchaseToken
+	result := r.database.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where(query, arg).First(&token)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrTokenNotFound
+		}
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
 func (r *PurchaseRepository) GetTokensByUserID(userID string) ([]TourPurchaseToken, error) {
 	var tokens []TourPurchaseToken
 	result := r.database.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens)
@@ -38,16 +69,16 @@ func (r *PurchaseRepository) GetTokensByUserID(userID string) ([]TourPurchaseTok
 	return tokens, nil
 }
 
-func (r *PurchaseRepository) GetTokenByUserAndTour(userID string, tourID uint) (*TourPurchaseToken, error) {
-	var token TourPurchaseToken
-	result := r.database.db.Where("user_id = ? AND tour_id = ? AND status = 'active'", userID, tourID).First(&token)
+// GetUsableTokensByUserAndTour returns the active and used tokens the user
+// holds for a tour, latest expiry first. A user can hold several, e.g. one
+// bought and one received as a gift.
+func (r *PurchaseRepository) GetUsableTokensByUserAndTour(userID string, tourID uint) ([]TourPurchaseToken, error) {
+	var tokens []TourPurchaseToken
+	result := r.database.db.Where("user_id = ? AND tour_id = ? AND status IN ?", userID, tourID, []string{TokenStatusActive, TokenStatusUsed}).Order("expires_at DESC").Find(&tokens)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, ErrTokenNotFound
-		}
 		return nil, result.Error
 	}
-	return &token, nil
+	return tokens, nil
 }
 
 func (r *PurchaseRepository) UpdateTokenStatus(tokenStr string, status string) error {
@@ -56,4 +87,117 @@ func (r *PurchaseRepository) UpdateTokenStatus(tokenStr string, status string) e
 		return ErrTokenNotFound
 	}
 	return result.Error
-}
\ No newline at end of file
+}
+
+func (r *PurchaseRepository) UpdateTokenStatusByID(tokenID uint, status string) error {
+	result := r.database.db.Model(&TourPurchaseToken{}).Where("id = ?", tokenID).Update("status", status)
+	if result.RowsAffected == 0 {
+		return ErrTokenNotFound
+	}
+	return result.Error
+}
+
+// TransferToken moves an active token from one holder to another. It fails
+// with ErrTokenNotTransferable if the token changed hands or status since it
+// was read.
+func (r *PurchaseRepository) TransferToken(tokenID uint, from string, to string, at time.Time) error {
+	result := r.database.db.Model(&TourPurchaseToken{}).
+		Where("id = ? AND user_id = ? AND status = ?", tokenID, from, TokenStatusActive).
+		Updates(map[string]interface{}{"user_id": to, "transferred_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTokenNotTransferable
+	}
+	return nil
+}
+
+func (r *PurchaseRepository) CreateTokenTransfer(transfer *TokenTransfer) error {
+	result := r.database.db.Create(transfer)
+	return result.Error
+}
+
+func (r *PurchaseRepository) GetTokenTransfers(tokenID uint) ([]TokenTransfer, error) {
+	var transfers []TokenTransfer
+	result := r.database.db.Where("token_id = ?", tokenID).Order("created_at").Find(&transfers)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return transfers, nil
+}
+
+// LockUsableTokensExpiringBefore locks up to limit active and used tokens
+// that expire before the given time, oldest first. Used tokens are included
+// because they keep granting access until they expire. With unwarned set it
+// only returns tokens that have not had an expiring-soon event yet. Rows
+// locked by another sweep are skipped.
+func (r *PurchaseRepository) LockUsableTokensExpiringBefore(before time.Time, unwarned bool, limit int) ([]TourPurchaseToken, error) {
+	var tokens []TourPurchaseToken
+	query := r.database.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status IN ? AND expires_at <= ?", []string{TokenStatusActive, TokenStatusUsed}, before)
+	if unwarned {
+		query = query.Where("expiry_warned_at IS NULL")
+	}
+	result := query.Order("expires_at").Limit(limit).Find(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tokens, nil
+}
+
+func (r *PurchaseRepository) ExpireTokens(tokenIDs []uint) error {
+	result := r.database.db.Model(&TourPurchaseToken{}).Where("id IN ? AND status IN ?", tokenIDs, []string{TokenStatusActive, TokenStatusUsed}).Update("status", TokenStatusExpired)
+	return result.Error
+}
+
+func (r *PurchaseRepository) MarkExpiryWarned(tokenIDs []uint, at time.Time) error {
+	result := r.database.db.Model(&TourPurchaseToken{}).Where("id IN ?", tokenIDs).Update("expiry_warned_at", at)
+	return result.Error
+}
+
+// MarkTokenUsed moves an active token to used. It returns ErrTokenInvalid if
+// the token is no longer active.
+func (r *PurchaseRepository) MarkTokenUsed(tokenID uint, at time.Time) error {
+	result := r.database.db.Model(&TourPurchaseToken{}).
+		Where("id = ? AND status = ?", tokenID, TokenStatusActive).
+		Updates(map[string]interface{}{"status": TokenStatusUsed, "used_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func (r *PurchaseRepository) GetTokensByOrderID(orderID uint) ([]TourPurchaseToken, error) {
+	var tokens []TourPurchaseToken
+	result := r.database.db.Where("order_id = ?", orderID).Order("id").Find(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tokens, nil
+}
+
+func (r *PurchaseRepository) CreateCheckoutRecord(record *CheckoutRecord) error {
+	result := r.database.db.Create(record)
+	return result.Error
+}
+
+func (r *PurchaseRepository) DeleteCheckoutRecord(orderID uint) error {
+	result := r.database.db.Where("order_id = ?", orderID).Delete(&CheckoutRecord{})
+	return result.Error
+}
+
+func (r *PurchaseRepository) GetCheckoutRecord(userID string, idempotencyKey string) (*CheckoutRecord, error) {
+	var record CheckoutRecord
+	result := r.database.db.Where("user_id = ? AND idempotency_key = ?", userID, idempotencyKey).First(&record)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrCheckoutNotFound
+		}
+		return nil, result.Error
+	}
+	return &record, nil
+}
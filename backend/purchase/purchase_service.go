@@ -1,62 +1,626 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type PurchaseService struct {
+	database           *Database
 	purchaseRepository *PurchaseRepository
 	cartRepository     *CartRepository
+	orderRepository    *OrderRepository
+	giftRepository     *GiftRepository
+	cartService        *CartService
+	paymentService     *PaymentService
+	couponService      *CouponService
+	ledgerService      *LedgerService
+	invoiceService     *InvoiceService
+	taxService         *TaxService
+	currencyService    *CurrencyService
 }
 
-func NewPurchaseService(purchaseRepo *PurchaseRepository, cartRepo *CartRepository) *PurchaseService {
+func NewPurchaseService(db *Database, purchaseRepo *PurchaseRepository, cartRepo *CartRepository, orderRepo *OrderRepository, giftRepo *GiftRepository, cartService *CartService, paymentService *PaymentService, couponService *CouponService, ledgerService *LedgerService, invoiceService *InvoiceService, taxService *TaxService, currencyService *CurrencyService) *PurchaseService {
 	return &PurchaseService{
+		database:           db,
 		purchaseRepository: purchaseRepo,
 		cartRepository:     cartRepo,
+		orderRepository:    orderRepo,
+		giftRepository:     giftRepo,
+		cartService:        cartService,
+		paymentService:     paymentService,
+		couponService:      couponService,
+		ledgerService:      ledgerService,
+		invoiceService:     invoiceService,
+		taxService:         taxService,
+		currencyService:    currencyService,
 	}
 }
 
-func (s *PurchaseService) Checkout(userID string) ([]TourPurchaseToken, error) {
-	// Get user's cart
-	cart, err := s.cartRepository.GetCartByUserID(userID)
+// CheckoutResult is what a checkout produced: the paid order, the tokens
+// issued for its lines and, for gift purchases, the gifts. When the checkout
+// is refused with ErrCartChanged it holds the changes and the updated cart
+// instead.
+type CheckoutResult struct {
+	Order   *Order
+	Tokens  []TourPurchaseToken
+	Gifts   []Gift
+	Changes []CartChange
+	Cart    *ShoppingCart
+}
+
+// Checkout snapshots the user's cart into an order, charges it and turns it
+// into purchase tokens, in three steps so that no transaction is open while
+// the payment provider is called:
+//
+//  1. With the cart row locked, so concurrent checkouts are serialized, the
+//     order is created as pending, its coupons are counted against their
+//     limits and the idempotency key is recorded.
+//  2. The order is charged.
+//  3. The order is marked paid, the guides are credited, the tokens issued
+//     and the checked-out items removed from the cart.
+//
+// A failed payment marks the order failed and gives its coupons back; the
+// cart is untouched. A user has at most one checkout in progress, others are
+// refused with ErrCheckoutInProgress. Orders left pending by a crash are
+// finished or given up by Sweep. When idempotencyKey is set, a retry with
+// the same key returns the result of the first successful checkout.
+//
+// Before anything is charged the cart is revalidated against the tour
+// service. If a tour was re-priced, renamed or withdrawn the cart is updated
+// and ErrCartChanged is returned with the changes, so the user can confirm
+// the new terms by checking out again.
+//
+// With a gift the tours are bought for someone else: tokens go straight to a
+// named recipient, or each line gets a gift code whose token is issued when
+// it is redeemed.
+//
+// Only users who verified their email address can buy, whichever way the
+// checkout arrives; emailVerified comes from their access token.
+func (s *PurchaseService) Checkout(userID string, emailVerified bool, idempotencyKey string, gift *GiftRequest) (*CheckoutResult, error) {
+	if !emailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	if len(idempotencyKey) > 255 {
+		return nil, ErrInvalidIdempotencyKey
+	}
+
+	// A retry of a recorded checkout is answered from its record below
+	var parties *checkoutParties
+	replay := false
+	if idempotencyKey != "" {
+		_, err := s.purchaseRepository.GetCheckoutRecord(userID, idempotencyKey)
+		replay = err == nil
+	}
+
+	if !replay {
+		if gift != nil {
+			err := validateGift(userID, gift)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		changes, cart, err := s.cartService.RevalidateCart(userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			return &CheckoutResult{Changes: changes, Cart: cart}, ErrCartChanged
+		}
+
+		parties, err = s.lookupParties(userID, cart)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	order, replayed, err := s.startCheckout(userID, idempotencyKey, gift, parties)
+	if err != nil {
+		return nil, err
+	}
+	if replayed != nil {
+		return replayed, nil
+	}
+
+	err = s.charge(order)
+	if err != nil {
+		if abandonErr := s.abandonCheckout(order); abandonErr != nil {
+			log.Printf("Checkout: failed to give up order %d: %v", order.ID, abandonErr)
+		}
+		return nil, err
+	}
+
+	result, err := s.finishCheckout(order)
 	if err != nil {
+		// The order stays pending and Sweep finishes it
+		log.Printf("Checkout: order %d was paid but finishing it failed: %v", order.ID, err)
 		return nil, err
 	}
 
-	if len(cart.Items) == 0 {
-		return nil, ErrEmptyCart
+	// The invoices can be issued later if the stakeholder service is down
+	_, err = s.invoiceService.IssueInvoices(order.ID)
+	if err != nil {
+		log.Printf("Checkout: failed to issue invoices for order %d: %v", order.ID, err)
 	}
 
-	var tokens []TourPurchaseToken
+	return result, nil
+}
 
-	// Create purchase token for each item
-	for _, item := range cart.Items {
-		token := TourPurchaseToken{
-			UserID:    userID,
-			TourID:    item.TourID,
-			TourName:  item.TourName,
-			Token:     s.generateToken(),
-			Status:    "active",
-			ExpiresAt: time.Now().Add(365 * 24 * time.Hour), // 1 year expiration
+// startCheckout creates the pending order for the user's cart. A retry of a
+// completed checkout is answered with its result instead.
+func (s *PurchaseService) startCheckout(userID string, idempotencyKey string, gift *GiftRequest, parties *checkoutParties) (*Order, *CheckoutResult, error) {
+	var order *Order
+	var replayed *CheckoutResult
+
+	err := s.database.Transaction(func(tx *Database) error {
+		cartRepo := s.cartRepository.WithTx(tx)
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+		orderRepo := s.orderRepository.WithTx(tx)
+		giftRepo := s.giftRepository.WithTx(tx)
+
+		// Get user's cart and hold its lock until the transaction ends
+		cart, err := cartRepo.LockCartByUserID(userID)
+		if err != nil {
+			return err
 		}
 
-		err := s.purchaseRepository.CreatePurchaseToken(&token)
+		// A previous checkout with the same key was already recorded
+		if idempotencyKey != "" {
+			record, err := purchaseRepo.GetCheckoutRecord(userID, idempotencyKey)
+			if err == nil {
+				previous, err := orderRepo.GetOrderByID(record.OrderID)
+				if err != nil {
+					return err
+				}
+				if previous.Status == OrderStatusPending {
+					return ErrCheckoutInProgress
+				}
+				replayed = &CheckoutResult{}
+				return s.loadCheckoutResult(orderRepo, purchaseRepo, giftRepo, record.OrderID, replayed)
+			}
+			if err != ErrCheckoutNotFound {
+				return err
+			}
+		}
+
+		pending, err := orderRepo.HasPendingOrder(userID)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if pending {
+			return ErrCheckoutInProgress
+		}
+
+		if len(cart.Items) == 0 {
+			return ErrEmptyCart
+		}
+		// Parties are only skipped for replays, which were answered above
+		if parties == nil {
+			return ErrCartModified
+		}
+
+		// Re-evaluate coupons, sales and exchange rates as of now
+		err = s.couponService.PriceCartIn(cart, userID, parties.currency)
+		if err != nil {
+			return err
+		}
+
+		// Snapshot the cart into an order
+		order = &Order{
+			UserID:        userID,
+			Status:        OrderStatusPending,
+			Currency:      cart.Currency,
+			ExchangeRates: cart.Rates,
+			Checkout:      &CheckoutState{CartID: cart.ID, Gift: gift},
+		}
+		for _, item := range cart.Items {
+			order.Checkout.ItemIDs = append(order.Checkout.ItemIDs, item.ID)
+		}
+		for _, coupon := range cart.Coupons {
+			order.Checkout.CouponIDs = append(order.Checkout.CouponIDs, coupon.ID)
+		}
+		order.Lines, order.Discounts, err = buildOrderLines(cart)
+		if err != nil {
+			return err
+		}
+		// Who sells each tour also decides its tax
+		err = assignGuides(order.Lines, parties.guides)
+		if err != nil {
+			return err
+		}
+		s.taxService.TaxLines(order.Lines, userID, parties.countries)
+		order.CalculateTotals()
+
+		err = orderRepo.CreateOrder(order)
+		if err != nil {
+			return err
+		}
+
+		// Count the coupons used against their limits
+		err = s.couponService.Redeem(tx, userID, order)
+		if err != nil {
+			return err
+		}
+
+		if idempotencyKey != "" {
+			return purchaseRepo.CreateCheckoutRecord(&CheckoutRecord{
+				UserID:         userID,
+				IdempotencyKey: idempotencyKey,
+				OrderID:        order.ID,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, replayed, nil
+}
+
+// charge authorizes and captures the order total.
+func (s *PurchaseService) charge(order *Order) error {
+	if order.Total == 0 {
+		return nil
+	}
+
+	payment, err := s.paymentService.Authorize(order.UserID, order.Total, order.Currency, fmt.Sprintf("order-%d", order.ID))
+	if payment == nil {
+		return err
+	}
+	order.PaymentID = &payment.ID
+	order.Payment = payment
+	linkErr := s.orderRepository.SetPayment(order.ID, payment.ID)
+	if linkErr != nil {
+		log.Printf("Checkout: failed to link payment %d to order %d: %v", payment.ID, order.ID, linkErr)
+	}
+	if err != nil {
+		return err
+	}
+	return s.paymentService.Capture(payment)
+}
+
+// abandonCheckout marks a pending order failed, keeping it as a record of
+// the attempt, and gives back its coupons and idempotency key so the
+// checkout can be tried again.
+func (s *PurchaseService) abandonCheckout(order *Order) error {
+	return s.database.Transaction(func(tx *Database) error {
+		err := s.orderRepository.WithTx(tx).ClaimPending(order.ID, OrderStatusFailed, nil)
+		if err != nil {
+			return err
 		}
+		order.Status = OrderStatusFailed
 
-		tokens = append(tokens, token)
+		err = s.couponService.Release(tx, order)
+		if err != nil {
+			return err
+		}
+		return s.purchaseRepository.WithTx(tx).DeleteCheckoutRecord(order.ID)
+	})
+}
+
+// finishCheckout marks a charged order paid, credits the guides, issues its
+// tokens or gift codes and removes what was bought from the cart.
+func (s *PurchaseService) finishCheckout(order *Order) (*CheckoutResult, error) {
+	result := &CheckoutResult{Order: order}
+	userID := order.UserID
+	var gift *GiftRequest
+	if order.Checkout != nil {
+		gift = order.Checkout.Gift
 	}
 
-	// Clear the cart after successful checkout
-	err = s.cartRepository.ClearCart(cart.ID)
+	err := s.database.Transaction(func(tx *Database) error {
+		cartRepo := s.cartRepository.WithTx(tx)
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+		orderRepo := s.orderRepository.WithTx(tx)
+		giftRepo := s.giftRepository.WithTx(tx)
+
+		paidAt := time.Now()
+		err := orderRepo.ClaimPending(order.ID, OrderStatusPaid, &paidAt)
+		if err != nil {
+			return err
+		}
+		order.Status = OrderStatusPaid
+		order.PaidAt = &paidAt
+
+		// Credit the guides, less the platform fee
+		err = s.ledgerService.RecordSale(tx, order)
+		if err != nil {
+			return err
+		}
+
+		// Create purchase token for each order line
+		for i := range order.Lines {
+			line := &order.Lines[i]
+
+			if gift != nil && gift.Recipient == "" {
+				// The token is issued when the code is redeemed
+				code := generateGiftCode()
+				pending := Gift{
+					OrderID:     order.ID,
+					OrderLineID: line.ID,
+					PurchasedBy: userID,
+					Code:        &code,
+					TourID:      line.TourID,
+					TourName:    line.TourName,
+					Message:     gift.Message,
+					Status:      GiftStatusPending,
+				}
+				err := giftRepo.CreateGift(&pending)
+				if err != nil {
+					return err
+				}
+				result.Gifts = append(result.Gifts, pending)
+				continue
+			}
+
+			holder := userID
+			if gift != nil {
+				holder = gift.Recipient
+			}
+
+			token, err := issueToken(purchaseRepo, orderRepo, holder, userID, order.ID, line)
+			if err != nil {
+				return err
+			}
+			result.Tokens = append(result.Tokens, *token)
+
+			if gift != nil {
+				redeemedAt := time.Now()
+				sent := Gift{
+					OrderID:     order.ID,
+					OrderLineID: line.ID,
+					PurchasedBy: userID,
+					Recipient:   gift.Recipient,
+					TourID:      line.TourID,
+					TourName:    line.TourName,
+					Message:     gift.Message,
+					Status:      GiftStatusRedeemed,
+					TokenID:     &token.ID,
+					RedeemedAt:  &redeemedAt,
+				}
+				err = giftRepo.CreateGift(&sent)
+				if err != nil {
+					return err
+				}
+				result.Gifts = append(result.Gifts, sent)
+			}
+		}
+
+		if order.Checkout == nil {
+			return nil
+		}
+		return cartRepo.RemoveCheckedOut(order.Checkout.CartID, order.Checkout.ItemIDs, order.Checkout.CouponIDs)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return result, nil
+}
 
-	return tokens, nil
+// checkoutSweepBatchSize is how many stale orders one sweep handles.
+const checkoutSweepBatchSize = 100
+
+// Start runs a sweep every interval until ctx is cancelled.
+func (s *PurchaseService) Start(ctx context.Context, interval time.Duration) {
+	log.Printf("Checkout sweeper running every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep settles orders left pending by a checkout that did not get to the
+// end, for example because the service restarted while it was charging.
+// Orders whose payment was captured are finished, the others given up.
+// An order only counts as left once its checkout must have timed out.
+func (s *PurchaseService) Sweep() {
+	before := time.Now().Add(-2*s.paymentService.timeout - time.Minute)
+	orderIDs, err := s.orderRepository.GetStalePendingOrderIDs(before, checkoutSweepBatchSize)
+	if err != nil {
+		log.Printf("Checkout sweep: failed to list pending orders: %v", err)
+		return
+	}
+
+	for _, orderID := range orderIDs {
+		order, err := s.orderRepository.GetOrderByID(orderID)
+		if err != nil {
+			log.Printf("Checkout sweep: failed to load order %d: %v", orderID, err)
+			continue
+		}
+
+		if order.Total == 0 || (order.Payment != nil && order.Payment.Status == PaymentStatusCaptured) {
+			_, err = s.finishCheckout(order)
+			if err != nil {
+				log.Printf("Checkout sweep: failed to finish order %d: %v", orderID, err)
+			} else {
+				log.Printf("Checkout sweep: finished paid order %d", orderID)
+			}
+			continue
+		}
+
+		if order.Payment != nil {
+			err = s.paymentService.Abandon(order.Payment)
+			if err != nil {
+				log.Printf("Checkout sweep: failed to give up payment of order %d: %v", orderID, err)
+				continue
+			}
+		}
+		err = s.abandonCheckout(order)
+		if err != nil {
+			log.Printf("Checkout sweep: failed to give up order %d: %v", orderID, err)
+		} else {
+			log.Printf("Checkout sweep: gave up unpaid order %d", orderID)
+		}
+	}
+}
+
+// checkoutParties is what a checkout needs to know about the buyer and the
+// guides from the other services. It is looked up before the checkout
+// transaction, so that the cart lock is not held while they answer.
+type checkoutParties struct {
+	currency  string
+	guides    map[uint]string
+	countries *countryLookup
+}
+
+// lookupParties looks up the buyer's currency, the guide of every tour in
+// the cart, and the countries of the buyer and the guides.
+func (s *PurchaseService) lookupParties(userID string, cart *ShoppingCart) (*checkoutParties, error) {
+	var tourIDs []uint
+	for _, item := range cart.Items {
+		if item.Bundle != nil {
+			for _, tour := range item.Bundle.Tours {
+				tourIDs = append(tourIDs, tour.TourID)
+			}
+			continue
+		}
+		tourIDs = append(tourIDs, item.TourID)
+	}
+	guides, err := fetchGuides(tourIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	countries := s.taxService.Countries()
+	countries.of(userID)
+	for _, guide := range guides {
+		countries.of(guide)
+	}
+
+	return &checkoutParties{
+		currency:  s.currencyService.PreferredCurrency(userID),
+		guides:    guides,
+		countries: countries,
+	}, nil
+}
+
+// buildOrderLines turns a priced cart into order lines, one per tour.
+// Bundles are split into their tours at each tour's allocated share of the
+// bundle price, and every discount follows the lines it was allocated to, so
+// the returned discount lines are keyed by tour ID.
+func buildOrderLines(cart *ShoppingCart) ([]OrderLine, []DiscountLine, error) {
+	var discounts []DiscountLine
+	for _, discount := range cart.Discounts {
+		discount.Allocations = make(map[uint]int64)
+		discounts = append(discounts, discount)
+	}
+
+	var lines []OrderLine
+	for _, item := range cart.Items {
+		itemLines := []OrderLine{{
+			TourID:       item.TourID,
+			TourName:     item.TourName,
+			BasePrice:    item.BasePrice,
+			BaseCurrency: item.BaseCurrency,
+			UnitPrice:    item.Price,
+		}}
+		if item.BundleID != nil {
+			if item.Bundle == nil || item.Bundle.Status != BundleStatusActive {
+				return nil, nil, ErrBundleUnavailable
+			}
+			itemLines = bundleLines(item)
+		}
+
+		weights := make([]int64, len(itemLines))
+		for i, line := range itemLines {
+			weights[i] = line.UnitPrice
+		}
+		for i, discount := range cart.Discounts {
+			amount := discount.Allocations[item.ID]
+			if amount <= 0 {
+				continue
+			}
+			for j, part := range splitAmount(amount, weights) {
+				itemLines[j].Discount += part
+				discounts[i].Allocations[itemLines[j].TourID] += part
+			}
+		}
+
+		lines = append(lines, itemLines...)
+	}
+
+	return lines, discounts, nil
+}
+
+// bundleLines splits the price paid for a bundle item across its tours.
+func bundleLines(item OrderItem) []OrderLine {
+	weights := make([]int64, len(item.Bundle.Tours))
+	for i, tour := range item.Bundle.Tours {
+		weights[i] = tour.AllocatedPrice
+	}
+
+	lines := make([]OrderLine, len(item.Bundle.Tours))
+	for i, share := range splitAmount(item.Price, weights) {
+		tour := item.Bundle.Tours[i]
+		lines[i] = OrderLine{
+			TourID:       tour.TourID,
+			TourName:     tour.TourName,
+			BundleID:     item.BundleID,
+			BundleName:   item.Bundle.Name,
+			BasePrice:    tour.AllocatedPrice,
+			BaseCurrency: item.BaseCurrency,
+			UnitPrice:    share,
+		}
+	}
+	return lines
+}
+
+// issueToken creates the purchase token for an order line, held by holder
+// and paid for by purchaser, and links it to the line.
+func issueToken(purchaseRepo *PurchaseRepository, orderRepo *OrderRepository, holder string, purchaser string, orderID uint, line *OrderLine) (*TourPurchaseToken, error) {
+	token := &TourPurchaseToken{
+		UserID:      holder,
+		PurchasedBy: purchaser,
+		OrderID:     &orderID,
+		TourID:      line.TourID,
+		TourName:    line.TourName,
+		Token:       uuid.New().String(),
+		Status:      TokenStatusActive,
+		ExpiresAt:   time.Now().Add(365 * 24 * time.Hour), // 1 year expiration
+	}
+
+	err := purchaseRepo.CreatePurchaseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = orderRepo.SetLineToken(line.ID, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	line.TokenID = &token.ID
+
+	return token, nil
+}
+
+func (s *PurchaseService) loadCheckoutResult(orderRepo *OrderRepository, purchaseRepo *PurchaseRepository, giftRepo *GiftRepository, orderID uint, result *CheckoutResult) error {
+	order, err := orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return err
+	}
+	result.Order = order
+
+	result.Tokens, err = purchaseRepo.GetTokensByOrderID(orderID)
+	if err != nil {
+		return err
+	}
+
+	result.Gifts, err = giftRepo.GetGiftsByOrderID(orderID)
+	return err
 }
 
 func (s *PurchaseService) GetUserTokens(userID string) ([]TourPurchaseToken, error) {
@@ -69,9 +633,8 @@ func (s *PurchaseService) GetTokenDetails(tokenStr string) (*TourPurchaseToken,
 		return nil, err
 	}
 
+	// The sweeper marks the token expired and publishes the event
 	if token.IsExpired() {
-		// Update token status to expired
-		s.purchaseRepository.UpdateTokenStatus(tokenStr, "expired")
 		return nil, ErrTokenExpired
 	}
 
@@ -82,24 +645,86 @@ func (s *PurchaseService) GetTokenDetails(tokenStr string) (*TourPurchaseToken,
 	return token, nil
 }
 
+// ValidateAccess returns a valid token the user currently holds for the
+// tour. Access follows the holder, so it covers tours the user bought, was
+// gifted or had transferred to them, and ends for a user who transferred
+// their token away. Used tokens keep granting access until they expire.
 func (s *PurchaseService) ValidateAccess(userID string, tourID uint) (*TourPurchaseToken, error) {
-	token, err := s.purchaseRepository.GetTokenByUserAndTour(userID, tourID)
+	tokens, err := s.purchaseRepository.GetUsableTokensByUserAndTour(userID, tourID)
 	if err != nil {
 		return nil, err
 	}
+	if len(tokens) == 0 {
+		return nil, ErrTokenNotFound
+	}
 
-	if token.IsExpired() {
-		s.purchaseRepository.UpdateTokenStatus(token.Token, "expired")
-		return nil, ErrTokenExpired
+	for i := range tokens {
+		if tokens[i].IsValid() {
+			return &tokens[i], nil
+		}
 	}
 
-	if !token.IsValid() {
-		return nil, ErrTokenInvalid
+	// Not swept yet, the sweeper marks them expired
+	return nil, ErrTokenExpired
+}
+
+// TransferToken hands an active, unused token the user holds to recipient
+// and records the transfer.
+func (s *PurchaseService) TransferToken(userID string, tokenStr string, recipient string, note string) (*TourPurchaseToken, error) {
+	token, err := s.purchaseRepository.GetTokenByID(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if token.UserID != userID {
+		return nil, ErrTokenNotFound
+	}
+	if token.Status != TokenStatusActive || token.IsExpired() {
+		return nil, ErrTokenNotTransferable
+	}
+
+	if recipient == "" || recipient == userID || len(note) > maxGiftMessageLength {
+		return nil, ErrInvalidGift
+	}
+	err = checkUserExists(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	transferredAt := time.Now()
+	err = s.database.Transaction(func(tx *Database) error {
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+
+		err := purchaseRepo.TransferToken(token.ID, userID, recipient, transferredAt)
+		if err != nil {
+			return err
+		}
+
+		return purchaseRepo.CreateTokenTransfer(&TokenTransfer{
+			TokenID:  token.ID,
+			FromUser: userID,
+			ToUser:   recipient,
+			Note:     note,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	token.UserID = recipient
+	token.TransferredAt = &transferredAt
 	return token, nil
 }
 
-func (s *PurchaseService) generateToken() string {
-	return uuid.New().String()
-}
\ No newline at end of file
+// GetTokenTransfers returns the transfer history of a token to its current
+// holder, its purchaser or, with anyToken, to anyone.
+func (s *PurchaseService) GetTokenTransfers(userID string, anyToken bool, tokenStr string) ([]TokenTransfer, error) {
+	token, err := s.purchaseRepository.GetTokenByID(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if !anyToken && token.UserID != userID && token.PurchasedBy != userID {
+		return nil, ErrTokenNotFound
+	}
+
+	return s.purchaseRepository.GetTokenTransfers(token.ID)
+}
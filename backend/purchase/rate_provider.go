@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RateProvider supplies exchange rates used to quote carts in the tourist's
+// currency. Implementations must be safe for concurrent use.
+type RateProvider interface {
+	// Name identifies the provider on snapshotted rates.
+	Name() string
+	// Rate returns how much one unit of from is worth in to.
+	Rate(ctx context.Context, from string, to string) (float64, error)
+}
+
+// ExchangeRate is a rate as it was used for a quote. Orders keep the rates
+// they were priced with so their amounts can always be explained later.
+type ExchangeRate struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Rate      float64   `json:"rate"`
+	Provider  string    `json:"provider"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// NewRateProvider picks the provider configured by RATE_PROVIDER. Only the
+// local static table exists for now.
+func NewRateProvider() RateProvider {
+	name := GetEnv("RATE_PROVIDER", "static")
+	if name != "static" {
+		log.Printf("Unknown rate provider %q, falling back to static rates", name)
+	}
+	return NewStaticRateProvider(GetEnv("EXCHANGE_RATES", ""))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"authz"
+
+	"github.com/gorilla/mux"
+)
+
+type RefundHandler struct {
+	service *RefundService
+}
+
+func NewRefundHandler(service *RefundService) *RefundHandler {
+	return &RefundHandler{service: service}
+}
+
+func (h *RefundHandler) RequestRefund(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	var request RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := h.service.RequestRefund(userID, request.Token, request.Reason)
+	if err != nil {
+		h.handleRefundError(w, err)
+		return
+	}
+
+	message := "Refund requested, awaiting approval"
+	if refund.Status == RefundStatusCompleted {
+		message = "Refund completed successfully"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(RefundResponse{Refund: refund, Message: message})
+}
+
+func (h *RefundHandler) GetUserRefunds(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	refunds, err := h.service.GetUserRefunds(userID)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get refunds: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RefundsResponse{Refunds: refunds, Message: "Refunds retrieved successfully"})
+}
+
+func (h *RefundHandler) GetPendingRefunds(w http.ResponseWriter, r *http.Request) {
+	if !authz.Has(r, authz.RefundReview) {
+		h.sendErrorResponse(w, "You are not allowed to review refunds", http.StatusForbidden)
+		return
+	}
+
+	refunds, err := h.service.GetPendingRefunds()
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get refunds: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RefundsResponse{Refunds: refunds, Message: "Pending refunds retrieved successfully"})
+}
+
+func (h *RefundHandler) ApproveRefund(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, h.service.ApproveRefund, "Refund approved and completed")
+}
+
+func (h *RefundHandler) RejectRefund(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, h.service.RejectRefund, "Refund rejected")
+}
+
+func (h *RefundHandler) decide(w http.ResponseWriter, r *http.Request, decision func(uint, string, string) (*Refund, error), message string) {
+	if !authz.Has(r, authz.RefundReview) {
+		h.sendErrorResponse(w, "You are not allowed to review refunds", http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(r)
+	refundID, err := strconv.ParseUint(vars["refundId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid refund ID", http.StatusBadRequest)
+		return
+	}
+
+	var request RefundDecisionRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	refund, err := decision(uint(refundID), r.Header.Get("x-username"), request.Note)
+	if err != nil {
+		h.handleRefundError(w, err)
+		return
+	}
+	if refund.Status == RefundStatusPaymentReturned {
+		message = "Refund approved, the payment was returned and the refund will be completed shortly"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RefundResponse{Refund: refund, Message: message})
+}
+
+func (h *RefundHandler) handleRefundError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrTokenNotFound:
+		h.sendErrorResponse(w, "Purchase not found", http.StatusNotFound)
+	case ErrRefundNotFound:
+		h.sendErrorResponse(w, "Refund not found", http.StatusNotFound)
+	case ErrTokenNotRefundable:
+		h.sendErrorResponse(w, "This purchase cannot be refunded", http.StatusBadRequest)
+	case ErrTokenGivenAway:
+		h.sendErrorResponse(w, "Tours given to someone else cannot be refunded", http.StatusConflict)
+	case ErrRefundAlreadyRequested:
+		h.sendErrorResponse(w, "A refund for this purchase is already in progress", http.StatusConflict)
+	case ErrRefundNotPending:
+		h.sendErrorResponse(w, "Refund has already been decided", http.StatusConflict)
+	case ErrPaymentFailed:
+		h.sendErrorResponse(w, "Payment provider refused the refund", http.StatusBadGateway)
+	case ErrPaymentTimeout:
+		h.sendErrorResponse(w, "Payment provider did not respond in time", http.StatusGatewayTimeout)
+	default:
+		h.sendErrorResponse(w, "Refund failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *RefundHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"gorm.io/gorm"
+)
+
+type RefundRepository struct {
+	database *Database
+}
+
+func NewRefundRepository(db *Database) *RefundRepository {
+	return &RefundRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *RefundRepository) WithTx(tx *Database) *RefundRepository {
+	return &RefundRepository{database: tx}
+}
+
+func (r *RefundRepository) CreateRefund(refund *Refund) error {
+	result := r.database.db.Create(refund)
+	return result.Error
+}
+
+func (r *RefundRepository) UpdateRefund(refund *Refund) error {
+	result := r.database.db.Save(refund)
+	return result.Error
+}
+
+// TransitionStatus moves a refund from one status to another and reports
+// ErrRefundNotPending if it was no longer in the expected status, so two
+// concurrent decisions cannot both succeed.
+func (r *RefundRepository) TransitionStatus(refundID uint, from string, to string) error {
+	result := r.database.db.Model(&Refund{}).Where("id = ? AND status = ?", refundID, from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefundNotPending
+	}
+	return nil
+}
+
+func (r *RefundRepository) GetRefundByID(id uint) (*Refund, error) {
+	var refund Refund
+	result := r.database.db.Where("id = ?", id).First(&refund)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrRefundNotFound
+		}
+		return nil, result.Error
+	}
+	return &refund, nil
+}
+
+func (r *RefundRepository) GetRefundsByUserID(userID string) ([]Refund, error) {
+	var refunds []Refund
+	result := r.database.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&refunds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return refunds, nil
+}
+
+func (r *RefundRepository) GetRefundsByStatus(status string) ([]Refund, error) {
+	var refunds []Refund
+	result := r.database.db.Where("status = ?", status).Order("created_at").Find(&refunds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return refunds, nil
+}
+
+// HasOpenRefund reports whether the token already has a refund that is
+// waiting for a decision or being processed.
+func (r *RefundRepository) HasOpenRefund(tokenID uint) (bool, error) {
+	var count int64
+	result := r.database.db.Model(&Refund{}).
+		Where("token_id = ? AND status IN ?", tokenID, []string{RefundStatusRequested, RefundStatusApproved, RefundStatusPaymentReturned}).
+		Count(&count)
+	return count > 0, result.Error
+}
+
+// GetRefundsByOrderID returns the refunds of an order that are in status.
+func (r *RefundRepository) GetRefundsByOrderID(orderID uint, status string) ([]Refund, error) {
+	var refunds []Refund
+	result := r.database.db.Where("order_id = ? AND status = ?", orderID, status).Order("id").Find(&refunds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return refunds, nil
+}
+
+// GetRefundsToComplete returns up to limit refunds whose money was returned
+// but which are not completed yet, oldest first.
+func (r *RefundRepository) GetRefundsToComplete(limit int) ([]Refund, error) {
+	var refunds []Refund
+	result := r.database.db.Where("status = ?", RefundStatusPaymentReturned).Order("id").Limit(limit).Find(&refunds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return refunds, nil
+}
+
+// GetUncreditedRefunds returns up to limit completed refunds that have no
+// credit note yet, oldest first.
+func (r *RefundRepository) GetUncreditedRefunds(limit int) ([]Refund, error) {
+	var refunds []Refund
+	result := r.database.db.
+		Where("status = ? AND NOT EXISTS (SELECT 1 FROM invoices WHERE invoices.refund_id = refunds.id)", RefundStatusCompleted).
+		Order("id").Limit(limit).Find(&refunds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return refunds, nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+const refundSweepBatchSize = 100
+
+type RefundService struct {
+	database           *Database
+	refundRepository   *RefundRepository
+	purchaseRepository *PurchaseRepository
+	orderRepository    *OrderRepository
+	paymentService     *PaymentService
+	ledgerService      *LedgerService
+	invoiceService     *InvoiceService
+	autoApproveWindow  time.Duration
+}
+
+func NewRefundService(db *Database, refundRepo *RefundRepository, purchaseRepo *PurchaseRepository, orderRepo *OrderRepository, paymentService *PaymentService, ledgerService *LedgerService, invoiceService *InvoiceService) *RefundService {
+	days, err := strconv.Atoi(GetEnv("REFUND_AUTO_APPROVE_DAYS", "14"))
+	if err != nil || days < 0 {
+		log.Printf("Invalid REFUND_AUTO_APPROVE_DAYS, using 14")
+		days = 14
+	}
+
+	return &RefundService{
+		database:           db,
+		refundRepository:   refundRepo,
+		purchaseRepository: purchaseRepo,
+		orderRepository:    orderRepo,
+		paymentService:     paymentService,
+		ledgerService:      ledgerService,
+		invoiceService:     invoiceService,
+		autoApproveWindow:  time.Duration(days) * 24 * time.Hour,
+	}
+}
+
+// RequestRefund opens a refund for one purchased tour. Only whoever paid can
+// ask, and only while they still hold the token: a gifted or transferred
+// token belongs to its recipient and is not taken back. Requests for tokens
+// that are still unused and within the auto-approve window are approved and
+// processed right away; everything else waits for an admin.
+//
+// The token row stays locked while the request is checked and recorded, so
+// concurrent requests for one token cannot both open a refund.
+func (s *RefundService) RequestRefund(userID string, tokenStr string, reason string) (*Refund, error) {
+	var refund *Refund
+	var token *TourPurchaseToken
+	err := s.database.Transaction(func(tx *Database) error {
+		refundRepo := s.refundRepository.WithTx(tx)
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+		orderRepo := s.orderRepository.WithTx(tx)
+
+		var err error
+		token, err = purchaseRepo.LockToken(tokenStr)
+		if err != nil {
+			return err
+		}
+
+		if token.PurchasedBy != userID {
+			return ErrTokenNotFound
+		}
+		if token.UserID != userID {
+			return ErrTokenGivenAway
+		}
+
+		if !token.IsValid() || token.OrderID == nil {
+			return ErrTokenNotRefundable
+		}
+
+		open, err := refundRepo.HasOpenRefund(token.ID)
+		if err != nil {
+			return err
+		}
+		if open {
+			return ErrRefundAlreadyRequested
+		}
+
+		order, err := orderRepo.GetOrderByID(*token.OrderID)
+		if err != nil {
+			return err
+		}
+
+		var line *OrderLine
+		for i := range order.Lines {
+			if order.Lines[i].TokenID != nil && *order.Lines[i].TokenID == token.ID {
+				line = &order.Lines[i]
+				break
+			}
+		}
+		if line == nil {
+			return ErrTokenNotRefundable
+		}
+
+		refund = &Refund{
+			UserID:      userID,
+			OrderID:     order.ID,
+			OrderLineID: line.ID,
+			TokenID:     token.ID,
+			TourID:      token.TourID,
+			TourName:    token.TourName,
+			Amount:      line.Total,
+			Currency:    order.Currency,
+			Reason:      reason,
+			Status:      RefundStatusRequested,
+		}
+		return refundRepo.CreateRefund(refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.isAutoApprovable(token) {
+		log.Printf("Refund %d auto-approved for token %s", refund.ID, token.Token)
+		return s.approve(refund, "system", "unused and within the automatic refund window")
+	}
+
+	return refund, nil
+}
+
+func (s *RefundService) ApproveRefund(refundID uint, adminUsername string, note string) (*Refund, error) {
+	refund, err := s.refundRepository.GetRefundByID(refundID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.approve(refund, adminUsername, note)
+}
+
+func (s *RefundService) RejectRefund(refundID uint, adminUsername string, note string) (*Refund, error) {
+	refund, err := s.refundRepository.GetRefundByID(refundID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.refundRepository.TransitionStatus(refund.ID, RefundStatusRequested, RefundStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+
+	refund.Status = RefundStatusRejected
+	refund.DecidedBy = adminUsername
+	refund.DecisionNote = note
+	return refund, s.refundRepository.UpdateRefund(refund)
+}
+
+func (s *RefundService) GetUserRefunds(userID string) ([]Refund, error) {
+	return s.refundRepository.GetRefundsByUserID(userID)
+}
+
+func (s *RefundService) GetPendingRefunds() ([]Refund, error) {
+	return s.refundRepository.GetRefundsByStatus(RefundStatusRequested)
+}
+
+func (s *RefundService) isAutoApprovable(token *TourPurchaseToken) bool {
+	if s.autoApproveWindow == 0 {
+		return false
+	}
+	return token.Status == TokenStatusActive && time.Since(token.CreatedAt) <= s.autoApproveWindow
+}
+
+// approve claims the refund and revokes the token in one transaction, then
+// returns the money through the payment provider. If the provider fails the
+// token is restored and the refund marked failed. Once the money is back the
+// refund is saved as payment returned and completed; if completing fails the
+// refund sweep finishes it later.
+func (s *RefundService) approve(refund *Refund, decidedBy string, note string) (*Refund, error) {
+	order, err := s.orderRepository.GetOrderByID(refund.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var previousStatus string
+	err = s.database.Transaction(func(tx *Database) error {
+		refundRepo := s.refundRepository.WithTx(tx)
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+
+		err := refundRepo.TransitionStatus(refund.ID, RefundStatusRequested, RefundStatusApproved)
+		if err != nil {
+			return err
+		}
+		refund.Status = RefundStatusApproved
+		refund.DecidedBy = decidedBy
+		refund.DecisionNote = note
+		err = refundRepo.UpdateRefund(refund)
+		if err != nil {
+			return err
+		}
+
+		// No access is left once the money can go back
+		token, err := purchaseRepo.LockTokenByRowID(refund.TokenID)
+		if err != nil {
+			return err
+		}
+		// It may have been transferred since the refund was requested
+		if token.UserID != token.PurchasedBy {
+			return ErrTokenGivenAway
+		}
+		previousStatus = token.Status
+		return purchaseRepo.UpdateTokenStatusByID(token.ID, TokenStatusRefunded)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Payment != nil && refund.Amount > 0 {
+		err = s.paymentService.Refund(order.Payment, refund.Amount)
+		if err != nil {
+			refund.Status = RefundStatusFailed
+			refund.FailureReason = err.Error()
+			restoreErr := s.database.Transaction(func(tx *Database) error {
+				restoreErr := s.purchaseRepository.WithTx(tx).UpdateTokenStatusByID(refund.TokenID, previousStatus)
+				if restoreErr != nil {
+					return restoreErr
+				}
+				return s.refundRepository.WithTx(tx).UpdateRefund(refund)
+			})
+			if restoreErr != nil {
+				log.Printf("Failed to record refund %d failure and restore its token: %v", refund.ID, restoreErr)
+			}
+			return nil, err
+		}
+	}
+
+	refund.Status = RefundStatusPaymentReturned
+	err = s.database.Transaction(func(tx *Database) error {
+		refundRepo := s.refundRepository.WithTx(tx)
+		err := refundRepo.TransitionStatus(refund.ID, RefundStatusApproved, RefundStatusPaymentReturned)
+		if err != nil {
+			return err
+		}
+		return refundRepo.UpdateRefund(refund)
+	})
+	if err != nil {
+		log.Printf("Refund %d: payment returned but recording it failed: %v", refund.ID, err)
+		return nil, err
+	}
+
+	s.finish(refund, order)
+	return refund, nil
+}
+
+// finish completes a refund whose money was returned and issues its credit
+// note. Failures are logged and left for the sweeps: the refund sweep
+// completes the refund, the invoice sweep issues the credit note.
+func (s *RefundService) finish(refund *Refund, order *Order) {
+	err := s.complete(refund, order)
+	if err != nil {
+		log.Printf("Refund %d: payment returned but completing it failed: %v", refund.ID, err)
+		return
+	}
+
+	err = s.invoiceService.CreditRefund(refund)
+	if err != nil {
+		log.Printf("Refund %d: failed to issue credit note: %v", refund.ID, err)
+	}
+}
+
+// Start runs a sweep every interval until ctx is cancelled.
+func (s *RefundService) Start(ctx context.Context, interval time.Duration) {
+	log.Printf("Refund sweeper running every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep completes refunds whose money was returned but whose order and
+// ledger could not be updated at the time. Failures are logged and retried
+// on the next sweep.
+func (s *RefundService) Sweep() {
+	refunds, err := s.refundRepository.GetRefundsToComplete(refundSweepBatchSize)
+	if err != nil {
+		log.Printf("Refund sweep: failed to list refunds to complete: %v", err)
+		return
+	}
+	for i := range refunds {
+		order, err := s.orderRepository.GetOrderByID(refunds[i].OrderID)
+		if err != nil {
+			log.Printf("Refund sweep: failed to load order of refund %d: %v", refunds[i].ID, err)
+			continue
+		}
+		s.finish(&refunds[i], order)
+	}
+}
+
+// complete records a refund whose money was returned: the order status, the
+// reversed sale in the ledger and the refund itself, in one transaction.
+// Claiming the refund first makes completing it twice fail with
+// ErrRefundNotPending instead of reversing the sale again.
+func (s *RefundService) complete(refund *Refund, order *Order) error {
+	return s.database.Transaction(func(tx *Database) error {
+		refundRepo := s.refundRepository.WithTx(tx)
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+		orderRepo := s.orderRepository.WithTx(tx)
+
+		err := refundRepo.TransitionStatus(refund.ID, RefundStatusPaymentReturned, RefundStatusCompleted)
+		if err != nil {
+			return err
+		}
+
+		tokens, err := purchaseRepo.GetTokensByOrderID(order.ID)
+		if err != nil {
+			return err
+		}
+		order.Status = OrderStatusRefunded
+		for _, token := range tokens {
+			if token.Status != TokenStatusRefunded {
+				order.Status = OrderStatusPartiallyRefunded
+				break
+			}
+		}
+		err = orderRepo.UpdateOrderStatus(order)
+		if err != nil {
+			return err
+		}
+
+		// Take the sale back off the guide's balance
+		err = s.ledgerService.RecordRefund(tx, refund)
+		if err != nil {
+			return err
+		}
+
+		completedAt := time.Now()
+		refund.Status = RefundStatusCompleted
+		refund.CompletedAt = &completedAt
+		return refundRepo.UpdateRefund(refund)
+	})
+}
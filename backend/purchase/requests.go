@@ -1,19 +1,90 @@
 package main
 
+import "time"
+
 type AddToCartRequest struct {
 	TourID uint `json:"tour_id" validate:"required"`
 }
 
+// CheckoutRequest is the optional body of a checkout. Without a gift the
+// tours are bought for the caller.
+type CheckoutRequest struct {
+	Gift *GiftRequest `json:"gift"`
+}
+
+// GiftRequest buys every tour in the cart for Recipient, or as redeemable
+// gift codes when Recipient is empty.
+type GiftRequest struct {
+	Recipient string `json:"recipient"`
+	Message   string `json:"message"`
+}
+
 type CheckoutResponse struct {
+	Order   *Order              `json:"order"`
 	Tokens  []TourPurchaseToken `json:"tokens"`
+	Gifts   []Gift              `json:"gifts,omitempty"`
 	Message string              `json:"message"`
 }
 
+// CartChangedResponse is returned by checkout when the cart had to be
+// updated to the tours' current terms and needs the user's confirmation.
+type CartChangedResponse struct {
+	Error   string        `json:"error"`
+	Changes []CartChange  `json:"changes"`
+	Cart    *ShoppingCart `json:"cart"`
+}
+
 type CartResponse struct {
 	Cart    *ShoppingCart `json:"cart"`
 	Message string        `json:"message"`
 }
 
+// MergeCartResponse is the user's cart after a guest cart was merged into
+// it, with the guest items it already held.
+type MergeCartResponse struct {
+	Cart    *ShoppingCart `json:"cart"`
+	Skipped []OrderItem   `json:"skipped"`
+	Message string        `json:"message"`
+}
+
+type SavedItemResponse struct {
+	SavedItem *SavedItem `json:"saved_item"`
+	Message   string     `json:"message"`
+}
+
+type SavedItemsResponse struct {
+	SavedItems []SavedItem `json:"saved_items"`
+	Message    string      `json:"message"`
+}
+
+type AddToWishlistRequest struct {
+	TourID uint `json:"tour_id"`
+}
+
+type WishlistItemResponse struct {
+	Item    *WishlistItem `json:"item"`
+	Message string        `json:"message"`
+}
+
+// WishlistResponse lists favourites with the tour as it is now; Tour is
+// missing when the tour service could not be reached or the tour is gone.
+type WishlistResponse struct {
+	Items   []WishlistItem `json:"items"`
+	Message string         `json:"message"`
+}
+
+// TourFavouriteCount is how many users have a tour on their wishlist.
+type TourFavouriteCount struct {
+	TourID   uint   `json:"tour_id"`
+	TourName string `json:"tour_name"`
+	Count    int64  `json:"count"`
+}
+
+type FavouriteCountsResponse struct {
+	Counts  []TourFavouriteCount `json:"counts"`
+	Message string               `json:"message"`
+}
+
 type TokenResponse struct {
 	Token   *TourPurchaseToken `json:"token"`
 	Message string             `json:"message"`
@@ -22,4 +93,254 @@ type TokenResponse struct {
 type TokensResponse struct {
 	Tokens  []TourPurchaseToken `json:"tokens"`
 	Message string              `json:"message"`
-}
\ No newline at end of file
+}
+
+type TransferTokenRequest struct {
+	Recipient string `json:"recipient" validate:"required"`
+	Note      string `json:"note"`
+}
+
+type TransfersResponse struct {
+	Transfers []TokenTransfer `json:"transfers"`
+	Message   string          `json:"message"`
+}
+
+// TourCompletedRequest is sent by the tour service when a tourist completes
+// a tour execution.
+type TourCompletedRequest struct {
+	Username string `json:"username"`
+	TourID   uint   `json:"tour_id"`
+}
+
+type TokenEventsResponse struct {
+	Events  []TokenEvent `json:"events"`
+	Message string       `json:"message"`
+}
+
+type RedeemGiftRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type GiftResponse struct {
+	Gift    *Gift              `json:"gift"`
+	Token   *TourPurchaseToken `json:"token,omitempty"`
+	Message string             `json:"message"`
+}
+
+type GiftsResponse struct {
+	Gifts   []Gift `json:"gifts"`
+	Message string `json:"message"`
+}
+
+type PaymentResponse struct {
+	Payment *Payment `json:"payment"`
+	Message string   `json:"message"`
+}
+
+type PaymentsResponse struct {
+	Payments []Payment `json:"payments"`
+	Message  string    `json:"message"`
+}
+
+type OrderResponse struct {
+	Order   *Order              `json:"order"`
+	Tokens  []TourPurchaseToken `json:"tokens"`
+	Message string              `json:"message"`
+}
+
+type OrdersResponse struct {
+	Orders  []Order `json:"orders"`
+	Message string  `json:"message"`
+}
+
+type RefundRequest struct {
+	Token  string `json:"token" validate:"required"`
+	Reason string `json:"reason"`
+}
+
+type RefundDecisionRequest struct {
+	Note string `json:"note"`
+}
+
+type RefundResponse struct {
+	Refund  *Refund `json:"refund"`
+	Message string  `json:"message"`
+}
+
+type RefundsResponse struct {
+	Refunds []Refund `json:"refunds"`
+	Message string   `json:"message"`
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type CreateCouponRequest struct {
+	Code           string     `json:"code"`
+	Description    string     `json:"description"`
+	DiscountType   string     `json:"discount_type" validate:"required,oneof=percentage fixed"`
+	Value          float64    `json:"value"`    // percent off, for percentage coupons
+	Amount         int64      `json:"amount"`   // minor units off, for fixed coupons
+	Currency       string     `json:"currency"` // of Amount, defaults to DEFAULT_CURRENCY
+	Scope          string     `json:"scope" validate:"required,oneof=tour guide cart"`
+	TourIDs        []uint     `json:"tour_ids"`
+	GuideUsername  string     `json:"guide_username"`
+	ValidFrom      *time.Time `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until"`
+	MaxUses        int        `json:"max_uses"`
+	MaxUsesPerUser int        `json:"max_uses_per_user"`
+	Stackable      bool       `json:"stackable"`
+	Automatic      bool       `json:"automatic"`
+}
+
+type CouponResponse struct {
+	Coupon  *Coupon `json:"coupon"`
+	Message string  `json:"message"`
+}
+
+type CouponsResponse struct {
+	Coupons []Coupon `json:"coupons"`
+	Message string   `json:"message"`
+}
+
+type AddBundleToCartRequest struct {
+	BundleID uint `json:"bundle_id" validate:"required"`
+}
+
+type CreateBundleRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	TourIDs     []uint `json:"tour_ids" validate:"required,min=2"`
+	Price       int64  `json:"price" validate:"required,gt=0"` // minor units of the tours' currency
+}
+
+type BundleResponse struct {
+	Bundle  *Bundle `json:"bundle"`
+	Message string  `json:"message"`
+}
+
+type BundlesResponse struct {
+	Bundles []Bundle `json:"bundles"`
+	Message string   `json:"message"`
+}
+
+// CreatePayoutRequest pays out Amount minor units of Currency to a guide, or
+// the guide's whole balance in that currency when Amount is zero.
+type CreatePayoutRequest struct {
+	GuideUsername string `json:"guide_username" validate:"required"`
+	Currency      string `json:"currency" validate:"required"`
+	Amount        int64  `json:"amount"`
+	Reference     string `json:"reference"`
+	Note          string `json:"note"`
+}
+
+type PayoutResponse struct {
+	Payout  *Payout `json:"payout"`
+	Message string  `json:"message"`
+}
+
+type PayoutsResponse struct {
+	Payouts []Payout `json:"payouts"`
+	Message string   `json:"message"`
+}
+
+// GuideBalance is what the platform owes a guide in one currency. It goes
+// negative when a refund comes in after the sale was paid out.
+type GuideBalance struct {
+	GuideUsername string `json:"guide_username"`
+	Currency      string `json:"currency"`
+	Balance       int64  `json:"balance"`
+}
+
+type BalancesResponse struct {
+	Balances []GuideBalance `json:"balances"`
+	Message  string         `json:"message"`
+}
+
+// Statement lists a guide's ledger entries in one currency between From
+// (inclusive) and To (exclusive). Closing is Opening plus GrossSales, minus
+// Fees, Refunds and Payouts; Fees are net of fees given back on refunds.
+type Statement struct {
+	GuideUsername string          `json:"guide_username"`
+	Currency      string          `json:"currency"`
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	Opening       int64           `json:"opening_balance"`
+	GrossSales    int64           `json:"gross_sales"`
+	Fees          int64           `json:"fees"`
+	Refunds       int64           `json:"refunds"`
+	Payouts       int64           `json:"payouts"`
+	Closing       int64           `json:"closing_balance"`
+	Lines         []StatementLine `json:"lines"`
+}
+
+// StatementLine is one entry on a guide's account with the balance after it.
+type StatementLine struct {
+	EntryID     uint      `json:"entry_id"`
+	Date        time.Time `json:"date"`
+	Kind        string    `json:"kind"`
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	Memo        string    `json:"memo"`
+	OrderID     *uint     `json:"order_id,omitempty"`
+	Debit       int64     `json:"debit"`
+	Credit      int64     `json:"credit"`
+	Balance     int64     `json:"balance"`
+}
+
+type StatementResponse struct {
+	Statement *Statement `json:"statement"`
+	Message   string     `json:"message"`
+}
+
+// CreateCreditNoteRequest credits the given lines of an invoice, or every
+// line not credited yet when OrderLineIDs is empty.
+type CreateCreditNoteRequest struct {
+	OrderLineIDs []uint `json:"order_line_ids"`
+	Reason       string `json:"reason" validate:"required"`
+}
+
+type InvoiceResponse struct {
+	Invoice *Invoice `json:"invoice"`
+	Message string   `json:"message"`
+}
+
+type InvoicesResponse struct {
+	Invoices []Invoice `json:"invoices"`
+	Message  string    `json:"message"`
+}
+
+type ReceiptResponse struct {
+	Receipt *Receipt `json:"receipt"`
+	Message string   `json:"message"`
+}
+
+// PurchaseDataExport is everything the purchase service keeps about a user.
+// Cart is nil when the user has no cart.
+type PurchaseDataExport struct {
+	Username   string              `json:"username"`
+	Cart       *ShoppingCart       `json:"cart"`
+	SavedItems []SavedItem         `json:"saved_items"`
+	Wishlist   []WishlistItem      `json:"wishlist"`
+	Orders     []Order             `json:"orders"`
+	Tokens     []TourPurchaseToken `json:"tokens"`
+	Refunds    []Refund            `json:"refunds"`
+	Gifts      []Gift              `json:"gifts"`
+}
+
+// ExportManifest describes a data export archive. Services lists the other
+// services asked for their part of a full export and whether they answered.
+type ExportManifest struct {
+	Username   string                `json:"username"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Files      []string              `json:"files"`
+	Services   []ServiceExportStatus `json:"services,omitempty"`
+}
+
+type ServiceExportStatus struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
+	File    string `json:"file,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
@@ -0,0 +1,65 @@
+package main
+
+import "gorm.io/gorm"
+
+type SavedItemRepository struct {
+	database *Database
+}
+
+func NewSavedItemRepository(db *Database) *SavedItemRepository {
+	return &SavedItemRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *SavedItemRepository) WithTx(tx *Database) *SavedItemRepository {
+	return &SavedItemRepository{database: tx}
+}
+
+func (r *SavedItemRepository) CreateSavedItem(item *SavedItem) error {
+	result := r.database.db.Create(item)
+	return result.Error
+}
+
+func (r *SavedItemRepository) GetSavedItemByID(itemID uint) (*SavedItem, error) {
+	var item SavedItem
+	result := r.database.db.Where("id = ?", itemID).First(&item)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrSavedItemNotFound
+		}
+		return nil, result.Error
+	}
+	return &item, nil
+}
+
+// GetSavedItems returns a user's saved items, most recently saved first.
+func (r *SavedItemRepository) GetSavedItems(userID string) ([]SavedItem, error) {
+	var items []SavedItem
+	result := r.database.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return items, nil
+}
+
+// IsSaved reports whether the user has already saved the tour or bundle.
+func (r *SavedItemRepository) IsSaved(userID string, tourID uint, bundleID *uint) (bool, error) {
+	query := r.database.db.Model(&SavedItem{}).Where("user_id = ?", userID)
+	if bundleID != nil {
+		query = query.Where("bundle_id = ?", *bundleID)
+	} else {
+		query = query.Where("tour_id = ? AND bundle_id IS NULL", tourID)
+	}
+
+	var count int64
+	result := query.Count(&count)
+	return count > 0, result.Error
+}
+
+func (r *SavedItemRepository) DeleteSavedItem(itemID uint) error {
+	result := r.database.db.Where("id = ?", itemID).Delete(&SavedItem{})
+	if result.RowsAffected == 0 {
+		return ErrSavedItemNotFound
+	}
+	return result.Error
+}
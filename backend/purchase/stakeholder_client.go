@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var stakeholderClient = &http.Client{Timeout: 3 * time.Second}
+
+// StakeholderProfile holds the parts of a user's profile in the stakeholder
+// service that purchases rely on.
+type StakeholderProfile struct {
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Currency  string `json:"currency"`
+	Country   string `json:"country"`
+}
+
+// fetchProfile reads a user's profile from the stakeholder service. It
+// returns nil without an error when the user has no profile, as do guests,
+// who have no username.
+func fetchProfile(username string) (*StakeholderProfile, error) {
+	if username == "" {
+		return nil, nil
+	}
+
+	stakeholderServiceURL := GetEnv("STAKEHOLDER_SERVICE_URL", "http://stakeholder-service:3003")
+	endpoint := fmt.Sprintf("%s/internal/profile/%s", stakeholderServiceURL, url.PathEscape(username))
+
+	resp, err := stakeholderClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch profile: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stakeholder service returned status: %d", resp.StatusCode)
+	}
+
+	var profile StakeholderProfile
+	err = json.NewDecoder(resp.Body).Decode(&profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile: %v", err)
+	}
+
+	return &profile, nil
+}
+
+// fetchPreferredCurrency reads the currency set on the user's profile in the
+// stakeholder service. An empty string means the user has not chosen one.
+func fetchPreferredCurrency(username string) (string, error) {
+	profile, err := fetchProfile(username)
+	if err != nil || profile == nil {
+		return "", err
+	}
+	return profile.Currency, nil
+}
+
+// checkUserExists returns ErrRecipientNotFound unless the user has a profile,
+// which every registered user gets when their account is created.
+func checkUserExists(username string) error {
+	profile, err := fetchProfile(username)
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		return ErrRecipientNotFound
+	}
+	return nil
+}
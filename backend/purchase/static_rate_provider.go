@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// defaultRates are units of each currency per one EUR.
+var defaultRates = map[string]float64{
+	"EUR": 1,
+	"USD": 1.08,
+	"GBP": 0.85,
+	"CHF": 0.95,
+	"RSD": 117.2,
+	"JPY": 162.5,
+}
+
+// StaticRateProvider serves rates from a fixed table. Rates are expressed
+// against EUR and can be overridden with EXCHANGE_RATES, for example
+// "USD=1.10,RSD=117.0".
+type StaticRateProvider struct {
+	rates map[string]float64
+}
+
+func NewStaticRateProvider(overrides string) *StaticRateProvider {
+	rates := make(map[string]float64, len(defaultRates))
+	for currency, rate := range defaultRates {
+		rates[currency] = rate
+	}
+
+	for _, pair := range strings.Split(overrides, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		currency := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || !isCurrencyCode(currency) {
+			log.Printf("Ignoring invalid exchange rate %q", pair)
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || rate <= 0 {
+			log.Printf("Ignoring invalid exchange rate %q", pair)
+			continue
+		}
+		rates[currency] = rate
+	}
+
+	return &StaticRateProvider{rates: rates}
+}
+
+func (p *StaticRateProvider) Name() string {
+	return "static"
+}
+
+func (p *StaticRateProvider) Rate(ctx context.Context, from string, to string) (float64, error) {
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return 0, ErrUnsupportedCurrency
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return 0, ErrUnsupportedCurrency
+	}
+	return toRate / fromRate, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TaxRules are the tax rules loaded from the TAX_RULES_FILE, for example:
+//
+//	{
+//	  "default_country": "RS",
+//	  "prices_include_tax": true,
+//	  "rules": [
+//	    {"name": "Serbian VAT", "seller_country": "RS", "buyer_country": "RS", "rate": 20},
+//	    {"name": "Export", "seller_country": "RS", "rate": 0}
+//	  ]
+//	}
+//
+// DefaultCountry is assumed for users who have not set a country on their
+// profile. PricesIncludeTax says whether tour prices already contain the tax.
+type TaxRules struct {
+	DefaultCountry   string    `json:"default_country"`
+	PricesIncludeTax bool      `json:"prices_include_tax"`
+	Rules            []TaxRule `json:"rules"`
+}
+
+// TaxRule sets the tax rate, in percent, of sales that match its seller
+// country, buyer country and product type. An empty or "*" field matches
+// anything. Inclusive overrides PricesIncludeTax for the sales it matches.
+type TaxRule struct {
+	Name          string  `json:"name"`
+	SellerCountry string  `json:"seller_country"`
+	BuyerCountry  string  `json:"buyer_country"`
+	ProductType   string  `json:"product_type"`
+	Rate          float64 `json:"rate"`
+	Inclusive     *bool   `json:"inclusive"`
+}
+
+// LoadTaxRules reads and checks a tax rules file.
+func LoadTaxRules(path string) (*TaxRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var rules TaxRules
+	err = decoder.Decode(&rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	rules.DefaultCountry = strings.ToUpper(rules.DefaultCountry)
+	if rules.DefaultCountry != "" && !isCountryCode(rules.DefaultCountry) {
+		return nil, fmt.Errorf("%s: invalid default_country %q", path, rules.DefaultCountry)
+	}
+
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		rule.SellerCountry = normalizeTaxMatch(rule.SellerCountry)
+		rule.BuyerCountry = normalizeTaxMatch(rule.BuyerCountry)
+		rule.ProductType = strings.ToLower(normalizeTaxMatch(rule.ProductType))
+
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Rate < 0 || rule.Rate > 100 {
+			return nil, fmt.Errorf("%s: %s has rate %v, must be between 0 and 100", path, rule.Name, rule.Rate)
+		}
+		for _, country := range []string{rule.SellerCountry, rule.BuyerCountry} {
+			if country != "" && !isCountryCode(country) {
+				return nil, fmt.Errorf("%s: %s has invalid country %q", path, rule.Name, country)
+			}
+		}
+		if rule.ProductType != "" && rule.ProductType != ProductTypeTour && rule.ProductType != ProductTypeBundle {
+			return nil, fmt.Errorf("%s: %s has unknown product_type %q", path, rule.Name, rule.ProductType)
+		}
+	}
+
+	return &rules, nil
+}
+
+// Match finds the rule for a sale: the one that names the most of seller
+// country, buyer country and product type, or the earlier one of equally
+// specific rules. It returns false if no rule matches.
+func (rules *TaxRules) Match(sellerCountry string, buyerCountry string, productType string) (TaxRule, bool) {
+	best := -1
+	bestScore := -1
+	for i, rule := range rules.Rules {
+		score := 0
+		for _, field := range []struct{ want, got string }{
+			{rule.SellerCountry, sellerCountry},
+			{rule.BuyerCountry, buyerCountry},
+			{rule.ProductType, productType},
+		} {
+			if field.want == "" {
+				continue
+			}
+			if field.want != field.got {
+				score = -1
+				break
+			}
+			score++
+		}
+		if score > bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+
+	if best < 0 {
+		return TaxRule{}, false
+	}
+	return rules.Rules[best], true
+}
+
+// IsInclusive reports whether prices the rule applies to contain the tax.
+func (rules *TaxRules) IsInclusive(rule TaxRule) bool {
+	if rule.Inclusive != nil {
+		return *rule.Inclusive
+	}
+	return rules.PricesIncludeTax
+}
+
+// normalizeTaxMatch turns the wildcard into an empty field.
+func normalizeTaxMatch(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "*" {
+		return ""
+	}
+	return value
+}
+
+// isCountryCode reports whether code looks like an ISO 3166-1 alpha-2 code.
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
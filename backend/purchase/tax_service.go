@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TaxService works out the tax on sales from the rules in a config file. The
+// seller is the guide who wrote the tour and the buyer the user checking
+// out; their countries come from their stakeholder profiles. The file is
+// watched, so rules can change without a restart.
+type TaxService struct {
+	path    string
+	mutex   sync.RWMutex
+	rules   *TaxRules
+	modTime time.Time
+}
+
+func NewTaxService(path string) (*TaxService, error) {
+	s := &TaxService{path: path}
+	err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d tax rules from %s", len(s.rules.Rules), path)
+	return s, nil
+}
+
+// Watch reloads the rules every interval when the file has changed, until
+// ctx is cancelled. A broken file is reported and the old rules are kept.
+func (s *TaxService) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil {
+			log.Printf("Tax rules: %v", err)
+			continue
+		}
+		s.mutex.RLock()
+		changed := !info.ModTime().Equal(s.modTime)
+		s.mutex.RUnlock()
+		if !changed {
+			continue
+		}
+
+		err = s.reload()
+		if err != nil {
+			log.Printf("Tax rules: keeping the previous rules: %v", err)
+			continue
+		}
+		log.Printf("Reloaded %d tax rules from %s", len(s.Rules().Rules), s.path)
+	}
+}
+
+func (s *TaxService) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	rules, err := LoadTaxRules(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rules = rules
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// Rules returns the rules currently in effect.
+func (s *TaxService) Rules() *TaxRules {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.rules
+}
+
+// Countries returns an empty lookup of user countries that falls back to
+// the default country of the rules in effect.
+func (s *TaxService) Countries() *countryLookup {
+	return newCountryLookup(s.Rules().DefaultCountry)
+}
+
+// TaxLines sets the taxation of every order line sold to buyer. The tax
+// itself is applied by Order.CalculateTotals. Countries not already in
+// countries are fetched from the stakeholder service.
+func (s *TaxService) TaxLines(lines []OrderLine, buyer string, countries *countryLookup) {
+	rules := s.Rules()
+	buyerCountry := countries.of(buyer)
+
+	for i := range lines {
+		line := &lines[i]
+		productType := ProductTypeTour
+		if line.BundleID != nil {
+			productType = ProductTypeBundle
+		}
+		line.Taxation = s.taxation(rules, countries.of(line.GuideUsername), buyerCountry, productType)
+	}
+}
+
+// QuoteCart adds the tax to a priced cart, so that the cart shows what
+// checking out will charge. Exclusive tax raises the total.
+func (s *TaxService) QuoteCart(cart *ShoppingCart) {
+	rules := s.Rules()
+	countries := newCountryLookup(rules.DefaultCountry)
+	buyerCountry := countries.of(cart.UserID)
+
+	cart.TaxTotal = 0
+	for _, item := range cart.Items {
+		productType := ProductTypeTour
+		if item.BundleID != nil {
+			productType = ProductTypeBundle
+		}
+		taxation := s.taxation(rules, countries.of(item.AuthorUsername), buyerCountry, productType)
+		if taxation == nil {
+			continue
+		}
+
+		amount := item.Price
+		for _, discount := range cart.Discounts {
+			amount -= discount.Allocations[item.ID]
+		}
+		_, tax := splitTax(max(amount, 0), taxation.Rate, taxation.Inclusive)
+		cart.TaxTotal += tax
+		if !taxation.Inclusive {
+			cart.Total += tax
+		}
+	}
+}
+
+func (s *TaxService) taxation(rules *TaxRules, sellerCountry string, buyerCountry string, productType string) *Taxation {
+	rule, ok := rules.Match(sellerCountry, buyerCountry, productType)
+	if !ok {
+		return nil
+	}
+	return &Taxation{
+		Rule:          rule.Name,
+		Rate:          rule.Rate,
+		Inclusive:     rules.IsInclusive(rule),
+		SellerCountry: sellerCountry,
+		BuyerCountry:  buyerCountry,
+		ProductType:   productType,
+	}
+}
+
+// countryLookup reads each user's country from the stakeholder service once,
+// falling back to the default country for users without one.
+type countryLookup struct {
+	defaultCountry string
+	countries      map[string]string
+}
+
+func newCountryLookup(defaultCountry string) *countryLookup {
+	return &countryLookup{defaultCountry: defaultCountry, countries: make(map[string]string)}
+}
+
+func (l *countryLookup) of(username string) string {
+	if country, ok := l.countries[username]; ok {
+		return country
+	}
+
+	country := l.defaultCountry
+	profile, err := fetchProfile(username)
+	if err != nil {
+		log.Printf("Tax: using country %q for %s: %v", country, username, err)
+	} else if profile != nil && profile.Country != "" {
+		country = profile.Country
+	}
+
+	l.countries[username] = country
+	return country
+}
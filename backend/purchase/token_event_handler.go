@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+type TokenEventHandler struct {
+	service *TokenLifecycleService
+}
+
+func NewTokenEventHandler(service *TokenLifecycleService) *TokenEventHandler {
+	return &TokenEventHandler{service: service}
+}
+
+// MarkTokenUsed is called by the tour service when a tourist completes a
+// tour execution.
+func (h *TokenEventHandler) MarkTokenUsed(w http.ResponseWriter, r *http.Request) {
+	var request TourCompletedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Username == "" || request.TourID == 0 {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.service.MarkTokenUsed(request.Username, request.TourID)
+	if err != nil {
+		switch err {
+		case ErrTokenNotFound:
+			h.sendErrorResponse(w, "No valid purchase found for this tour", http.StatusNotFound)
+		case ErrTokenInvalid:
+			h.sendErrorResponse(w, "Purchase token is no longer active", http.StatusConflict)
+		default:
+			h.sendErrorResponse(w, "Failed to mark token as used: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TokenResponse{Token: token, Message: "Token marked as used"})
+}
+
+// GetEvents serves the token event feed: ?after=<last seen event ID>&limit=.
+func (h *TokenEventHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	var afterID uint64
+	if after := r.URL.Query().Get("after"); after != "" {
+		var err error
+		afterID, err = strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			h.sendErrorResponse(w, "Invalid after parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	events, err := h.service.GetEventsAfter(uint(afterID), limit)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get token events: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TokenEventsResponse{Events: events, Message: "Token events retrieved successfully"})
+}
+
+func (h *TokenEventHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
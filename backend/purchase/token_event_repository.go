@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+type TokenEventRepository struct {
+	database *Database
+}
+
+func NewTokenEventRepository(db *Database) *TokenEventRepository {
+	return &TokenEventRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *TokenEventRepository) WithTx(tx *Database) *TokenEventRepository {
+	return &TokenEventRepository{database: tx}
+}
+
+func (r *TokenEventRepository) CreateEvent(event *TokenEvent) error {
+	result := r.database.db.Create(event)
+	return result.Error
+}
+
+// GetUnpublishedEvents returns up to limit events still waiting for
+// delivery, oldest first.
+func (r *TokenEventRepository) GetUnpublishedEvents(limit int) ([]TokenEvent, error) {
+	var events []TokenEvent
+	result := r.database.db.Where("published_at IS NULL").Order("id").Limit(limit).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+func (r *TokenEventRepository) MarkPublished(eventID uint, at time.Time) error {
+	result := r.database.db.Model(&TokenEvent{}).Where("id = ?", eventID).Update("published_at", at)
+	return result.Error
+}
+
+// GetEventsAfter returns up to limit events with an ID greater than afterID,
+// for consumers that read the feed instead of receiving pushes.
+func (r *TokenEventRepository) GetEventsAfter(afterID uint, limit int) ([]TokenEvent, error) {
+	var events []TokenEvent
+	result := r.database.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
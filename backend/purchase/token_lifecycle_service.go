@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+// sweepBatchSize bounds how many tokens one sweep transaction touches.
+const sweepBatchSize = 500
+
+// TokenLifecycleService moves purchase tokens through their lifecycle outside
+// of requests: it expires tokens in bulk, warns about tokens that expire
+// soon, marks tokens used when their tour is completed and publishes the
+// resulting events.
+type TokenLifecycleService struct {
+	database           *Database
+	purchaseRepository *PurchaseRepository
+	eventRepository    *TokenEventRepository
+	publisher          EventPublisher
+	warningWindow      time.Duration
+}
+
+func NewTokenLifecycleService(db *Database, purchaseRepo *PurchaseRepository, eventRepo *TokenEventRepository, publisher EventPublisher) *TokenLifecycleService {
+	days, err := strconv.Atoi(GetEnv("TOKEN_EXPIRY_WARNING_DAYS", "7"))
+	if err != nil || days < 0 {
+		log.Printf("Invalid TOKEN_EXPIRY_WARNING_DAYS, using 7")
+		days = 7
+	}
+
+	return &TokenLifecycleService{
+		database:           db,
+		purchaseRepository: purchaseRepo,
+		eventRepository:    eventRepo,
+		publisher:          publisher,
+		warningWindow:      time.Duration(days) * 24 * time.Hour,
+	}
+}
+
+// Start runs a sweep every interval until ctx is cancelled.
+func (s *TokenLifecycleService) Start(ctx context.Context, interval time.Duration) {
+	log.Printf("Token sweeper running every %s, publishing with %s", interval, s.publisher.Name())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires due tokens and warns about the ones close to expiry, then
+// publishes pending events. Failures are logged and retried on the next
+// sweep.
+func (s *TokenLifecycleService) Sweep(ctx context.Context) {
+	now := time.Now()
+
+	// Expire first so lapsed tokens do not also get an expiring-soon event
+	expired, err := s.ExpireTokens(now)
+	if err != nil {
+		log.Printf("Token sweep: failed to expire tokens: %v", err)
+	}
+
+	warned, err := s.WarnExpiringTokens(now)
+	if err != nil {
+		log.Printf("Token sweep: failed to warn about expiring tokens: %v", err)
+	}
+
+	published, err := s.PublishPendingEvents(ctx)
+	if err != nil {
+		log.Printf("Token sweep: failed to publish events: %v", err)
+	}
+
+	if warned > 0 || expired > 0 || published > 0 {
+		log.Printf("Token sweep: %d expiring soon, %d expired, %d events published", warned, expired, published)
+	}
+}
+
+// ExpireTokens marks every active or used token past its expiry as expired
+// and records a token.expired event for each.
+func (s *TokenLifecycleService) ExpireTokens(now time.Time) (int, error) {
+	return sweepBatches(s.database, func(tx *Database) (int, error) {
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+
+		tokens, err := purchaseRepo.LockUsableTokensExpiringBefore(now, false, sweepBatchSize)
+		if err != nil || len(tokens) == 0 {
+			return 0, err
+		}
+
+		err = purchaseRepo.ExpireTokens(tokenIDs(tokens))
+		if err != nil {
+			return 0, err
+		}
+		return len(tokens), s.recordEvents(tx, TokenEventExpired, tokens, now)
+	})
+}
+
+// WarnExpiringTokens records a token.expiring_soon event, once, for every
+// active or used token that expires within the warning window.
+func (s *TokenLifecycleService) WarnExpiringTokens(now time.Time) (int, error) {
+	if s.warningWindow == 0 {
+		return 0, nil
+	}
+
+	return sweepBatches(s.database, func(tx *Database) (int, error) {
+		purchaseRepo := s.purchaseRepository.WithTx(tx)
+
+		tokens, err := purchaseRepo.LockUsableTokensExpiringBefore(now.Add(s.warningWindow), true, sweepBatchSize)
+		if err != nil || len(tokens) == 0 {
+			return 0, err
+		}
+
+		err = purchaseRepo.MarkExpiryWarned(tokenIDs(tokens), now)
+		if err != nil {
+			return 0, err
+		}
+		return len(tokens), s.recordEvents(tx, TokenEventExpiringSoon, tokens, now)
+	})
+}
+
+// MarkTokenUsed records that userID completed the tour, turning their active
+// token for it into a used one. Reporting the same tour again is a no-op.
+func (s *TokenLifecycleService) MarkTokenUsed(userID string, tourID uint) (*TourPurchaseToken, error) {
+	tokens, err := s.purchaseRepository.GetUsableTokensByUserAndTour(userID, tourID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use up the token that expires first, unless one is already used
+	var token *TourPurchaseToken
+	for i := range tokens {
+		if !tokens[i].IsValid() {
+			continue
+		}
+		if tokens[i].Status == TokenStatusUsed {
+			return &tokens[i], nil
+		}
+		token = &tokens[i]
+	}
+	if token == nil {
+		return nil, ErrTokenNotFound
+	}
+
+	usedAt := time.Now()
+	err = s.database.Transaction(func(tx *Database) error {
+		err := s.purchaseRepository.WithTx(tx).MarkTokenUsed(token.ID, usedAt)
+		if err != nil {
+			return err
+		}
+		return s.recordEvents(tx, TokenEventUsed, []TourPurchaseToken{*token}, usedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token.Status = TokenStatusUsed
+	token.UsedAt = &usedAt
+	return token, nil
+}
+
+// PublishPendingEvents hands queued events to the publisher in order. It
+// stops at the first failure so events are never delivered out of order.
+func (s *TokenLifecycleService) PublishPendingEvents(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		events, err := s.eventRepository.GetUnpublishedEvents(sweepBatchSize)
+		if err != nil || len(events) == 0 {
+			return published, err
+		}
+
+		for i := range events {
+			err := s.publisher.Publish(ctx, &events[i])
+			if err != nil {
+				return published, err
+			}
+			err = s.eventRepository.MarkPublished(events[i].ID, time.Now())
+			if err != nil {
+				return published, err
+			}
+			published++
+		}
+	}
+}
+
+// GetEventsAfter serves the event feed to consumers that poll.
+func (s *TokenLifecycleService) GetEventsAfter(afterID uint, limit int) ([]TokenEvent, error) {
+	if limit <= 0 || limit > sweepBatchSize {
+		limit = sweepBatchSize
+	}
+	return s.eventRepository.GetEventsAfter(afterID, limit)
+}
+
+// sweepBatches runs batch in its own transaction until it reports no work.
+func sweepBatches(db *Database, batch func(tx *Database) (int, error)) (int, error) {
+	total := 0
+	for {
+		count := 0
+		err := db.Transaction(func(tx *Database) error {
+			var err error
+			count, err = batch(tx)
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+		total += count
+		if count < sweepBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (s *TokenLifecycleService) recordEvents(tx *Database, eventType string, tokens []TourPurchaseToken, at time.Time) error {
+	eventRepo := s.eventRepository.WithTx(tx)
+	for _, token := range tokens {
+		err := eventRepo.CreateEvent(&TokenEvent{
+			Type:       eventType,
+			TokenID:    token.ID,
+			UserID:     token.UserID,
+			TourID:     token.TourID,
+			TourName:   token.TourName,
+			ExpiresAt:  token.ExpiresAt,
+			OccurredAt: at,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tokenIDs(tokens []TourPurchaseToken) []uint {
+	ids := make([]uint, len(tokens))
+	for i, token := range tokens {
+		ids[i] = token.ID
+	}
+	return ids
+}
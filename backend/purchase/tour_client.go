@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Helper function to fetch tour info from tour service
+func fetchTourInfo(tourID uint) (*TourInfo, error) {
+	tourServiceURL := GetEnv("TOUR_SERVICE_URL", "http://tour-service:3006")
+	url := fmt.Sprintf("%s/%d", tourServiceURL, tourID)
+
+	log.Printf("fetchTourInfo: requesting URL: %s", url)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tour info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	log.Printf("fetchTourInfo: tour service response status: %d", resp.StatusCode)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrTourNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tour service returned status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tour response: %v", err)
+	}
+
+	log.Printf("fetchTourInfo: response body: %s", string(body))
+
+	var tourInfo TourInfo
+	err = json.Unmarshal(body, &tourInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tour info: %v", err)
+	}
+	if tourInfo.Currency == "" {
+		tourInfo.Currency = GetEnv("DEFAULT_CURRENCY", "EUR")
+	}
+
+	return &tourInfo, nil
+}
+
+// resolveGuides sets the guide of every order line to the author of its tour
+// as the tour service knows it.
+func resolveGuides(lines []OrderLine) error {
+	tourIDs := make([]uint, len(lines))
+	for i, line := range lines {
+		tourIDs[i] = line.TourID
+	}
+	guides, err := fetchGuides(tourIDs)
+	if err != nil {
+		return err
+	}
+	return assignGuides(lines, guides)
+}
+
+// fetchGuides looks up the author of each tour in the tour service.
+func fetchGuides(tourIDs []uint) (map[uint]string, error) {
+	guides := make(map[uint]string)
+	for _, tourID := range tourIDs {
+		if _, ok := guides[tourID]; ok {
+			continue
+		}
+		tourInfo, err := fetchTourInfo(tourID)
+		if err != nil {
+			return nil, err
+		}
+		guides[tourID] = tourInfo.AuthorUsername
+	}
+	return guides, nil
+}
+
+// assignGuides sets the guide of every order line from guides, the tour
+// authors looked up earlier. It returns ErrCartModified for a tour that was
+// not looked up.
+func assignGuides(lines []OrderLine, guides map[uint]string) error {
+	for i := range lines {
+		line := &lines[i]
+
+		author, ok := guides[line.TourID]
+		if !ok {
+			return ErrCartModified
+		}
+		if author == "" {
+			return ErrGuideNotFound
+		}
+		line.GuideUsername = author
+	}
+	return nil
+}
+
+// TourInfo represents basic tour information from tour service. Price is in
+// minor units of Currency, the guide's base currency.
+type TourInfo struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	Price          int64  `json:"price_minor"`
+	Currency       string `json:"currency"`
+	Status         string `json:"status"`
+	AuthorUsername string `json:"author_username"`
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookEventPublisher posts each event as JSON to a single URL. When a
+// secret is set the body is signed with HMAC-SHA256, hex encoded in the
+// X-Event-Signature header, the same scheme the payment webhook uses.
+type WebhookEventPublisher struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookEventPublisher(url string, secret string) *WebhookEventPublisher {
+	return &WebhookEventPublisher{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p *WebhookEventPublisher) Name() string {
+	return "webhook"
+}
+
+func (p *WebhookEventPublisher) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", event.EventType())
+	req.Header.Set("X-Event-ID", event.EventID())
+	if p.secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.secret))
+		mac.Write(payload)
+		req.Header.Set("X-Event-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver event %s: %v", event.EventID(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("event webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
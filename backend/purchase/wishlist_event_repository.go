@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+type WishlistEventRepository struct {
+	database *Database
+}
+
+func NewWishlistEventRepository(db *Database) *WishlistEventRepository {
+	return &WishlistEventRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *WishlistEventRepository) WithTx(tx *Database) *WishlistEventRepository {
+	return &WishlistEventRepository{database: tx}
+}
+
+func (r *WishlistEventRepository) CreateEvent(event *WishlistEvent) error {
+	result := r.database.db.Create(event)
+	return result.Error
+}
+
+// GetUnpublishedEvents returns up to limit events still waiting for
+// delivery, oldest first.
+func (r *WishlistEventRepository) GetUnpublishedEvents(limit int) ([]WishlistEvent, error) {
+	var events []WishlistEvent
+	result := r.database.db.Where("published_at IS NULL").Order("id").Limit(limit).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+func (r *WishlistEventRepository) MarkPublished(eventID uint, at time.Time) error {
+	result := r.database.db.Model(&WishlistEvent{}).Where("id = ?", eventID).Update("published_at", at)
+	return result.Error
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"authz"
+
+	"github.com/gorilla/mux"
+)
+
+type WishlistHandler struct {
+	service *WishlistService
+}
+
+func NewWishlistHandler(service *WishlistService) *WishlistHandler {
+	return &WishlistHandler{service: service}
+}
+
+func (h *WishlistHandler) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := h.service.GetWishlist(userID)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get wishlist: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(WishlistResponse{Items: items, Message: "Wishlist retrieved successfully"})
+}
+
+func (h *WishlistHandler) AddToWishlist(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	var request AddToWishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.TourID == 0 {
+		h.sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.service.AddToWishlist(userID, request.TourID)
+	if err != nil {
+		h.handleWishlistError(w, err, "Failed to add tour to wishlist")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(WishlistItemResponse{Item: item, Message: "Tour added to wishlist"})
+}
+
+func (h *WishlistHandler) RemoveFromWishlist(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("x-username")
+	if userID == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	tourID, err := strconv.ParseUint(mux.Vars(r)["tourId"], 10, 32)
+	if err != nil {
+		h.sendErrorResponse(w, "Invalid tour ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.RemoveFromWishlist(userID, uint(tourID))
+	if err != nil {
+		h.handleWishlistError(w, err, "Failed to remove tour from wishlist")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Tour removed from wishlist"})
+}
+
+// GetFavouriteCounts shows guides how often each of their tours was
+// favourited; auditors pass ?author= to see any guide's.
+func (h *WishlistHandler) GetFavouriteCounts(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	if username == "" {
+		h.sendErrorResponse(w, "User ID is required", http.StatusUnauthorized)
+		return
+	}
+
+	author := username
+	switch {
+	case authz.Has(r, authz.SalesAudit):
+		if r.URL.Query().Get("author") != "" {
+			author = r.URL.Query().Get("author")
+		}
+	case authz.Has(r, authz.SalesRead):
+	default:
+		h.sendErrorResponse(w, "You are not allowed to view favourite counts", http.StatusForbidden)
+		return
+	}
+
+	counts, err := h.service.GetFavouriteCounts(author)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to get favourite counts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(FavouriteCountsResponse{Counts: counts, Message: "Favourite counts retrieved successfully"})
+}
+
+func (h *WishlistHandler) handleWishlistError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case ErrWishlistItemNotFound:
+		h.sendErrorResponse(w, "Tour is not in the wishlist", http.StatusNotFound)
+	case ErrTourNotFound:
+		h.sendErrorResponse(w, "Tour not found", http.StatusNotFound)
+	case ErrTourNotPublished:
+		h.sendErrorResponse(w, "Tour is not published", http.StatusBadRequest)
+	default:
+		h.sendErrorResponse(w, message+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *WishlistHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
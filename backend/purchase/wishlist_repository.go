@@ -0,0 +1,111 @@
+package main
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WishlistRepository struct {
+	database *Database
+}
+
+func NewWishlistRepository(db *Database) *WishlistRepository {
+	return &WishlistRepository{database: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries on tx.
+func (r *WishlistRepository) WithTx(tx *Database) *WishlistRepository {
+	return &WishlistRepository{database: tx}
+}
+
+// AddItem stores a favourite unless the user already has one for the tour,
+// and returns the stored favourite either way.
+func (r *WishlistRepository) AddItem(item *WishlistItem) (*WishlistItem, error) {
+	result := r.database.db.Clauses(clause.OnConflict{DoNothing: true}).Create(item)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return r.GetItem(item.UserID, item.TourID)
+}
+
+func (r *WishlistRepository) GetItem(userID string, tourID uint) (*WishlistItem, error) {
+	var item WishlistItem
+	result := r.database.db.Where("user_id = ? AND tour_id = ?", userID, tourID).First(&item)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrWishlistItemNotFound
+		}
+		return nil, result.Error
+	}
+	return &item, nil
+}
+
+// GetItems returns a user's favourites, most recently added first.
+func (r *WishlistRepository) GetItems(userID string) ([]WishlistItem, error) {
+	var items []WishlistItem
+	result := r.database.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return items, nil
+}
+
+func (r *WishlistRepository) DeleteItem(userID string, tourID uint) error {
+	result := r.database.db.Where("user_id = ? AND tour_id = ?", userID, tourID).Delete(&WishlistItem{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWishlistItemNotFound
+	}
+	return nil
+}
+
+// GetTourIDs returns every tour that is on someone's wishlist.
+func (r *WishlistRepository) GetTourIDs() ([]uint, error) {
+	var tourIDs []uint
+	result := r.database.db.Model(&WishlistItem{}).Distinct("tour_id").Order("tour_id").Pluck("tour_id", &tourIDs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tourIDs, nil
+}
+
+// LockItemsByTour returns the favourites of a tour, locked so that a
+// concurrent watcher does not report the same change twice.
+func (r *WishlistRepository) LockItemsByTour(tourID uint) ([]WishlistItem, error) {
+	var items []WishlistItem
+	result := r.database.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("tour_id = ?", tourID).Order("id").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return items, nil
+}
+
+// UpdateTourSnapshot records what the favourites of a tour last saw of it.
+func (r *WishlistRepository) UpdateTourSnapshot(tourID uint, tour *TourInfo) error {
+	result := r.database.db.Model(&WishlistItem{}).Where("tour_id = ?", tourID).Updates(map[string]interface{}{
+		"tour_name":       tour.Name,
+		"author_username": tour.AuthorUsername,
+		"last_price":      tour.Price,
+		"last_currency":   tour.Currency,
+		"last_status":     tour.Status,
+	})
+	return result.Error
+}
+
+// CountByAuthor returns how many users have each of the author's tours on
+// their wishlist, most favoured first.
+func (r *WishlistRepository) CountByAuthor(author string) ([]TourFavouriteCount, error) {
+	var counts []TourFavouriteCount
+	result := r.database.db.Model(&WishlistItem{}).
+		Select("tour_id, MAX(tour_name) AS tour_name, COUNT(*) AS count").
+		Where("author_username = ?", author).
+		Group("tour_id").Order("count DESC, tour_id").
+		Scan(&counts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return counts, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// WishlistService keeps the tours users marked as favourites. A watcher
+// checks wishlisted tours against the tour service and records a
+// wishlist.price_dropped or wishlist.on_sale event for every user whose
+// favourite got cheaper or can be bought again.
+type WishlistService struct {
+	database           *Database
+	wishlistRepository *WishlistRepository
+	eventRepository    *WishlistEventRepository
+	publisher          EventPublisher
+}
+
+func NewWishlistService(db *Database, wishlistRepo *WishlistRepository, eventRepo *WishlistEventRepository, publisher EventPublisher) *WishlistService {
+	return &WishlistService{
+		database:           db,
+		wishlistRepository: wishlistRepo,
+		eventRepository:    eventRepo,
+		publisher:          publisher,
+	}
+}
+
+// AddToWishlist marks a tour as a favourite of the user. Archived tours can
+// be added too, so the user hears when they are on sale again. Adding a
+// favourite twice returns the existing one.
+func (s *WishlistService) AddToWishlist(userID string, tourID uint) (*WishlistItem, error) {
+	tourInfo, err := fetchTourInfo(tourID)
+	if err != nil {
+		return nil, err
+	}
+	if tourInfo.Status != "published" && tourInfo.Status != "archived" {
+		return nil, ErrTourNotPublished
+	}
+
+	item, err := s.wishlistRepository.AddItem(&WishlistItem{
+		UserID:         userID,
+		TourID:         tourID,
+		TourName:       tourInfo.Name,
+		AuthorUsername: tourInfo.AuthorUsername,
+		LastPrice:      tourInfo.Price,
+		LastCurrency:   tourInfo.Currency,
+		LastStatus:     tourInfo.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	item.Tour = tourInfo
+	return item, nil
+}
+
+func (s *WishlistService) RemoveFromWishlist(userID string, tourID uint) error {
+	return s.wishlistRepository.DeleteItem(userID, tourID)
+}
+
+// GetWishlist returns the user's favourites with the tours as they are now.
+// Tours that cannot be fetched are listed without their live data.
+func (s *WishlistService) GetWishlist(userID string) ([]WishlistItem, error) {
+	items, err := s.wishlistRepository.GetItems(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		tourInfo, err := fetchTourInfo(items[i].TourID)
+		if err != nil {
+			log.Printf("Wishlist: no live data for tour %d: %v", items[i].TourID, err)
+			continue
+		}
+		items[i].Tour = tourInfo
+	}
+	return items, nil
+}
+
+// GetFavouriteCounts returns how many users favourited each of the author's
+// tours. Tours nobody favourited are left out.
+func (s *WishlistService) GetFavouriteCounts(author string) ([]TourFavouriteCount, error) {
+	return s.wishlistRepository.CountByAuthor(author)
+}
+
+// Start checks wishlisted tours every interval until ctx is cancelled.
+func (s *WishlistService) Start(ctx context.Context, interval time.Duration) {
+	log.Printf("Wishlist watcher running every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep records events for changed favourites and publishes pending
+// wishlist events. Failures are logged and retried on the next sweep.
+func (s *WishlistService) Sweep(ctx context.Context) {
+	recorded, err := s.CheckTours(time.Now())
+	if err != nil {
+		log.Printf("Wishlist sweep: failed to check tours: %v", err)
+	}
+
+	published, err := s.PublishPendingEvents(ctx)
+	if err != nil {
+		log.Printf("Wishlist sweep: failed to publish events: %v", err)
+	}
+
+	if recorded > 0 || published > 0 {
+		log.Printf("Wishlist sweep: %d events recorded, %d published", recorded, published)
+	}
+}
+
+// CheckTours compares every wishlisted tour with what its favourites last
+// saw of it and records an event for each user who should hear about a
+// change. Tours the tour service cannot return, or whose events cannot be
+// recorded, are logged and skipped until the next sweep.
+func (s *WishlistService) CheckTours(now time.Time) (int, error) {
+	tourIDs, err := s.wishlistRepository.GetTourIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	recorded := 0
+	for _, tourID := range tourIDs {
+		tourInfo, err := fetchTourInfo(tourID)
+		if err != nil {
+			if err != ErrTourNotFound {
+				log.Printf("Wishlist sweep: skipping tour %d: %v", tourID, err)
+			}
+			continue
+		}
+
+		events := 0
+		err = s.database.Transaction(func(tx *Database) error {
+			wishlistRepo := s.wishlistRepository.WithTx(tx)
+			eventRepo := s.eventRepository.WithTx(tx)
+
+			items, err := wishlistRepo.LockItemsByTour(tourID)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				event := wishlistEvent(&item, tourInfo, now)
+				if event == nil {
+					continue
+				}
+				err := eventRepo.CreateEvent(event)
+				if err != nil {
+					return err
+				}
+				events++
+			}
+			return wishlistRepo.UpdateTourSnapshot(tourID, tourInfo)
+		})
+		if err != nil {
+			log.Printf("Wishlist sweep: failed to record events for tour %d: %v", tourID, err)
+			continue
+		}
+		recorded += events
+	}
+	return recorded, nil
+}
+
+// wishlistEvent returns the event a favourite's owner should get now that
+// the tour looks like tourInfo, or nil. A tour that comes back on sale is
+// reported as such even if its price also dropped. Prices in different
+// currencies are not compared.
+func wishlistEvent(item *WishlistItem, tourInfo *TourInfo, now time.Time) *WishlistEvent {
+	if tourInfo.Status != "published" {
+		return nil
+	}
+
+	eventType := ""
+	switch {
+	case item.LastStatus != "published":
+		eventType = WishlistEventOnSale
+	case item.LastCurrency == tourInfo.Currency && tourInfo.Price < item.LastPrice:
+		eventType = WishlistEventPriceDropped
+	default:
+		return nil
+	}
+
+	return &WishlistEvent{
+		Type:       eventType,
+		UserID:     item.UserID,
+		TourID:     item.TourID,
+		TourName:   tourInfo.Name,
+		OldPrice:   item.LastPrice,
+		NewPrice:   tourInfo.Price,
+		Currency:   tourInfo.Currency,
+		OccurredAt: now,
+	}
+}
+
+// PublishPendingEvents hands queued wishlist events to the publisher in
+// order. It stops at the first failure so events are never delivered out of
+// order.
+func (s *WishlistService) PublishPendingEvents(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		events, err := s.eventRepository.GetUnpublishedEvents(sweepBatchSize)
+		if err != nil || len(events) == 0 {
+			return published, err
+		}
+
+		for i := range events {
+			err := s.publisher.Publish(ctx, &events[i])
+			if err != nil {
+				return published, err
+			}
+			err = s.eventRepository.MarkPublished(events[i].ID, time.Now())
+			if err != nil {
+				return published, err
+			}
+			published++
+		}
+	}
+}
@@ -22,13 +22,14 @@ func main() {
 	r.HandleFunc("/{id}", handler.UpdateReview).Methods(http.MethodPut)
 	r.HandleFunc("/{id}", handler.DeleteReview).Methods(http.MethodDelete)
 	r.HandleFunc("/my", handler.GetMyReviews).Methods(http.MethodGet)
-	
+
 	// Tour-specific review routes
 	r.HandleFunc("/tour/{tour_id}", handler.GetTourReviews).Methods(http.MethodGet)
 	r.HandleFunc("/tour/{tour_id}/rating", handler.GetTourRating).Methods(http.MethodGet)
 
 	// Health check
 	r.HandleFunc("/internal/ping", handler.Ping).Methods(http.MethodGet)
+	r.HandleFunc("/internal/export/{username}", handler.ExportUserData).Methods(http.MethodGet)
 
 	port := os.Getenv("PORT")
 	if port == "" {
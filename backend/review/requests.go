@@ -17,16 +17,16 @@ type UpdateReviewRequest struct {
 }
 
 type ReviewResponse struct {
-	ID              uint                `json:"id"`
-	TourID          uint                `json:"tour_id"`
-	TouristUsername string              `json:"tourist_username"`
-	Rating          int                 `json:"rating"`
-	Comment         string              `json:"comment"`
-	VisitDate       time.Time           `json:"visit_date"`
-	ReviewDate      time.Time           `json:"review_date"`
+	ID              uint                  `json:"id"`
+	TourID          uint                  `json:"tour_id"`
+	TouristUsername string                `json:"tourist_username"`
+	Rating          int                   `json:"rating"`
+	Comment         string                `json:"comment"`
+	VisitDate       time.Time             `json:"visit_date"`
+	ReviewDate      time.Time             `json:"review_date"`
 	Images          []ReviewImageResponse `json:"images"`
-	CreatedAt       time.Time           `json:"created_at"`
-	UpdatedAt       time.Time           `json:"updated_at"`
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
 }
 
 type ReviewImageResponse struct {
@@ -35,9 +35,15 @@ type ReviewImageResponse struct {
 }
 
 type ReviewListResponse struct {
-	Reviews      []ReviewResponse `json:"reviews"`
-	TotalCount   int64            `json:"total_count"`
-	AverageRating float64         `json:"average_rating"`
+	Reviews       []ReviewResponse `json:"reviews"`
+	TotalCount    int64            `json:"total_count"`
+	AverageRating float64          `json:"average_rating"`
+}
+
+// UserDataExport is the review service's part of a user's data export
+type UserDataExport struct {
+	Username string           `json:"username"`
+	Reviews  []ReviewResponse `json:"reviews"`
 }
 
 // ToResponse converts a Review model to ReviewResponse
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"authz"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 )
@@ -160,7 +162,8 @@ func (h *ReviewHandler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 	h.writeSuccessResponse(w, review.ToResponse(), http.StatusOK)
 }
 
-// DeleteReview deletes a review
+// DeleteReview deletes a review of the caller, or any review for callers
+// who moderate reviews
 func (h *ReviewHandler) DeleteReview(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 32)
@@ -175,7 +178,7 @@ func (h *ReviewHandler) DeleteReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.service.DeleteReview(uint(id), username)
+	err = h.service.DeleteReview(uint(id), username, authz.Has(r, authz.ReviewModerate))
 	if err != nil {
 		h.writeErrorResponse(w, NewAPIError(err.Error(), GetErrorStatusCode(err)))
 		return
@@ -216,6 +219,20 @@ func (h *ReviewHandler) Ping(w http.ResponseWriter, r *http.Request) {
 	h.writeSuccessResponse(w, response, http.StatusOK)
 }
 
+// ExportUserData returns the user's reviews for the data export. Internal
+// only: the username comes from the calling service, not a token.
+func (h *ReviewHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	export, err := h.service.ExportUserData(username)
+	if err != nil {
+		h.writeErrorResponse(w, NewAPIError(err.Error(), GetErrorStatusCode(err)))
+		return
+	}
+
+	h.writeSuccessResponse(w, export, http.StatusOK)
+}
+
 // Helper methods
 func (h *ReviewHandler) writeSuccessResponse(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -227,7 +244,7 @@ func (h *ReviewHandler) writeErrorResponse(w http.ResponseWriter, err APIError)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(err.StatusCode)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error":   err.Message,
-		"status":  err.StatusCode,
+		"error":  err.Message,
+		"status": err.StatusCode,
 	})
 }
@@ -66,6 +66,16 @@ func (r *ReviewRepository) GetReviewsByUsername(username string, limit, offset i
 	return reviews, totalCount, err
 }
 
+// GetAllReviewsByUsername returns every review the user wrote, newest first.
+func (r *ReviewRepository) GetAllReviewsByUsername(username string) ([]Review, error) {
+	var reviews []Review
+	err := r.database.Preload("Images").
+		Where("tourist_username = ?", username).
+		Order("review_date DESC").
+		Find(&reviews).Error
+	return reviews, err
+}
+
 func (r *ReviewRepository) UpdateReview(review *Review) error {
 	return r.database.Save(review).Error
 }
@@ -90,12 +100,12 @@ func (r *ReviewRepository) GetAverageRating(tourID uint) (float64, error) {
 	var avg struct {
 		Average float64
 	}
-	
+
 	err := r.database.Model(&Review{}).
 		Select("AVG(rating) as average").
 		Where("tour_id = ?", tourID).
 		Scan(&avg).Error
-	
+
 	return avg.Average, err
 }
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"time"
 )
 
@@ -126,6 +127,25 @@ func (s *ReviewService) GetReviewsByUsername(username string, page, pageSize int
 	}, nil
 }
 
+// ExportUserData collects everything the review service holds about a user,
+// for the data export.
+func (s *ReviewService) ExportUserData(username string) (*UserDataExport, error) {
+	reviews, err := s.repository.GetAllReviewsByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewResponses := make([]ReviewResponse, len(reviews))
+	for i, review := range reviews {
+		reviewResponses[i] = review.ToResponse()
+	}
+
+	return &UserDataExport{
+		Username: username,
+		Reviews:  reviewResponses,
+	}, nil
+}
+
 func (s *ReviewService) UpdateReview(id uint, req UpdateReviewRequest, username string) (*Review, error) {
 	review, err := s.repository.GetReviewByID(id)
 	if err != nil {
@@ -184,17 +204,22 @@ func (s *ReviewService) UpdateReview(id uint, req UpdateReviewRequest, username
 	return review, nil
 }
 
-func (s *ReviewService) DeleteReview(id uint, username string) error {
+// DeleteReview deletes a review of the user. Moderators can delete any
+// review.
+func (s *ReviewService) DeleteReview(id uint, username string, moderator bool) error {
 	review, err := s.repository.GetReviewByID(id)
 	if err != nil {
 		return err
 	}
 
 	// Check if user owns this review
-	if review.TouristUsername != username {
+	if review.TouristUsername != username && !moderator {
 		return ErrUnauthorizedReview
 	}
 
+	if review.TouristUsername != username {
+		log.Printf("Review %d by %s deleted by moderator %s", id, review.TouristUsername, username)
+	}
 	return s.repository.DeleteReview(id)
 }
 
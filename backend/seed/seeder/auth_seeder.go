@@ -23,6 +23,11 @@ func (s *AuthSeeder) Seed() {
 	for _, user := range data.Users {
 		if err := s.registerUser(user); err != nil {
 			log.Printf("Error registering user %s: %v\n", user["username"], err)
+			continue
+		}
+		// Seeded users have no mailbox to confirm their email with
+		if err := s.verifyUser(user); err != nil {
+			log.Printf("Error verifying user %s: %v\n", user["username"], err)
 		} else {
 			log.Printf("User %s registered successfully.\n", user["username"])
 		}
@@ -49,3 +54,22 @@ func (s *AuthSeeder) registerUser(user map[string]interface{}) error {
 
 	return nil
 }
+
+func (s *AuthSeeder) verifyUser(user map[string]interface{}) error {
+	resp, err := s.client.Post(
+		fmt.Sprintf("%s/internal/users/%s/verify", s.serviceURL, user["username"]),
+		"application/json",
+		nil,
+	)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to verify user %s, status code: %d", user["username"], resp.StatusCode)
+	}
+
+	return nil
+}
@@ -8,6 +8,8 @@ var (
 	ErrUsernameRequired         = errors.New("username is required")
 	ErrInvalidProfileData       = errors.New("invalid profile data")
 	ErrPositionNotFound         = errors.New("position not found")
+	ErrInvalidCurrency          = errors.New("currency must be a three letter ISO 4217 code")
+	ErrInvalidCountry           = errors.New("country must be a two letter ISO 3166 code")
 )
 
 const (
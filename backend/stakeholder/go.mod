@@ -26,3 +26,7 @@ require (
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 )
+
+require authz v0.0.0
+
+replace authz => ../authz
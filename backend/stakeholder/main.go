@@ -33,6 +33,8 @@ func main() {
 	// Internal routes
 	r.HandleFunc("/internal/ping", handler.Ping).Methods(http.MethodGet)
 	r.HandleFunc("/internal/user", handler.CreateStakeholderFromAuth).Methods(http.MethodPost)
+	r.HandleFunc("/internal/profile/{username}", handler.GetInternalProfile).Methods(http.MethodGet)
+	r.HandleFunc("/internal/export/{username}", handler.ExportUserData).Methods(http.MethodGet)
 
 	// Pokretanje RPC servera u goroutine
 	rpcServer := NewStakeholderRPCServer(service)
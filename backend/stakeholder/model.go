@@ -10,6 +10,8 @@ type Stakeholder struct {
 	ProfilePicture string    `json:"profile_picture"`
 	Biography      string    `json:"biography"`
 	Motto          string    `json:"motto"`
+	Currency       string    `json:"currency" gorm:"size:3"` // tourists pay in it, guides price tours in it
+	Country        string    `json:"country" gorm:"size:2"`  // ISO 3166-1 alpha-2, decides the tax on purchases
 	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 }
@@ -17,6 +17,8 @@ type UpdateProfileRequest struct {
 	ProfilePicture string `json:"profile_picture"`
 	Biography      string `json:"biography"`
 	Motto          string `json:"motto"`
+	Currency       string `json:"currency"`
+	Country        string `json:"country"`
 }
 
 type PositionUpdateRequest struct {
@@ -30,3 +32,11 @@ type PositionResponse struct {
 	Longitude float64   `json:"longitude"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// UserDataExport is the stakeholder service's part of a user's data export.
+// Profile and Position are null when the user has none.
+type UserDataExport struct {
+	Username string            `json:"username"`
+	Profile  *Stakeholder      `json:"profile"`
+	Position *PositionResponse `json:"position"`
+}
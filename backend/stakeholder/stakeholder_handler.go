@@ -9,7 +9,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	"authz"
+
 	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
 )
 
 type StakeholderHandler struct {
@@ -99,6 +102,8 @@ func (h *StakeholderHandler) UpdateProfile(w http.ResponseWriter, r *http.Reques
 		req.LastName = r.FormValue("last_name")
 		req.Biography = r.FormValue("biography")
 		req.Motto = r.FormValue("motto")
+		req.Currency = r.FormValue("currency")
+		req.Country = r.FormValue("country")
 
 		// Handle file upload if present
 		file, header, err := r.FormFile("profile_picture")
@@ -153,7 +158,32 @@ func (h *StakeholderHandler) UpdateProfile(w http.ResponseWriter, r *http.Reques
 		req.ProfilePicture,
 		req.Biography,
 		req.Motto,
+		strings.ToUpper(req.Currency),
+		strings.ToUpper(req.Country),
 	)
+	if err != nil {
+		if err == ErrInvalidCurrency || err == ErrInvalidCountry {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "profile not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stakeholder)
+}
+
+// GetInternalProfile returns a user's profile to other services, which use it
+// for details such as the user's currency and country.
+func (h *StakeholderHandler) GetInternalProfile(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	stakeholder, err := h.service.GetStakeholderProfile(username)
 	if err != nil {
 		if err.Error() == "profile not found" {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -167,6 +197,37 @@ func (h *StakeholderHandler) UpdateProfile(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(stakeholder)
 }
 
+// ExportUserData returns the user's profile and last known position for the
+// user's data export.
+func (h *StakeholderHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	export := UserDataExport{Username: username}
+
+	stakeholder, err := h.service.GetStakeholderProfile(username)
+	if err != nil && err.Error() != "profile not found" {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	export.Profile = stakeholder
+
+	position, err := h.service.GetTouristPosition(username)
+	if err != nil && err != ErrPositionNotFound {
+		http.Error(w, "Failed to get position: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if position != nil {
+		export.Position = &PositionResponse{
+			Username:  position.Username,
+			Latitude:  position.Latitude,
+			Longitude: position.Longitude,
+			UpdatedAt: position.UpdatedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
 func (h *StakeholderHandler) Ping(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Stakeholder service is running"))
@@ -213,11 +274,10 @@ func (h *StakeholderHandler) CreateStakeholderFromAuth(w http.ResponseWriter, r
 
 func (h *StakeholderHandler) UpdatePosition(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	// Check if user is a tourist
-	if userRole != "tourist" {
-		http.Error(w, "Only tourists can update their position", http.StatusForbidden)
+	// The position is tracked while taking tours
+	if !authz.Has(r, authz.TourExecute) {
+		http.Error(w, "forbidden: requires permission "+authz.TourExecute, http.StatusForbidden)
 		return
 	}
 
@@ -252,11 +312,10 @@ func (h *StakeholderHandler) UpdatePosition(w http.ResponseWriter, r *http.Reque
 
 func (h *StakeholderHandler) GetPosition(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	// Check if user is a tourist
-	if userRole != "tourist" {
-		http.Error(w, "Only tourists can get their position", http.StatusForbidden)
+	// The position is tracked while taking tours
+	if !authz.Has(r, authz.TourExecute) {
+		http.Error(w, "forbidden: requires permission "+authz.TourExecute, http.StatusForbidden)
 		return
 	}
 
@@ -286,10 +345,10 @@ func (h *StakeholderHandler) GetPosition(w http.ResponseWriter, r *http.Request)
 }
 func (h *StakeholderHandler) DeletePosition(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	if userRole != "tourist" {
-		http.Error(w, "Only tourists can delete their position", http.StatusForbidden)
+	// The position is tracked while taking tours
+	if !authz.Has(r, authz.TourExecute) {
+		http.Error(w, "forbidden: requires permission "+authz.TourExecute, http.StatusForbidden)
 		return
 	}
 
@@ -2,10 +2,14 @@ package main
 
 import (
 	"errors"
+	"regexp"
 
 	"gorm.io/gorm"
 )
 
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
 type StakeholderService struct {
 	repository *StakeholderRepository
 }
@@ -45,7 +49,14 @@ func (s *StakeholderService) GetStakeholderProfile(username string) (*Stakeholde
 	return stakeholder, nil
 }
 
-func (s *StakeholderService) UpdateStakeholderProfile(username, firstName, lastName, profilePicture, biography, motto string) (*Stakeholder, error) {
+func (s *StakeholderService) UpdateStakeholderProfile(username, firstName, lastName, profilePicture, biography, motto, currency, country string) (*Stakeholder, error) {
+	if currency != "" && !currencyCodePattern.MatchString(currency) {
+		return nil, ErrInvalidCurrency
+	}
+	if country != "" && !countryCodePattern.MatchString(country) {
+		return nil, ErrInvalidCountry
+	}
+
 	stakeholder, err := s.repository.GetByUsername(username)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -70,6 +81,12 @@ func (s *StakeholderService) UpdateStakeholderProfile(username, firstName, lastN
 	if motto != "" {
 		stakeholder.Motto = motto
 	}
+	if currency != "" {
+		stakeholder.Currency = currency
+	}
+	if country != "" {
+		stakeholder.Country = country
+	}
 
 	err = s.repository.Update(stakeholder)
 	if err != nil {
@@ -3,7 +3,12 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"sort"
+	"strings"
+
+	"money"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -27,11 +32,63 @@ func InitDatabase() *gorm.DB {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	err = migrateTourPrices(db)
+	if err != nil {
+		log.Fatalf("Failed to migrate tour prices: %v", err)
+	}
+
 	db.AutoMigrate(&Tour{}, &KeyPoint{}, &TourExecution{}, &KeyPointCompletion{})
 
+	// Tours priced before currencies existed are in the default currency
+	db.Model(&Tour{}).Where("currency IS NULL OR currency = ''").Update("currency", defaultCurrency())
+
 	return db
 }
 
+// migrateTourPrices moves the old float price column to price_minor, in
+// minor units of each tour's currency, or of the default currency for tours
+// from before currencies. Both steps run in one transaction, so a failed
+// conversion does not leave a renamed column of float prices behind.
+func migrateTourPrices(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Tour{}, "price") || db.Migrator().HasColumn(&Tour{}, "price_minor") {
+		return nil
+	}
+
+	scale := tourPriceScale(db.Migrator().HasColumn(&Tour{}, "currency"))
+
+	log.Println("Migrating tours.price to price_minor")
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().RenameColumn(&Tour{}, "price", "price_minor")
+		if err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf("ALTER TABLE tours ALTER COLUMN price_minor TYPE bigint USING ROUND(price_minor * %s)", scale)).Error
+	})
+}
+
+// tourPriceScale is the SQL factor from major to minor units of a tour's
+// price. Without a currency column every tour is in the default currency.
+func tourPriceScale(hasCurrency bool) string {
+	fallback := defaultCurrency()
+	if !hasCurrency {
+		return fmt.Sprint(math.Pow10(money.MinorUnitExponent(fallback)))
+	}
+
+	currencies := make([]string, 0, len(money.Exponents))
+	for currency := range money.Exponents {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	var scale strings.Builder
+	fmt.Fprintf(&scale, "CASE COALESCE(NULLIF(currency, ''), '%s')", fallback)
+	for _, currency := range currencies {
+		fmt.Fprintf(&scale, " WHEN '%s' THEN %v", currency, math.Pow10(money.MinorUnitExponent(currency)))
+	}
+	fmt.Fprintf(&scale, " ELSE %v END", math.Pow10(money.MinorUnitExponent("")))
+	return scale.String()
+}
+
 func SeedTour(db *gorm.DB) {
 	var count int64
 	db.Model(&Tour{}).Count(&count)
@@ -47,7 +104,8 @@ func SeedTour(db *gorm.DB) {
 			Difficulty:  DifficultyEasy,
 			Tags:        "city,culture,history",
 			Status:      TourStatusDraft,
-			Price:       0,
+			PriceMinor:  0,
+			Currency:    defaultCurrency(),
 			TransportDetails: []Transport{
 				{
 					TransportType: TransportDriving,
@@ -80,7 +138,8 @@ func SeedTour(db *gorm.DB) {
 			Difficulty:       DifficultyMedium,
 			Tags:             "culture,fortress,danube",
 			Status:           TourStatusDraft,
-			Price:            0,
+			PriceMinor:       0,
+			Currency:         defaultCurrency(),
 			AuthorUsername:   "guide1",
 			TransportDetails: []Transport{},
 			KeyPoints: []KeyPoint{
@@ -14,7 +14,7 @@ func main() {
 	SeedTour(database)
 
 	repository := &TourRepository{database: database}
-	service := &TourService{repository: repository}
+	service := &TourService{repository: repository, purchases: NewPurchaseClient()}
 	handler := &TourHandler{service: service}
 
 	r.HandleFunc("/", handler.CreateTour).Methods(http.MethodPost)
@@ -36,6 +36,7 @@ func main() {
 	r.HandleFunc("/{id}/unarchive", handler.UnarchiveTour).Methods(http.MethodPut)
 
 	r.HandleFunc("/internal/ping", handler.Ping).Methods(http.MethodGet)
+	r.HandleFunc("/internal/export/{username}", handler.ExportUserData).Methods(http.MethodGet)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"math"
 	"time"
 
+	"money"
+
 	"gorm.io/gorm"
 )
 
@@ -13,7 +17,8 @@ type Tour struct {
 	Difficulty       string         `json:"difficulty" validate:"required"`
 	Tags             string         `json:"tags" validate:"required"`
 	Status           string         `json:"status" gorm:"default:'draft'"`
-	Price            float64        `json:"price" gorm:"default:0"`
+	PriceMinor       int64          `json:"price_minor" gorm:"default:0"` // in minor units of Currency
+	Currency         string         `json:"currency" gorm:"size:3"`
 	TransportDetails []Transport    `json:"transport_details" gorm:"type:jsonb;serializer:json"`
 	Distance         float64        `json:"distance" gorm:"default:0"`
 	AuthorUsername   string         `json:"author_username" gorm:"not null"`
@@ -23,6 +28,27 @@ type Tour struct {
 	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// MarshalJSON adds the deprecated price, in major units of Currency, for
+// clients from before price_minor. It will be dropped once they have moved.
+func (t Tour) MarshalJSON() ([]byte, error) {
+	type tour Tour
+	return json.Marshal(struct {
+		tour
+		Price float64 `json:"price"`
+	}{tour(t), majorUnits(t.PriceMinor, t.Currency)})
+}
+
+// majorUnits turns minor units of currency into a decimal amount.
+func majorUnits(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(money.MinorUnitExponent(currency))
+}
+
+// minorUnits turns a decimal amount of currency into minor units, rounding
+// half away from zero.
+func minorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(money.MinorUnitExponent(currency))))
+}
+
 type Transport struct {
 	Duration      uint   `json:"duration"`
 	TransportType string `json:"transport_type"`
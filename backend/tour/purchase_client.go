@@ -0,0 +1,62 @@
+package main
+
+//go:generate protoc -I ../purchase --go_out=. --go-grpc_out=. ../purchase/purchase.proto
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"tour/purchasepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// purchaseCallTimeout is the deadline for each call to the purchase service.
+const purchaseCallTimeout = 5 * time.Second
+
+// NewPurchaseClient returns a client for the purchase service's gRPC server.
+// The connection is made on first use and re-established when it drops.
+func NewPurchaseClient() purchasepb.PurchaseServiceClient {
+	purchaseHost := os.Getenv("PURCHASE_SERVICE_HOST")
+	purchasePort := os.Getenv("PURCHASE_GRPC_PORT")
+	if purchaseHost == "" {
+		purchaseHost = "purchase-service"
+	}
+	if purchasePort == "" {
+		purchasePort = "3015"
+	}
+
+	conn, err := grpc.NewClient(fmt.Sprintf("%s:%s", purchaseHost, purchasePort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to create purchase gRPC client: %v", err)
+	}
+	return purchasepb.NewPurchaseServiceClient(conn)
+}
+
+func (service *TourService) checkTourPurchase(userID string, tourID uint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), purchaseCallTimeout)
+	defer cancel()
+
+	_, err := service.purchases.ValidateAccess(ctx, &purchasepb.ValidateAccessRequest{
+		Username: userID,
+		TourId:   uint64(tourID),
+	})
+	if err != nil {
+		// Missing, expired, refunded or otherwise revoked purchases all deny access
+		switch status.Code(err) {
+		case codes.NotFound, codes.FailedPrecondition, codes.InvalidArgument:
+			return ErrTourNotPurchased
+		}
+		fmt.Printf("Failed to validate purchase of tour %d for user %s: %v\n", tourID, userID, err)
+		return fmt.Errorf("failed to validate purchase: %w", err)
+	}
+
+	fmt.Printf("Tour purchase validated successfully for user %s and tour %d\n", userID, tourID)
+	return nil
+}
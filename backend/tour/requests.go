@@ -11,7 +11,7 @@ type CreateTourRequest struct {
 	KeyPoints        []CreateKeyPointRequest `json:"key_points"`
 	Distance         float64                 `json:"distance"`
 	Status           string                  `json:"status"`
-	Price            float64                 `json:"price"`
+	PriceMinor       int64                   `json:"price_minor"`
 }
 
 type UpdateTourRequest struct {
@@ -20,7 +20,8 @@ type UpdateTourRequest struct {
 	Difficulty       string                  `json:"difficulty" validate:"omitempty,oneof=easy medium hard"`
 	Tags             string                  `json:"tags"`
 	TransportDetails []Transport             `json:"transport_details"`
-	Price            float64                 `json:"price" validate:"omitempty,gt=0"`
+	PriceMinor       int64                   `json:"price_minor" validate:"omitempty,gt=0"`
+	Price            *float64                `json:"price,omitempty" validate:"omitempty,gt=0"` // deprecated, major units, used without PriceMinor
 	KeyPoints        []CreateKeyPointRequest `json:"key_points"`
 	Distance         float64                 `json:"distance"`
 	Status           string                  `json:"status"`
@@ -42,7 +43,9 @@ type CreateTourResponse struct {
 	Difficulty     string     `json:"difficulty"`
 	Tags           string     `json:"tags"`
 	Status         string     `json:"status"`
-	Price          float64    `json:"price"`
+	PriceMinor     int64      `json:"price_minor"`
+	Price          float64    `json:"price"` // deprecated, major units of Currency
+	Currency       string     `json:"currency"`
 	Distance       float64    `json:"distance"`
 	KeyPoints      []KeyPoint `json:"key_points"`
 	AuthorUsername string     `json:"author_username"`
@@ -125,3 +128,10 @@ type CheckProximityResponse struct {
 	LastActivity       time.Time           `json:"last_activity"`
 	Message            string              `json:"message"`
 }
+
+// UserDataExport is the tour service's part of a user's data export
+type UserDataExport struct {
+	Username   string          `json:"username"`
+	Tours      []Tour          `json:"tours"`
+	Executions []TourExecution `json:"executions"`
+}
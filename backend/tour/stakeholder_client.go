@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+func defaultCurrency() string {
+	currency := os.Getenv("DEFAULT_CURRENCY")
+	if currency == "" {
+		currency = "EUR"
+	}
+	return currency
+}
+
+// guideCurrency returns the base currency the guide prices tours in. When
+// the guide has not set one, or the stakeholder service cannot be reached,
+// the default currency is used.
+func (service *TourService) guideCurrency(username string) string {
+	stakeholderURL := os.Getenv("STAKEHOLDER_SERVICE_URL")
+	if stakeholderURL == "" {
+		stakeholderURL = "http://stakeholder-service:3003"
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%s/internal/profile/%s", stakeholderURL, username))
+	if err != nil {
+		fmt.Printf("Failed to fetch currency for guide %s: %v\n", username, err)
+		return defaultCurrency()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return defaultCurrency()
+	}
+
+	var profile struct {
+		Currency string `json:"currency"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil || profile.Currency == "" {
+		return defaultCurrency()
+	}
+	return profile.Currency
+}
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"authz"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 )
@@ -19,7 +21,6 @@ var validate = validator.New()
 
 func (h *TourHandler) CreateTour(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
 	var request CreateTourRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -32,9 +33,9 @@ func (h *TourHandler) CreateTour(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a guide (author)
-	if userRole != RoleGuide {
-		h.sendErrorResponse(w, "Only guides can create tours", http.StatusForbidden)
+	// Check if user may author tours
+	if !authz.Has(r, authz.TourWrite) {
+		h.sendErrorResponse(w, "You are not allowed to create tours", http.StatusForbidden)
 		return
 	}
 
@@ -51,7 +52,9 @@ func (h *TourHandler) CreateTour(w http.ResponseWriter, r *http.Request) {
 		Difficulty:     tour.Difficulty,
 		Tags:           tour.Tags,
 		Status:         tour.Status,
-		Price:          tour.Price,
+		PriceMinor:     tour.PriceMinor,
+		Price:          majorUnits(tour.PriceMinor, tour.Currency),
+		Currency:       tour.Currency,
 		Distance:       tour.Distance,
 		KeyPoints:      tour.KeyPoints,
 		AuthorUsername: tour.AuthorUsername,
@@ -65,7 +68,6 @@ func (h *TourHandler) CreateTour(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) UpdateTour(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -86,9 +88,9 @@ func (h *TourHandler) UpdateTour(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a guide (author)
-	if userRole != RoleGuide {
-		h.sendErrorResponse(w, "Only guides can update tours", http.StatusForbidden)
+	// Check if user may author tours
+	if !authz.Has(r, authz.TourWrite) {
+		h.sendErrorResponse(w, "You are not allowed to update tours", http.StatusForbidden)
 		return
 	}
 
@@ -117,7 +119,9 @@ func (h *TourHandler) UpdateTour(w http.ResponseWriter, r *http.Request) {
 		Difficulty:     tour.Difficulty,
 		Tags:           tour.Tags,
 		Status:         tour.Status,
-		Price:          tour.Price,
+		PriceMinor:     tour.PriceMinor,
+		Price:          majorUnits(tour.PriceMinor, tour.Currency),
+		Currency:       tour.Currency,
 		Distance:       tour.Distance,
 		KeyPoints:      tour.KeyPoints,
 		AuthorUsername: tour.AuthorUsername,
@@ -131,11 +135,10 @@ func (h *TourHandler) UpdateTour(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) GetMyTours(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	// Check if user is a guide (author)
-	if userRole != RoleGuide {
-		h.sendErrorResponse(w, "Only guides can access their tours", http.StatusForbidden)
+	// Check if user may author tours
+	if !authz.Has(r, authz.TourWrite) {
+		h.sendErrorResponse(w, "You are not allowed to access your tours", http.StatusForbidden)
 		return
 	}
 
@@ -195,7 +198,6 @@ func (h *TourHandler) GetTourByID(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) CreateKeyPoint(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -216,9 +218,9 @@ func (h *TourHandler) CreateKeyPoint(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a guide (author)
-	if userRole != RoleGuide {
-		h.sendErrorResponse(w, "Only guides can create key points", http.StatusForbidden)
+	// Check if user may author tours
+	if !authz.Has(r, authz.TourWrite) {
+		h.sendErrorResponse(w, "You are not allowed to create key points", http.StatusForbidden)
 		return
 	}
 
@@ -257,7 +259,6 @@ func (h *TourHandler) CreateKeyPoint(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) PublishTour(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -268,9 +269,15 @@ func (h *TourHandler) PublishTour(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a guide (author)
-	if userRole != RoleGuide {
-		h.sendErrorResponse(w, "Only guides can publish tours", http.StatusForbidden)
+	// Check if user may publish tours
+	if !authz.Has(r, authz.TourPublish) {
+		h.sendErrorResponse(w, "You are not allowed to publish tours", http.StatusForbidden)
+		return
+	}
+
+	// Set by the gateway from the access token
+	if r.Header.Get("x-email-verified") != "true" {
+		h.sendErrorResponse(w, "Verify your email before publishing tours", http.StatusForbidden)
 		return
 	}
 
@@ -294,7 +301,6 @@ func (h *TourHandler) PublishTour(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) ArchiveTour(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -305,9 +311,9 @@ func (h *TourHandler) ArchiveTour(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a guide (author)
-	if userRole != RoleGuide {
-		h.sendErrorResponse(w, "Only guides can archive tours", http.StatusForbidden)
+	// Check if user may publish tours
+	if !authz.Has(r, authz.TourPublish) {
+		h.sendErrorResponse(w, "You are not allowed to archive tours", http.StatusForbidden)
 		return
 	}
 
@@ -331,7 +337,6 @@ func (h *TourHandler) ArchiveTour(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) UnarchiveTour(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -342,9 +347,9 @@ func (h *TourHandler) UnarchiveTour(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a guide (author)
-	if userRole != RoleGuide {
-		h.sendErrorResponse(w, "Only guides can unarchive tours", http.StatusForbidden)
+	// Check if user may publish tours
+	if !authz.Has(r, authz.TourPublish) {
+		h.sendErrorResponse(w, "You are not allowed to unarchive tours", http.StatusForbidden)
 		return
 	}
 
@@ -368,10 +373,9 @@ func (h *TourHandler) UnarchiveTour(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) StartTourExecution(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	if userRole != RoleTourist {
-		h.sendErrorResponse(w, "Only tourists can execute tours", http.StatusForbidden)
+	if !authz.Has(r, authz.TourExecute) {
+		h.sendErrorResponse(w, "You are not allowed to execute tours", http.StatusForbidden)
 		return
 	}
 
@@ -415,10 +419,9 @@ func (h *TourHandler) StartTourExecution(w http.ResponseWriter, r *http.Request)
 
 func (h *TourHandler) GetActiveTourExecution(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	if userRole != RoleTourist {
-		h.sendErrorResponse(w, "Only tourists can access tour executions", http.StatusForbidden)
+	if !authz.Has(r, authz.TourExecute) {
+		h.sendErrorResponse(w, "You are not allowed to access tour executions", http.StatusForbidden)
 		return
 	}
 
@@ -435,10 +438,9 @@ func (h *TourHandler) GetActiveTourExecution(w http.ResponseWriter, r *http.Requ
 
 func (h *TourHandler) EndTourExecution(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	if userRole != RoleTourist {
-		h.sendErrorResponse(w, "Only tourists can end tour executions", http.StatusForbidden)
+	if !authz.Has(r, authz.TourExecute) {
+		h.sendErrorResponse(w, "You are not allowed to end tour executions", http.StatusForbidden)
 		return
 	}
 
@@ -483,10 +485,9 @@ func (h *TourHandler) EndTourExecution(w http.ResponseWriter, r *http.Request) {
 
 func (h *TourHandler) CheckProximity(w http.ResponseWriter, r *http.Request) {
 	username := r.Header.Get("x-username")
-	userRole := r.Header.Get("x-user-role")
 
-	if userRole != RoleTourist {
-		h.sendErrorResponse(w, "Only tourists can check proximity", http.StatusForbidden)
+	if !authz.Has(r, authz.TourExecute) {
+		h.sendErrorResponse(w, "You are not allowed to check proximity", http.StatusForbidden)
 		return
 	}
 
@@ -520,15 +521,11 @@ func (h *TourHandler) CheckProximity(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *TourHandler) GetExecutableToursForTourist(w http.ResponseWriter, r *http.Request) {
-	userRole := r.Header.Get("x-user-role")
 	username := r.Header.Get("x-username")
 
-	// Debug logging
-	log.Printf("GetExecutableToursForTourist - userRole: '%s', username: '%s'", userRole, username)
-
-	if userRole != RoleTourist {
-		log.Printf("Access denied - expected '%s', got '%s'", RoleTourist, userRole)
-		h.sendErrorResponse(w, "Only tourists can access executable tours", http.StatusForbidden)
+	if !authz.Has(r, authz.TourExecute) {
+		log.Printf("Access denied - missing permission %s", authz.TourExecute)
+		h.sendErrorResponse(w, "You are not allowed to access executable tours", http.StatusForbidden)
 		return
 	}
 
@@ -550,6 +547,22 @@ func (h *TourHandler) GetExecutableToursForTourist(w http.ResponseWriter, r *htt
 	json.NewEncoder(w).Encode(response)
 }
 
+// ExportUserData returns the user's tours and executions for the data
+// export. Internal only: the username comes from the calling service.
+func (h *TourHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	export, err := h.service.ExportUserData(username)
+	if err != nil {
+		h.sendErrorResponse(w, "Failed to export user data: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(export)
+}
+
 func (h *TourHandler) Ping(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -75,6 +75,17 @@ func (repo *TourRepository) GetActiveTourExecution(touristUsername string) (*Tou
 	return &execution, nil
 }
 
+// GetTourExecutionsByTourist returns all of a tourist's executions, newest
+// first.
+func (repo *TourRepository) GetTourExecutionsByTourist(touristUsername string) ([]TourExecution, error) {
+	var executions []TourExecution
+	result := repo.database.Preload("KeyPointCompletions").
+		Where("tourist_username = ?", touristUsername).
+		Order("start_time DESC").
+		Find(&executions)
+	return executions, result.Error
+}
+
 func (repo *TourRepository) GetTourExecutionByID(id uint) (*TourExecution, error) {
 	var execution TourExecution
 	result := repo.database.Preload("KeyPointCompletions").First(&execution, id)
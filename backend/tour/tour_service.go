@@ -8,10 +8,13 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"tour/purchasepb"
 )
 
 type TourService struct {
 	repository *TourRepository
+	purchases  purchasepb.PurchaseServiceClient
 }
 
 func (service *TourService) CreateTour(request *CreateTourRequest, authorUsername string) (*Tour, error) {
@@ -39,7 +42,8 @@ func (service *TourService) CreateTour(request *CreateTourRequest, authorUsernam
 		Difficulty:       request.Difficulty,
 		Tags:             strings.TrimSpace(request.Tags),
 		Status:           TourStatusDraft,
-		Price:            0, // Always 0 for draft
+		PriceMinor:       0, // Always 0 for draft
+		Currency:         service.guideCurrency(authorUsername),
 		AuthorUsername:   authorUsername,
 		TransportDetails: request.TransportDetails,
 		Distance:         request.Distance,
@@ -90,7 +94,12 @@ func (service *TourService) UpdateTour(id uint, request *UpdateTourRequest, auth
 	tour.Description = request.Description
 	tour.Difficulty = request.Difficulty
 	tour.Tags = strings.TrimSpace(request.Tags)
-	tour.Price = request.Price
+	// The price is entered in the tour's own currency, which stays the one
+	// the tour was created in even if the guide's base currency changed since
+	tour.PriceMinor = request.PriceMinor
+	if request.PriceMinor == 0 && request.Price != nil {
+		tour.PriceMinor = minorUnits(*request.Price, tour.Currency)
+	}
 	tour.Distance = request.Distance
 
 	if request.TransportDetails != nil {
@@ -141,12 +150,12 @@ func (service *TourService) UpdateTour(id uint, request *UpdateTourRequest, auth
 	// Update the tour itself (without trying to save associations again)
 	// Note: We don't include transport_details in Select/Updates to avoid JSONB serialization issues
 	// GORM will handle it properly when we save the entire model
-	result = tx.Model(&tour).Select("name", "description", "difficulty", "tags", "price", "distance").Updates(map[string]interface{}{
+	result = tx.Model(&tour).Select("name", "description", "difficulty", "tags", "price_minor", "distance").Updates(map[string]interface{}{
 		"name":        tour.Name,
 		"description": tour.Description,
 		"difficulty":  tour.Difficulty,
 		"tags":        tour.Tags,
-		"price":       tour.Price,
+		"price_minor": tour.PriceMinor,
 		"distance":    tour.Distance,
 	})
 	if result.Error != nil {
@@ -348,6 +357,25 @@ func isValidDifficulty(difficulty string) bool {
 	return false
 }
 
+// ExportUserData collects the tours the user wrote and the tours they went
+// on, for the data export.
+func (service *TourService) ExportUserData(username string) (*UserDataExport, error) {
+	tours, err := service.repository.GetToursByAuthor(username)
+	if err != nil {
+		return nil, err
+	}
+	executions, err := service.repository.GetTourExecutionsByTourist(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserDataExport{
+		Username:   username,
+		Tours:      tours,
+		Executions: executions,
+	}, nil
+}
+
 // TourExecution Service Methods
 
 const ProximityThresholdMeters = 1000.0 // 1 km proximity threshold for simulation
@@ -374,6 +402,7 @@ func (service *TourService) StartTourExecution(request *StartTourExecutionReques
 		if err == ErrTourNotPurchased {
 			return nil, errors.New("tour must be purchased before execution")
 		}
+		return nil, errors.New("could not verify tour purchase")
 	}
 
 	// Create new tour execution
@@ -416,7 +445,16 @@ func (service *TourService) EndTourExecution(executionID uint, status string, to
 		return nil, errors.New("invalid end status")
 	}
 
-	return service.repository.EndTourExecution(executionID, status)
+	ended, err := service.repository.EndTourExecution(executionID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == ExecutionStatusCompleted {
+		service.reportTourCompleted(touristUsername, execution.TourID)
+	}
+
+	return ended, nil
 }
 
 func (service *TourService) CheckProximity(executionID uint, latitude, longitude float64, touristUsername string) (*CheckProximityResponse, error) {
@@ -561,10 +599,11 @@ func (service *TourService) getPurchasedTourIds(userID string) ([]uint, error) {
 	// Parse response
 	var tokensResponse struct {
 		Tokens []struct {
-			ID       uint   `json:"id"`
-			TourID   uint   `json:"tour_id"`
-			TourName string `json:"tour_name"`
-			Status   string `json:"status"`
+			ID        uint      `json:"id"`
+			TourID    uint      `json:"tour_id"`
+			TourName  string    `json:"tour_name"`
+			Status    string    `json:"status"`
+			ExpiresAt time.Time `json:"expires_at"`
 		} `json:"tokens"`
 		Message string `json:"message"`
 	}
@@ -575,10 +614,12 @@ func (service *TourService) getPurchasedTourIds(userID string) ([]uint, error) {
 		return nil, fmt.Errorf("failed to parse purchase response: %w", err)
 	}
 
-	// Extract tour IDs from valid/active tokens
+	// Extract tour IDs from valid tokens, used ones keep access until they
+	// expire. The purchase service only marks them expired when it sweeps.
 	var tourIds []uint
+	now := time.Now()
 	for _, token := range tokensResponse.Tokens {
-		if token.Status == "active" {
+		if (token.Status == "active" || token.Status == "used") && now.Before(token.ExpiresAt) {
 			tourIds = append(tourIds, token.TourID)
 		}
 	}
@@ -587,7 +628,10 @@ func (service *TourService) getPurchasedTourIds(userID string) ([]uint, error) {
 	return tourIds, nil
 }
 
-func (service *TourService) checkTourPurchase(userID string, tourID uint) error {
+// reportTourCompleted tells the purchase service the tourist completed the
+// tour, so their purchase token is marked used. It is best effort: a failure
+// is logged and does not undo the completed execution.
+func (service *TourService) reportTourCompleted(userID string, tourID uint) {
 	purchaseHost := os.Getenv("PURCHASE_SERVICE_HOST")
 	purchasePort := os.Getenv("PURCHASE_SERVICE_PORT")
 	if purchaseHost == "" {
@@ -597,34 +641,21 @@ func (service *TourService) checkTourPurchase(userID string, tourID uint) error
 		purchasePort = "8084"
 	}
 
-	purchaseURL := fmt.Sprintf("http://%s:%s/validate/%d", purchaseHost, purchasePort, tourID)
-
-	req, err := http.NewRequest(http.MethodGet, purchaseURL, nil)
-	if err != nil {
-		fmt.Printf("Failed to create purchase validation request: %v\n", err)
-		return fmt.Errorf("failed to validate purchase: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-username", userID)
+	purchaseURL := fmt.Sprintf("http://%s:%s/internal/tokens/used", purchaseHost, purchasePort)
+	payload, _ := json.Marshal(map[string]interface{}{
+		"username": userID,
+		"tour_id":  tourID,
+	})
 
 	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := client.Post(purchaseURL, "application/json", strings.NewReader(string(payload)))
 	if err != nil {
-		fmt.Printf("Failed to call purchase service: %v\n", err)
-		return fmt.Errorf("failed to validate purchase: %w", err)
+		fmt.Printf("Failed to report completed tour %d for user %s: %v\n", tourID, userID, err)
+		return
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-
-		return ErrTourNotPurchased
-	} else if resp.StatusCode >= 300 {
-
-		fmt.Printf("Purchase service returned error status: %d\n", resp.StatusCode)
-		return fmt.Errorf("purchase validation failed with status: %d", resp.StatusCode)
+	if resp.StatusCode >= 300 {
+		fmt.Printf("Purchase service returned status %d when reporting completed tour %d for user %s\n", resp.StatusCode, tourID, userID)
 	}
-
-	fmt.Printf("Tour purchase validated successfully for user %s and tour %d\n", userID, tourID)
-	return nil
 }
@@ -4,10 +4,13 @@ import Home from '../views/Home.vue'
 import Tours from '../views/Tours.vue'
 import TourEditor from '../views/TourEditor.vue'
 import Login from '../views/Login.vue'
+import ResetPassword from '../views/ResetPassword.vue'
+import VerifyEmail from '../views/VerifyEmail.vue'
 import Profile from '../views/Profile.vue'
 import Users from '../views/Users.vue'
 import ShoppingCart from '../views/ShoppingCart.vue'
 import PurchasedTours from '../views/PurchasedTours.vue'
+import Wishlist from '../views/Wishlist.vue'
 import BlogList from '../views/BlogList.vue'
 import CreateBlog from '../views/CreateBlog.vue'
 import PositionSimulator from '../views/PositionSimulator.vue'
@@ -44,6 +47,16 @@ const routes = [
     component: Login,
     meta: { requiresGuest: true }
   },
+  {
+    path: '/reset-password',
+    name: 'ResetPassword',
+    component: ResetPassword
+  },
+  {
+    path: '/verify-email',
+    name: 'VerifyEmail',
+    component: VerifyEmail
+  },
   {
     path: '/profile',
     name: 'Profile',
@@ -60,7 +73,7 @@ const routes = [
     path: '/users',
     name: 'Users',
     component: Users,
-    meta: { requiresAuth: true, requiresAdmin: true }
+    meta: { requiresAuth: true, requiresPermission: 'user:read' }
   },
   {
     path: '/cart',
@@ -68,6 +81,12 @@ const routes = [
     component: ShoppingCart,
     meta: { requiresAuth: true, requiresTourist: true }
   },
+  {
+    path: '/wishlist',
+    name: 'Wishlist',
+    component: Wishlist,
+    meta: { requiresAuth: true, requiresTourist: true }
+  },
   {
     path: '/purchases',
     name: 'PurchasedTours',
@@ -121,6 +140,12 @@ router.beforeEach((to, from, next) => {
     return
   }
 
+  // Check if route requires a permission of the user's role
+  if (to.meta.requiresPermission && !userStore.hasPermission(to.meta.requiresPermission)) {
+    next('/')
+    return
+  }
+
   // Check if route requires guide or admin privileges
   if (to.meta.requiresGuideOrAdmin && !userStore.canCreateTours) {
     next('/')
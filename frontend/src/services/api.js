@@ -25,16 +25,53 @@ api.interceptors.request.use(
   }
 )
 
+// Access tokens are short-lived; one refresh is shared by all requests that
+// failed while it was running
+let refreshing = null
+
+export const refreshAccessToken = async () => {
+  const refreshToken = localStorage.getItem('refresh_token')
+  if (!refreshToken) {
+    throw new Error('No refresh token')
+  }
+
+  // Plain axios so a failed refresh does not trigger another one
+  const response = await axios.post(`${api.defaults.baseURL}/api/auth/refresh`, { refresh_token: refreshToken })
+  localStorage.setItem('token', response.data.token)
+  localStorage.setItem('refresh_token', response.data.refresh_token)
+  return response.data.token
+}
+
+const isAuthRequest = (config) => ['/api/auth/login', '/api/auth/refresh'].includes(config?.url)
+
 // Response interceptor to handle errors
 api.interceptors.response.use(
   (response) => {
     return response
   },
-  (error) => {
+  async (error) => {
+    const config = error.config
+
+    // Expired or revoked access token - renew it once and retry
+    if (error.response?.status === 401 && config && !config._retried && !isAuthRequest(config) && localStorage.getItem('refresh_token')) {
+      config._retried = true
+      try {
+        refreshing = refreshing || refreshAccessToken()
+        const token = await refreshing
+        config.headers.Authorization = `Bearer ${token}`
+        return api(config)
+      } catch (refreshError) {
+        console.warn('Session could not be renewed:', refreshError.message)
+      } finally {
+        refreshing = null
+      }
+    }
+
     // Handle common error cases
-    if (error.response?.status === 401) {
+    if (error.response?.status === 401 && !isAuthRequest(config)) {
       // Unauthorized - clear token and redirect to login
       localStorage.removeItem('token')
+      localStorage.removeItem('refresh_token')
       localStorage.removeItem('user')
       window.location.href = '/login'
     } else if (error.response?.status === 403) {
@@ -2,18 +2,44 @@ import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import api from '../services/api'
 
+// Visitors who are not logged in get a guest cart keyed by a random client ID,
+// which is merged into their own cart when they log in
+const CLIENT_ID_KEY = 'cartClientId'
+
+const isGuest = () => !localStorage.getItem('token')
+
+const guestClientId = () => {
+  let clientId = localStorage.getItem(CLIENT_ID_KEY)
+  if (!clientId) {
+    clientId = crypto.randomUUID()
+    localStorage.setItem(CLIENT_ID_KEY, clientId)
+  }
+  return clientId
+}
+
+// Base path and request options for the current visitor's cart
+const cartRequest = () => isGuest()
+  ? { base: '/api/purchases/guest-cart', config: { headers: { 'X-Client-ID': guestClientId() } } }
+  : { base: '/api/purchases/cart', config: {} }
+
 export const useCartStore = defineStore('cart', () => {
   const cart = ref(null)
+  const savedItems = ref([])
   const loading = ref(false)
+  // Reused until checkout succeeds so retries and double-clicks are not charged twice
+  let checkoutKey = null
   
   const cartItems = computed(() => cart.value?.items || [])
   const total = computed(() => cart.value?.total || 0)
+  const taxTotal = computed(() => cart.value?.tax_total || 0)
+  const currency = computed(() => cart.value?.currency || 'EUR')
   const itemCount = computed(() => cartItems.value.length)
   
   const fetchCart = async () => {
     loading.value = true
     try {
-      const response = await api.get('/api/purchases/cart')
+      const { base, config } = cartRequest()
+      const response = await api.get(base, config)
       cart.value = response.data.cart
     } catch (error) {
       console.error('Failed to fetch cart:', error)
@@ -26,7 +52,9 @@ export const useCartStore = defineStore('cart', () => {
   
   const addToCart = async (tourId) => {
     try {
-      await api.post('/api/purchases/cart/items', { tour_id: tourId })
+      const { base, config } = cartRequest()
+      await api.post(`${base}/items`, { tour_id: tourId }, config)
+      checkoutKey = null
       await fetchCart() // Refresh cart
       return true
     } catch (error) {
@@ -37,7 +65,9 @@ export const useCartStore = defineStore('cart', () => {
   
   const removeFromCart = async (tourId) => {
     try {
-      await api.delete(`/api/purchases/cart/items/${tourId}`)
+      const { base, config } = cartRequest()
+      await api.delete(`${base}/items/${tourId}`, config)
+      checkoutKey = null
       await fetchCart() // Refresh cart
       return true
     } catch (error) {
@@ -48,7 +78,8 @@ export const useCartStore = defineStore('cart', () => {
   
   const clearCart = async () => {
     try {
-      await api.delete('/api/purchases/cart')
+      const { base, config } = cartRequest()
+      await api.delete(base, config)
       await fetchCart() // Refresh cart
       return true
     } catch (error) {
@@ -57,17 +88,96 @@ export const useCartStore = defineStore('cart', () => {
     }
   }
   
-  const checkout = async () => {
+  // gift is optional: { recipient, message }, with an empty recipient for gift codes
+  const checkout = async (gift = null) => {
     try {
-      const response = await api.post('/api/purchases/cart/checkout')
+      if (!checkoutKey) {
+        checkoutKey = crypto.randomUUID()
+      }
+      const response = await api.post('/api/purchases/cart/checkout', gift ? { gift } : null, {
+        headers: { 'Idempotency-Key': checkoutKey }
+      })
+      checkoutKey = null
       await fetchCart() // Should be empty after checkout
-      return response.data.tokens
+      return {
+        tokens: response.data.tokens || [],
+        gifts: response.data.gifts || []
+      }
     } catch (error) {
+      // Prices or availability changed: show the updated cart for confirmation
+      if (error.response?.status === 409 && error.response.data?.changes) {
+        cart.value = error.response.data.cart
+        checkoutKey = null
+      }
       const message = error.response?.data?.error || 'Checkout failed'
       throw new Error(message)
     }
   }
   
+  // Moves the guest cart into the user's cart after login. Returns the guest
+  // items that were dropped because the user's cart already had them.
+  const mergeGuestCart = async () => {
+    const clientId = localStorage.getItem(CLIENT_ID_KEY)
+    if (!clientId) {
+      return []
+    }
+    const response = await api.post('/api/purchases/cart/merge', null, {
+      headers: { 'X-Client-ID': clientId }
+    })
+    localStorage.removeItem(CLIENT_ID_KEY)
+    cart.value = response.data.cart
+    return response.data.skipped || []
+  }
+  
+  const fetchSavedItems = async () => {
+    try {
+      const response = await api.get('/api/purchases/saved')
+      savedItems.value = response.data.saved_items || []
+    } catch (error) {
+      console.error('Failed to fetch saved items:', error)
+      savedItems.value = []
+    }
+  }
+  
+  // item is a cart item; bundles are saved as a whole
+  const saveForLater = async (item) => {
+    try {
+      const path = item.bundle_id
+        ? `/api/purchases/cart/bundles/${item.bundle_id}/save`
+        : `/api/purchases/cart/items/${item.tour_id}/save`
+      await api.post(path)
+      checkoutKey = null
+      await Promise.all([fetchCart(), fetchSavedItems()])
+      return true
+    } catch (error) {
+      const message = error.response?.data?.error || 'Failed to save for later'
+      throw new Error(message)
+    }
+  }
+  
+  const moveToCart = async (savedItemId) => {
+    try {
+      await api.post(`/api/purchases/saved/${savedItemId}/move-to-cart`)
+      checkoutKey = null
+      await Promise.all([fetchCart(), fetchSavedItems()])
+      return true
+    } catch (error) {
+      const message = error.response?.data?.error || 'Failed to move to cart'
+      throw new Error(message)
+    }
+  }
+  
+  const removeSavedItem = async (savedItemId) => {
+    try {
+      await api.delete(`/api/purchases/saved/${savedItemId}`)
+      await fetchSavedItems()
+      return true
+    } catch (error) {
+      const message = error.response?.data?.error || 'Failed to remove saved item'
+      throw new Error(message)
+    }
+  }
+  
   const isInCart = (tourId) => {
     return cartItems.value.some(item => item.tour_id === tourId)
   }
@@ -76,6 +186,8 @@ export const useCartStore = defineStore('cart', () => {
     cart,
     cartItems,
     total,
+    taxTotal,
+    currency,
     itemCount,
     loading,
     fetchCart,
@@ -83,6 +195,12 @@ export const useCartStore = defineStore('cart', () => {
     removeFromCart,
     clearCart,
     checkout,
+    mergeGuestCart,
+    savedItems,
+    fetchSavedItems,
+    saveForLater,
+    moveToCart,
+    removeSavedItem,
     isInCart
   }
 })
\ No newline at end of file
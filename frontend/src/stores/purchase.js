@@ -44,12 +44,82 @@ export const usePurchaseStore = defineStore('purchase', () => {
     }
   }
   
+  const redeemGift = async (code) => {
+    try {
+      const response = await api.post('/api/purchases/gifts/redeem', { code })
+      await fetchPurchasedTours()
+      return response.data.token
+    } catch (error) {
+      throw new Error(error.response?.data?.error || 'Failed to redeem gift code')
+    }
+  }
+  
+  const transferToken = async (token, recipient, note = '') => {
+    try {
+      const response = await api.post(`/api/purchases/tokens/${token}/transfer`, { recipient, note })
+      await fetchPurchasedTours()
+      return response.data.token
+    } catch (error) {
+      throw new Error(error.response?.data?.error || 'Failed to transfer tour')
+    }
+  }
+  
+  const saveBlob = (blob, filename) => {
+    const url = URL.createObjectURL(blob)
+    const link = document.createElement('a')
+    link.href = url
+    link.download = filename
+    link.click()
+    URL.revokeObjectURL(url)
+  }
+  
+  // Saves the order's receipt or one of its invoices as a PDF
+  const downloadPdf = async (path, filename) => {
+    try {
+      const response = await api.get(path, { params: { format: 'pdf' }, responseType: 'blob' })
+      saveBlob(response.data, filename)
+    } catch (error) {
+      throw new Error('Failed to download ' + filename)
+    }
+  }
+  
+  const downloadReceipt = (orderId) => downloadPdf(`/api/purchases/orders/${orderId}/receipt`, `receipt-${orderId}.pdf`)
+  
+  const downloadInvoices = async (orderId) => {
+    try {
+      const response = await api.get(`/api/purchases/orders/${orderId}/invoices`)
+      for (const invoice of response.data.invoices || []) {
+        await downloadPdf(`/api/purchases/invoices/${invoice.id}`, `${invoice.number}.pdf`)
+      }
+    } catch (error) {
+      throw new Error(error.response?.data?.error || error.message || 'Failed to download invoices')
+    }
+  }
+  
+  // Saves a zip of the user's purchase data, or with full of all their data
+  const downloadDataExport = async (full = false) => {
+    try {
+      const path = full ? '/api/purchases/export/full' : '/api/purchases/export'
+      const response = await api.get(path, { responseType: 'blob' })
+      const date = new Date().toISOString().slice(0, 10)
+      saveBlob(response.data, `${full ? 'data' : 'purchases'}-${date}.zip`)
+    } catch (error) {
+      throw new Error('Failed to download your data')
+    }
+  }
+  
+  // Used tokens (tour completed) keep granting access until they expire.
+  // Expiry is checked too, the purchase service only marks tokens expired
+  // when it sweeps.
+  const grantsAccess = (token) =>
+    (token.status === 'active' || token.status === 'used') && new Date(token.expires_at) > new Date()
+  
   const hasPurchased = (tourId) => {
-    return purchasedTokens.value.some(token => token.tour_id === tourId && token.status === 'active')
+    return purchasedTokens.value.some(token => token.tour_id === tourId && grantsAccess(token))
   }
   
   const getPurchaseToken = (tourId) => {
-    return purchasedTokens.value.find(token => token.tour_id === tourId && token.status === 'active')
+    return purchasedTokens.value.find(token => token.tour_id === tourId && grantsAccess(token))
   }
   
   return {
@@ -58,6 +128,12 @@ export const usePurchaseStore = defineStore('purchase', () => {
     fetchPurchasedTours,
     getTokenDetails,
     validateAccess,
+    redeemGift,
+    transferToken,
+    downloadReceipt,
+    downloadInvoices,
+    downloadDataExport,
+    grantsAccess,
     hasPurchased,
     getPurchaseToken
   }
@@ -1,6 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
-import api from '../services/api'
+import api, { refreshAccessToken } from '../services/api'
+import { useCartStore } from './cart'
 import { getUserFromToken, isTokenExpired } from '../utils/jwt'
 
 export const useUserStore = defineStore('user', () => {
@@ -13,28 +14,67 @@ export const useUserStore = defineStore('user', () => {
   const isGuide = computed(() => user.value?.role === 'guide')
   const isTourist = computed(() => user.value?.role === 'tourist')
   const canCreateTours = computed(() => user.value?.role === 'guide' || user.value?.role === 'admin')
+  const isEmailVerified = computed(() => user.value?.emailVerified === true)
+  // Permissions of the user's role, e.g. 'user:block', as in the access token
+  const hasPermission = (permission) => user.value?.permissions?.includes(permission) === true
+
+  // Set while a login waits for its two-factor code
+  const twoFactorChallenge = ref(null)
+
+  const loginErrorMessage = (error) => {
+    if (error.response?.status === 429 || error.response?.status === 423) {
+      const seconds = Number(error.response.headers['retry-after'])
+      const wait = seconds >= 60 ? `${Math.ceil(seconds / 60)} minutes` : `${seconds || 'a few'} seconds`
+      return error.response.status === 423
+        ? `Your account is locked after too many failed logins. Try again in ${wait}.`
+        : `Too many failed logins. Try again in ${wait}.`
+    }
+    return null
+  }
 
-  const login = async (credentials) => {
-    try {
-      const response = await api.post('/api/auth/login', credentials)
-      const { token: authToken } = response.data
+  const startSession = async (data) => {
+    const { token: authToken, refresh_token: refreshToken } = data
 
-      // Extract user data from JWT token
-      const userData = getUserFromToken(authToken)
-      if (!userData) {
-        throw new Error('Invalid token received')
-      }
+    // Extract user data from JWT token
+    const userData = getUserFromToken(authToken)
+    if (!userData) {
+      throw new Error('Invalid token received')
+    }
 
-      token.value = authToken
-      user.value = userData
+    token.value = authToken
+    user.value = userData
 
-      localStorage.setItem('token', authToken)
-      // No need to store user separately since we decode from token
+    localStorage.setItem('token', authToken)
+    localStorage.setItem('refresh_token', refreshToken)
+    // No need to store user separately since we decode from token
 
-      // Set token for future API calls
-      api.defaults.headers.common['Authorization'] = `Bearer ${authToken}`
+    // Set token for future API calls
+    api.defaults.headers.common['Authorization'] = `Bearer ${authToken}`
+
+    // Keep what was added to the cart before logging in
+    try {
+      await useCartStore().mergeGuestCart()
+    } catch (mergeError) {
+      console.error('Failed to merge guest cart:', mergeError)
+    }
+
+    return userData
+  }
 
-      return userData
+  // Resolves with the user, or with { twoFactor: true } when the login
+  // needs a code from completeTwoFactor first
+  const login = async (credentials) => {
+    try {
+      const response = await api.post('/api/auth/login', credentials)
+      if (response.data.challenge_token) {
+        twoFactorChallenge.value = {
+          token: response.data.challenge_token,
+          expiresAt: response.data.challenge_expires_at,
+          enrolmentRequired: response.data.enrolment_required
+        }
+        return { twoFactor: true, enrolmentRequired: response.data.enrolment_required }
+      }
+      return await startSession(response.data)
     } catch (error) {
       if (error.response?.status === 401) {
         throw new Error('Invalid username or password')
@@ -42,11 +82,118 @@ export const useUserStore = defineStore('user', () => {
       else if (error.response?.status === 403) {
         throw new Error('Your account is blocked. Please contact support.')
       }
+      const throttled = loginErrorMessage(error)
+      if (throttled) {
+        throw new Error(throttled)
+      }
 
       throw new Error(error.response?.data?.message || 'Login failed')
     }
   }
 
+  // Returns the secret to add to an authenticator app when the user's role
+  // requires two-factor authentication and they have not set it up yet
+  const enrollTwoFactorDuringLogin = async () => {
+    try {
+      const response = await api.post('/api/auth/login/2fa/enroll', {
+        challenge_token: twoFactorChallenge.value?.token
+      })
+      return response.data
+    } catch (error) {
+      if (error.response?.status === 401) {
+        twoFactorChallenge.value = null
+        throw new Error('Your login has expired. Please log in again.')
+      }
+      throw new Error(error.response?.data || 'Failed to set up two-factor authentication')
+    }
+  }
+
+  // Takes a code from the authenticator app or a recovery code. Resolves with
+  // the user and, after enrolling during the login, their recovery codes
+  const completeTwoFactor = async (code) => {
+    try {
+      const response = await api.post('/api/auth/login/2fa', {
+        challenge_token: twoFactorChallenge.value?.token,
+        code
+      })
+      const userData = await startSession(response.data)
+      twoFactorChallenge.value = null
+      return { user: userData, recoveryCodes: response.data.recovery_codes || [] }
+    } catch (error) {
+      const message = typeof error.response?.data === 'string' ? error.response.data.trim() : ''
+      if (error.response?.status === 401 && message.includes('challenge')) {
+        twoFactorChallenge.value = null
+        throw new Error('Your login has expired. Please log in again.')
+      }
+      else if (error.response?.status === 401) {
+        throw new Error('Invalid code')
+      }
+      else if (error.response?.status === 403) {
+        twoFactorChallenge.value = null
+        throw new Error('Your account is blocked. Please contact support.')
+      }
+      const throttled = loginErrorMessage(error)
+      if (throttled) {
+        throw new Error(throttled)
+      }
+      throw new Error(message || 'Login failed')
+    }
+  }
+
+  const cancelTwoFactor = () => {
+    twoFactorChallenge.value = null
+  }
+
+  const getTwoFactorStatus = async () => {
+    const response = await api.get('/api/auth/2fa')
+    return response.data
+  }
+
+  const enrollTwoFactor = async () => {
+    try {
+      const response = await api.post('/api/auth/2fa/enroll')
+      return response.data
+    } catch (error) {
+      throw new Error(error.response?.data || 'Failed to set up two-factor authentication')
+    }
+  }
+
+  const confirmTwoFactor = async (code) => {
+    try {
+      const response = await api.post('/api/auth/2fa/confirm', { code })
+      return response.data.recovery_codes
+    } catch (error) {
+      throw new Error(error.response?.status === 401 ? 'Invalid code' : (error.response?.data || 'Failed to enable two-factor authentication'))
+    }
+  }
+
+  const regenerateRecoveryCodes = async (code) => {
+    try {
+      const response = await api.post('/api/auth/2fa/recovery-codes', { code })
+      return response.data.recovery_codes
+    } catch (error) {
+      throw new Error(error.response?.status === 401 ? 'Invalid code' : (error.response?.data || 'Failed to create recovery codes'))
+    }
+  }
+
+  const disableTwoFactor = async (code) => {
+    try {
+      await api.post('/api/auth/2fa/disable', { code })
+    } catch (error) {
+      throw new Error(error.response?.status === 401 ? 'Invalid code' : (error.response?.data || 'Failed to disable two-factor authentication'))
+    }
+  }
+
+  const getTwoFactorPolicies = async () => {
+    const response = await api.get('/api/auth/2fa/policies')
+    return response.data
+  }
+
+  const setTwoFactorPolicy = async (role, required) => {
+    const response = await api.put('/api/auth/2fa/policies', { role, required })
+    return response.data
+  }
+
   const register = async (userData) => {
     try {
       console.log('Attempting registration with:', userData)
@@ -62,7 +209,15 @@ export const useUserStore = defineStore('user', () => {
         })
 
         console.log('Auto-login response:', loginResponse.data)
-        const { token: authToken } = loginResponse.data
+        if (loginResponse.data.challenge_token) {
+          twoFactorChallenge.value = {
+            token: loginResponse.data.challenge_token,
+            expiresAt: loginResponse.data.challenge_expires_at,
+            enrolmentRequired: loginResponse.data.enrolment_required
+          }
+          return { twoFactor: true, enrolmentRequired: loginResponse.data.enrolment_required }
+        }
+        const { token: authToken, refresh_token: refreshToken } = loginResponse.data
 
         // Extract user data from JWT token
         const userInfo = getUserFromToken(authToken)
@@ -74,6 +229,7 @@ export const useUserStore = defineStore('user', () => {
         user.value = userInfo
 
         localStorage.setItem('token', authToken)
+        localStorage.setItem('refresh_token', refreshToken)
         // No need to store user separately since we decode from token
 
         // Set token for future API calls
@@ -90,22 +246,109 @@ export const useUserStore = defineStore('user', () => {
   }
 
   const logout = () => {
+    // Revoke the session server-side too without waiting for it. The header
+    // is set here since the token is cleared before the interceptor runs.
+    const accessToken = localStorage.getItem('token')
+    const refreshToken = localStorage.getItem('refresh_token')
+    if (accessToken) {
+      api.post('/api/auth/logout', { refresh_token: refreshToken || '' }, {
+        headers: { Authorization: `Bearer ${accessToken}` }
+      }).catch(() => {})
+    }
+
     user.value = null
     token.value = null
 
     localStorage.removeItem('token')
+    localStorage.removeItem('refresh_token')
     // No need to remove user since we only store token
 
     delete api.defaults.headers.common['Authorization']
   }
 
+  const verifyEmail = async (verificationToken) => {
+    try {
+      await api.post('/api/auth/verify-email', { token: verificationToken })
+    } catch (error) {
+      if (error.response?.status === 400) {
+        throw new Error('This verification link is invalid or has expired')
+      }
+      throw new Error(error.response?.data || 'Failed to verify email')
+    }
+
+    // The current access token still says unverified
+    if (localStorage.getItem('refresh_token')) {
+      const authToken = await refreshAccessToken()
+      token.value = authToken
+      user.value = getUserFromToken(authToken)
+      api.defaults.headers.common['Authorization'] = `Bearer ${authToken}`
+    }
+  }
+
+  const resendVerification = async () => {
+    try {
+      await api.post('/api/auth/verify-email/resend')
+    } catch (error) {
+      if (error.response?.status === 429) {
+        const seconds = error.response.headers['retry-after']
+        throw new Error(`Please wait ${seconds || 'a moment'} seconds before asking for another email`)
+      }
+      throw new Error(error.response?.data || 'Failed to send verification email')
+    }
+  }
+
+  const changePassword = async (oldPassword, newPassword) => {
+    try {
+      const response = await api.post('/api/auth/change-password', {
+        old_password: oldPassword,
+        new_password: newPassword
+      })
+      // Every other session was revoked; this one continues with new tokens
+      const { token: authToken, refresh_token: refreshToken } = response.data
+      token.value = authToken
+      user.value = getUserFromToken(authToken)
+
+      localStorage.setItem('token', authToken)
+      localStorage.setItem('refresh_token', refreshToken)
+      api.defaults.headers.common['Authorization'] = `Bearer ${authToken}`
+    } catch (error) {
+      if (error.response?.status === 403) {
+        throw new Error('Current password is incorrect')
+      }
+      throw new Error(error.response?.data || 'Failed to change password')
+    }
+  }
+
+  const forgotPassword = async (email) => {
+    try {
+      await api.post('/api/auth/forgot-password', { email })
+    } catch (error) {
+      throw new Error(error.response?.data || 'Failed to request a password reset')
+    }
+  }
+
+  const resetPassword = async (resetToken, newPassword) => {
+    try {
+      await api.post('/api/auth/reset-password', {
+        token: resetToken,
+        new_password: newPassword
+      })
+    } catch (error) {
+      if (error.response?.status === 400) {
+        throw new Error('This reset link is invalid or has expired')
+      }
+      throw new Error(error.response?.data || 'Failed to reset password')
+    }
+  }
+
   const loadUserFromStorage = () => {
     try {
       const storedToken = localStorage.getItem('token')
 
       if (storedToken) {
-        // Check if token is expired
-        if (isTokenExpired(storedToken)) {
+        // An expired token is renewed on the first request while there is
+        // a refresh token
+        if (isTokenExpired(storedToken) && !localStorage.getItem('refresh_token')) {
           console.warn('Stored token is expired, clearing storage')
           localStorage.removeItem('token')
           user.value = null
@@ -202,6 +445,8 @@ export const useUserStore = defineStore('user', () => {
         formData.append('last_name', profileData.last_name || '')
         formData.append('biography', profileData.biography || '')
         formData.append('motto', profileData.motto || '')
+        formData.append('currency', profileData.currency || '')
+        formData.append('country', profileData.country || '')
         formData.append('profile_picture', file)
 
         response = await api.put('/api/stakeholder/profile', formData, {
@@ -233,9 +478,27 @@ export const useUserStore = defineStore('user', () => {
     isGuide,
     isTourist,
     canCreateTours,
+    isEmailVerified,
+    hasPermission,
+    twoFactorChallenge,
     login,
+    enrollTwoFactorDuringLogin,
+    completeTwoFactor,
+    cancelTwoFactor,
+    getTwoFactorStatus,
+    enrollTwoFactor,
+    confirmTwoFactor,
+    regenerateRecoveryCodes,
+    disableTwoFactor,
+    getTwoFactorPolicies,
+    setTwoFactorPolicy,
     register,
     logout,
+    verifyEmail,
+    resendVerification,
+    changePassword,
+    forgotPassword,
+    resetPassword,
     updateProfile,
     fetchUserProfile,
     updateUserProfile,
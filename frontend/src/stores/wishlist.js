@@ -0,0 +1,84 @@
+import { defineStore } from 'pinia'
+import { ref, computed } from 'vue'
+import api from '../services/api'
+
+export const useWishlistStore = defineStore('wishlist', () => {
+  const items = ref([])
+  // Favourite counts of the guide's own tours, by tour ID
+  const favouriteCounts = ref({})
+  const loading = ref(false)
+  
+  const itemCount = computed(() => items.value.length)
+  
+  const fetchWishlist = async () => {
+    loading.value = true
+    try {
+      const response = await api.get('/api/purchases/wishlist')
+      items.value = response.data.items || []
+    } catch (error) {
+      console.error('Failed to fetch wishlist:', error)
+      items.value = []
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  const addToWishlist = async (tourId) => {
+    try {
+      await api.post('/api/purchases/wishlist', { tour_id: tourId })
+      await fetchWishlist()
+      return true
+    } catch (error) {
+      const message = error.response?.data?.error || 'Failed to add tour to wishlist'
+      throw new Error(message)
+    }
+  }
+  
+  const removeFromWishlist = async (tourId) => {
+    try {
+      await api.delete(`/api/purchases/wishlist/${tourId}`)
+      items.value = items.value.filter(item => item.tour_id !== tourId)
+      return true
+    } catch (error) {
+      const message = error.response?.data?.error || 'Failed to remove tour from wishlist'
+      throw new Error(message)
+    }
+  }
+  
+  const toggleWishlist = async (tourId) => {
+    return isInWishlist(tourId) ? removeFromWishlist(tourId) : addToWishlist(tourId)
+  }
+  
+  const fetchFavouriteCounts = async () => {
+    try {
+      const response = await api.get('/api/purchases/wishlist/counts')
+      favouriteCounts.value = Object.fromEntries(
+        (response.data.counts || []).map(count => [count.tour_id, count.count])
+      )
+    } catch (error) {
+      console.error('Failed to fetch favourite counts:', error)
+      favouriteCounts.value = {}
+    }
+  }
+  
+  const isInWishlist = (tourId) => {
+    return items.value.some(item => item.tour_id === tourId)
+  }
+  
+  const favouriteCount = (tourId) => {
+    return favouriteCounts.value[tourId] || 0
+  }
+  
+  return {
+    items,
+    itemCount,
+    loading,
+    fetchWishlist,
+    addToWishlist,
+    removeFromWishlist,
+    toggleWishlist,
+    fetchFavouriteCounts,
+    isInWishlist,
+    favouriteCount
+  }
+})
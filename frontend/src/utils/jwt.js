@@ -54,6 +54,8 @@ export function getUserFromToken(token) {
   
   return {
     username: decoded.username,
-    role: decoded.role
+    role: decoded.role,
+    emailVerified: decoded.email_verified === true,
+    permissions: decoded.permissions || []
   }
 }
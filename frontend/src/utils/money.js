@@ -0,0 +1,40 @@
+// Number of minor units per major unit, for currencies that do not use cents
+const exponents = { JPY: 0, KRW: 0, BHD: 3, KWD: 3 }
+
+const exponentOf = (currency) => exponents[currency] ?? 2
+
+/**
+ * Format an amount in minor units, e.g. formatMoney(1250, 'EUR') -> "€12.50"
+ * @param {number} minor - Amount in minor units of the currency
+ * @param {string} currency - ISO 4217 currency code
+ * @returns {string}
+ */
+export function formatMoney(minor, currency = 'EUR') {
+  const exponent = exponentOf(currency)
+  return new Intl.NumberFormat(undefined, {
+    style: 'currency',
+    currency,
+    minimumFractionDigits: exponent,
+    maximumFractionDigits: exponent
+  }).format((minor || 0) / 10 ** exponent)
+}
+
+/**
+ * Convert a decimal amount entered by a user into minor units
+ * @param {number} amount - Amount in major units, e.g. 12.5
+ * @param {string} currency - ISO 4217 currency code
+ * @returns {number}
+ */
+export function toMinorUnits(amount, currency = 'EUR') {
+  return Math.round((amount || 0) * 10 ** exponentOf(currency))
+}
+
+/**
+ * Convert minor units back into a decimal amount for editing
+ * @param {number} minor - Amount in minor units
+ * @param {string} currency - ISO 4217 currency code
+ * @returns {number}
+ */
+export function fromMinorUnits(minor, currency = 'EUR') {
+  return (minor || 0) / 10 ** exponentOf(currency)
+}